@@ -3,21 +3,28 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"net"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	"vkvm/internal/api"
 	"vkvm/internal/config"
 	"vkvm/internal/hotkey"
+	"vkvm/internal/logging"
+	"vkvm/internal/network"
 	"vkvm/internal/osutils"
+	"vkvm/internal/supervisor"
 	"vkvm/internal/switcher"
 	"vkvm/internal/tray"
 	"vkvm/internal/ui"
@@ -28,6 +35,7 @@ var (
 	showUI   = flag.Bool("ui", false, "Open the configuration UI")
 	listMons = flag.Bool("list", false, "List connected monitors")
 	switchTo = flag.String("switch", "", "Switch to profile name")
+	openUI   = flag.Bool("open-settings", false, "Open the configuration UI once the service is running")
 	showVer  = flag.Bool("version", false, "Show version")
 )
 
@@ -42,10 +50,34 @@ func main() {
 	// Initialize config
 	cfgMgr, err := config.NewManager()
 	if err != nil {
-		log.Fatalf("Failed to initialize config: %v", err)
+		logging.Fatalf("Failed to initialize config: %v", err)
 	}
 	if err := cfgMgr.Load(); err != nil {
-		log.Printf("Warning: failed to load config: %v", err)
+		logging.Warnf("Config: Failed to load config: %v", err)
+	}
+
+	// Handle the use-preset command
+	if flag.Arg(0) == "use-preset" {
+		usePreset(cfgMgr, flag.Arg(1))
+		return
+	}
+
+	// Handle the monitor command
+	if flag.Arg(0) == "monitor" {
+		monitorPower(cfgMgr, flag.Arg(1), flag.Arg(2))
+		return
+	}
+
+	// Handle the pair command
+	if flag.Arg(0) == "pair" {
+		pair(cfgMgr)
+		return
+	}
+
+	// Handle the bench command
+	if flag.Arg(0) == "bench" {
+		bench(cfgMgr, flag.Args()[1:])
+		return
 	}
 
 	// Handle --list flag
@@ -62,7 +94,8 @@ func main() {
 
 	// Handle --ui flag
 	if *showUI {
-		runUI(cfgMgr)
+		setupLogging(cfgMgr, "vkvm-ui.log")
+		runUI(cfgMgr, nil, nil)
 		return
 	}
 
@@ -73,12 +106,12 @@ func main() {
 func listMonitors(cfgMgr *config.Manager) {
 	sw, err := switcher.New(cfgMgr)
 	if err != nil {
-		log.Fatalf("Failed to create switcher: %v", err)
+		logging.Fatalf("Failed to create switcher: %v", err)
 	}
 
 	monitors, err := sw.ListMonitors()
 	if err != nil {
-		log.Fatalf("Failed to list monitors: %v", err)
+		logging.Fatalf("Failed to list monitors: %v", err)
 	}
 
 	fmt.Println("Connected Monitors:")
@@ -86,9 +119,18 @@ func listMonitors(cfgMgr *config.Manager) {
 	for _, mon := range monitors {
 		fmt.Printf("ID: %s\n", mon.ID)
 		fmt.Printf("  Name: %s\n", mon.Name)
+		if mon.Label != "" && mon.Label != mon.Name {
+			fmt.Printf("  Label: %s\n", mon.Label)
+		}
+		if mon.Connector != "" {
+			fmt.Printf("  Connector: %s\n", mon.Connector)
+		}
 		if mon.Serial != "" {
 			fmt.Printf("  Serial: %s\n", mon.Serial)
 		}
+		if mon.Backend != "" {
+			fmt.Printf("  Backend: %s\n", mon.Backend)
+		}
 		if mon.DDCSupported {
 			fmt.Printf("  DDC/CI: ✓ Supported\n")
 		} else {
@@ -101,253 +143,525 @@ func listMonitors(cfgMgr *config.Manager) {
 func handleSwitch(cfgMgr *config.Manager, profileName string) {
 	sw, err := switcher.New(cfgMgr)
 	if err != nil {
-		log.Fatalf("Failed to create switcher: %v", err)
+		logging.Fatalf("Failed to create switcher: %v", err)
 	}
 
 	if err := sw.SwitchToProfile(profileName); err != nil {
-		log.Fatalf("Failed to switch to profile %s: %v", profileName, err)
+		logging.Fatalf("Failed to switch to profile %s: %v", profileName, err)
 	}
 	fmt.Printf("Switched to profile: %s\n", profileName)
 }
 
-func runUI(cfgMgr *config.Manager) {
+// unreachablePromptTimeout is how long the "switch video only?" prompt waits
+const unreachablePromptTimeout = 30 * time.Second
+
+// switchFromShortcut switches to a profile for a hotkey or tray click. If an
+// agent showing the profile is unreachable, the user is asked whether to
+// switch the monitors anyway.
+func switchFromShortcut(sw *switcher.Switcher, profileName string) {
+	err := sw.SwitchToProfile(profileName)
+	var unreachable *switcher.AgentUnreachableError
+	if !errors.As(err, &unreachable) {
+		if err != nil && !errors.Is(err, switcher.ErrSuperseded) && !errors.Is(err, switcher.ErrQueued) {
+			logging.Errorf("Switch error: %v", err)
+		}
+		return
+	}
+
+	logging.Infof("Switch to %s held: %v", profileName, unreachable)
+	promptVideoOnly(sw, unreachable)
+}
+
+// promptVideoOnly asks whether to switch the monitors to a profile whose agent
+// is unreachable, and does so if the user agrees
+func promptVideoOnly(sw *switcher.Switcher, unreachable *switcher.AgentUnreachableError) {
+	profileName := unreachable.Profile
+	supervisor.Go("switch-prompt", supervisor.Once, func() {
+		msg := fmt.Sprintf("The %v.\n\nSwitch the monitors to '%s' anyway (video only)?", unreachable, profileName)
+		ok, err := osutils.Confirm("VKVM - Agent unreachable", msg, unreachablePromptTimeout)
+		if err != nil {
+			logging.Errorf("Switch prompt failed: %v", err)
+		}
+		if !ok {
+			logging.Infof("Switch to %s cancelled", profileName)
+			return
+		}
+		if err := sw.SwitchVideoOnly(profileName); err != nil && !errors.Is(err, switcher.ErrSuperseded) && !errors.Is(err, switcher.ErrQueued) {
+			logging.Errorf("Switch error: %v", err)
+		}
+	})
+}
+
+// monitorPower puts one monitor to sleep or wakes it ("vkvm monitor sleep <id>")
+func monitorPower(cfgMgr *config.Manager, action, monitorID string) {
+	if (action != "sleep" && action != "wake") || monitorID == "" {
+		fmt.Println("Usage: vkvm monitor sleep|wake <id>")
+		fmt.Println()
+		fmt.Println("Monitor IDs are listed by vkvm --list.")
+		return
+	}
+
+	sw, err := switcher.New(cfgMgr)
+	if err != nil {
+		logging.Fatalf("Failed to create switcher: %v", err)
+	}
+	if err := sw.SetMonitorPower(monitorID, action == "wake"); err != nil {
+		logging.Fatalf("Failed to %s monitor %s: %v", action, monitorID, err)
+	}
+	if action == "wake" {
+		fmt.Printf("Woke monitor: %s\n", monitorID)
+	} else {
+		fmt.Printf("Put monitor to sleep: %s\n", monitorID)
+	}
+}
+
+// pair pairs this agent with its Host: the Host shows a PIN, which is
+// entered here
+func pair(cfgMgr *config.Manager) {
+	sw, err := switcher.New(cfgMgr)
+	if err != nil {
+		logging.Fatalf("Failed to create switcher: %v", err)
+	}
+	id, err := sw.RequestPairing()
+	if err != nil {
+		logging.Fatalf("Failed to request pairing: %v", err)
+	}
+
+	fmt.Print("Enter the PIN shown on the Host: ")
+	var pin string
+	fmt.Scanln(&pin)
+	if err := sw.CompletePairing(id, pin); err != nil {
+		logging.Fatalf("Pairing failed: %v", err)
+	}
+	fmt.Println("Paired with the Host. Restart vkvm for the change to take effect.")
+}
+
+// bench measures round trips to an agent's API over each transport and
+// prints a comparison table
+func bench(cfgMgr *config.Manager, args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	target := fs.String("target", "", "Agent to measure: a registered machine, a known agent or host:port")
+	rounds := fs.Int("rounds", 20, "Number of bursts")
+	burst := fs.Int("burst", 10, "Probes per burst")
+	interval := fs.Duration("interval", 100*time.Millisecond, "Pause between bursts")
+	fs.Parse(args)
+	if *target == "" || *rounds < 1 || *burst < 1 {
+		fmt.Println("Usage: vkvm bench --target <agent> [--rounds 20] [--burst 10] [--interval 100ms]")
+		return
+	}
+
+	cfg := cfgMgr.Get()
+	addr, token, pin := *target, cfg.General.APIToken, ""
+	if mc := cfgMgr.FindMachine(*target); mc != nil {
+		addr, pin = mc.Address, mc.CertSHA256
+		if mc.Token != "" {
+			token = mc.Token
+		}
+	} else if a, err := cfgMgr.FindKnownAgent(*target); err == nil && a.Address != "" {
+		addr = net.JoinHostPort(a.Address, strconv.Itoa(cfg.General.APIPort))
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(cfg.General.APIPort))
+	}
+
+	fmt.Printf("Benchmarking %s: %d bursts of %d probes, %v apart\n\n", addr, *rounds, *burst, *interval)
+	results := network.Bench(context.Background(), addr, network.BenchOptions{
+		Token:      token,
+		TLS:        cfg.General.PeerTLS(),
+		CertSHA256: pin,
+		Rounds:     *rounds,
+		Burst:      *burst,
+		Interval:   *interval,
+	})
+
+	ms := func(d time.Duration) string { return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond)) }
+	fmt.Printf("%-10s %6s %6s %7s %9s %9s %9s %9s\n", "Transport", "Sent", "Recv", "Loss", "Min", "Avg", "Max", "Jitter")
+	for _, r := range results {
+		if r.Err != nil && r.Received == 0 {
+			fmt.Printf("%-10s failed: %v\n", r.Transport, r.Err)
+			continue
+		}
+		fmt.Printf("%-10s %6d %6d %6.1f%% %9s %9s %9s %9s\n", r.Transport, r.Sent, r.Received, r.Loss(), ms(r.Min), ms(r.Avg), ms(r.Max), ms(r.Jitter))
+	}
+}
+
+// usePreset applies a role preset, or lists the presets if name is empty
+func usePreset(cfgMgr *config.Manager, name string) {
+	if name == "" {
+		cfg := cfgMgr.Get()
+		fmt.Println("Usage: vkvm use-preset <name>")
+		fmt.Println()
+		fmt.Println("Presets:")
+		for _, p := range cfg.Presets {
+			active := ""
+			if p.Name == cfg.General.Preset {
+				active = " (active)"
+			}
+			fmt.Printf("  %s: %s%s\n", p.Name, p.Role, active)
+		}
+		return
+	}
+
+	if err := cfgMgr.UsePreset(name); err != nil {
+		logging.Fatalf("Failed to use preset %s: %v", name, err)
+	}
+	fmt.Printf("Using preset: %s. Restart vkvm for the change to take effect.\n", name)
+}
+
+// restartSelf starts a new vkvm process with the same arguments, opening the
+// settings UI if openSettings is set. The caller exits right after, handing
+// over hotkeys and the API port.
+func restartSelf(openSettings bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if arg != "-open-settings" && arg != "--open-settings" {
+			args = append(args, arg)
+		}
+	}
+	if openSettings {
+		args = append(args, "-open-settings")
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Start()
+}
+
+// runUI starts the settings UI. hkMgr and rc are nil when the UI runs without
+// the background service (--ui), in which case no hotkey status is shown and
+// no restart is offered.
+func runUI(cfgMgr *config.Manager, hkMgr *hotkey.Manager, rc *ui.RestartControl) {
 	// Create switcher for the UI
 	sw, err := switcher.New(cfgMgr)
 	if err != nil {
-		log.Printf("Failed to create switcher: %v", err)
+		logging.Errorf("UI: Failed to create switcher: %v", err)
 		return
 	}
 
 	// Start the UI server
 	server := ui.NewServer(cfgMgr, sw)
-	log.Println("Starting configuration UI...")
+	if hkMgr != nil {
+		server.SetHotkeyManager(hkMgr)
+	}
+	if rc != nil {
+		server.SetRestartControl(rc)
+	}
+	logging.Infof("UI: Starting configuration UI...")
 
 	// Check if running from CLI (blocking mode) or from tray (non-blocking)
 	// When called from main with --ui flag, we should block
 	if *showUI {
 		// Blocking mode for CLI
 		if err := server.Start(); err != nil {
-			log.Printf("UI server error: %v", err)
+			logging.Errorf("UI: Server error: %v", err)
 		}
 	} else {
 		// Non-blocking mode for tray
 		go func() {
 			if err := server.Start(); err != nil {
-				log.Printf("UI server error: %v", err)
+				logging.Errorf("UI: Server error: %v", err)
 			}
 		}()
 	}
 }
 
 func runService(cfgMgr *config.Manager) {
-	log.Println("VKVM Service starting...")
+	setupLogging(cfgMgr, "vkvm.log")
+	defer logging.Close()
+	logging.Infof("Service: Starting VKVM %s...", version)
+
+	if delay := cfgMgr.Get().General.StartupDelaySec; delay > 0 {
+		logging.Infof("Service: Delaying startup by %ds", delay)
+		time.Sleep(time.Duration(delay) * time.Second)
+	}
 
 	// Create switcher
 	sw, err := switcher.New(cfgMgr)
 	if err != nil {
-		log.Fatalf("Failed to create switcher: %v", err)
+		logging.Fatalf("Failed to create switcher: %v", err)
+	}
+
+	// Displays may not be enumerated yet right after boot
+	supervisor.Go("display-wait", supervisor.Once, sw.WaitForDisplays)
+
+	// A switch that waited for the cooldown finds out only then that an agent
+	// is unreachable; ask as for a switch that ran right away
+	sw.SetOnError(func(err error) {
+		var unreachable *switcher.AgentUnreachableError
+		if errors.As(err, &unreachable) {
+			promptVideoOnly(sw, unreachable)
+		}
+	})
+
+	// Hotkey manager
+	hkMgr := hotkey.NewManager()
+	if err := hkMgr.Start(); err != nil {
+		logging.Warnf("Hotkey Engine: Failed to start: %v", err)
+	}
+
+	// Tray instance
+	t := tray.New("VKVM - KVM Switcher")
+
+	// Role presets, adoption and changes to the API listener restart the
+	// service; other settings apply at runtime (see restartReasons)
+	restart, reopenSettings := false, false
+	running := cfgMgr.Get().General
+	restartCtl := &ui.RestartControl{
+		Pending: func() []string {
+			return restartReasons(running, cfgMgr.Get().General)
+		},
+		Restart: func() {
+			restart, reopenSettings = true, true
+			t.Stop()
+		},
 	}
 
 	// Start API server if enabled
 	cfg := cfgMgr.Get()
+	var apiServer *api.Server
 	if cfg.General.APIEnabled {
 		// New: Ensure firewall rule exists on Windows
 		if runtime.GOOS == "windows" {
 			go func() {
 				if err := osutils.EnsureFirewallRule(cfg.General.APIPort); err != nil {
-					log.Printf("Firewall warning: %v", err)
+					logging.Warnf("Firewall: %v", err)
 				}
 			}()
 		}
 
-		apiServer := api.NewServer(cfgMgr, sw)
-
-		// Wire up switcher -> api broadcast for WebSocket
-		sw.SetOnSwitch(func(profileName string) {
-			// Broadcast the switch event to all connected agents
-			// Origin is "host" because this callback is triggered by a local decision/action on the host
-			// (or a successfully processed agent request)
-			apiServer.BroadcastSwitch(profileName, "host")
+		apiServer = api.NewServer(cfgMgr, sw)
+		apiServer.SetVersion(version)
+		apiServer.SetHotkeyManager(hkMgr)
+		apiServer.SetOnAdopted(func() {
+			restart = true
+			t.Stop()
 		})
 
-		go func() {
+		supervisor.Go("api-server", supervisor.Once, func() {
 			if err := apiServer.Start(cfg.General.APIPort); err != nil {
-				log.Printf("API server error: %v", err)
+				logging.Errorf("API: Server error: %v", err)
 			}
-		}()
-	}
-
-	// Hotkey manager
-	hkMgr := hotkey.NewManager()
-	if err := hkMgr.Start(); err != nil {
-		log.Printf("Warning: Hotkey Engine failed to start: %v", err)
-	}
-
-	// Tray instance
-	t := tray.New("VKVM - KVM Switcher")
-
-	// Debouncer for hotkeys
-	var lastHkTime time.Time
-	var hkMux sync.Mutex
-	debounce := func() bool {
-		hkMux.Lock()
-		defer hkMux.Unlock()
-		if time.Since(lastHkTime) < 500*time.Millisecond {
-			return false
-		}
-		lastHkTime = time.Now()
-		return true
+		})
 	}
 
 	// Helper to refresh hotkeys and tray menu on config change
 	refreshShortcuts := func() {
 		cfg := cfgMgr.Get()
-		hkMgr.Clear() // Clear existing registered callbacks
 
-		// Register global settings hotkey
-		if cfg.General.SettingsHotkey != "" {
-			_, err := hkMgr.Register(cfg.General.SettingsHotkey, func() {
-				if !debounce() {
-					return
-				}
-				log.Printf("Hotkey: Opening Settings UI...")
-				go runUI(cfgMgr)
-			})
-			if err != nil {
-				log.Printf("Warning: failed to register settings hotkey: %v", err)
+		hkMgr.SetPolicy(hotkey.TriggerPolicy{
+			ExactMatch: cfg.General.HotkeyExactMatch,
+			OnRelease:  cfg.General.HotkeyOnRelease,
+			Debounce:   time.Duration(cfg.General.HotkeyDebounceMs) * time.Millisecond,
+		})
+
+		// Build the complete hotkey set first and swap it in at once, so the
+		// escape/switch hotkeys never disappear while a refresh is in progress
+		var bindings []hotkey.Binding
+		swallow := false // set for profile hotkeys below
+		bind := func(hk, action string, callback func()) {
+			if hk == "" {
+				return
 			}
+			bindings = append(bindings, hotkey.Binding{Hotkey: hk, Callback: callback, Action: action, Swallow: swallow})
 
-			// Cross-platform mapping for settings hotkey
-			if runtime.GOOS == "darwin" && strings.Contains(strings.ToUpper(cfg.General.SettingsHotkey), "CTRL") {
-				cmdVariant := strings.ReplaceAll(strings.ToUpper(cfg.General.SettingsHotkey), "CTRL", "CMD")
-				hkMgr.Register(cmdVariant, func() {
-					if !debounce() {
-						return
-					}
-					log.Printf("Hotkey: Opening Settings UI...")
-					go runUI(cfgMgr)
-				})
+			// Cross-platform mapping: on macOS, also register CMD variant if CTRL is present
+			if runtime.GOOS == "darwin" && strings.Contains(strings.ToUpper(hk), "CTRL") {
+				cmdVariant := strings.ReplaceAll(strings.ToUpper(hk), "CTRL", "CMD")
+				bindings = append(bindings, hotkey.Binding{Hotkey: cmdVariant, Callback: callback, Action: action, Swallow: swallow})
 			}
 		}
 
+		// Register global settings hotkey
+		bind(cfg.General.SettingsHotkey, "settings", func() {
+			logging.Infof("Hotkey: Opening Settings UI...")
+			go runUI(cfgMgr, hkMgr, restartCtl)
+		})
+
 		// Register global sleep hotkey
-		if cfg.General.SleepHotkey != "" {
-			_, err := hkMgr.Register(cfg.General.SleepHotkey, func() {
-				if !debounce() {
-					return
+		bind(cfg.General.SleepHotkey, "sleep", func() {
+			logging.Infof("Hotkey: Sleeping Displays...")
+			// Execute sleep in a separate goroutine so it doesn't block the hotkey thread
+			go func() {
+				// Wait a bit to prevent immediate wake from key release
+				time.Sleep(500 * time.Millisecond)
+				if err := osutils.TurnOffDisplay(); err != nil {
+					logging.Errorf("Hotkey: Error sleeping displays: %v", err)
 				}
-				log.Printf("Hotkey: Sleeping Displays...")
-				// Execute sleep in a separate goroutine so it doesn't block the hotkey thread
-				go func() {
-					// Wait a bit to prevent immediate wake from key release
-					time.Sleep(500 * time.Millisecond)
-					if err := osutils.TurnOffDisplay(); err != nil {
-						log.Printf("Error sleeping displays: %v", err)
-					}
-				}()
-			})
-			if err != nil {
-				log.Printf("Warning: failed to register sleep hotkey: %v", err)
-			}
+			}()
+		})
 
-			// Cross-platform mapping for sleep hotkey
-			if runtime.GOOS == "darwin" && strings.Contains(strings.ToUpper(cfg.General.SleepHotkey), "CTRL") {
-				cmdVariant := strings.ReplaceAll(strings.ToUpper(cfg.General.SleepHotkey), "CTRL", "CMD")
-				hkMgr.Register(cmdVariant, func() {
-					if !debounce() {
-						return
-					}
-					log.Printf("Hotkey: Sleeping Displays...")
-					go func() {
-						// Wait a bit to prevent immediate wake from key release
-						time.Sleep(500 * time.Millisecond)
-						if err := osutils.TurnOffDisplay(); err != nil {
-							log.Printf("Error sleeping displays: %v", err)
-						}
-					}()
-				})
+		// Register brightness hotkeys (all monitors at once)
+		step := cfg.General.BrightnessStep
+		if step <= 0 {
+			step = switcher.DefaultBrightnessStep
+		}
+		adjustBrightness := func(delta int) func() {
+			return func() {
+				logging.Infof("Hotkey: Adjusting brightness by %+d...", delta)
+				if _, err := sw.AdjustBrightness(delta); err != nil {
+					logging.Errorf("Hotkey: Brightness error: %v", err)
+				}
 			}
 		}
-
+		bind(cfg.General.BrightnessUpHotkey, fmt.Sprintf("brightness:%+d", step), adjustBrightness(step))
+		bind(cfg.General.BrightnessDownHotkey, fmt.Sprintf("brightness:%+d", -step), adjustBrightness(-step))
+
+		// Agents may keep the (synced) profile hotkeys disarmed while another
+		// computer's profile is showing
+		armProfiles := cfg.General.Role != "agent" || !cfg.General.AgentHotkeysWhenActive ||
+			sw.GetCurrentProfile() == cfg.General.AgentProfile
+		swallow = cfg.General.SwallowHotkeys
 		for _, profile := range cfg.Profiles {
-			if profile.Hotkey == "" {
-				continue
+			if !armProfiles {
+				break
 			}
 			pName := profile.Name
-			hotkey := profile.Hotkey
-
-			// Register the original hotkey
-			_, err := hkMgr.Register(hotkey, func() {
-				if !debounce() {
-					return
-				}
-				log.Printf("Hotkey: Switching to %s...", pName)
-				if err := sw.SwitchToProfile(pName); err != nil {
-					log.Printf("Switch error: %v", err)
-				}
+			bind(profile.Hotkey, "profile:"+pName, func() {
+				logging.Infof("Hotkey: Switching to %s...", pName)
+				switchFromShortcut(sw, pName)
 			})
-			if err != nil {
-				log.Printf("Warning: failed to register hotkey for profile %s: %v", pName, err)
-			}
+		}
 
-			// Cross-platform mapping: on macOS, also register CMD variant if CTRL is present
-			if runtime.GOOS == "darwin" && strings.Contains(strings.ToUpper(hotkey), "CTRL") {
-				cmdVariant := strings.ReplaceAll(strings.ToUpper(hotkey), "CTRL", "CMD")
-				_, _ = hkMgr.Register(cmdVariant, func() {
-					if !debounce() {
-						return
-					}
-					log.Printf("Hotkey: Switching to %s...", pName)
-					if err := sw.SwitchToProfile(pName); err != nil {
-						log.Printf("Switch error: %v", err)
-					}
-				})
-			}
+		if err := hkMgr.ReplaceAll(bindings); err != nil {
+			logging.Warnf("Shortcuts: Some hotkeys could not be registered: %v", err)
+		}
+		if armProfiles {
+			logging.Infof("Shortcuts: Refreshed %d profiles", len(cfg.Profiles))
+		} else {
+			logging.Infof("Shortcuts: Profile hotkeys disarmed until '%s' is active", cfg.General.AgentProfile)
 		}
-		log.Printf("Shortcuts: Refreshed %d profiles", len(cfg.Profiles))
 	}
 
 	// Initial shortcut setup
 	refreshShortcuts()
 
 	// Register callback to refresh shortcuts when config changes (e.g. via API)
-	cfgMgr.RegisterChangeCallback(refreshShortcuts)
+	cfgMgr.RegisterChangeCallback(func(change config.Change) {
+		// Hotkeys only depend on the profiles and the general settings
+		if change.Has(config.SectionProfiles) || change.Has(config.SectionGeneral) {
+			refreshShortcuts()
+		}
+		if change.Has(config.SectionGeneral) {
+			setupLogging(cfgMgr, "vkvm.log")
+			if reasons := restartReasons(running, cfgMgr.Get().General); len(reasons) > 0 {
+				logging.Infof("Service: %s changed, restart vkvm (or use Restart in the settings) to apply", strings.Join(reasons, ", "))
+			}
+		}
+	})
+
+	sw.SetOnSwitch(func(profileName, origin string) {
+		// Broadcast the switch event to all connected agents. Switches started
+		// here (or requested by an agent) originate on this machine; a switch
+		// received from our own Host keeps its origin so it can't loop back.
+		if apiServer != nil {
+			if origin == "" {
+				origin = network.MachineID()
+			}
+			apiServer.BroadcastSwitch(profileName, origin)
+		}
+		// Profile hotkeys armed only while this agent's profile is active follow the switch
+		if cfgMgr.Get().General.AgentHotkeysWhenActive {
+			refreshShortcuts()
+		}
+	})
+
+	// Time-of-day and docking profile switching (idle on agents, which
+	// follow the host instead)
+	supervisor.Go("schedule", supervisor.Always, sw.RunSchedule)
+	supervisor.Go("monitor-set", supervisor.Always, sw.RunMonitorSetWatch)
+
+	// Automation rules (see config.Rule)
+	supervisor.Go("rules", supervisor.Always, sw.RunRules)
+
+	// External plugin processes (see config.Plugin)
+	sw.StartPlugins()
 
 	// Agent sync loop: Periodic sync from Host
 	if cfg.General.Role == "agent" && cfg.General.CoordinatorAddr != "" {
-		log.Printf("Service: Initial sync from Host %s...", cfg.General.CoordinatorAddr)
+		logging.Infof("Service: Initial sync from Host %s...", cfg.General.CoordinatorAddr)
 		// One immediate sync on startup (synchronous)
-		if err := sw.SyncProfiles(); err == nil {
-			refreshShortcuts()
-		} else {
-			log.Printf("Warning: Initial sync from Host failed: %v", err)
+		// Synced profiles reach the shortcuts through the change callback
+		if err := sw.SyncProfiles(); errors.Is(err, network.ErrNotConnected) {
+			logging.Infof("Service: Host not connected yet, profiles will sync once connected")
+		} else if err != nil {
+			logging.Warnf("Service: Initial sync from Host failed: %v", err)
 		}
+	}
 
-		go func() {
-			// Periodic sync every 2 minutes
-			ticker := time.NewTicker(2 * time.Minute)
-			for range ticker.C {
-				if err := sw.SyncProfiles(); err == nil {
-					refreshShortcuts()
-				}
+	// The loop runs whatever the role: SyncProfiles does nothing without a
+	// link to a Host, and the switcher builds one when this machine becomes
+	// an agent
+	supervisor.Go("agent-sync", supervisor.Always, func() {
+		// Periodic sync every 2 minutes
+		ticker := time.NewTicker(2 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			// Profiles also sync on every reconnect; skip the poll while
+			// nobody is here or the laptop runs on battery
+			if sw.IsIdle() || sw.PowerSaving() {
+				continue
 			}
-		}()
-	}
+			if err := sw.SyncProfiles(); err != nil && !errors.Is(err, network.ErrNotConnected) {
+				logging.Warnf("Service: Periodic sync from Host failed: %v", err)
+			}
+		}
+	})
 
 	// Add menu items for each profile (Note: Tray menu currently only supports initial setup)
 	for _, profile := range cfg.Profiles {
 		profileName := profile.Name // Capture for closure
 		t.AddMenuItem(fmt.Sprintf("Switch to %s", profileName), func() {
-			if err := sw.SwitchToProfile(profileName); err != nil {
-				log.Printf("Switch error: %v", err)
-			}
+			switchFromShortcut(sw, profileName)
 		})
 	}
 
 	t.AddSeparator()
 
+	// Role presets restart the service
+	if len(cfg.Presets) > 0 {
+		for _, preset := range cfg.Presets {
+			presetName := preset.Name
+			id := t.AddMenuItem(fmt.Sprintf("Preset: %s (%s)", presetName, preset.Role), func() {
+				if presetName == cfgMgr.Get().General.Preset {
+					return
+				}
+				if err := cfgMgr.UsePreset(presetName); err != nil {
+					logging.Errorf("Service: Preset error: %v", err)
+					return
+				}
+				restart = true
+				t.Stop()
+			})
+			t.SetItemChecked(id, presetName == cfg.General.Preset)
+		}
+		t.AddSeparator()
+	}
+
+	// Workspaces swap profiles and hotkeys in place
+	if len(cfg.Workspaces) > 0 {
+		workspaceItems := make(map[int]string) // tray item -> workspace name
+		for _, ws := range cfg.Workspaces {
+			wsName := ws.Name
+			id := t.AddMenuItem("Workspace: "+wsName, func() {
+				if err := cfgMgr.UseWorkspace(wsName); err != nil {
+					logging.Errorf("Service: Workspace error: %v", err)
+					return
+				}
+				for item, name := range workspaceItems {
+					t.SetItemChecked(item, name == wsName)
+				}
+			})
+			t.SetItemChecked(id, wsName == cfg.General.Workspace)
+			workspaceItems[id] = wsName
+		}
+		t.AddSeparator()
+	}
+
 	t.AddMenuItem("Settings...", func() {
-		go runUI(cfgMgr)
+		go runUI(cfgMgr, hkMgr, restartCtl)
 	})
 
 	t.AddSeparator()
@@ -361,10 +675,52 @@ func runService(cfgMgr *config.Manager) {
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigCh
-		log.Println("Shutting down...")
+		logging.Infof("Service: Shutting down...")
 		t.Stop()
 	}()
 
-	log.Println("VKVM Service running. Press Ctrl+C to stop.")
+	if *openUI {
+		go runUI(cfgMgr, hkMgr, restartCtl)
+	}
+
+	logging.Infof("Service: Running. Press Ctrl+C to stop.")
 	t.Run()
+	hkMgr.Stop()
+
+	if restart {
+		logging.Infof("Service: Restarting to apply the new role...")
+		if err := restartSelf(reopenSettings); err != nil {
+			logging.Errorf("Service: Failed to restart: %v", err)
+		}
+	}
+}
+
+// setupLogging applies the log settings, writing the log to file in the logs
+// folder next to config.json. Calling it again applies changed settings.
+func setupLogging(cfgMgr *config.Manager, file string) {
+	g := cfgMgr.Get().General
+	err := logging.Setup(logging.Options{
+		Level:     g.LogLevel,
+		JSON:      g.LogJSON,
+		Dir:       filepath.Join(cfgMgr.Dir(), "logs"),
+		File:      file,
+		MaxSizeMB: g.LogMaxSizeMB,
+		MaxFiles:  g.LogMaxFiles,
+	})
+	if err != nil {
+		logging.Warnf("Service: Log settings not applied: %v", err)
+	}
+}
+
+// restartReasons lists the settings that differ from the ones the service was
+// started with and only take effect after a restart. Role, Host address and
+// API token changes apply at runtime: the switcher rebuilds its link to the
+// Host, the role-dependent loops check the role as they run and the API reads
+// its token per request. Only the API listener is set up once.
+func restartReasons(running, cur config.GeneralConfig) []string {
+	var reasons []string
+	if cur.APIEnabled != running.APIEnabled || cur.APIPort != running.APIPort || cur.APITLS != running.APITLS || cur.APIRequireTLS != running.APIRequireTLS {
+		reasons = append(reasons, "API server")
+	}
+	return reasons
 }
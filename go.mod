@@ -4,6 +4,7 @@ go 1.25.0
 
 require (
 	github.com/getlantern/systray v1.2.2
+	github.com/gorilla/websocket v1.5.3
 	golang.org/x/sys v0.40.0
 )
 
@@ -15,6 +16,5 @@ require (
 	github.com/getlantern/hidden v0.0.0-20190325191715-f02dbb02be55 // indirect
 	github.com/getlantern/ops v0.0.0-20190325191751-d70cb0d6f85f // indirect
 	github.com/go-stack/stack v1.8.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
 )
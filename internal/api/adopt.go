@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/network"
+)
+
+// AdoptRequest asks a standalone instance to become an agent of the sending Host
+type AdoptRequest struct {
+	HostID       string `json:"host_id"`                 // machine ID (hostname) of the Host
+	HostPort     int    `json:"host_port"`               // API port of the Host
+	Token        string `json:"token,omitempty"`         // API token of the Host
+	AgentProfile string `json:"agent_profile,omitempty"` // profile that shows this machine
+}
+
+// SetOnAdopted sets the callback run after this machine accepted to become an
+// agent. The service is set up for one role at startup and must restart.
+func (s *Server) SetOnAdopted(fn func()) {
+	s.onAdopted = fn
+}
+
+// handleAdopt handles POST /api/adopt. The Host's address is taken from the
+// connection; the local user must confirm before anything is changed.
+func (s *Server) handleAdopt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AdoptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.HostID == "" || req.HostPort <= 0 || req.HostPort > 65535 {
+		http.Error(w, "host_id and host_port are required", http.StatusBadRequest)
+		return
+	}
+	hostIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "Cannot determine Host address", http.StatusBadRequest)
+		return
+	}
+	hostAddr := net.JoinHostPort(hostIP, strconv.Itoa(req.HostPort))
+
+	cfg := s.configMgr.Get()
+	if cfg.General.Role == "agent" && cfg.General.CoordinatorAddr != "" {
+		http.Error(w, fmt.Sprintf("Already an agent of %s", cfg.General.CoordinatorAddr), http.StatusConflict)
+		return
+	}
+	if req.AgentProfile != "" && s.configMgr.GetProfile(req.AgentProfile) == nil {
+		logging.Infof("API: Agent profile '%s' is not known here yet, it will sync from the Host", req.AgentProfile)
+	}
+
+	logging.Infof("API: Host '%s' (%s) asks to adopt this machine as agent", req.HostID, hostAddr)
+	msg := fmt.Sprintf("The VKVM Host '%s' (%s) wants to adopt this computer as an agent.\n\nIts settings will replace the role, Host address and API token of this computer, and VKVM will restart.\n\nAccept?", req.HostID, hostAddr)
+	if !s.confirmRemote(w, "Adopt as agent", msg, config.Change{}) {
+		return
+	}
+
+	// Register the Host by name so the agent follows it to a new address
+	s.configMgr.SetMachine(config.Machine{Name: req.HostID, ID: req.HostID, Address: hostAddr, Role: "host", Token: req.Token})
+	s.configMgr.Update(func(cfg *config.Config) {
+		cfg.General.Role = "agent"
+		cfg.General.CoordinatorAddr = req.HostID
+		cfg.General.APIToken = req.Token
+		if req.AgentProfile != "" {
+			cfg.General.AgentProfile = req.AgentProfile
+		}
+	})
+	if err := s.configMgr.Save(); err != nil {
+		http.Error(w, "Failed to save config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.Infof("API: Adopted as agent of '%s' (%s)", req.HostID, hostAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "adopted",
+		"machine": network.MachineID(),
+		"restart": s.onAdopted != nil,
+	})
+
+	if s.onAdopted != nil {
+		// Give the response time to reach the Host before the server goes away
+		time.AfterFunc(time.Second, s.onAdopted)
+	}
+}
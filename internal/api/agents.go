@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"vkvm/internal/logging"
+	"vkvm/internal/protocol"
+)
+
+// handleKnownAgents handles GET /api/agents/known: every agent that has
+// connected to this Host, including offline ones
+func (s *Server) handleKnownAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.configMgr.KnownAgents())
+}
+
+// handleKnownAgent handles DELETE /api/agents/{name}: forgets an agent
+func (s *Server) handleKnownAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	agent, err := s.configMgr.FindKnownAgent(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := s.configMgr.ForgetAgent(agent.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.Infof("API: Forgot agent '%s'", agent.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "agent": agent.Name})
+}
+
+// handleWakeAgent handles POST /api/agents/{name}/wake: sends a Wake-on-LAN
+// packet to a known agent
+func (s *Server) handleWakeAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if _, err := s.configMgr.FindKnownAgent(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := s.switcher.WakeAgent(name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "agent": name})
+}
+
+// handleSendFile handles POST /api/agents/{name}/files?name=<file>: sends the
+// request body to a connected agent as a file
+func (s *Server) handleSendFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, protocol.MaxFileSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	agent := r.PathValue("name")
+	path, err := s.SendFile(agent, name, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "agent": agent, "path": path})
+}
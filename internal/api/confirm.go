@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/osutils"
+)
+
+// remoteConfirmTimeout is how long the local user has to accept a remote
+// configuration change
+const remoteConfirmTimeout = 60 * time.Second
+
+// confirmMu allows one confirmation prompt at a time
+var confirmMu sync.Mutex
+
+// localOnlySettings are the general settings (json names) a remote change
+// may never touch: they name programs the DDC layer runs
+var localOnlySettings = []string{"control_my_monitor_path", "m1ddc_path", "ddcutil_path"}
+
+// confirmRemote asks the local user to accept a configuration change
+// requested over the API, unless this machine is managed (see
+// GeneralConfig.Managed). A change of local-only settings is always refused.
+// If the change may not proceed, it writes the error response and returns
+// false.
+func (s *Server) confirmRemote(w http.ResponseWriter, title, message string, change config.Change) bool {
+	if slices.ContainsFunc(change.General, func(name string) bool {
+		return slices.Contains(localOnlySettings, name)
+	}) {
+		logging.Warnf("API: Refused remote change of local-only settings: %s", change)
+		http.Error(w, "DDC tool paths can only be changed on this computer", http.StatusForbidden)
+		return false
+	}
+	if s.configMgr.Get().General.Managed {
+		return true
+	}
+
+	if !confirmMu.TryLock() {
+		http.Error(w, "Another request is waiting for confirmation on the target", http.StatusConflict)
+		return false
+	}
+	defer confirmMu.Unlock()
+
+	logging.Infof("API: Waiting for local confirmation: %s", title)
+	accepted, err := osutils.Confirm("VKVM - "+title, message, remoteConfirmTimeout)
+	if err != nil {
+		logging.Warnf("API: Cannot ask for confirmation: %v", err)
+		http.Error(w, "Cannot ask for confirmation on the target (mark it as managed to skip the prompt): "+err.Error(), http.StatusServiceUnavailable)
+		return false
+	}
+	if !accepted {
+		logging.Infof("API: %s declined", title)
+		http.Error(w, "Declined (or not answered) on the target", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"vkvm/internal/network"
+	"vkvm/internal/protocol"
+	"vkvm/internal/supervisor"
+)
+
+// ComponentHealth is the state of one part of vkvm in /health
+type ComponentHealth struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Health is the /health response. Status is "ok" or "degraded"; the HTTP
+// status is 200 either way so that discovery still finds a degraded instance.
+// It also describes the machine, since /health is the one endpoint discovery
+// can read without the API token.
+type Health struct {
+	Status        string                     `json:"status"`
+	Degraded      bool                       `json:"degraded"`
+	Version       string                     `json:"version"`
+	Protocol      int                        `json:"protocol"`
+	Machine       string                     `json:"machine"`
+	Role          string                     `json:"role"`
+	Platform      string                     `json:"platform"`
+	TokenRequired bool                       `json:"token_required"`
+	Components    map[string]ComponentHealth `json:"components"`
+}
+
+// health checks the components. Every check is cheap: /health is polled by
+// LAN scans and monitoring and must not touch the DDC bus.
+func (s *Server) health() Health {
+	cfg := s.configMgr.Get()
+	h := Health{
+		Version:       s.version,
+		Protocol:      protocol.Version,
+		Machine:       network.MachineID(),
+		Role:          cfg.General.Role,
+		Platform:      runtime.GOOS,
+		TokenRequired: cfg.General.APIToken != "",
+		Components:    make(map[string]ComponentHealth),
+	}
+
+	if s.switcher.DisplaysReady() {
+		h.Components["ddc"] = ComponentHealth{OK: true}
+	} else {
+		h.Components["ddc"] = ComponentHealth{Detail: "no display detected yet"}
+	}
+
+	if s.hotkeyMgr != nil {
+		st := s.hotkeyMgr.Status()
+		c := ComponentHealth{OK: st.Running, Detail: st.Error}
+		if st.PermissionRequired {
+			c.Detail = "permission required"
+		} else if !st.Running && c.Detail == "" {
+			c.Detail = "not started"
+		}
+		h.Components["hotkeys"] = c
+	}
+
+	ws := s.wsMgr.Stats()
+	h.Components["ws"] = ComponentHealth{OK: true, Detail: fmt.Sprintf("%d agent(s) connected", ws.Clients)}
+
+	if cfg.General.Role == "agent" {
+		conn := s.switcher.ConnectionStatus()
+		h.Components["host_link"] = ComponentHealth{OK: conn.Connected, Detail: conn.State}
+	}
+
+	// A supervised goroutine that panicked and was not restarted is dead
+	var dead []string
+	for _, st := range supervisor.Statuses() {
+		if st.Panics > 0 && st.Running == 0 {
+			dead = append(dead, st.Name)
+		}
+	}
+	if len(dead) > 0 {
+		h.Components["goroutines"] = ComponentHealth{Detail: "stopped after a panic: " + strings.Join(dead, ", ")}
+	} else {
+		h.Components["goroutines"] = ComponentHealth{OK: true}
+	}
+
+	h.Status = "ok"
+	for _, c := range h.Components {
+		if !c.OK {
+			h.Status = "degraded"
+			h.Degraded = true
+		}
+	}
+	return h
+}
+
+// handleHealth handles GET /health (for monitoring)
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.health())
+}
+
+// mdnsInfo is what this machine announces over mDNS
+func (s *Server) mdnsInfo() map[string]string {
+	cfg := s.configMgr.Get()
+	return network.MDNSInfo(cfg.General.Role, s.version, runtime.GOOS, s.switcher.GetCurrentProfile(), cfg.General.APIToken != "")
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"vkvm/internal/network"
+	"vkvm/internal/protocol"
+)
+
+// startHost serves a Host API on a loopback port and returns the server and
+// the address agents dial
+func startHost(t *testing.T, token string) (*Server, string) {
+	t.Helper()
+	s, h := newTestServer(t, token)
+	stopped := make(chan struct{})
+	go func() {
+		s.wsMgr.start()
+		close(stopped)
+	}()
+	// Let the agents leave through the manager loop, which records them as
+	// last seen, before stopping it and removing the state directory
+	t.Cleanup(func() {
+		waitFor(t, func() bool { return s.wsMgr.Stats().Clients == 0 }, "the agents to leave")
+		close(s.wsMgr.shutdown)
+		<-stopped
+	})
+
+	host := httptest.NewServer(h)
+	t.Cleanup(host.Close)
+
+	// The agent refuses a Host announcing its own machine ID, which the Host
+	// in this process does; a proxy drops the header from the upgrade response
+	target, _ := url.Parse(host.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		resp.Header.Del(protocol.MachineHeader)
+		return nil
+	}
+	front := httptest.NewServer(proxy)
+	t.Cleanup(front.Close)
+
+	u, _ := url.Parse(front.URL)
+	return s, u.Host
+}
+
+// testAgent is a network.WSClient whose callbacks report on channels
+type testAgent struct {
+	*network.WSClient
+	connected chan struct{}
+	switched  chan string
+	synced    chan json.RawMessage
+}
+
+// startAgent connects a WSClient to addr with token
+func startAgent(t *testing.T, addr, token string) *testAgent {
+	t.Helper()
+	a := &testAgent{
+		WSClient:  network.NewWSClient(addr, token),
+		connected: make(chan struct{}, 10),
+		switched:  make(chan string, 10),
+		synced:    make(chan json.RawMessage, 10),
+	}
+	a.OnConnect = func(string, string) { a.connected <- struct{}{} }
+	a.OnSwitch = func(profile, origin string) { a.switched <- profile }
+	a.OnSync = func(profiles json.RawMessage) { a.synced <- profiles }
+	a.Start()
+	t.Cleanup(a.Close)
+	return a
+}
+
+// wait returns the next value from ch or fails the test after a while
+func wait[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	var zero T
+	return zero
+}
+
+// waitFor polls cond until it holds or fails the test after a while
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgentRejectedToken(t *testing.T) {
+	s, addr := startHost(t, "secret")
+	a := startAgent(t, addr, "guess")
+
+	select {
+	case <-a.connected:
+		t.Fatal("agent with a wrong token connected")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if a.IsConnected() || s.wsMgr.Stats().Clients != 0 {
+		t.Errorf("connected %v, Host clients %d", a.IsConnected(), s.wsMgr.Stats().Clients)
+	}
+	if status := a.Status(); status.State != "waiting" || status.Failures == 0 {
+		t.Errorf("agent status %+v, want waiting after a failure", status)
+	}
+}
+
+func TestAgentSession(t *testing.T) {
+	s, addr := startHost(t, "secret")
+	a := startAgent(t, addr, "secret")
+
+	wait(t, a.connected, "connect")
+	waitFor(t, func() bool { return s.wsMgr.Stats().Clients == 1 }, "the Host to register the agent")
+
+	// The agent asks for the profiles right after authenticating
+	var profiles []json.RawMessage
+	if err := json.Unmarshal(wait(t, a.synced, "sync_resp"), &profiles); err != nil || len(profiles) != 2 {
+		t.Errorf("synced profiles %d: %v", len(profiles), err)
+	}
+	if err := a.RequestSync(5 * time.Second); err != nil {
+		t.Errorf("RequestSync: %v", err)
+	}
+	wait(t, a.synced, "requested sync_resp")
+
+	// Switches on the Host reach the agent
+	s.wsMgr.BroadcastSwitch("PC2", "test-host")
+	if profile := wait(t, a.switched, "switch broadcast"); profile != "PC2" {
+		t.Errorf("switched to %q, want PC2", profile)
+	}
+
+	// The Host drops the agent; a request queued meanwhile must go out after
+	// the auth message on the new connection, or the Host closes it again
+	s.wsMgr.Disconnect(network.MachineID())
+	waitFor(t, func() bool { return !a.IsConnected() }, "the agent to notice the disconnect")
+	a.SendSyncRequest()
+	a.Reconnect()
+
+	wait(t, a.connected, "reconnect")
+	wait(t, a.synced, "sync_resp after reconnect")
+	wait(t, a.synced, "sync_resp for the queued request")
+	waitFor(t, func() bool { return s.wsMgr.Stats().Clients == 1 }, "the Host to register the agent again")
+	if !a.IsConnected() || a.Status().Reconnects != 1 {
+		t.Errorf("after reconnect: %+v", a.Status())
+	}
+
+	s.wsMgr.BroadcastSwitch("PC1", "test-host")
+	if profile := wait(t, a.switched, "switch broadcast after reconnect"); profile != "PC1" {
+		t.Errorf("switched to %q, want PC1", profile)
+	}
+}
+
+func TestBench(t *testing.T) {
+	s, addr := startHost(t, "secret")
+	opts := network.BenchOptions{Token: "secret", Rounds: 2, Burst: 3, Interval: 10 * time.Millisecond}
+
+	for _, r := range network.Bench(context.Background(), addr, opts) {
+		if r.Err != nil || r.Sent != 6 || r.Received != r.Sent {
+			t.Errorf("%s: sent %d, received %d: %v", r.Transport, r.Sent, r.Received, r.Err)
+		}
+	}
+	// The bench connection said goodbye instead of lingering
+	if n := s.wsMgr.Stats().Clients; n != 0 {
+		t.Errorf("%d clients left after the bench", n)
+	}
+
+	opts.Token = "guess"
+	for _, r := range network.Bench(context.Background(), addr, opts) {
+		if r.Err == nil || r.Received != 0 {
+			t.Errorf("%s with a wrong token: received %d: %v", r.Transport, r.Received, r.Err)
+		}
+	}
+}
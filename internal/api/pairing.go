@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/osutils"
+	"vkvm/internal/supervisor"
+)
+
+// PairRequest starts pairing an agent with this Host
+type PairRequest struct {
+	AgentName string `json:"agent_name"`
+}
+
+// PairResponse identifies a pairing request; the agent completes it with the
+// PIN shown on the Host
+type PairResponse struct {
+	ID        string `json:"id"`
+	ExpiresIn int    `json:"expires_in"` // seconds
+}
+
+// PairCompleteRequest carries the PIN the user read on the Host
+type PairCompleteRequest struct {
+	PIN string `json:"pin"`
+}
+
+// PairCompleteResponse hands the agent its own token
+type PairCompleteResponse struct {
+	Agent string `json:"agent"`
+	Token string `json:"token"`
+}
+
+// isPairingPath reports whether path is one of the pairing endpoints, which
+// agents call before they have a token
+func isPairingPath(path string) bool {
+	for _, prefix := range []string{apiV1Prefix, "/api"} {
+		if path == prefix+"/pair" || strings.HasPrefix(path, prefix+"/pair/") {
+			return true
+		}
+	}
+	return false
+}
+
+// pairedAgentRoute reports whether a paired agent's own token may be used for
+// path: the WebSocket and the /agents/{name} endpoints of that agent.
+// Everything else, the config and other agents included, needs the API token.
+func pairedAgentRoute(path, agent string) bool {
+	if path == "/ws" {
+		return true
+	}
+	for _, prefix := range []string{apiV1Prefix, "/api"} {
+		if rest, ok := strings.CutPrefix(path, prefix+"/agents/"); ok {
+			name, _, _ := strings.Cut(rest, "/")
+			// /agents/known lists every agent, whatever this one is called
+			return name != "known" && strings.EqualFold(name, agent)
+		}
+	}
+	return false
+}
+
+// handlePair handles POST /api/pair: an agent asks to pair. The PIN is only
+// shown on the Host, in a dialog and in the settings' Agents card.
+func (s *Server) handlePair(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PairRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.AgentName == "" {
+		http.Error(w, "agent_name is required", http.StatusBadRequest)
+		return
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	p, err := s.configMgr.StartPairing(req.AgentName, ip)
+	if errors.Is(err, config.ErrTooManyPairings) || errors.Is(err, config.ErrPairingBlocked) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logging.Infof("API: Agent '%s' (%s) asks to pair", p.Agent, ip)
+
+	supervisor.Go("pair-prompt", supervisor.Once, func() { s.showPairingPIN(p) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PairResponse{ID: p.ID, ExpiresIn: int(time.Until(p.Expires).Seconds())})
+}
+
+// showPairingPIN shows the PIN on this machine; declining cancels the pairing
+func (s *Server) showPairingPIN(p config.PendingPairing) {
+	msg := fmt.Sprintf("'%s' (%s) wants to pair with this Host.\n\nPIN: %s\n\nEnter this PIN on the agent, or Decline to refuse.", p.Agent, p.Address, p.PIN)
+	accepted, err := osutils.Confirm("VKVM - Pair agent", msg, time.Until(p.Expires))
+	if err != nil {
+		// Headless Host: the log is the only place left to show the PIN
+		logging.Warnf("API: Cannot show the pairing PIN (%v); PIN for '%s' is %s", err, p.Agent, p.PIN)
+		return
+	}
+	if !accepted && time.Now().Before(p.Expires) {
+		logging.Infof("API: Pairing with '%s' declined", p.Agent)
+		s.configMgr.CancelPairing(p.ID)
+	}
+}
+
+// handlePairComplete handles POST /api/pair/{id}: the agent submits the PIN
+// and receives its token
+func (s *Server) handlePairComplete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PairCompleteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	agent, token, err := s.configMgr.CompletePairing(r.PathValue("id"), req.PIN)
+	switch {
+	case errors.Is(err, config.ErrWrongPIN):
+		logging.Warnf("API: Wrong pairing PIN from %s", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, config.ErrNoPairing):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.Infof("API: Paired agent '%s'", agent)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PairCompleteResponse{Agent: agent, Token: token})
+}
+
+// handleAgentPairing handles DELETE /api/agents/{name}/pairing: revokes an
+// agent's token and drops its connection
+func (s *Server) handleAgentPairing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := s.configMgr.Unpair(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	logging.Infof("API: Revoked the pairing of agent '%s'", name)
+	s.wsMgr.Disconnect(name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "agent": name})
+}
+
+// authorizeAgent checks the token an agent authenticates its WebSocket with:
+// its own token from pairing, or the shared API token unless pairing is
+// required
+func (s *Server) authorizeAgent(name, token string) bool {
+	if agent, ok := s.configMgr.PairedAgent(token); ok {
+		return strings.EqualFold(agent, name)
+	}
+	cfg := s.configMgr.Get()
+	if cfg.General.RequirePairing {
+		return false
+	}
+	return cfg.General.APIToken == "" || token == cfg.General.APIToken
+}
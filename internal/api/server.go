@@ -2,23 +2,54 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"vkvm/internal/config"
+	"vkvm/internal/ddc"
+	"vkvm/internal/hotkey"
+	"vkvm/internal/logging"
 	"vkvm/internal/network"
+	"vkvm/internal/osutils"
+	"vkvm/internal/protocol"
+	"vkvm/internal/supervisor"
 	"vkvm/internal/switcher"
 )
 
+// apiV1Prefix is the versioned prefix every API endpoint is also served under.
+// New endpoints should be written against /api/v1; the bare /api paths remain
+// as aliases for older agents and scripts.
+const apiV1Prefix = "/api/v1"
+
+// Size of the circle drawn by /api/test-inject
+const (
+	testInjectRadius = 20
+	testInjectSteps  = 24
+)
+
+// confirmWaitTimeout bounds how long /api/switch?confirm=true waits for the read-back
+const confirmWaitTimeout = 10 * time.Second
+
 // Server provides HTTP API for remote control
 type Server struct {
 	configMgr *config.Manager
 	switcher  *switcher.Switcher
-	token     string
+	version   string
 	wsMgr     *WSManager
+	hotkeyMgr *hotkey.Manager
+	onAdopted func()
+	files     *network.FileReceiver
+
+	// certFingerprint is the SHA-256 of the TLS certificate, if serving TLS
+	certFingerprint string
 }
 
 // NewServer creates a new API server
@@ -26,67 +57,168 @@ func NewServer(configMgr *config.Manager, sw *switcher.Switcher) *Server {
 	s := &Server{
 		configMgr: configMgr,
 		switcher:  sw,
+		files:     network.NewFileReceiver(configMgr),
 	}
 	s.wsMgr = newWSManager(s)
 	return s
 }
 
+// SetVersion sets the application version reported by /health and /api/status
+func (s *Server) SetVersion(version string) {
+	s.version = version
+}
+
+// SetHotkeyManager lets /api/status report the hotkey engine health
+func (s *Server) SetHotkeyManager(m *hotkey.Manager) {
+	s.hotkeyMgr = m
+}
+
 // Start starts the API server on the specified port
 func (s *Server) Start(port int) error {
 	cfg := s.configMgr.Get()
-	s.token = cfg.General.APIToken
 
 	// Start WebSocket Manager
-	go s.wsMgr.start()
-
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/switch", s.handleSwitch)
-	mux.HandleFunc("/api/status", s.handleStatus)
-	mux.HandleFunc("/api/discover", s.handleDiscover)
-	mux.HandleFunc("/api/config", s.handleConfig)
-	mux.HandleFunc("/ws", s.wsMgr.handleWebSocket)
-	mux.HandleFunc("/health", s.handleHealth)
+	supervisor.Go("ws-manager", supervisor.Always, s.wsMgr.start)
 
 	// Use "0.0.0.0:port" and explicitly use tcp4 to avoid IPv6-only binding issues on Windows
 	addr := fmt.Sprintf("0.0.0.0:%d", port)
 
-	// Diagnostic: Print all local IPs to console to help user verify
-	log.Printf("--- Diagnostic: Network Interfaces ---")
+	// Diagnostic: log all local IPs to help the user verify
+	logging.Debugf("API: Network interfaces:")
 	if ips, err := network.GetLocalIPs(); err == nil {
 		for _, ip := range ips {
-			log.Printf("  Found Local IPv4: %s", ip)
+			logging.Debugf("API: Local IPv4 %s", ip)
 		}
 	}
-	log.Printf("--------------------------------------")
 
-	log.Printf("Starting API server on FORCED IPv4 %s", addr)
+	logging.Infof("API: Starting server on %s", addr)
 
 	// Create a listener explicitly with tcp4
 	ln, err := net.Listen("tcp4", addr)
 	if err != nil {
-		log.Printf("ERROR: API server failed to listen on %s: %v", addr, err)
-		log.Printf("Note: VKVM will continue running without remote switching support.")
+		logging.Errorf("API: Failed to listen on %s: %v", addr, err)
+		logging.Warnf("API: VKVM will continue running without remote switching support.")
 		return err
 	}
 
+	if cfg.General.APITLS {
+		cert, err := network.LoadOrCreateCert(s.configMgr.Dir())
+		if err != nil {
+			ln.Close()
+			logging.Errorf("API: Could not set up TLS: %v", err)
+			return err
+		}
+		s.certFingerprint = network.CertFingerprint(cert.Certificate[0])
+		if cfg.General.APIRequireTLS {
+			logging.Infof("API: Serving HTTPS/WSS only (plaintext from this machine only), certificate SHA-256 %s", s.certFingerprint)
+		} else {
+			logging.Infof("API: Serving HTTPS/WSS (plaintext still accepted), certificate SHA-256 %s", s.certFingerprint)
+		}
+		ln = network.SniffTLS(ln, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, cfg.General.APIRequireTLS)
+	}
+
+	// Let LAN scans find us without probing the whole subnet
+	supervisor.Go("mdns", supervisor.Once, func() {
+		if err := network.AdvertiseMDNS(context.Background(), port, s.mdnsInfo); err != nil {
+			logging.Warnf("API: mDNS advertisement unavailable, scans will find this machine by probing: %v", err)
+		}
+	})
+
 	server := &http.Server{
-		Handler: s.authMiddleware(s.recoverMiddleware(mux)),
+		Handler: s.handler(),
 	}
 
 	// This is blocking
 	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
-		log.Printf("ERROR: API server stopped: %v", err)
+		logging.Errorf("API: Server stopped: %v", err)
 		return err
 	}
 	return nil
 }
 
+// apiToken returns the configured API token. It is read for every request,
+// so a new token takes effect without a restart.
+func (s *Server) apiToken() string {
+	return s.configMgr.Get().General.APIToken
+}
+
+// handler returns the API's routes wrapped in its middleware
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	handleAPI(mux, "/switch", s.handleSwitch)
+	handleAPI(mux, "/status", s.handleStatus)
+	handleAPI(mux, "/discover", s.handleDiscover)
+	handleAPI(mux, "/config", s.handleConfig)
+	handleAPI(mux, "/workspaces", s.handleWorkspaces)
+	handleAPI(mux, "/brightness", s.handleBrightness)
+	handleAPI(mux, "/monitors/{id}/power", s.handleMonitorPower)
+	handleAPI(mux, "/monitors/reprobe", s.handleReprobe)
+	handleAPI(mux, "/agents", s.handleAgents)
+	handleAPI(mux, "/agents/known", s.handleKnownAgents)
+	handleAPI(mux, "/agents/{name}", s.handleKnownAgent)
+	handleAPI(mux, "/agents/{name}/wake", s.handleWakeAgent)
+	handleAPI(mux, "/agents/{name}/files", s.handleSendFile)
+	handleAPI(mux, "/agents/{name}/pairing", s.handleAgentPairing)
+	handleAPI(mux, "/pair", s.handlePair)
+	handleAPI(mux, "/pair/{id}", s.handlePairComplete)
+	handleAPI(mux, "/test-inject", s.handleTestInject)
+	handleAPI(mux, "/adopt", s.handleAdopt)
+	mux.HandleFunc("/ws", s.wsMgr.handleWebSocket)
+	mux.HandleFunc("/health", s.handleHealth)
+
+	return s.versionMiddleware(s.authMiddleware(s.recoverMiddleware(mux)))
+}
+
+// handleAPI registers a handler under both /api/v1<path> and the legacy /api<path>
+func handleAPI(mux *http.ServeMux, path string, handler http.HandlerFunc) {
+	mux.HandleFunc(apiV1Prefix+path, handler)
+	mux.HandleFunc("/api"+path, handler)
+}
+
+// versionMiddleware rejects peers that announce an incompatible protocol version.
+// Requests without the version header (browsers, curl, older builds) are let through.
+func (s *Server) versionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Always announce our version so peers can enable newer features
+		w.Header().Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+
+		header := r.Header.Get(protocol.VersionHeader)
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		peerVersion, err := strconv.Atoi(header)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s header: %q", protocol.VersionHeader, header), http.StatusBadRequest)
+			return
+		}
+
+		if !protocol.IsCompatible(peerVersion) {
+			logging.Warnf("API: Rejecting %s %s from %s: protocol version %d is not supported (supported %d-%d)",
+				r.Method, r.URL.Path, r.RemoteAddr, peerVersion, protocol.MinCompatibleVersion, protocol.Version)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUpgradeRequired)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":                  "incompatible protocol version",
+				"version":                s.version,
+				"protocol":               protocol.Version,
+				"min_compatible_version": protocol.MinCompatibleVersion,
+				"client_protocol":        peerVersion,
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // recoverMiddleware prevents panics from crashing the whole server
 func (s *Server) recoverMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("PANIC RECOV: %v", err)
+				logging.Errorf("API: Recovered from panic: %v", err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
@@ -98,22 +230,27 @@ func (s *Server) recoverMiddleware(next http.Handler) http.Handler {
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Log every request for debugging
-		log.Printf("API: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		logging.Debugf("API: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
 
-		// Skip auth for health check
-		if r.URL.Path == "/health" {
+		// Skip auth for health check, and for pairing, which agents do
+		// before they hold a token
+		if r.URL.Path == "/health" || isPairingPath(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// If token is configured, verify it
-		if s.token != "" {
+		// If token is configured, verify it. Paired agents present their own,
+		// which only opens their WebSocket and their own endpoints.
+		if token := s.apiToken(); token != "" {
 			authHeader := r.Header.Get("Authorization")
-			expectedAuth := "Bearer " + s.token
+			expectedAuth := "Bearer " + token
 
 			if authHeader != expectedAuth {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
+				agent, ok := s.configMgr.PairedAgent(strings.TrimPrefix(authHeader, "Bearer "))
+				if !ok || !pairedAgentRoute(r.URL.Path, agent) {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
 			}
 		}
 
@@ -137,28 +274,63 @@ func (s *Server) handleSwitch(w http.ResponseWriter, r *http.Request) {
 	propagateStr := r.URL.Query().Get("propagate")
 	propagate := propagateStr != "false"
 
-	log.Printf("API: Switching to profile '%s' (remote request from %s, propagate=%v)", profileName, r.RemoteAddr, propagate)
+	logging.Infof("API: Switching to profile '%s' (remote request from %s, propagate=%v)", profileName, r.RemoteAddr, propagate)
 
 	// If propagate is false, we need to bypass the Agent -> Host forwarding in SwitchToProfile
-	if !propagate {
-		if err := s.switcher.SwitchLocalOnly(profileName); err != nil {
-			log.Printf("API: Switch error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		if err := s.switcher.SwitchToProfile(profileName); err != nil {
-			log.Printf("API: Switch error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	// ?video_only=true switches even if the profile's agent is unreachable
+	var err error
+	switch {
+	case !propagate:
+		err = s.switcher.SwitchLocalOnly(profileName)
+	case r.URL.Query().Get("video_only") == "true":
+		err = s.switcher.SwitchVideoOnly(profileName)
+	default:
+		err = s.switcher.SwitchToProfile(profileName)
+	}
+	if errors.Is(err, switcher.ErrQueued) {
+		// Runs when the cooldown ends, unless a newer switch replaces it
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "queued",
+			"profile": profileName,
+		})
+		return
+	}
+	if err != nil {
+		logging.Errorf("API: Switch error: %v", err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, switcher.ErrSuperseded) {
+			status = http.StatusConflict
+		} else if errors.Is(err, switcher.ErrAgentUnreachable) {
+			status = http.StatusFailedDependency
 		}
+		http.Error(w, err.Error(), status)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	resp := map[string]interface{}{
 		"status":  "ok",
 		"profile": profileName,
-	})
+	}
+	// ?confirm=true waits for the input read-back (needs confirm_switch)
+	if r.URL.Query().Get("confirm") == "true" {
+		if c := s.switcher.AwaitConfirmation(confirmWaitTimeout); c != nil {
+			resp["confirmation"] = c
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SyncResult is the response to POST /api/config
+type SyncResult struct {
+	Status  string   `json:"status"`            // "ok" or "rejected"
+	Version string   `json:"version,omitempty"` // vkvm version of the receiving machine
+	Applied []string `json:"applied,omitempty"` // config sections that changed
+	General []string `json:"general,omitempty"` // general settings that changed
+	Errors  []string `json:"errors,omitempty"`  // validation problems, if rejected
 }
 
 // handleConfig handles GET (read) and POST (update) for configuration
@@ -176,16 +348,90 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		log.Printf("API: Receiving configuration update from %s", r.RemoteAddr)
+		logging.Infof("API: Receiving configuration update from %s", r.RemoteAddr)
+
+		// A push can't make this machine managed or unmanaged, nor make it run
+		// programs: plugins and the DDC tool paths stay as they are
+		cur := s.configMgr.Get()
+		newCfg.General.Managed = cur.General.Managed
+		newCfg.Plugins = cur.Plugins
+		newCfg.General.ControlMyMonitorPath = cur.General.ControlMyMonitorPath
+		newCfg.General.M1DDCPath = cur.General.M1DDCPath
+		newCfg.General.DDCUtilPath = cur.General.DDCUtilPath
+
+		result := SyncResult{Version: s.version}
+		if err := newCfg.Validate(); err != nil {
+			logging.Warnf("API: Rejected configuration from %s: %v", r.RemoteAddr, err)
+			result.Status = "rejected"
+			result.Errors = strings.Split(err.Error(), "\n")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+
+		if diff := s.configMgr.Diff(&newCfg); !diff.Empty() {
+			msg := fmt.Sprintf("The VKVM instance at %s wants to replace the configuration of this computer.\n\nChanged: %s\n\nAccept?", r.RemoteAddr, diff)
+			if !s.confirmRemote(w, "Configuration update", msg, diff) {
+				return
+			}
+		}
 
 		// Update in-memory config and save to disk
-		s.configMgr.Set(&newCfg)
+		change := s.configMgr.Set(&newCfg)
 		if err := s.configMgr.Save(); err != nil {
-			log.Printf("API: Failed to save received config: %v", err)
+			logging.Errorf("API: Failed to save received config: %v", err)
 			http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 			return
 		}
 
+		result.Status = "ok"
+		result.Applied = change.Sections
+		result.General = change.General
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWorkspaces handles /api/workspaces:
+//
+//	GET                   list the stored workspaces (for export)
+//	POST ?save=NAME       store the current setup as workspace NAME
+//	POST ?use=NAME        apply a stored workspace
+//	POST (Workspace JSON) import a workspace, replacing one of the same name
+func (s *Server) handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.configMgr.Get().Workspaces)
+
+	case "POST":
+		query := r.URL.Query()
+		var err error
+		switch {
+		case query.Get("save") != "":
+			err = s.configMgr.SaveWorkspace(s.configMgr.CurrentWorkspace(query.Get("save")))
+		case query.Get("use") != "":
+			logging.Infof("API: Switching to workspace '%s' (requested by %s)", query.Get("use"), r.RemoteAddr)
+			err = s.configMgr.UseWorkspace(query.Get("use"))
+		default:
+			var ws config.Workspace
+			if err := json.NewDecoder(r.Body).Decode(&ws); err != nil {
+				http.Error(w, "Invalid workspace data", http.StatusBadRequest)
+				return
+			}
+			logging.Infof("API: Importing workspace '%s' from %s", ws.Name, r.RemoteAddr)
+			err = s.configMgr.SaveWorkspace(ws)
+		}
+		if err != nil {
+			logging.Errorf("API: Workspace request failed: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
@@ -204,19 +450,185 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	currentProfile := s.switcher.GetCurrentProfile()
 	cfg := s.configMgr.Get()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	status := map[string]interface{}{
 		"current_profile": currentProfile,
 		"profiles":        getProfileNames(cfg.Profiles),
-	})
+		"version":         s.version,
+		"protocol":        protocol.Version,
+		"machine":         network.MachineID(),
+		"role":            cfg.General.Role,
+		"ddc":             ddc.Stats(),
+		"displays_ready":  s.switcher.DisplaysReady(),
+		"idle":            s.switcher.IsIdle(),
+		"power_saving":    s.switcher.PowerSaving(),
+		"ws":              s.wsMgr.Stats(),
+		"goroutines":      supervisor.Statuses(),
+	}
+	if c := s.switcher.LastConfirmation(); c != nil {
+		status["last_switch"] = c
+	}
+	// ?detect=true compares the configured profile with what the monitors show,
+	// e.g. after someone switched inputs from the monitor's OSD
+	if r.URL.Query().Get("detect") == "true" {
+		detected, err := s.switcher.DetectProfile()
+		if err != nil {
+			status["detect_error"] = err.Error()
+		} else {
+			status["detected_profile"] = detected
+			status["profile_mismatch"] = detected != currentProfile
+		}
+	}
+	if s.hotkeyMgr != nil {
+		status["hotkeys"] = s.hotkeyMgr.Status()
+	}
+	if s.certFingerprint != "" {
+		status["tls_fingerprint"] = s.certFingerprint
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleReprobe handles POST /api/monitors/reprobe: forgets the stored DDC/CI
+// probe results and probes every monitor again
+func (s *Server) handleReprobe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	monitors, err := s.switcher.ReprobeMonitors()
+	if err != nil && monitors == nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(monitors)
+}
+
+// SendFile sends data to a connected agent as a file named name
+func (s *Server) SendFile(agent, name string, data []byte) (string, error) {
+	return s.wsMgr.SendFile(agent, name, data)
+}
+
+// handleAgents handles GET /api/agents: connected agents and their traffic
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.wsMgr.Agents())
 }
 
-// handleHealth handles GET /health (for monitoring)
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+// handleTestInject handles POST /api/test-inject: moves the mouse in a small
+// circle so a remote user can see that input injection works on this machine
+func (s *Server) handleTestInject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	logging.Infof("API: Test injection requested by %s", r.RemoteAddr)
+	if err := osutils.TestInject(testInjectRadius, testInjectSteps); err != nil {
+		logging.Errorf("API: Test injection failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// handleBrightness handles GET/POST /api/brightness
+// POST takes either ?value=0-100 (absolute, all monitors) or ?delta=+/-N (relative)
+func (s *Server) handleBrightness(w http.ResponseWriter, r *http.Request) {
+	var results []switcher.MonitorBrightness
+	var err error
+
+	switch r.Method {
+	case "GET":
+		results, err = s.switcher.GetBrightness()
+	case "POST":
+		q := r.URL.Query()
+		if v := q.Get("value"); v != "" {
+			value, convErr := strconv.Atoi(v)
+			if convErr != nil {
+				http.Error(w, "Invalid value parameter", http.StatusBadRequest)
+				return
+			}
+			results, err = s.switcher.SetBrightness(value)
+		} else if d := q.Get("delta"); d != "" {
+			delta, convErr := strconv.Atoi(d)
+			if convErr != nil {
+				http.Error(w, "Invalid delta parameter", http.StatusBadRequest)
+				return
+			}
+			results, err = s.switcher.AdjustBrightness(delta)
+		} else {
+			http.Error(w, "Missing value or delta parameter", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil && results == nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Every monitor failed: report per-monitor reasons with an error status
+	status := "ok"
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status = "error"
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   status,
+		"monitors": results,
+	})
+}
+
+// handleMonitorPower handles POST /api/monitors/{id}/power?state=on|off
+func (s *Server) handleMonitorPower(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	monitorID := r.PathValue("id")
+	var on bool
+	switch r.URL.Query().Get("state") {
+	case "on":
+		on = true
+	case "off":
+	default:
+		http.Error(w, "Missing or invalid state parameter (on or off)", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.switcher.SetMonitorPower(monitorID, on); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ddc.ErrMonitorNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"monitor": monitorID,
+		"on":      on,
+	})
+}
+
 // handleDiscover handles GET /api/discover - scans LAN for VKVM instances
 func (s *Server) handleDiscover(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
@@ -225,16 +637,17 @@ func (s *Server) handleDiscover(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cfg := s.configMgr.Get()
-	log.Printf("API: Starting LAN scan on port %d", cfg.General.APIPort)
+	logging.Infof("API: Starting LAN scan on port %d", cfg.General.APIPort)
 
-	hosts, err := network.ScanLAN(cfg.General.APIPort)
+	hosts, err := network.ScanLANContext(r.Context(), cfg.General.APIPort, cfg.General.PeerTLS(), nil)
 	if err != nil {
-		log.Printf("API: Scan error: %v", err)
+		logging.Errorf("API: Scan error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("API: Found %d VKVM instance(s) on LAN", len(hosts))
+	logging.Infof("API: Found %d VKVM instance(s) on LAN", len(hosts))
+	network.ApplyMachines(hosts, s.configMgr)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(hosts)
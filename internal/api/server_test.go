@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"vkvm/internal/config"
+	"vkvm/internal/protocol"
+	"vkvm/internal/switcher"
+	"vkvm/internal/testutil"
+)
+
+// newTestServer returns a Host API server with a fresh config directory and
+// the given API token
+func newTestServer(t *testing.T, token string) (*Server, http.Handler) {
+	t.Helper()
+	cfgMgr := testutil.NewConfig(t)
+	testutil.FakeDDCTool(t)
+	cfgMgr.Update(func(c *config.Config) { c.General.APIToken = token })
+	sw, err := switcher.New(cfgMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(cfgMgr, sw)
+	return s, s.handler()
+}
+
+// do sends a request with the given API token (if any) through h
+func do(h http.Handler, method, path, token string, header http.Header) *httptest.ResponseRecorder {
+	header = header.Clone()
+	if token != "" {
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return testutil.Do(h, method, path, nil, header)
+}
+
+func TestHealthNeedsNoToken(t *testing.T) {
+	_, h := newTestServer(t, "secret")
+
+	rec := do(h, "GET", "/health", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /health: %d", rec.Code)
+	}
+	if got := rec.Header().Get(protocol.VersionHeader); got != strconv.Itoa(protocol.Version) {
+		t.Errorf("version header %q, want %d", got, protocol.Version)
+	}
+
+	var health Health
+	if err := json.NewDecoder(rec.Body).Decode(&health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "ok" && health.Status != "degraded" {
+		t.Errorf("status %q", health.Status)
+	}
+	if !health.TokenRequired || health.Protocol != protocol.Version || health.Components == nil {
+		t.Errorf("unexpected health %+v", health)
+	}
+}
+
+func TestAuthRejection(t *testing.T) {
+	_, h := newTestServer(t, "secret")
+
+	tests := []struct {
+		name, path, token string
+		want              int
+	}{
+		{"no token", "/api/status", "", http.StatusUnauthorized},
+		{"wrong token", "/api/status", "guess", http.StatusUnauthorized},
+		{"no token v1", "/api/v1/config", "", http.StatusUnauthorized},
+		{"legacy path", "/api/status", "secret", http.StatusOK},
+		{"v1 path", "/api/v1/status", "secret", http.StatusOK},
+		// Pairing is how agents get a token, so it is reachable without one
+		{"pairing", "/api/v1/pair/unknown", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(h, "GET", tt.path, tt.token, nil); rec.Code != tt.want {
+				t.Errorf("GET %s: %d, want %d", tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenChangeApplies(t *testing.T) {
+	s, h := newTestServer(t, "secret")
+
+	cfg := s.configMgr.Get()
+	cfg.General.APIToken = "rotated"
+	s.configMgr.Set(cfg)
+
+	if rec := do(h, "GET", "/api/status", "secret", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("old token: %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := do(h, "GET", "/api/status", "rotated", nil); rec.Code != http.StatusOK {
+		t.Errorf("new token: %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestStatusResponse(t *testing.T) {
+	_, h := newTestServer(t, "")
+
+	rec := do(h, "GET", "/api/v1/status", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/status: %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type %q", ct)
+	}
+	var status map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"current_profile", "profiles", "version", "protocol", "machine", "role", "ws", "goroutines"} {
+		if _, ok := status[key]; !ok {
+			t.Errorf("status lacks %q", key)
+		}
+	}
+	var profiles []string
+	if err := json.Unmarshal(status["profiles"], &profiles); err != nil || len(profiles) != 2 {
+		t.Errorf("profiles %s: %v", status["profiles"], err)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	_, h := newTestServer(t, "")
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/v1/nonexistent", http.StatusNotFound},
+		{"POST", "/api/v1/status", http.StatusMethodNotAllowed},
+		{"GET", "/api/v1/switch", http.StatusMethodNotAllowed},
+		{"POST", "/api/v1/switch", http.StatusBadRequest}, // no profile
+		{"GET", "/api/v1/agents/known", http.StatusOK},
+		{"DELETE", "/api/v1/agents/nobody", http.StatusNotFound},
+		{"DELETE", "/api/v1/agents/nobody/pairing", http.StatusNotFound},
+		{"GET", "/api/v1/config", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := do(h, tt.method, tt.path, "", nil); rec.Code != tt.want {
+			t.Errorf("%s %s: %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+
+	rec := do(h, "GET", "/api/v1/agents/known", "", nil)
+	var agents []config.KnownAgent
+	if err := json.NewDecoder(rec.Body).Decode(&agents); err != nil || agents == nil {
+		t.Errorf("known agents %q: %v", rec.Body.String(), err)
+	}
+
+	rec = do(h, "GET", "/api/config", "", nil)
+	var cfg config.Config
+	if err := json.NewDecoder(rec.Body).Decode(&cfg); err != nil || cfg.General.APIPort != 18080 {
+		t.Errorf("config: %v, port %d", err, cfg.General.APIPort)
+	}
+}
+
+func TestIncompatibleProtocolVersion(t *testing.T) {
+	_, h := newTestServer(t, "")
+
+	header := http.Header{}
+	header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version+1))
+	if rec := do(h, "GET", "/api/v1/status", "", header); rec.Code != http.StatusUpgradeRequired {
+		t.Errorf("newer protocol: %d, want %d", rec.Code, http.StatusUpgradeRequired)
+	}
+	header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+	if rec := do(h, "GET", "/api/v1/status", "", header); rec.Code != http.StatusOK {
+		t.Errorf("same protocol: %d", rec.Code)
+	}
+}
+
+func TestPairedAgentToken(t *testing.T) {
+	s, h := newTestServer(t, "secret")
+
+	p, err := s.configMgr.StartPairing("laptop", "192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := s.configMgr.CompletePairing(p.ID, p.PIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A per-agent token opens nothing but the agent's own endpoints
+	for _, path := range []string{"/api/v1/config", "/api/v1/status", "/api/v1/agents/known", "/api/v1/agents/desktop/pairing"} {
+		if rec := do(h, "GET", path, token, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s with agent token: %d, want 401", path, rec.Code)
+		}
+	}
+
+	rec := do(h, "DELETE", "/api/v1/agents/laptop/pairing", token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoking own pairing: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp["status"] != "ok" || resp["agent"] != "laptop" {
+		t.Errorf("response %v: %v", resp, err)
+	}
+
+	// Revoked: the token no longer opens anything
+	if rec := do(h, "DELETE", "/api/v1/agents/laptop/pairing", token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: %d, want 401", rec.Code)
+	}
+}
+
+func TestConfigPushKeepsToolPaths(t *testing.T) {
+	s, h := newTestServer(t, "")
+	s.configMgr.Update(func(c *config.Config) {
+		c.General.Managed = true // no prompt
+		c.General.DDCUtilPath = "/usr/bin/ddcutil"
+	})
+
+	pushed := s.configMgr.Get()
+	pushed.General.SwitchCooldownMs = 750
+	pushed.General.ControlMyMonitorPath = `C:\evil.exe`
+	pushed.General.M1DDCPath = "/tmp/evil"
+	pushed.General.DDCUtilPath = "/tmp/evil"
+	body, err := json.Marshal(pushed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := testutil.Do(h, "POST", "/api/v1/config", body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST config: %d %s", rec.Code, rec.Body.String())
+	}
+
+	g := s.configMgr.Get().General
+	if g.SwitchCooldownMs != 750 {
+		t.Errorf("switch cooldown %d, want the pushed 750", g.SwitchCooldownMs)
+	}
+	if g.ControlMyMonitorPath != "" || g.M1DDCPath != "" || g.DDCUtilPath != "/usr/bin/ddcutil" {
+		t.Errorf("tool paths changed by a push: %q %q %q", g.ControlMyMonitorPath, g.M1DDCPath, g.DDCUtilPath)
+	}
+
+	// Even a managed machine refuses a remote change of the tool paths
+	rec = httptest.NewRecorder()
+	if s.confirmRemote(rec, "test", "test", config.Change{Sections: []string{config.SectionGeneral}, General: []string{"ddcutil_path"}}) {
+		t.Error("change of ddcutil_path confirmed")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("refusal: %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -2,12 +2,23 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"vkvm/internal/config"
+	"vkvm/internal/events"
+	"vkvm/internal/logging"
+	"vkvm/internal/network"
 	"vkvm/internal/protocol"
+	"vkvm/internal/supervisor"
+	"vkvm/internal/switcher"
 
 	"github.com/gorilla/websocket"
 )
@@ -21,31 +32,96 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+const (
+	// clientQueueSize is how many outgoing messages may wait for a slow client
+	clientQueueSize = 256
+
+	// maxConsecutiveDrops is how many messages in a row a client may miss
+	// because its queue is full before it is disconnected
+	maxConsecutiveDrops = 32
+
+	// broadcastQueueSize is how many broadcasts may wait for the manager loop
+	broadcastQueueSize = 64
+)
+
+// WSStats counts broadcast traffic and slow-consumer handling
+type WSStats struct {
+	Clients      int    `json:"clients"`
+	Broadcasts   uint64 `json:"broadcasts"`
+	QueueDepth   int    `json:"queue_depth"`     // Broadcasts waiting for the manager loop
+	MaxQueue     int    `json:"max_queue_depth"` // Highest queue depth seen
+	Overflows    uint64 `json:"overflows"`       // Broadcasts discarded because the queue was full
+	Dropped      uint64 `json:"dropped"`         // Messages discarded because a client queue was full
+	Disconnected uint64 `json:"disconnected"`    // Clients dropped for falling too far behind
+}
+
 // WSManager handles WebSocket connections and broadcasting
 type WSManager struct {
 	server     *Server
 	clients    map[*WebSocketClient]bool
 	clientsMu  sync.RWMutex
 	broadcast  chan protocol.Message
-	register   chan *WebSocketClient
 	unregister chan *WebSocketClient
 	shutdown   chan struct{}
+
+	// seq counts broadcasts
+	seq atomic.Uint64
+
+	dropped      atomic.Uint64
+	disconnected atomic.Uint64
+	maxQueue     atomic.Int64
+	overflows    atomic.Uint64
 }
 
 // WebSocketClient represents a connected agent
 type WebSocketClient struct {
 	manager *WSManager
 	conn    *websocket.Conn
-	send    chan []byte
+	send    chan []byte // Bounded queue drained by writePump; closed on removal
 	ip      string
+
+	// drops counts messages missed in a row because send was full
+	drops atomic.Int32
+
+	// Traffic counters reported by WSManager.Agents
+	connectedAt time.Time
+	sent        atomic.Uint64
+	sentBytes   atomic.Uint64
+	dropped     atomic.Uint64
+	received    atomic.Uint64
+	lastSeen    atomic.Int64 // UnixNano of the last message from the agent
+
+	// name is the agent name from its auth message; guarded by manager.clientsMu
+	name string
+
+	// authenticated is set once the agent's auth message was accepted, which
+	// registers the client; only used by the readPump goroutine
+	authenticated bool
+
+	// topics is the client's subscription (nil: everything); guarded by
+	// manager.clientsMu. seq numbers the broadcasts this client was sent.
+	topics map[string]bool
+	seq    uint64
+
+	// protocol is the version the agent announced on upgrade (0: unknown)
+	protocol int
+
+	// Requests the Host sent to this agent, waiting for their replies
+	pendingMu sync.Mutex
+	pending   map[string]chan protocol.Message
+	nextID    uint64
+}
+
+// subscribed reports whether the client wants broadcasts of the given topic
+func (c *WebSocketClient) subscribed(topic string) bool {
+	return c.topics == nil || topic == "" || c.topics[topic]
 }
 
 func newWSManager(s *Server) *WSManager {
 	return &WSManager{
 		server:     s,
 		clients:    make(map[*WebSocketClient]bool),
-		broadcast:  make(chan protocol.Message),
-		register:   make(chan *WebSocketClient),
+		broadcast:  make(chan protocol.Message, broadcastQueueSize),
 		unregister: make(chan *WebSocketClient),
 		shutdown:   make(chan struct{}),
 	}
@@ -54,20 +130,8 @@ func newWSManager(s *Server) *WSManager {
 func (m *WSManager) start() {
 	for {
 		select {
-		case client := <-m.register:
-			m.clientsMu.Lock()
-			m.clients[client] = true
-			m.clientsMu.Unlock()
-			log.Printf("WS: New client registered from %s. Total clients: %d", client.ip, len(m.clients))
-
 		case client := <-m.unregister:
-			m.clientsMu.Lock()
-			if _, ok := m.clients[client]; ok {
-				delete(m.clients, client)
-				close(client.send)
-				log.Printf("WS: Client unregistered from %s. Total clients: %d", client.ip, len(m.clients))
-			}
-			m.clientsMu.Unlock()
+			m.removeClient(client, "unregistered")
 
 		case message := <-m.broadcast:
 			m.broadcastMessage(message)
@@ -79,55 +143,188 @@ func (m *WSManager) start() {
 }
 
 func (m *WSManager) broadcastMessage(message protocol.Message) {
-	jsonMsg, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("WS: Failed to marshal broadcast message: %v", err)
-		return
+	m.seq.Add(1)
+	topic := protocol.TopicOf(message.Type)
+
+	// Sequence numbers are per client so that unsubscribed topics do not show
+	// up as gaps; the write lock guards each client's seq
+	var slow []*WebSocketClient
+	m.clientsMu.Lock()
+	for client := range m.clients {
+		if !client.subscribed(topic) {
+			continue
+		}
+		client.seq++
+		message.Seq = client.seq
+		jsonMsg, err := json.Marshal(message)
+		if err != nil {
+			logging.Errorf("WS: Failed to marshal broadcast message: %v", err)
+			break
+		}
+		if !client.enqueue(jsonMsg) {
+			slow = append(slow, client)
+		}
+	}
+	m.clientsMu.Unlock()
+
+	for _, client := range slow {
+		logging.Warnf("WS: Disconnecting %s: missed %d messages in a row", client.ip, maxConsecutiveDrops)
+		if m.removeClient(client, "too slow") {
+			m.disconnected.Add(1)
+		}
 	}
+}
+
+// addClient registers client, so it receives broadcasts and replies. It is
+// called synchronously from the auth handler, so the replies to the messages
+// that follow the auth message are never dropped.
+func (m *WSManager) addClient(client *WebSocketClient) {
+	m.clientsMu.Lock()
+	m.clients[client] = true
+	total := len(m.clients)
+	m.clientsMu.Unlock()
+	logging.Infof("WS: New client registered from %s. Total clients: %d", client.ip, total)
+}
+
+// removeClient unregisters client and closes its queue, which makes writePump
+// close the connection. Returns false if the client was already removed.
+func (m *WSManager) removeClient(client *WebSocketClient, reason string) bool {
+	m.clientsMu.Lock()
+	if !m.clients[client] {
+		m.clientsMu.Unlock()
+		return false
+	}
+	delete(m.clients, client)
+	close(client.send)
+	total, name := len(m.clients), client.name
+	m.clientsMu.Unlock()
+
+	// Persisting state and notifying subscribers must not hold up broadcasts
+	logging.Infof("WS: Client %s removed (%s). Total clients: %d", client.ip, reason, total)
+	m.server.configMgr.AgentDisconnected(name)
+	events.Publish(events.Event{Type: events.AgentDisconnected, Agent: name, Address: client.ip})
+	return true
+}
+
+// AgentStats is a per-connection view of an agent's traffic
+type AgentStats struct {
+	Name        string     `json:"name,omitempty"`
+	Address     string     `json:"address"`
+	Transport   string     `json:"transport"`
+	ConnectedAt time.Time  `json:"connected_at"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+	Sent        uint64     `json:"sent"`
+	SentBytes   uint64     `json:"sent_bytes"`
+	Dropped     uint64     `json:"dropped"`
+	Received    uint64     `json:"received"`
+	QueueDepth  int        `json:"queue_depth"`
+}
 
+// Agents returns traffic counters for every connected agent
+func (m *WSManager) Agents() []AgentStats {
 	m.clientsMu.RLock()
 	defer m.clientsMu.RUnlock()
 
-	for client := range m.clients {
-		select {
-		case client.send <- jsonMsg:
-		default:
-			close(client.send)
-			delete(m.clients, client)
+	agents := make([]AgentStats, 0, len(m.clients))
+	for c := range m.clients {
+		a := AgentStats{
+			Name:        c.name,
+			Address:     c.ip,
+			Transport:   "websocket",
+			ConnectedAt: c.connectedAt,
+			Sent:        c.sent.Load(),
+			SentBytes:   c.sentBytes.Load(),
+			Dropped:     c.dropped.Load(),
+			Received:    c.received.Load(),
+			QueueDepth:  len(c.send),
 		}
+		if ns := c.lastSeen.Load(); ns != 0 {
+			t := time.Unix(0, ns)
+			a.LastSeen = &t
+		}
+		agents = append(agents, a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ConnectedAt.Before(agents[j].ConnectedAt) })
+	return agents
+}
+
+// Stats returns connection and queue counters
+func (m *WSManager) Stats() WSStats {
+	m.clientsMu.RLock()
+	clients := len(m.clients)
+	m.clientsMu.RUnlock()
+
+	return WSStats{
+		Clients:      clients,
+		Broadcasts:   m.seq.Load(),
+		QueueDepth:   len(m.broadcast),
+		MaxQueue:     int(m.maxQueue.Load()),
+		Overflows:    m.overflows.Load(),
+		Dropped:      m.dropped.Load(),
+		Disconnected: m.disconnected.Load(),
+	}
+}
+
+// enqueue queues data without blocking. When the queue is full the message is
+// dropped; it returns false once the client has dropped too many in a row.
+// Callers must hold clientsMu and have checked registration.
+func (c *WebSocketClient) enqueue(data []byte) bool {
+	select {
+	case c.send <- data:
+		c.drops.Store(0)
+		c.sent.Add(1)
+		c.sentBytes.Add(uint64(len(data)))
+		return true
+	default:
+	}
+
+	c.dropped.Add(1)
+	c.manager.dropped.Add(1)
+	n := c.drops.Add(1)
+	if n == 1 {
+		logging.Warnf("WS: Send queue to %s is full, dropping messages", c.ip)
 	}
+	return n < maxConsecutiveDrops
 }
 
 func (m *WSManager) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// The upgrade response is written by the websocket package, so headers set
+	// by middleware are lost; announce our protocol version explicitly
+	respHeader := http.Header{}
+	respHeader.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+	respHeader.Set(protocol.MachineHeader, network.MachineID())
+
+	conn, err := upgrader.Upgrade(w, r, respHeader)
 	if err != nil {
-		log.Printf("WS: Failed to upgrade connection: %v", err)
+		logging.Errorf("WS: Failed to upgrade connection: %v", err)
 		return
 	}
 
 	client := &WebSocketClient{
 		manager: m,
 		conn:    conn,
-		send:    make(chan []byte, 256),
+		send:    make(chan []byte, clientQueueSize),
 		ip:      r.RemoteAddr,
-	}
+		pending: make(map[string]chan protocol.Message),
 
-	// Register client
-	m.register <- client
+		connectedAt: time.Now(),
+	}
+	client.protocol, _ = strconv.Atoi(r.Header.Get(protocol.VersionHeader))
 
-	// Start pump goroutines
-	go client.writePump()
-	go client.readPump()
+	// The client is registered, and so receives broadcasts, only once its
+	// auth message was accepted (see handleMessage)
+	supervisor.Go("ws-write", supervisor.Once, client.writePump)
+	supervisor.Go("ws-read", supervisor.Once, client.readPump)
 }
 
 // readPump pumps messages from the websocket connection to the hub.
 func (c *WebSocketClient) readPump() {
 	defer func() {
-		c.manager.unregister <- c
+		c.leave()
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(4096)
+	c.conn.SetReadLimit(protocol.MaxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
 
@@ -135,15 +332,32 @@ func (c *WebSocketClient) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WS: Read error: %v", err)
+				logging.Warnf("WS: Read error: %v", err)
 			}
 			break
 		}
 
+		c.received.Add(1)
+		c.lastSeen.Store(time.Now().UnixNano())
 		c.handleMessage(message)
 	}
 }
 
+// leave unregisters an authenticated client, or stops the writePump of one
+// that never registered
+func (c *WebSocketClient) leave() {
+	if !c.authenticated {
+		close(c.send)
+		return
+	}
+	// The manager loop is gone after shutdown
+	select {
+	case c.manager.unregister <- c:
+	case <-c.manager.shutdown:
+		c.manager.removeClient(c, "shutdown")
+	}
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 func (c *WebSocketClient) writePump() {
 	ticker := time.NewTicker(50 * time.Second)
@@ -182,69 +396,342 @@ func (c *WebSocketClient) writePump() {
 }
 
 func (c *WebSocketClient) handleMessage(data []byte) {
-	var msg protocol.Message
-	if err := json.Unmarshal(data, &msg); err != nil {
-		log.Printf("WS: Invalid message format: %v", err)
+	// Anyone on the LAN can reach this socket; a bad message must not take the Host down
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Errorf("WS: Recovered from panic handling message from %s: %v", c.ip, r)
+		}
+	}()
+
+	msg, err := protocol.Decode(data)
+	if err != nil {
+		logging.Warnf("WS: Invalid message from %s: %v", c.ip, err)
+		c.replyError(msg.ID, protocol.ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	// Nothing but the auth message is accepted before authorizeAgent let
+	// the agent in; with require_pairing this is what keeps unpaired peers out
+	if msg.Type != protocol.TypeAuth && !c.authenticated {
+		logging.Warnf("WS: Closing %s: sent %s before authenticating", c.ip, msg.Type)
+		c.closeWith(websocket.ClosePolicyViolation, "authenticate first")
 		return
 	}
 
 	switch msg.Type {
 	case protocol.TypeAuth:
-		// TODO: Handle authentication if needed
-		// For now we might just log it or verify token if present in payload
-		log.Printf("WS: Received auth from client")
+		var payload protocol.AuthPayload
+		if err := msg.DecodePayload(&payload); err != nil {
+			logging.Warnf("WS: Invalid auth payload from %s: %v", c.ip, err)
+			c.replyError(msg.ID, protocol.ErrCodeBadRequest, err.Error())
+			return
+		}
+
+		// The upgrade request already passed authMiddleware; still refuse an
+		// auth message carrying the wrong token rather than trusting it blindly.
+		// A paired agent's token is only valid for that agent.
+		if !c.manager.server.authorizeAgent(payload.AgentName, payload.Token) {
+			logging.Warnf("WS: Rejecting client %s (%s): invalid token", c.ip, payload.AgentName)
+			c.closeWith(websocket.ClosePolicyViolation, "unauthorized")
+			return
+		}
+
+		c.subscribe(payload.Topics)
+		if !c.authenticated {
+			c.authenticated = true
+			c.manager.addClient(c)
+		}
+		c.manager.clientsMu.Lock()
+		prev := c.name
+		c.name = payload.AgentName
+		c.manager.clientsMu.Unlock()
+		logging.Infof("WS: Client %s authenticated as '%s'", c.ip, payload.AgentName)
+		c.manager.server.configMgr.AgentConnected(config.KnownAgent{
+			Name:    payload.AgentName,
+			Address: c.ip,
+			MAC:     payload.MAC,
+			Profile: payload.Profile,
+		})
+		// Re-authentication on the same connection moves it from the previous
+		// name; counted after the new one, so the same name never shows offline
+		if prev != "" {
+			c.manager.server.configMgr.AgentDisconnected(prev)
+		}
+		events.Publish(events.Event{Type: events.AgentConnected, Agent: payload.AgentName, Address: c.ip})
 
 	case protocol.TypeSwitch:
 		var payload protocol.SwitchPayload
-		jsonBytes, _ := json.Marshal(msg.Payload)
-		if err := json.Unmarshal(jsonBytes, &payload); err != nil {
-			log.Printf("WS: Invalid switch payload: %v", err)
+		if err := msg.DecodePayload(&payload); err != nil {
+			logging.Warnf("WS: Invalid switch payload from %s: %v", c.ip, err)
+			c.replyError(msg.ID, protocol.ErrCodeBadRequest, err.Error())
 			return
 		}
 
-		log.Printf("WS: Received switch request to '%s' from %s", payload.Profile, c.ip)
-
-		// Execute switch
-		// Note: We use SwitchLocalOnly because we will rebroadcast via WebSocket if needed,
-		// but SwitchToProfile logic involves legacy propagation we want to avoid double-triggering.
-		// Actually, we should use the switcher's method that knows what to do.
-		// If we are Host, we should apply locally and broadcast to others.
+		// Our own agent connection relaying back to us (coordinator points at this machine)
+		if payload.Origin == network.MachineID() {
+			logging.Warnf("WS: Dropping switch request to '%s' from %s that originated on this machine. "+
+				"Check the coordinator address in General Settings.", payload.Profile, c.ip)
+			c.replyError(msg.ID, protocol.ErrCodeBadRequest, "switch request originated on the host itself")
+			return
+		}
 
-		// Use a goroutine to avoid blocking the read pump
-		go func() {
-			if err := c.manager.server.switcher.SwitchLocalOnly(payload.Profile); err != nil {
-				log.Printf("WS: Switch failed: %v", err)
+		logging.Infof("WS: Received switch request to '%s' from %s", payload.Profile, c.ip)
+
+		// Apply the switch on this machine, off the read pump. The OnSwitch
+		// callback wired in main.go then broadcasts it to every agent,
+		// including the one that asked.
+		supervisor.Go("ws-switch", supervisor.Once, func() {
+			result := protocol.SwitchResultPayload{Profile: payload.Profile, Success: true}
+			if err := c.manager.server.switcher.SwitchLocalOnly(payload.Profile); errors.Is(err, switcher.ErrQueued) {
+				result.Success = false
+				result.Queued = true
+			} else if err != nil {
+				logging.Errorf("WS: Switch failed: %v", err)
+				result.Success = false
+				result.Error = err.Error()
+			}
+			// Agents that sent an ID are waiting for the outcome
+			if msg.ID != "" {
+				c.reply(protocol.TypeSwitchResult, msg.ID, result)
 			}
-			// Note: We do NOT broadcast here effectively avoiding double broadcast if onSwitch is wired up.
-			// The onSwitch callback in Switcher (wired in main.go) will trigger the broadcast.
-			// However, if we rely on onSwitch, we lose the "Origin" information (it becomes "host").
-			// But for now that's acceptable consistency.
-		}()
+		})
 
 	case protocol.TypeSyncRequest:
 		// Send config back
 		cfg := c.manager.server.configMgr.Get()
-		resp := protocol.Message{
-			Type: protocol.TypeSyncResponse,
-			Payload: protocol.SyncResponsePayload{
-				Profiles: cfg.Profiles,
-			},
+		profiles, err := json.Marshal(cfg.Profiles)
+		if err != nil {
+			logging.Errorf("WS: Failed to encode profiles for sync: %v", err)
+			c.replyError(msg.ID, protocol.ErrCodeInternal, "failed to encode profiles")
+			return
 		}
+		c.reply(protocol.TypeSyncResponse, msg.ID, protocol.SyncResponsePayload{Profiles: profiles})
 
-		respBytes, _ := json.Marshal(resp)
-		c.send <- respBytes
+	case protocol.TypePing:
+		// Application-level heartbeat, nothing to do
+
+	case protocol.TypeFileOffer:
+		var offer protocol.FileOfferPayload
+		if err := msg.DecodePayload(&offer); err != nil {
+			c.replyError(msg.ID, protocol.ErrCodeBadRequest, err.Error())
+			return
+		}
+		c.reply(protocol.TypeFileAck, msg.ID, c.manager.server.files.HandleOffer(c.sender(), offer))
+
+	case protocol.TypeFileChunk:
+		var chunk protocol.FileChunkPayload
+		if err := msg.DecodePayload(&chunk); err != nil {
+			c.replyError(msg.ID, protocol.ErrCodeBadRequest, err.Error())
+			return
+		}
+		c.reply(protocol.TypeFileAck, msg.ID, c.manager.server.files.HandleChunk(c.sender(), chunk))
+
+	case protocol.TypeFileAck, protocol.TypeError:
+		c.resolve(msg)
+
+	default:
+		logging.Warnf("WS: Unsupported message type '%s' from %s", msg.Type, c.ip)
+		c.replyError(msg.ID, protocol.ErrCodeUnsupported, "unsupported message type: "+string(msg.Type))
+	}
+}
+
+// closeWith closes the connection with a close frame giving the reason
+func (c *WebSocketClient) closeWith(code int, reason string) {
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+// label names the client for logs: its agent name, or its address before
+// it authenticated
+func (c *WebSocketClient) label() string {
+	c.manager.clientsMu.RLock()
+	defer c.manager.clientsMu.RUnlock()
+	if c.name != "" {
+		return c.name
+	}
+	return c.ip
+}
+
+// sender identifies the connection in file transfers. The address tells apart
+// agents that claim the same name.
+func (c *WebSocketClient) sender() string {
+	if label := c.label(); label != c.ip {
+		return fmt.Sprintf("%s (%s)", label, c.ip)
+	}
+	return c.ip
+}
+
+// request sends msg to the agent with a fresh ID and waits for its reply. A
+// TypeError reply is returned as an error.
+func (c *WebSocketClient) request(msg protocol.Message, timeout time.Duration) (protocol.Message, error) {
+	ch := make(chan protocol.Message, 1)
+	c.pendingMu.Lock()
+	c.nextID++
+	msg.ID = fmt.Sprintf("host-%d", c.nextID)
+	c.pending[msg.ID] = ch
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, msg.ID)
+		c.pendingMu.Unlock()
+	}()
+
+	c.deliver(msg)
+
+	select {
+	case reply := <-ch:
+		if reply.Type == protocol.TypeError {
+			var payload protocol.ErrorPayload
+			if err := reply.DecodePayload(&payload); err != nil {
+				return reply, fmt.Errorf("agent error: %w", err)
+			}
+			return reply, fmt.Errorf("agent error (%s): %s", payload.Code, payload.Message)
+		}
+		return reply, nil
+	case <-time.After(timeout):
+		return protocol.Message{}, fmt.Errorf("agent did not answer %s within %v", msg.Type, timeout)
+	}
+}
+
+// resolve hands a reply to the request waiting for it
+func (c *WebSocketClient) resolve(msg protocol.Message) {
+	c.pendingMu.Lock()
+	ch, ok := c.pending[msg.ID]
+	c.pendingMu.Unlock()
+	if !ok {
+		logging.Debugf("WS: Ignoring %s from %s for unknown or expired request %q", msg.Type, c.ip, msg.ID)
+		return
+	}
+	select {
+	case ch <- msg:
+	default: // duplicate reply
+	}
+}
+
+// Disconnect closes the connections of the agent called name
+func (m *WSManager) Disconnect(name string) {
+	m.clientsMu.RLock()
+	defer m.clientsMu.RUnlock()
+	for c := range m.clients {
+		if strings.EqualFold(c.name, name) {
+			logging.Infof("WS: Disconnecting agent '%s' (%s)", c.name, c.ip)
+			c.conn.Close()
+		}
+	}
+}
+
+// SendFile sends data to the connected agent called agent as a file named
+// name and returns where the agent saved it
+func (m *WSManager) SendFile(agent, name string, data []byte) (string, error) {
+	m.clientsMu.RLock()
+	var target *WebSocketClient
+	for c := range m.clients {
+		if strings.EqualFold(c.name, agent) {
+			target = c
+			break
+		}
+	}
+	m.clientsMu.RUnlock()
+
+	if target == nil {
+		return "", fmt.Errorf("agent '%s' is not connected", agent)
+	}
+	if target.protocol < protocol.FileTransferVersion {
+		return "", network.ErrFilesUnsupported
+	}
+	logging.Infof("WS: Sending '%s' (%d bytes) to agent '%s'", name, len(data), agent)
+	return network.SendFile(name, data, target.request)
+}
+
+// subscribe limits the broadcasts the client receives to topics (empty: all)
+func (c *WebSocketClient) subscribe(topics []string) {
+	var set map[string]bool
+	if len(topics) > 0 {
+		set = make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			set[topic] = true
+		}
+		logging.Debugf("WS: Client %s subscribed to %v", c.ip, topics)
+	}
+
+	c.manager.clientsMu.Lock()
+	c.topics = set
+	c.manager.clientsMu.Unlock()
+}
+
+// replyError answers a request with TypeError; requests without an ID expect no reply
+func (c *WebSocketClient) replyError(id, code, message string) {
+	if id == "" {
+		return
+	}
+	c.deliver(protocol.NewError(id, code, message))
+}
+
+// reply answers the request with the given ID (which may be empty for
+// unsolicited responses) with a message of type t
+func (c *WebSocketClient) reply(t protocol.MessageType, id string, payload interface{}) {
+	msg, err := protocol.NewMessage(t, payload)
+	if err != nil {
+		logging.Errorf("WS: Failed to build %s reply: %v", t, err)
+		c.replyError(id, protocol.ErrCodeInternal, "failed to encode reply")
+		return
+	}
+	msg.ID = id
+	c.deliver(msg)
+}
+
+// deliver queues a direct (non-broadcast) message to this client. It is safe to
+// call from any goroutine, including after the client has disconnected.
+func (c *WebSocketClient) deliver(msg protocol.Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logging.Errorf("WS: Failed to marshal reply: %v", err)
+		return
+	}
+
+	c.manager.clientsMu.RLock()
+	if !c.manager.clients[c] {
+		c.manager.clientsMu.RUnlock()
+		return // unregistered, send channel is closed
+	}
+	ok := c.enqueue(data)
+	c.manager.clientsMu.RUnlock()
+
+	if !ok && c.manager.removeClient(c, "too slow") {
+		c.manager.disconnected.Add(1)
 	}
 }
 
 // Public method to broadcast switch events from the Switcher (e.g. host triggered by hotkey)
 func (m *WSManager) BroadcastSwitch(profile string, origin string) {
-	msg := protocol.Message{
-		Type: protocol.TypeSwitch,
-		Payload: protocol.SwitchPayload{
-			Profile:   profile,
-			Origin:    origin,
-			Propagate: true, // Tell receivers they should act on it
-		},
-	}
-	m.broadcast <- msg
+	msg, err := protocol.NewMessage(protocol.TypeSwitch, protocol.SwitchPayload{
+		Profile:   profile,
+		Origin:    origin,
+		Propagate: true, // Tell receivers they should act on it
+	})
+	if err != nil {
+		logging.Errorf("WS: Failed to build switch broadcast: %v", err)
+		return
+	}
+	m.queueBroadcast(msg)
+}
+
+// queueBroadcast hands msg to the manager loop without blocking the caller
+func (m *WSManager) queueBroadcast(msg protocol.Message) {
+	select {
+	case m.broadcast <- msg:
+	default:
+		m.overflows.Add(1)
+		logging.Warnf("WS: Broadcast queue full, dropping %s", msg.Type)
+		return
+	}
+
+	depth := int64(len(m.broadcast))
+	for {
+		max := m.maxQueue.Load()
+		if depth <= max || m.maxQueue.CompareAndSwap(max, depth) {
+			return
+		}
+	}
 }
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/protocol"
+)
+
+// newTestClient returns a client with a goroutine draining its queue in
+// place of writePump, which stops once the client is removed
+func newTestClient(m *WSManager, name string) *WebSocketClient {
+	c := &WebSocketClient{
+		manager:     m,
+		send:        make(chan []byte, clientQueueSize),
+		ip:          "192.0.2.1:" + name,
+		name:        name,
+		connectedAt: time.Now(),
+		pending:     make(map[string]chan protocol.Message),
+	}
+	go func() {
+		for range c.send {
+		}
+	}()
+	return c
+}
+
+// TestWSRegistryConcurrentAccess is meant for go test -race: clients come and
+// go while the manager broadcasts, handlers reply and the API reads stats
+func TestWSRegistryConcurrentAccess(t *testing.T) {
+	s, _ := newTestServer(t, "")
+	m := s.wsMgr
+	go m.start()
+	defer close(m.shutdown)
+
+	const workers, rounds = 8, 40
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				c := newTestClient(m, fmt.Sprintf("agent-%d-%d", w, i))
+				m.addClient(c)
+				c.subscribe([]string{protocol.TopicSwitch})
+				c.reply(protocol.TypePing, "", nil)
+				m.BroadcastSwitch("PC1", "")
+				m.Agents()
+				m.Stats()
+				if i%2 == 0 {
+					m.unregister <- c
+				} else {
+					m.removeClient(c, "test")
+				}
+				// Replies to a removed client are dropped, not sent on a closed queue
+				c.reply(protocol.TypePing, "", nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Removal is synchronous for removeClient but goes through the manager
+	// loop for unregister; wait for the last ones to be processed
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Clients != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients left registered", m.Stats().Clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stray := newTestClient(m, "never-registered")
+	defer close(stray.send)
+	if m.removeClient(stray, "test") {
+		t.Error("removed a client that was never registered")
+	}
+}
+
+// authMessage returns the encoded auth message of agent name
+func authMessage(t *testing.T, name string) []byte {
+	t.Helper()
+	msg, err := protocol.NewMessage(protocol.TypeAuth, protocol.AuthPayload{AgentName: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// online returns the online state of each known agent
+func online(s *Server) map[string]bool {
+	agents := make(map[string]bool)
+	for _, a := range s.configMgr.KnownAgents() {
+		agents[a.Name] = a.Online
+	}
+	return agents
+}
+
+func TestWSReauthentication(t *testing.T) {
+	s, _ := newTestServer(t, "")
+	c := newTestClient(s.wsMgr, "")
+	defer s.wsMgr.removeClient(c, "test")
+
+	c.handleMessage(authMessage(t, "laptop"))
+	if got := online(s); len(got) != 1 || !got["laptop"] {
+		t.Fatalf("after auth: %v, want laptop online only", got)
+	}
+
+	// The same name again keeps one connection counted
+	c.handleMessage(authMessage(t, "laptop"))
+	s.configMgr.AgentDisconnected("laptop")
+	if got := online(s); got["laptop"] {
+		t.Errorf("re-authentication counted twice: %v", got)
+	}
+	s.configMgr.AgentConnected(config.KnownAgent{Name: "laptop"})
+
+	// Another name moves the connection
+	c.handleMessage(authMessage(t, "desktop"))
+	if got := online(s); len(got) != 2 || got["laptop"] || !got["desktop"] {
+		t.Errorf("after re-authenticating as desktop: %v", got)
+	}
+}
+
+// A connection closing after the manager loop stopped must not block
+func TestWSLeaveAfterShutdown(t *testing.T) {
+	s, _ := newTestServer(t, "")
+	m := s.wsMgr
+	close(m.shutdown)
+
+	c := newTestClient(m, "laptop")
+	c.authenticated = true
+	m.addClient(c)
+
+	left := make(chan struct{})
+	go func() {
+		c.leave()
+		close(left)
+	}()
+	select {
+	case <-left:
+	case <-time.After(time.Second):
+		t.Fatal("leave blocked after shutdown")
+	}
+	if n := m.Stats().Clients; n != 0 {
+		t.Errorf("%d clients registered, want 0", n)
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// KnownAgent is an agent that has connected to this Host. Entries stay after
+// the agent disconnects so the dashboard can show it offline and wake it.
+type KnownAgent struct {
+	// Name is the machine ID the agent authenticates with
+	Name string `json:"name"`
+
+	// Address is the IP the agent last connected from
+	Address string `json:"address,omitempty"`
+
+	// MAC is the hardware address of the agent's network interface, used
+	// for Wake-on-LAN
+	MAC string `json:"mac,omitempty"`
+
+	// Profile is the profile that shows the agent
+	Profile string `json:"profile,omitempty"`
+
+	// LastSeen is when the agent connected or disconnected last
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+
+	// Online reports an open connection; it is not persisted
+	Online bool `json:"online"`
+
+	// Paired reports that the agent holds its own token (see pairing.go);
+	// it is not persisted
+	Paired bool `json:"paired"`
+}
+
+// AgentConnected records that agent opened a connection and persists its
+// latest address, MAC and profile
+func (m *Manager) AgentConnected(agent KnownAgent) {
+	if agent.Name == "" {
+		return
+	}
+	m.mu.Lock()
+	if m.online == nil {
+		m.online = make(map[string]int)
+	}
+	m.online[strings.ToLower(agent.Name)]++
+	m.mu.Unlock()
+
+	m.recordAgent(agent.Name, func(a *KnownAgent) {
+		a.Address = agent.Address
+		if agent.MAC != "" {
+			a.MAC = agent.MAC // keep the last known MAC if the agent could not tell
+		}
+		a.Profile = agent.Profile
+	})
+}
+
+// AgentDisconnected records that one of agent's connections closed
+func (m *Manager) AgentDisconnected(name string) {
+	if name == "" {
+		return
+	}
+	key := strings.ToLower(name)
+	m.mu.Lock()
+	if m.online[key] > 1 {
+		m.online[key]--
+	} else {
+		delete(m.online, key)
+	}
+	m.mu.Unlock()
+
+	m.recordAgent(name, func(*KnownAgent) {})
+}
+
+// recordAgent applies update to the entry for name, creating it if needed,
+// stamps it as seen now and saves the runtime state
+func (m *Manager) recordAgent(name string, update func(*KnownAgent)) {
+	err := m.UpdateState(func(st *State) {
+		i := -1
+		for j := range st.Agents {
+			if strings.EqualFold(st.Agents[j].Name, name) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			st.Agents = append(st.Agents, KnownAgent{Name: name})
+			i = len(st.Agents) - 1
+		}
+		now := time.Now()
+		update(&st.Agents[i])
+		st.Agents[i].LastSeen = &now
+		st.Agents[i].Online = false
+		st.Agents[i].Paired = false
+	})
+	if err != nil {
+		logging.Errorf("Config: Failed to save agent '%s': %v", name, err)
+	}
+}
+
+// KnownAgents returns every agent that has connected to this Host, online or not
+func (m *Manager) KnownAgents() []KnownAgent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	agents := make([]KnownAgent, len(m.state.Agents))
+	for i, a := range m.state.Agents {
+		a.Online = m.online[strings.ToLower(a.Name)] > 0
+		a.Paired = slices.ContainsFunc(m.state.Pairings, func(p Pairing) bool { return strings.EqualFold(p.Agent, a.Name) })
+		agents[i] = a
+	}
+	return agents
+}
+
+// FindKnownAgent returns the known agent with the given name (case-insensitive)
+func (m *Manager) FindKnownAgent(name string) (KnownAgent, error) {
+	for _, a := range m.KnownAgents() {
+		if strings.EqualFold(a.Name, name) {
+			return a, nil
+		}
+	}
+	return KnownAgent{}, fmt.Errorf("unknown agent: %s", name)
+}
+
+// ForgetAgent removes an agent from the registry and revokes its pairing
+func (m *Manager) ForgetAgent(name string) error {
+	return m.UpdateState(func(st *State) {
+		st.Pairings = removePairing(st.Pairings, name)
+		for i := range st.Agents {
+			if strings.EqualFold(st.Agents[i].Name, name) {
+				st.Agents = append(st.Agents[:i], st.Agents[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// OfflineAgents returns the known agents bound to profileName that are not
+// connected
+func (m *Manager) OfflineAgents(profileName string) []KnownAgent {
+	var offline []KnownAgent
+	for _, a := range m.KnownAgents() {
+		if !a.Online && a.Profile != "" && a.Profile == profileName {
+			offline = append(offline, a)
+		}
+	}
+	return offline
+}
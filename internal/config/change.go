@@ -0,0 +1,86 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Configuration sections reported in a Change
+const (
+	SectionProfiles   = "profiles"
+	SectionMonitors   = "monitors"
+	SectionGeneral    = "general"
+	SectionMachines   = "machines"
+	SectionPresets    = "presets"
+	SectionWorkspaces = "workspaces"
+	SectionRules      = "rules"
+	SectionPlugins    = "plugins"
+)
+
+// Change describes what a configuration update changed, so change callbacks
+// can skip work that unrelated changes don't need
+type Change struct {
+	// Sections lists the changed top-level sections (Section* constants)
+	Sections []string
+
+	// General lists the json names of the changed general settings
+	General []string
+}
+
+// Has reports whether section changed
+func (c Change) Has(section string) bool {
+	return slices.Contains(c.Sections, section)
+}
+
+// Empty reports whether nothing changed
+func (c Change) Empty() bool {
+	return len(c.Sections) == 0
+}
+
+// String describes the change for logs, e.g. "profiles, general (api_port, role)"
+func (c Change) String() string {
+	parts := make([]string, len(c.Sections))
+	for i, s := range c.Sections {
+		parts[i] = s
+		if s == SectionGeneral && len(c.General) > 0 {
+			parts[i] += " (" + strings.Join(c.General, ", ") + ")"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// diffConfig compares two configurations section by section
+func diffConfig(old, cur *Config) Change {
+	var c Change
+	sections := []struct {
+		name     string
+		old, cur any
+	}{
+		{SectionProfiles, old.Profiles, cur.Profiles},
+		{SectionMonitors, old.Monitors, cur.Monitors},
+		{SectionGeneral, old.General, cur.General},
+		{SectionMachines, old.Machines, cur.Machines},
+		{SectionPresets, old.Presets, cur.Presets},
+		{SectionWorkspaces, old.Workspaces, cur.Workspaces},
+		{SectionRules, old.Rules, cur.Rules},
+		{SectionPlugins, old.Plugins, cur.Plugins},
+	}
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.old, s.cur) {
+			c.Sections = append(c.Sections, s.name)
+		}
+	}
+
+	if c.Has(SectionGeneral) {
+		ov, cv := reflect.ValueOf(old.General), reflect.ValueOf(cur.General)
+		t := ov.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !reflect.DeepEqual(ov.Field(i).Interface(), cv.Field(i).Interface()) {
+				name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+				c.General = append(c.General, name)
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"maps"
+	"slices"
+)
+
+// Clone returns a deep copy of c that shares no slices, maps or pointers with it
+func (c *Config) Clone() *Config {
+	cp := *c
+	cp.Profiles = cloneProfiles(c.Profiles)
+	cp.Monitors = cloneMonitors(c.Monitors)
+	cp.Machines = slices.Clone(c.Machines)
+	cp.Presets = slices.Clone(c.Presets)
+	cp.Workspaces = slices.Clone(c.Workspaces)
+	for i := range cp.Workspaces {
+		cp.Workspaces[i] = cloneWorkspace(cp.Workspaces[i])
+	}
+	cp.Rules = slices.Clone(c.Rules)
+	for i := range cp.Rules {
+		cp.Rules[i].When.Days = slices.Clone(cp.Rules[i].When.Days)
+	}
+	cp.Plugins = slices.Clone(c.Plugins)
+	for i := range cp.Plugins {
+		cp.Plugins[i].Args = slices.Clone(cp.Plugins[i].Args)
+	}
+	return &cp
+}
+
+// clone returns a deep copy of p
+func (p Profile) clone() Profile {
+	p.MonitorInputs = maps.Clone(p.MonitorInputs)
+	p.RemoteHosts = slices.Clone(p.RemoteHosts)
+	p.MonitorSet = slices.Clone(p.MonitorSet)
+	if p.Display != nil {
+		d := *p.Display
+		d.Brightness = cloneInt(d.Brightness)
+		d.ColorPreset = cloneInt(d.ColorPreset)
+		d.RedGain = cloneInt(d.RedGain)
+		d.GreenGain = cloneInt(d.GreenGain)
+		d.BlueGain = cloneInt(d.BlueGain)
+		p.Display = &d
+	}
+	return p
+}
+
+func cloneProfiles(profiles []Profile) []Profile {
+	if profiles == nil {
+		return nil
+	}
+	cp := make([]Profile, len(profiles))
+	for i, p := range profiles {
+		cp[i] = p.clone()
+	}
+	return cp
+}
+
+func cloneMonitors(monitors []MonitorInfo) []MonitorInfo {
+	cp := slices.Clone(monitors)
+	for i := range cp {
+		cp[i].InputRemap = maps.Clone(cp[i].InputRemap)
+	}
+	return cp
+}
+
+func cloneInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	n := *v
+	return &n
+}
@@ -3,15 +3,13 @@ package config
 
 import (
 	"encoding/json"
-	"fmt"
-	"io"
-	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sync"
-	"time"
+
+	"vkvm/internal/logging"
 )
 
 // Config represents the application configuration
@@ -24,6 +22,22 @@ type Config struct {
 
 	// General contains general application settings
 	General GeneralConfig `json:"general"`
+
+	// Machines names the other vkvm instances on the LAN
+	Machines []Machine `json:"machines,omitempty"`
+
+	// Presets are role setups to switch between, see UsePreset
+	Presets []Preset `json:"presets,omitempty"`
+
+	// Workspaces are stored desk setups, see UseWorkspace
+	Workspaces []Workspace `json:"workspaces,omitempty"`
+
+	// Rules switch profiles automatically when events happen
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Plugins are external programs driven by events. They are never changed
+	// by a configuration push from another machine.
+	Plugins []Plugin `json:"plugins,omitempty"`
 }
 
 // RemoteHost represents a remote computer to notify during profile switching
@@ -52,6 +66,32 @@ type Profile struct {
 	// SwitchMode determines how switching is performed
 	// Values: "local" (DDC only), "remote" (notify only), "both" (default)
 	SwitchMode string `json:"switch_mode,omitempty"`
+
+	// Display optionally adjusts picture settings on all monitors (e.g. a warmer evening profile)
+	Display *DisplaySettings `json:"display,omitempty"`
+
+	// Schedule activates this profile automatically at a local time of day ("HH:MM", optional)
+	Schedule string `json:"schedule,omitempty"`
+
+	// MonitorSet activates this profile automatically when the connected
+	// monitors change to exactly these monitor IDs, e.g. when a laptop is
+	// docked (optional)
+	MonitorSet []string `json:"monitor_set,omitempty"`
+}
+
+// DisplaySettings are picture adjustments applied with a profile. Unset
+// fields leave the monitor's current value alone.
+type DisplaySettings struct {
+	// Brightness is the brightness level in percent (VCP 0x10)
+	Brightness *int `json:"brightness,omitempty"`
+
+	// ColorPreset selects a monitor color preset (VCP 0x14, e.g. 4 = 5000K, 5 = 6500K)
+	ColorPreset *int `json:"color_preset,omitempty"`
+
+	// RedGain, GreenGain and BlueGain set the RGB video gains (VCP 0x16/0x18/0x1A)
+	RedGain   *int `json:"red_gain,omitempty"`
+	GreenGain *int `json:"green_gain,omitempty"`
+	BlueGain  *int `json:"blue_gain,omitempty"`
 }
 
 // MonitorInfo contains basic information about a detected monitor
@@ -64,6 +104,10 @@ type MonitorInfo struct {
 
 	// Serial is the monitor's serial number or UUID
 	Serial string `json:"serial,omitempty"`
+
+	// InputRemap translates raw input readings for monitors whose firmware
+	// misreports the active input (e.g. {17: 15} reads HDMI1 as DP1)
+	InputRemap map[int]int `json:"input_remap,omitempty"`
 }
 
 // GeneralConfig contains general application settings
@@ -77,7 +121,8 @@ type GeneralConfig struct {
 	// ShowNotifications shows desktop notifications on switch
 	ShowNotifications bool `json:"show_notifications"`
 
-	// CurrentProfile is the currently active profile
+	// CurrentProfile is the profile that was active when this file was last
+	// written by an older version; the live value is kept in State
 	CurrentProfile string `json:"current_profile"`
 
 	// APIEnabled enables the HTTP API server for remote switching
@@ -89,12 +134,41 @@ type GeneralConfig struct {
 	// APIToken is an optional authentication token for API requests
 	APIToken string `json:"api_token,omitempty"`
 
+	// APITLS serves the API and WebSocket over TLS with a self-signed
+	// certificate kept next to config.json; plaintext is still accepted
+	APITLS bool `json:"api_tls,omitempty"`
+
+	// APIRequireTLS refuses plaintext connections from other machines; only
+	// this machine's own tools may still use http:// (requires api_tls)
+	APIRequireTLS bool `json:"api_require_tls,omitempty"`
+
+	// RequirePairing only lets paired agents connect: the shared API token
+	// no longer authenticates an agent's WebSocket
+	RequirePairing bool `json:"require_pairing,omitempty"`
+
 	// Role determines if this machine is a "host" or "agent"
 	Role string `json:"role,omitempty"`
 
 	// CoordinatorAddr is the Address:Port of the host machine (mandatory for agents)
 	CoordinatorAddr string `json:"coordinator_addr,omitempty"`
 
+	// CoordinatorTLS makes agents connect to the Host over wss://
+	CoordinatorTLS bool `json:"coordinator_tls,omitempty"`
+
+	// CoordinatorCertSHA256 pins the Host's certificate by its SHA-256
+	// fingerprint; empty accepts any certificate
+	CoordinatorCertSHA256 string `json:"coordinator_cert_sha256,omitempty"`
+
+	// AgentToken is the token the Host issued when this agent paired; it is
+	// used instead of the API token
+	AgentToken string `json:"agent_token,omitempty"`
+
+	// Preset is the name of the preset last applied with UsePreset
+	Preset string `json:"preset,omitempty"`
+
+	// Workspace is the name of the workspace last applied with UseWorkspace
+	Workspace string `json:"workspace,omitempty"`
+
 	// ThisComputerIP is the IP address of this computer (auto-detected or manual)
 	ThisComputerIP string `json:"this_computer_ip,omitempty"`
 
@@ -103,6 +177,101 @@ type GeneralConfig struct {
 
 	// SleepHotkey is the global hotkey to put displays to sleep (e.g. "Ctrl+Alt+P")
 	SleepHotkey string `json:"sleep_hotkey,omitempty"`
+
+	// BrightnessUpHotkey raises the brightness of all monitors (e.g. "Ctrl+Alt+Up")
+	BrightnessUpHotkey string `json:"brightness_up_hotkey,omitempty"`
+
+	// BrightnessDownHotkey lowers the brightness of all monitors (e.g. "Ctrl+Alt+Down")
+	BrightnessDownHotkey string `json:"brightness_down_hotkey,omitempty"`
+
+	// BrightnessStep is the brightness change per hotkey press in percent (0: 10)
+	BrightnessStep int `json:"brightness_step,omitempty"`
+
+	// HotkeyExactMatch only triggers a hotkey when no extra keys are held
+	HotkeyExactMatch bool `json:"hotkey_exact_match,omitempty"`
+
+	// HotkeyOnRelease triggers hotkeys when the combo is released instead of pressed
+	HotkeyOnRelease bool `json:"hotkey_on_release,omitempty"`
+
+	// HotkeyDebounceMs is the minimum interval between two triggers of the same hotkey (0: 500 ms)
+	HotkeyDebounceMs int `json:"hotkey_debounce_ms,omitempty"`
+
+	// ControlMyMonitorPath overrides the ControlMyMonitor.exe location (Windows, empty: auto-detect)
+	ControlMyMonitorPath string `json:"control_my_monitor_path,omitempty"`
+
+	// M1DDCPath overrides the m1ddc location (macOS, empty: auto-detect)
+	M1DDCPath string `json:"m1ddc_path,omitempty"`
+
+	// DDCUtilPath overrides the ddcutil location (Linux, empty: auto-detect)
+	DDCUtilPath string `json:"ddcutil_path,omitempty"`
+
+	// DDCCommandTimeoutMs bounds each external DDC tool run (0: 3000 ms)
+	DDCCommandTimeoutMs int `json:"ddc_command_timeout_ms,omitempty"`
+
+	// InputWriteIntervalMs is the minimum interval between two input switches
+	// of the same monitor, protecting firmware from rapid switching (0: 500 ms,
+	// negative: no limit)
+	InputWriteIntervalMs int `json:"input_write_interval_ms,omitempty"`
+
+	// SwitchCooldownMs is the minimum interval between two profile switches.
+	// Requests arriving sooner are coalesced: only the latest one runs once
+	// the cooldown ends (0: no cooldown).
+	SwitchCooldownMs int `json:"switch_cooldown_ms,omitempty"`
+
+	// StartupDelaySec delays the background service at startup, for machines
+	// whose displays or network come up late after boot (0: no delay)
+	StartupDelaySec int `json:"startup_delay_sec,omitempty"`
+
+	// IdleThresholdSec is how long without keyboard or mouse input counts as
+	// idle; background checks slow down while idle (0: 300 s, negative: never)
+	IdleThresholdSec int `json:"idle_threshold_sec,omitempty"`
+
+	// BatterySaver reduces background work (slower polling, no automatic LAN
+	// scans): "auto" or empty while on battery, "always" or "never"
+	BatterySaver string `json:"battery_saver,omitempty"`
+
+	// ConfirmSwitch reads each monitor's input back after a switch and
+	// re-sends the switch once if it did not take effect
+	ConfirmSwitch bool `json:"confirm_switch,omitempty"`
+
+	// CheckAgentsBeforeSwitch refuses a switch to a profile whose agent is
+	// unreachable until the user chooses to switch the video only
+	CheckAgentsBeforeSwitch bool `json:"check_agents_before_switch,omitempty"`
+
+	// AgentProfile is the profile that shows this computer (agents)
+	AgentProfile string `json:"agent_profile,omitempty"`
+
+	// AgentHotkeysWhenActive arms the synced profile hotkeys on an agent only
+	// while AgentProfile is the active profile
+	AgentHotkeysWhenActive bool `json:"agent_hotkeys_when_active,omitempty"`
+
+	// SwallowHotkeys hides profile hotkeys from other applications (Windows)
+	SwallowHotkeys bool `json:"swallow_hotkeys,omitempty"`
+
+	// ReceiveFiles accepts files sent from the Host or an agent over the
+	// WebSocket link
+	ReceiveFiles bool `json:"receive_files,omitempty"`
+
+	// ReceiveDir is where received files are saved (empty: Downloads)
+	ReceiveDir string `json:"receive_dir,omitempty"`
+
+	// LogLevel is the least severe level written to the log: "debug",
+	// "info", "warn" or "error" (empty: info)
+	LogLevel string `json:"log_level,omitempty"`
+
+	// LogJSON writes the log as JSON lines instead of text
+	LogJSON bool `json:"log_json,omitempty"`
+
+	// LogMaxSizeMB is the size at which the log file in the logs folder
+	// next to config.json is rotated (0: 10 MB)
+	LogMaxSizeMB int `json:"log_max_size_mb,omitempty"`
+
+	// LogMaxFiles is how many rotated log files are kept (0: 3)
+	LogMaxFiles int `json:"log_max_files,omitempty"`
+
+	// Managed accepts configuration pushes and adoption requests over the API
+	// without asking the local user first. It is never changed by a push.
+	Managed bool `json:"managed,omitempty"`
 }
 
 // DefaultConfig returns a new Config with sensible defaults
@@ -139,7 +308,17 @@ type Manager struct {
 	mu         sync.Mutex
 	configPath string
 	config     *Config
-	onChanged  func()
+	state      State
+	onChanged  []func(Change)
+
+	// online counts the open connections of each known agent by lowercased
+	// name, as names match case-insensitively (see agents.go)
+	online map[string]int
+
+	// pairings are the pairing requests waiting for a PIN (see pairing.go)
+	pairings map[string]*PendingPairing
+	// pairingBlocks are the addresses that used up their PIN attempts
+	pairingBlocks map[string]*pairingBlock
 }
 
 // NewManager creates a new configuration manager
@@ -192,27 +371,33 @@ func getConfigPath() (string, error) {
 	return filepath.Join(configDir, "config.json"), nil
 }
 
-// Load reads the configuration from disk
+// Load reads the configuration and runtime state from disk
 func (m *Manager) Load() error {
+	change, err := m.load()
+	m.notifyChanged(change)
+	return err
+}
+
+func (m *Manager) load() (Change, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	data, err := os.ReadFile(m.configPath)
 	if os.IsNotExist(err) {
 		// No config file, use defaults
-		return nil
+		m.loadState()
+		return Change{}, nil
 	}
 	if err != nil {
-		return err
+		return Change{}, err
 	}
 
+	old := m.config.Clone()
 	if err := json.Unmarshal(data, m.config); err != nil {
-		return err
-	}
-	if m.onChanged != nil {
-		m.onChanged()
+		return Change{}, err
 	}
-	return nil
+	m.loadState()
+	return diffConfig(old, m.config), nil
 }
 
 // Save writes the configuration to disk
@@ -225,41 +410,93 @@ func (m *Manager) Save() error {
 		return err
 	}
 
-	log.Printf("Config: Saving configuration to %s (%d bytes)", m.configPath, len(data))
-	return os.WriteFile(m.configPath, data, 0644)
+	logging.Debugf("Config: Saving configuration to %s (%d bytes)", m.configPath, len(data))
+	return writeFileAtomic(m.configPath, data)
 }
 
-// Get returns the current configuration
+// Get returns a snapshot of the current configuration. Changes to it have no
+// effect; use Set or Update to modify the configuration.
 func (m *Manager) Get() *Config {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.config
+	return m.config.Clone()
+}
+
+// Update applies fn to the configuration under the lock. Call Save to persist the change.
+func (m *Manager) Update(fn func(*Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(m.config)
 }
 
-// Set updates the configuration
-func (m *Manager) Set(config *Config) {
+// Set replaces the configuration with a copy of config and reports what
+// changed to the change callbacks. It returns the change.
+func (m *Manager) Set(config *Config) Change {
 	m.mu.Lock()
-	m.config = config
+	change := diffConfig(m.config, config)
+	m.config = config.Clone()
 	m.mu.Unlock()
-	if m.onChanged != nil {
-		m.onChanged()
+
+	if change.Empty() {
+		return change
 	}
+	logging.Infof("Config: Changed %s", change)
+	m.notifyChanged(change)
+	return change
 }
 
-// RegisterChangeCallback registers a function to be called when config changes
-func (m *Manager) RegisterChangeCallback(fn func()) {
+// Diff returns what Set(config) would change, without applying it
+func (m *Manager) Diff(config *Config) Change {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.onChanged = fn
+	return diffConfig(m.config, config)
 }
 
-// GetProfile returns a profile by name
+// RegisterChangeCallback registers a function to be called with a
+// description of the change whenever Set, UseWorkspace or
+// UpdateProfilesFromRemote changes the config. Callbacks run in registration
+// order.
+func (m *Manager) RegisterChangeCallback(fn func(Change)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChanged = append(m.onChanged, fn)
+}
+
+// notifyChanged runs the change callbacks; callers must not hold m.mu
+func (m *Manager) notifyChanged(change Change) {
+	if change.Empty() {
+		return
+	}
+	m.mu.Lock()
+	callbacks := slices.Clone(m.onChanged)
+	m.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(change)
+	}
+}
+
+// GetProfile returns a copy of the profile with the given name, or nil
 func (m *Manager) GetProfile(name string) *Profile {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	for i := range m.config.Profiles {
-		if m.config.Profiles[i].Name == name {
-			return &m.config.Profiles[i]
+	for _, p := range m.config.Profiles {
+		if p.Name == name {
+			cp := p.clone()
+			return &cp
+		}
+	}
+	return nil
+}
+
+// GetMonitor returns a copy of the per-monitor settings by monitor ID, or nil
+func (m *Manager) GetMonitor(id string) *MonitorInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, mon := range m.config.Monitors {
+		if mon.ID == id {
+			cp := cloneMonitors([]MonitorInfo{mon})[0]
+			return &cp
 		}
 	}
 	return nil
@@ -271,12 +508,12 @@ func (m *Manager) SetProfile(profile Profile) {
 	defer m.mu.Unlock()
 	for i := range m.config.Profiles {
 		if m.config.Profiles[i].Name == profile.Name {
-			m.config.Profiles[i] = profile
+			m.config.Profiles[i] = profile.clone()
 			return
 		}
 	}
 	// Not found, add new
-	m.config.Profiles = append(m.config.Profiles, profile)
+	m.config.Profiles = append(m.config.Profiles, profile.clone())
 }
 
 // DeleteProfile removes a profile by name
@@ -293,57 +530,17 @@ func (m *Manager) DeleteProfile(name string) {
 
 // GetCurrentProfile returns the currently active profile
 func (m *Manager) GetCurrentProfile() *Profile {
-	return m.GetProfile(m.config.General.CurrentProfile)
+	return m.GetProfile(m.GetState().CurrentProfile)
 }
 
-// SyncFromCoordinator pulls profiles from the host machine if in agent mode
-func (m *Manager) SyncFromCoordinator() error {
-	m.mu.Lock()
-	cfg := m.config
-	m.mu.Unlock()
-
-	if cfg.General.Role != "agent" || cfg.General.CoordinatorAddr == "" {
-		return nil
-	}
-
-	url := fmt.Sprintf("http://%s/api/config", cfg.General.CoordinatorAddr)
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-
-	if cfg.General.APIToken != "" {
-		req.Header.Set("Authorization", "Bearer "+cfg.General.APIToken)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("coordinator returned status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var remoteConfig Config
-	if err := json.NewDecoder(resp.Body).Decode(&remoteConfig); err != nil {
-		return err
-	}
-
-	m.mu.Lock()
-	// Update profiles from remote
-	if len(remoteConfig.Profiles) > 0 {
-		m.config.Profiles = remoteConfig.Profiles
-	}
-	m.mu.Unlock()
-
-	return m.Save()
+// PeerTLS reports whether requests to other vkvm instances go over https: on
+// machines that serve TLS themselves and on agents that reach their Host over TLS
+func (g *GeneralConfig) PeerTLS() bool {
+	return g.APITLS || g.CoordinatorTLS
 }
 
-// UpdateProfilesFromRemote updates profiles from a generic interface (decoded from JSON)
+// UpdateProfilesFromRemote updates profiles from a generic interface (decoded
+// from JSON), saves them and reports the change to the change callbacks
 func (m *Manager) UpdateProfilesFromRemote(profiles interface{}) error {
 	// Re-marshal to bytes then unmarshal to []Profile to be safe with types
 	data, err := json.Marshal(profiles)
@@ -357,8 +554,16 @@ func (m *Manager) UpdateProfilesFromRemote(profiles interface{}) error {
 	}
 
 	m.mu.Lock()
-	m.config.Profiles = newProfiles
+	cur := m.config.Clone()
+	cur.Profiles = newProfiles
+	change := diffConfig(m.config, cur)
+	m.config = cur
 	m.mu.Unlock()
 
-	return m.Save()
+	err = m.Save()
+	if !change.Empty() {
+		logging.Infof("Config: Changed %s from the Host", change)
+		m.notifyChanged(change)
+	}
+	return err
 }
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestManager returns a Manager whose files live in a temporary directory
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+	m, err := NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestManagerConcurrentAccess is meant for go test -race: the tray, API,
+// settings UI and switcher read and change the config from their own goroutines
+func TestManagerConcurrentAccess(t *testing.T) {
+	m := newTestManager(t)
+
+	m.RegisterChangeCallback(func(Change) {
+		// Callbacks run outside the lock and commonly read the config back
+		m.Get()
+	})
+
+	const workers, rounds = 8, 50
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent := fmt.Sprintf("agent-%d", w)
+			for i := range rounds {
+				switch i % 5 {
+				case 0:
+					cfg := m.Get()
+					cfg.General.SwitchCooldownMs = w*rounds + i
+					cfg.Profiles[0].MonitorInputs["m1"] = i
+					m.Set(cfg)
+				case 1:
+					m.Update(func(c *Config) {
+						c.Profiles[1].Hotkey = agent
+						c.General.LogMaxFiles = i
+					})
+				case 2:
+					if err := m.UpdateState(func(s *State) { s.CurrentProfile = agent }); err != nil {
+						t.Error(err)
+					}
+				case 3:
+					m.AgentConnected(KnownAgent{Name: agent, Address: "192.0.2.1"})
+					m.AgentDisconnected(agent)
+				case 4:
+					if err := m.Save(); err != nil {
+						t.Error(err)
+					}
+				}
+				// Readers run alongside every kind of writer
+				cfg := m.Get()
+				_ = cfg.Profiles[0].MonitorInputs["m1"]
+				_ = m.GetState().CurrentProfile
+				m.KnownAgents()
+				m.GetCurrentProfile()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Snapshots are copies: changing one must not reach the manager
+	snap := m.Get()
+	snap.Profiles[0].MonitorInputs["m1"] = -1
+	if m.Get().Profiles[0].MonitorInputs["m1"] == -1 {
+		t.Error("Get returned the live config")
+	}
+	for _, a := range m.KnownAgents() {
+		if a.Online {
+			t.Errorf("agent %s still online after disconnecting", a.Name)
+		}
+	}
+}
+
+func TestPairingBlockedAfterWrongPINs(t *testing.T) {
+	m := newTestManager(t)
+
+	p, err := m.StartPairing("laptop", "192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range maxPINAttempts {
+		if _, _, err := m.CompletePairing(p.ID, "bad"); !errors.Is(err, ErrWrongPIN) {
+			t.Fatalf("wrong PIN: %v", err)
+		}
+	}
+	if _, _, err := m.CompletePairing(p.ID, p.PIN); !errors.Is(err, ErrNoPairing) {
+		t.Errorf("cancelled pairing: %v", err)
+	}
+
+	// The freed slot is not open to the same address
+	if _, err := m.StartPairing("laptop", "192.0.2.10"); !errors.Is(err, ErrPairingBlocked) {
+		t.Errorf("blocked address: %v", err)
+	}
+	if _, err := m.StartPairing("desktop", "192.0.2.11"); err != nil {
+		t.Errorf("other address: %v", err)
+	}
+
+	// Each further cancelled pairing blocks for longer
+	if d := m.blockPairing("192.0.2.10"); d != 2*pairingBlockTime {
+		t.Errorf("second block %s, want %s", d, 2*pairingBlockTime)
+	}
+	for range 10 {
+		m.blockPairing("192.0.2.10")
+	}
+	if d := m.blockPairing("192.0.2.10"); d != maxPairingBlockTime {
+		t.Errorf("block %s, want at most %s", d, maxPairingBlockTime)
+	}
+}
+
+func TestAgentOnlineIgnoresCase(t *testing.T) {
+	m := newTestManager(t)
+
+	m.AgentConnected(KnownAgent{Name: "Laptop", Address: "192.0.2.1"})
+	m.AgentConnected(KnownAgent{Name: "LAPTOP", Address: "192.0.2.1"})
+	if agents := m.KnownAgents(); len(agents) != 1 || !agents[0].Online {
+		t.Fatalf("known agents %+v, want one online", agents)
+	}
+	m.AgentDisconnected("laptop")
+	if !m.KnownAgents()[0].Online {
+		t.Error("offline with a connection left")
+	}
+	m.AgentDisconnected("Laptop")
+	if m.KnownAgents()[0].Online {
+		t.Error("online after both connections closed")
+	}
+}
+
+func TestUpdateProfilesFromRemoteNotifies(t *testing.T) {
+	m := newTestManager(t)
+
+	var changes []Change
+	m.RegisterChangeCallback(func(c Change) { changes = append(changes, c) })
+
+	profiles := []Profile{{Name: "Remote", Hotkey: "Ctrl+Alt+9", MonitorInputs: map[string]int{"m1": 17}}}
+	if err := m.UpdateProfilesFromRemote(profiles); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || !changes[0].Has(SectionProfiles) || len(changes[0].Sections) != 1 {
+		t.Fatalf("changes %v, want one of the profiles", changes)
+	}
+	if p := m.GetProfile("Remote"); p == nil || p.Hotkey != "Ctrl+Alt+9" {
+		t.Errorf("profile %+v not applied", p)
+	}
+
+	// The same profiles again change nothing
+	if err := m.UpdateProfilesFromRemote(profiles); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("changes %v after an unchanged sync", changes)
+	}
+}
+
+func TestFilesOwnerOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes do not apply")
+	}
+	m := newTestManager(t)
+
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UpdateState(func(st *State) { st.CurrentProfile = "A" }); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{m.configPath, m.statePath()} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("%s has mode %v, want 0600", path, mode)
+		}
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	profiles := map[string]bool{"Work": true}
+	tests := []struct {
+		rule Rule
+		err  string // substring of the error, empty if valid
+	}{
+		{Rule{When: RuleTrigger{Event: RuleAgentDisconnected}, Switch: "Work"}, ""},
+		{Rule{When: RuleTrigger{Event: RuleTime, Time: "09:00", Days: []string{"Weekdays", "sat"}}, Switch: "Work"}, ""},
+		{Rule{When: RuleTrigger{Event: RuleMonitorInput, Monitor: "m1", Input: 18}, Switch: "Work"}, ""},
+		{Rule{When: RuleTrigger{Event: RuleAgentConnected}, Switch: "Home"}, "unknown profile"},
+		{Rule{When: RuleTrigger{Event: RuleTime, Time: "9am"}, Switch: "Work"}, "invalid time"},
+		{Rule{When: RuleTrigger{Event: RuleTime, Time: "09:00", Days: []string{"someday"}}, Switch: "Work"}, "invalid day"},
+		{Rule{When: RuleTrigger{Event: RuleMonitorInput, Monitor: "m1"}, Switch: "Work"}, "needs a monitor and an input"},
+		{Rule{When: RuleTrigger{Event: "reboot"}, Switch: "Work"}, "unknown event"},
+	}
+	for _, tt := range tests {
+		err := tt.rule.validate(profiles)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: validate = %v, want %q", tt.rule.Label(), err, tt.err)
+		}
+	}
+}
+
+func TestRuleOnDay(t *testing.T) {
+	tests := []struct {
+		days []string
+		on   []time.Weekday
+	}{
+		{nil, []time.Weekday{time.Sunday, time.Monday, time.Saturday}},
+		{[]string{"weekdays"}, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}},
+		{[]string{"weekends"}, []time.Weekday{time.Saturday, time.Sunday}},
+		{[]string{"Tue", "sun"}, []time.Weekday{time.Tuesday, time.Sunday}},
+	}
+	for _, tt := range tests {
+		trigger := RuleTrigger{Event: RuleTime, Days: tt.days}
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if want := len(tt.days) == 0 || slices.Contains(tt.on, d); trigger.OnDay(d) != want {
+				t.Errorf("days %v: OnDay(%v) = %v, want %v", tt.days, d, !want, want)
+			}
+		}
+	}
+}
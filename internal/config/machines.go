@@ -0,0 +1,97 @@
+package config
+
+import (
+	"strings"
+
+	"vkvm/internal/logging"
+)
+
+// Machine is a named vkvm instance on the LAN, so users and logs can refer to
+// "Gaming-PC" instead of 192.168.1.57:18080
+type Machine struct {
+	// Name is the display name chosen by the user
+	Name string `json:"name"`
+
+	// ID is the hostname the machine reports in /api/status; discovery uses it
+	// to follow the machine to a new address
+	ID string `json:"id,omitempty"`
+
+	// Address is the machine's API address (host:port)
+	Address string `json:"address"`
+
+	// Role is the machine's role ("host" or "agent", informational)
+	Role string `json:"role,omitempty"`
+
+	// Token is the API token of that machine, if it requires one
+	Token string `json:"token,omitempty"`
+
+	// CertSHA256 pins the machine's certificate when it is reached over TLS
+	// (see GeneralConfig.PeerTLS); empty accepts any certificate
+	CertSHA256 string `json:"cert_sha256,omitempty"`
+}
+
+// FindMachine returns a copy of the machine with the given name (case-insensitive)
+// or address, or nil if none is registered
+func (m *Manager) FindMachine(nameOrAddr string) *Machine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, mc := range m.config.Machines {
+		if strings.EqualFold(mc.Name, nameOrAddr) || mc.Address == nameOrAddr {
+			found := mc
+			return &found
+		}
+	}
+	return nil
+}
+
+// MachineLabel describes an address for logs and the UI: "Name (address)" for
+// registered machines, the bare address otherwise
+func (m *Manager) MachineLabel(addr string) string {
+	if mc := m.FindMachine(addr); mc != nil && mc.Address == addr {
+		return mc.Name + " (" + addr + ")"
+	}
+	return addr
+}
+
+// SetMachine adds mc to the registry or replaces the entry with the same name
+func (m *Manager) SetMachine(mc Machine) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.config.Machines {
+		if strings.EqualFold(m.config.Machines[i].Name, mc.Name) {
+			m.config.Machines[i] = mc
+			return
+		}
+	}
+	m.config.Machines = append(m.config.Machines, mc)
+}
+
+// UpdateMachineAddress records that the machine reporting id is now reachable
+// at addr. It returns true (and saves the config) if a registered address
+// changed.
+func (m *Manager) UpdateMachineAddress(id, addr string) bool {
+	if id == "" {
+		return false
+	}
+
+	m.mu.Lock()
+	changed := false
+	for i := range m.config.Machines {
+		mc := &m.config.Machines[i]
+		if mc.ID == id && mc.Address != addr {
+			logging.Infof("Config: Machine '%s' moved from %s to %s", mc.Name, mc.Address, addr)
+			mc.Address = addr
+			changed = true
+		}
+	}
+	m.mu.Unlock()
+
+	if changed {
+		if err := m.Save(); err != nil {
+			logging.Errorf("Config: Failed to save updated machine address: %v", err)
+		}
+	}
+	return changed
+}
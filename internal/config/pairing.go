@@ -0,0 +1,283 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+const (
+	// pairingTimeout is how long a PIN can be entered after it was shown
+	pairingTimeout = 2 * time.Minute
+
+	// maxPINAttempts cancels a pairing after this many wrong PINs
+	maxPINAttempts = 5
+
+	// maxPendingPairings bounds the requests waiting for a PIN, so that
+	// unauthenticated requests cannot pile up
+	maxPendingPairings = 5
+
+	// pairingBlockTime is how long an address that used up its PIN attempts
+	// cannot start pairing. It doubles with each further cancelled pairing, up
+	// to maxPairingBlockTime.
+	pairingBlockTime    = 5 * time.Minute
+	maxPairingBlockTime = time.Hour
+)
+
+var (
+	// ErrWrongPIN is returned for a PIN that does not match
+	ErrWrongPIN = errors.New("wrong PIN")
+
+	// ErrNoPairing is returned for an unknown, expired or cancelled pairing
+	ErrNoPairing = errors.New("no such pairing request, or it expired")
+
+	// ErrTooManyPairings is returned while maxPendingPairings are waiting
+	ErrTooManyPairings = errors.New("too many pairing requests, try again in a few minutes")
+
+	// ErrPairingBlocked is returned to an address whose last pairing was
+	// cancelled for wrong PINs
+	ErrPairingBlocked = errors.New("too many wrong PINs from this address, try again later")
+)
+
+// Pairing is an agent paired with this Host. Only a hash of the agent's
+// token is kept.
+type Pairing struct {
+	Agent     string    `json:"agent"`
+	TokenHash string    `json:"token_hash"`
+	PairedAt  time.Time `json:"paired_at"`
+}
+
+// PendingPairing is a pairing request waiting for the agent to enter the PIN
+// shown on the Host. Pending pairings are not persisted.
+type PendingPairing struct {
+	ID      string    `json:"id"`
+	Agent   string    `json:"agent"`
+	Address string    `json:"address"`
+	PIN     string    `json:"pin"`
+	Expires time.Time `json:"expires"`
+
+	attempts int
+}
+
+// pairingBlock keeps an address from pairing after it guessed too many PINs
+type pairingBlock struct {
+	until   time.Time
+	strikes int
+}
+
+// validAgentName reports whether name looks like the host name agents
+// authenticate with. Pairing requests are unauthenticated and their names are
+// shown in dialogs and the settings page.
+func validAgentName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// hashToken returns the hex SHA-256 of token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// StartPairing creates a pairing request for agent and the 6-digit PIN to
+// show on this Host
+func (m *Manager) StartPairing(agent, address string) (PendingPairing, error) {
+	if !validAgentName(agent) {
+		return PendingPairing{}, errors.New("invalid agent name")
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return PendingPairing{}, err
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return PendingPairing{}, err
+	}
+	p := &PendingPairing{
+		ID:      id,
+		Agent:   agent,
+		Address: address,
+		PIN:     fmt.Sprintf("%06d", n.Int64()),
+		Expires: time.Now().Add(pairingTimeout),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropExpiredPairings()
+	if b := m.pairingBlocks[address]; b != nil && time.Now().Before(b.until) {
+		return PendingPairing{}, ErrPairingBlocked
+	}
+	if len(m.pairings) >= maxPendingPairings {
+		return PendingPairing{}, ErrTooManyPairings
+	}
+	if m.pairings == nil {
+		m.pairings = make(map[string]*PendingPairing)
+	}
+	m.pairings[id] = p
+	return *p, nil
+}
+
+// PendingPairings returns the pairing requests waiting for their PIN
+func (m *Manager) PendingPairings() []PendingPairing {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropExpiredPairings()
+	pending := make([]PendingPairing, 0, len(m.pairings))
+	for _, p := range m.pairings {
+		pending = append(pending, *p)
+	}
+	return pending
+}
+
+// CancelPairing drops a pairing request
+func (m *Manager) CancelPairing(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pairings, id)
+}
+
+// CompletePairing checks pin against the pairing request id. On success the
+// agent is paired, replacing an earlier pairing, and its new token returned.
+func (m *Manager) CompletePairing(id, pin string) (agent, token string, err error) {
+	m.mu.Lock()
+	m.dropExpiredPairings()
+	p := m.pairings[id]
+	if p == nil {
+		m.mu.Unlock()
+		return "", "", ErrNoPairing
+	}
+	if subtle.ConstantTimeCompare([]byte(p.PIN), []byte(strings.TrimSpace(pin))) != 1 {
+		p.attempts++
+		if p.attempts >= maxPINAttempts {
+			delete(m.pairings, id)
+			d := m.blockPairing(p.Address)
+			logging.Warnf("Config: Pairing with '%s' (%s) cancelled after %d wrong PINs, blocked for %s", p.Agent, p.Address, p.attempts, d)
+		}
+		m.mu.Unlock()
+		return "", "", ErrWrongPIN
+	}
+	delete(m.pairings, id)
+	m.mu.Unlock()
+
+	token, err = randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	err = m.UpdateState(func(st *State) {
+		st.Pairings = removePairing(st.Pairings, p.Agent)
+		st.Pairings = append(st.Pairings, Pairing{Agent: p.Agent, TokenHash: hashToken(token), PairedAt: time.Now()})
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return p.Agent, token, nil
+}
+
+// dropExpiredPairings removes pairing requests whose PIN timed out, and
+// pairing blocks long past. Callers must hold m.mu.
+func (m *Manager) dropExpiredPairings() {
+	for id, p := range m.pairings {
+		if time.Now().After(p.Expires) {
+			delete(m.pairings, id)
+		}
+	}
+	// Strikes count towards the next block until a quiet period has passed
+	for addr, b := range m.pairingBlocks {
+		if time.Since(b.until) > maxPairingBlockTime {
+			delete(m.pairingBlocks, addr)
+		}
+	}
+}
+
+// blockPairing refuses new pairings from address for a while and returns for
+// how long. Callers must hold m.mu.
+func (m *Manager) blockPairing(address string) time.Duration {
+	if m.pairingBlocks == nil {
+		m.pairingBlocks = make(map[string]*pairingBlock)
+	}
+	b := m.pairingBlocks[address]
+	if b == nil {
+		b = &pairingBlock{}
+		m.pairingBlocks[address] = b
+	}
+	b.strikes++
+	d := pairingBlockTime << (b.strikes - 1)
+	if d > maxPairingBlockTime || d <= 0 {
+		d = maxPairingBlockTime
+	}
+	b.until = time.Now().Add(d)
+	return d
+}
+
+// PairedAgent returns the agent token belongs to, if any
+func (m *Manager) PairedAgent(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	hash := hashToken(token)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.state.Pairings {
+		if subtle.ConstantTimeCompare([]byte(p.TokenHash), []byte(hash)) == 1 {
+			return p.Agent, true
+		}
+	}
+	return "", false
+}
+
+// IsPaired reports whether agent has a pairing (case-insensitive)
+func (m *Manager) IsPaired(agent string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.state.Pairings {
+		if strings.EqualFold(p.Agent, agent) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unpair revokes agent's token
+func (m *Manager) Unpair(agent string) error {
+	if !m.IsPaired(agent) {
+		return fmt.Errorf("agent '%s' is not paired", agent)
+	}
+	return m.UpdateState(func(st *State) {
+		st.Pairings = removePairing(st.Pairings, agent)
+	})
+}
+
+// removePairing returns pairings without agent's entry
+func removePairing(pairings []Pairing, agent string) []Pairing {
+	kept := pairings[:0]
+	for _, p := range pairings {
+		if !strings.EqualFold(p.Agent, agent) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
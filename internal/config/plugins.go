@@ -0,0 +1,34 @@
+package config
+
+import "fmt"
+
+// Plugin is an external program that receives events as JSON lines on stdin
+// and may write commands back on stdout (see switcher.StartPlugins)
+type Plugin struct {
+	// Name identifies the plugin in logs
+	Name string `json:"name"`
+
+	// Path is the executable to run
+	Path string `json:"path"`
+
+	// Args are passed to the executable
+	Args []string `json:"args,omitempty"`
+
+	// Disabled keeps the plugin configured without running it
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// validate checks a plugin; seen collects the names of the plugins before it
+func (p Plugin) validate(seen map[string]bool) error {
+	if p.Name == "" {
+		return fmt.Errorf("plugins: plugin for %q needs a name", p.Path)
+	}
+	if seen[p.Name] {
+		return fmt.Errorf("plugins: duplicate plugin %s", p.Name)
+	}
+	seen[p.Name] = true
+	if p.Path == "" {
+		return fmt.Errorf("plugins: %s: missing path", p.Name)
+	}
+	return nil
+}
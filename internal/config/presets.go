@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"vkvm/internal/logging"
+)
+
+// Preset is a named role setup for machines that move between desks, e.g. a
+// laptop that is the Host at home and an agent when docked at the office
+type Preset struct {
+	// Name is used to select the preset (e.g. "desk")
+	Name string `json:"name"`
+
+	// Role is the role to take on: "host" or "agent"
+	Role string `json:"role"`
+
+	// CoordinatorAddr is the Host to connect to as an agent (address or machine name)
+	CoordinatorAddr string `json:"coordinator_addr,omitempty"`
+
+	// AgentProfile is the profile that shows this computer (agents)
+	AgentProfile string `json:"agent_profile,omitempty"`
+
+	// Workspace is a stored workspace to apply along with the preset (optional)
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// UsePreset copies the named preset (case-insensitive) into the general
+// settings and saves the configuration. The new role takes effect when the
+// service starts.
+func (m *Manager) UsePreset(name string) error {
+	m.mu.Lock()
+	var preset *Preset
+	for _, p := range m.config.Presets {
+		if strings.EqualFold(p.Name, name) {
+			preset = &p
+			break
+		}
+	}
+	if preset == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("preset not found: %s", name)
+	}
+	if preset.Role != "host" && preset.Role != "agent" {
+		m.mu.Unlock()
+		return fmt.Errorf("preset %s: invalid role %q (want \"host\" or \"agent\")", preset.Name, preset.Role)
+	}
+	if preset.Role == "agent" && preset.CoordinatorAddr == "" {
+		m.mu.Unlock()
+		return fmt.Errorf("preset %s: agents need a coordinator address", preset.Name)
+	}
+
+	general := &m.config.General
+	general.Role = preset.Role
+	general.CoordinatorAddr = preset.CoordinatorAddr
+	general.AgentProfile = preset.AgentProfile
+	general.Preset = preset.Name
+	m.mu.Unlock()
+
+	logging.Infof("Config: Using preset '%s' (role %s)", preset.Name, preset.Role)
+	if preset.Workspace != "" {
+		return m.UseWorkspace(preset.Workspace) // saves the config too
+	}
+	return m.Save()
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// unsupportedProbeTTL is how long a failed DDC/CI probe is trusted. A monitor
+// that was asleep or busy while probed gets another chance after this.
+const unsupportedProbeTTL = 24 * time.Hour
+
+// DDCProbe is the stored result of probing a monitor for DDC/CI support
+type DDCProbe struct {
+	Supported bool      `json:"supported"`
+	ProbedAt  time.Time `json:"probed_at"`
+}
+
+// DDCProbe returns the stored probe result for a monitor fingerprint (see
+// ddc.Fingerprint). Failed probes expire after unsupportedProbeTTL.
+func (m *Manager) DDCProbe(fingerprint string) (supported, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.state.DDCProbes[fingerprint]
+	if !ok || (!p.Supported && time.Since(p.ProbedAt) > unsupportedProbeTTL) {
+		return false, false
+	}
+	return p.Supported, true
+}
+
+// SetDDCProbe stores a probe result in the runtime state
+func (m *Manager) SetDDCProbe(fingerprint string, supported bool) {
+	err := m.UpdateState(func(st *State) {
+		if st.DDCProbes == nil {
+			st.DDCProbes = make(map[string]DDCProbe)
+		}
+		st.DDCProbes[fingerprint] = DDCProbe{Supported: supported, ProbedAt: time.Now()}
+	})
+	if err != nil {
+		logging.Errorf("Config: Failed to save DDC probe result: %v", err)
+	}
+}
+
+// ClearDDCProbes forgets every probe result so all monitors are probed again
+func (m *Manager) ClearDDCProbes() error {
+	return m.UpdateState(func(st *State) {
+		st.DDCProbes = nil
+	})
+}
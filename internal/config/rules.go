@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Rule triggers (RuleTrigger.Event)
+const (
+	RuleAgentConnected    = "agent_connected"
+	RuleAgentDisconnected = "agent_disconnected"
+	RuleTime              = "time"
+	RuleMonitorInput      = "monitor_input"
+)
+
+// Rule is an automation: when something happens, switch to a profile, e.g.
+// "when agent Laptop disconnects, switch to Desktop"
+type Rule struct {
+	// Name identifies the rule in logs (optional)
+	Name string `json:"name,omitempty"`
+
+	// When is the trigger
+	When RuleTrigger `json:"when"`
+
+	// Switch is the profile to switch to
+	Switch string `json:"switch"`
+
+	// Disabled keeps the rule without running it
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// RuleTrigger describes when a rule fires
+type RuleTrigger struct {
+	// Event is one of agent_connected, agent_disconnected, time, monitor_input
+	Event string `json:"event"`
+
+	// Agent is the agent name (hostname) or address to match (agent events,
+	// empty: any agent)
+	Agent string `json:"agent,omitempty"`
+
+	// Time is the time of day as HH:MM (time)
+	Time string `json:"time,omitempty"`
+
+	// Days limits a time rule to some days: "mon".."sun", "weekdays" or
+	// "weekends" (empty: every day)
+	Days []string `json:"days,omitempty"`
+
+	// Monitor is the monitor ID to watch (monitor_input)
+	Monitor string `json:"monitor,omitempty"`
+
+	// Input is the input the monitor must report, e.g. 18 for HDMI2 (monitor_input)
+	Input int `json:"input,omitempty"`
+}
+
+// Label names the rule for logs
+func (r Rule) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.When.Event + " -> " + r.Switch
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// OnDay reports whether a time rule applies on weekday d
+func (t RuleTrigger) OnDay(d time.Weekday) bool {
+	if len(t.Days) == 0 {
+		return true
+	}
+	for _, day := range t.Days {
+		switch strings.ToLower(day) {
+		case "weekdays":
+			if d >= time.Monday && d <= time.Friday {
+				return true
+			}
+		case "weekends":
+			if d == time.Saturday || d == time.Sunday {
+				return true
+			}
+		default:
+			if strings.EqualFold(day, weekdays[d]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validate checks the rule against the profiles it may switch to
+func (r Rule) validate(profiles map[string]bool) error {
+	if !profiles[r.Switch] {
+		return fmt.Errorf("rules: %s: unknown profile %q", r.Label(), r.Switch)
+	}
+	switch r.When.Event {
+	case RuleAgentConnected, RuleAgentDisconnected:
+	case RuleTime:
+		if _, err := time.Parse("15:04", r.When.Time); err != nil {
+			return fmt.Errorf("rules: %s: invalid time %q (want HH:MM)", r.Label(), r.When.Time)
+		}
+		for _, day := range r.When.Days {
+			day = strings.ToLower(day)
+			if day != "weekdays" && day != "weekends" && !slices.Contains(weekdays, day) {
+				return fmt.Errorf("rules: %s: invalid day %q", r.Label(), day)
+			}
+		}
+	case RuleMonitorInput:
+		if r.When.Monitor == "" || r.When.Input <= 0 {
+			return fmt.Errorf("rules: %s: monitor_input needs a monitor and an input", r.Label())
+		}
+	default:
+		return fmt.Errorf("rules: %s: unknown event %q", r.Label(), r.When.Event)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// State is runtime state that must survive a crash or reboot. It lives in
+// state.json next to the configuration so that frequent updates (every
+// switch) never rewrite the user's config.json.
+type State struct {
+	// CurrentProfile is the last profile that was switched to
+	CurrentProfile string `json:"current_profile,omitempty"`
+
+	// SwitchedAt is when CurrentProfile was applied
+	SwitchedAt *time.Time `json:"switched_at,omitempty"`
+
+	// Agents are the agents that have connected to this Host (see agents.go)
+	Agents []KnownAgent `json:"agents,omitempty"`
+
+	// Pairings are the agents paired with this Host (see pairing.go)
+	Pairings []Pairing `json:"pairings,omitempty"`
+
+	// DDCProbes are DDC/CI probe results by monitor fingerprint (see probes.go)
+	DDCProbes map[string]DDCProbe `json:"ddc_probes,omitempty"`
+}
+
+// Dir returns the directory config.json and state.json live in
+func (m *Manager) Dir() string {
+	return filepath.Dir(m.configPath)
+}
+
+// statePath returns the path of state.json
+func (m *Manager) statePath() string {
+	return filepath.Join(m.Dir(), "state.json")
+}
+
+// loadState reads state.json. A missing or corrupt file leaves the state
+// seeded from the configuration. Callers must hold m.mu.
+func (m *Manager) loadState() {
+	m.state = State{CurrentProfile: m.config.General.CurrentProfile}
+
+	data, err := os.ReadFile(m.statePath())
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		logging.Errorf("Config: Failed to read runtime state: %v", err)
+		return
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		logging.Warnf("Config: Ignoring corrupt runtime state %s: %v", m.statePath(), err)
+		return
+	}
+	m.state = state
+	if m.state.CurrentProfile != "" {
+		logging.Infof("Config: Restored runtime state (profile '%s')", m.state.CurrentProfile)
+	}
+}
+
+// GetState returns a copy of the runtime state
+func (m *Manager) GetState() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.state
+	state.Agents = slices.Clone(state.Agents)
+	state.Pairings = slices.Clone(state.Pairings)
+	state.DDCProbes = maps.Clone(state.DDCProbes)
+	return state
+}
+
+// UpdateState applies update to the runtime state and persists it
+func (m *Manager) UpdateState(update func(*State)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	update(&m.state)
+	data, err := json.MarshalIndent(m.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.statePath(), data)
+}
+
+// writeFileAtomic replaces path with data so that a crash leaves either the
+// old or the new file, never a truncated one. The file is readable by its
+// owner only: the config holds the API token and the state the pairings.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
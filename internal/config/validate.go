@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Validate checks a configuration received from elsewhere (API, sync) before
+// it is applied. All problems found are returned joined into one error.
+func (c *Config) Validate() error {
+	var errs []error
+
+	seen := make(map[string]bool, len(c.Profiles))
+	for _, p := range c.Profiles {
+		switch {
+		case p.Name == "":
+			errs = append(errs, errors.New("profiles: profile without a name"))
+		case seen[p.Name]:
+			errs = append(errs, fmt.Errorf("profiles: duplicate profile %s", p.Name))
+		}
+		seen[p.Name] = true
+
+		if p.Schedule != "" {
+			if _, err := time.Parse("15:04", p.Schedule); err != nil {
+				errs = append(errs, fmt.Errorf("profiles: %s: invalid schedule %q (want HH:MM)", p.Name, p.Schedule))
+			}
+		}
+		switch p.SwitchMode {
+		case "", "local", "remote", "both":
+		default:
+			errs = append(errs, fmt.Errorf("profiles: %s: invalid switch mode %q", p.Name, p.SwitchMode))
+		}
+	}
+
+	for _, r := range c.Rules {
+		if err := r.validate(seen); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	plugins := make(map[string]bool)
+	for _, p := range c.Plugins {
+		if err := p.validate(plugins); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	g := c.General
+	switch g.Role {
+	case "", "host":
+	case "agent":
+		if g.CoordinatorAddr == "" {
+			errs = append(errs, errors.New("general: agents need a coordinator address"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("general: invalid role %q (want \"host\" or \"agent\")", g.Role))
+	}
+	switch g.BatterySaver {
+	case "", "auto", "always", "never":
+	default:
+		errs = append(errs, fmt.Errorf("general: invalid battery saver mode %q (want auto, always or never)", g.BatterySaver))
+	}
+	switch g.LogLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("general: invalid log level %q (want debug, info, warn or error)", g.LogLevel))
+	}
+	if !validFingerprint(g.CoordinatorCertSHA256) {
+		errs = append(errs, fmt.Errorf("general: invalid certificate fingerprint %q (want 64 hex digits)", g.CoordinatorCertSHA256))
+	}
+	if g.APIRequireTLS && !g.APITLS {
+		errs = append(errs, errors.New("general: requiring TLS needs the API to serve TLS (api_tls)"))
+	}
+	for _, mc := range c.Machines {
+		if !validFingerprint(mc.CertSHA256) {
+			errs = append(errs, fmt.Errorf("machines: %s: invalid certificate fingerprint %q (want 64 hex digits)", mc.Name, mc.CertSHA256))
+		}
+	}
+	if g.APIPort < 0 || g.APIPort > 65535 {
+		errs = append(errs, fmt.Errorf("general: invalid API port %d", g.APIPort))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validFingerprint reports whether pin is empty or a SHA-256 fingerprint, with
+// or without colons
+func validFingerprint(pin string) bool {
+	pin = strings.ReplaceAll(pin, ":", "")
+	if pin == "" {
+		return true
+	}
+	_, err := hex.DecodeString(pin)
+	return err == nil && len(pin) == 64
+}
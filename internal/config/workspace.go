@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"vkvm/internal/logging"
+)
+
+// Workspace bundles everything that differs between desks (profiles,
+// monitors, named machines and hotkeys) so a whole setup can be exported,
+// shared and applied in one step
+type Workspace struct {
+	// Name identifies the workspace (e.g. "home", "office")
+	Name string `json:"name"`
+
+	Profiles []Profile        `json:"profiles"`
+	Monitors []MonitorInfo    `json:"monitors,omitempty"`
+	Machines []Machine        `json:"machines,omitempty"`
+	Hotkeys  WorkspaceHotkeys `json:"hotkeys"`
+}
+
+// WorkspaceHotkeys are the global hotkeys of a workspace; profile hotkeys
+// are part of its profiles
+type WorkspaceHotkeys struct {
+	SettingsHotkey       string `json:"settings_hotkey,omitempty"`
+	SleepHotkey          string `json:"sleep_hotkey,omitempty"`
+	BrightnessUpHotkey   string `json:"brightness_up_hotkey,omitempty"`
+	BrightnessDownHotkey string `json:"brightness_down_hotkey,omitempty"`
+}
+
+// Validate checks that a workspace can be applied
+func (ws *Workspace) Validate() error {
+	if ws.Name == "" {
+		return fmt.Errorf("workspace has no name")
+	}
+	seen := make(map[string]bool, len(ws.Profiles))
+	for _, p := range ws.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("workspace %s: profile without a name", ws.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("workspace %s: duplicate profile %s", ws.Name, p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+// CurrentWorkspace returns the current setup as a workspace named name
+func (m *Manager) CurrentWorkspace(name string) Workspace {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g := m.config.General
+	return cloneWorkspace(Workspace{
+		Name:     name,
+		Profiles: m.config.Profiles,
+		Monitors: m.config.Monitors,
+		Machines: m.config.Machines,
+		Hotkeys: WorkspaceHotkeys{
+			SettingsHotkey:       g.SettingsHotkey,
+			SleepHotkey:          g.SleepHotkey,
+			BrightnessUpHotkey:   g.BrightnessUpHotkey,
+			BrightnessDownHotkey: g.BrightnessDownHotkey,
+		},
+	})
+}
+
+// SaveWorkspace stores ws (replacing a workspace of the same name) and saves the config
+func (m *Manager) SaveWorkspace(ws Workspace) error {
+	if err := ws.Validate(); err != nil {
+		return err
+	}
+	ws = cloneWorkspace(ws)
+
+	m.mu.Lock()
+	i := slices.IndexFunc(m.config.Workspaces, func(w Workspace) bool {
+		return strings.EqualFold(w.Name, ws.Name)
+	})
+	if i >= 0 {
+		m.config.Workspaces[i] = ws
+	} else {
+		m.config.Workspaces = append(m.config.Workspaces, ws)
+	}
+	m.mu.Unlock()
+
+	logging.Infof("Config: Saved workspace '%s' (%d profiles)", ws.Name, len(ws.Profiles))
+	return m.Save()
+}
+
+// UseWorkspace replaces the profiles, monitors, machines and global hotkeys
+// with those of the named stored workspace (case-insensitive) in one step,
+// then saves the config and notifies the change callback
+func (m *Manager) UseWorkspace(name string) error {
+	m.mu.Lock()
+	i := slices.IndexFunc(m.config.Workspaces, func(w Workspace) bool {
+		return strings.EqualFold(w.Name, name)
+	})
+	if i < 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("workspace not found: %s", name)
+	}
+	ws := cloneWorkspace(m.config.Workspaces[i])
+	if err := ws.Validate(); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	old := m.config.Clone()
+
+	m.config.Profiles = ws.Profiles
+	m.config.Monitors = ws.Monitors
+	m.config.Machines = ws.Machines
+	g := &m.config.General
+	g.SettingsHotkey = ws.Hotkeys.SettingsHotkey
+	g.SleepHotkey = ws.Hotkeys.SleepHotkey
+	g.BrightnessUpHotkey = ws.Hotkeys.BrightnessUpHotkey
+	g.BrightnessDownHotkey = ws.Hotkeys.BrightnessDownHotkey
+	g.Workspace = ws.Name
+	change := diffConfig(old, m.config)
+	m.mu.Unlock()
+
+	logging.Infof("Config: Using workspace '%s' (%d profiles), changed %s", ws.Name, len(ws.Profiles), change)
+	if err := m.Save(); err != nil {
+		return err
+	}
+	m.notifyChanged(change)
+	return nil
+}
+
+// cloneWorkspace copies ws so that the copy shares no slices or maps with it
+func cloneWorkspace(ws Workspace) Workspace {
+	ws.Profiles = cloneProfiles(ws.Profiles)
+	ws.Monitors = cloneMonitors(ws.Monitors)
+	ws.Machines = slices.Clone(ws.Machines)
+	return ws
+}
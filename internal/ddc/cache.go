@@ -0,0 +1,127 @@
+package ddc
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// DefaultInputCacheTTL is how long an input-source reading is reused
+const DefaultInputCacheTTL = 2 * time.Second
+
+// cachedInput is one input-source reading
+type cachedInput struct {
+	input InputSource
+	at    time.Time
+}
+
+// cachedController wraps a Controller and reuses recent input-source reads,
+// since every read is a slow round trip over the monitor's I2C bus. Any write
+// to a monitor drops its cached value.
+type cachedController struct {
+	Controller
+	ttl time.Duration
+
+	mu     sync.Mutex
+	inputs map[string]cachedInput
+
+	// gens counts invalidations per monitor. A read only stores its result if
+	// no write invalidated the monitor while it ran, so a slow read started
+	// before a switch cannot cache the pre-switch input.
+	gens map[string]uint64
+}
+
+// newCachedController wraps ctrl with an input-source cache
+func newCachedController(ctrl Controller, ttl time.Duration) *cachedController {
+	return &cachedController{
+		Controller: ctrl,
+		ttl:        ttl,
+		inputs:     make(map[string]cachedInput),
+		gens:       make(map[string]uint64),
+	}
+}
+
+// ListMonitors returns all connected monitors and refreshes the cache from them
+func (c *cachedController) ListMonitors() ([]Monitor, error) {
+	c.mu.Lock()
+	gens := maps.Clone(c.gens)
+	c.mu.Unlock()
+
+	monitors, err := c.Controller.ListMonitors()
+
+	c.mu.Lock()
+	now := time.Now()
+	for _, m := range monitors {
+		if m.DDCSupported && m.InputSource != 0 && c.gens[m.ID] == gens[m.ID] {
+			c.inputs[m.ID] = cachedInput{input: m.InputSource, at: now}
+		}
+	}
+	c.mu.Unlock()
+
+	return monitors, err
+}
+
+// GetCurrentInput returns a cached reading if it is fresh enough
+func (c *cachedController) GetCurrentInput(monitorID string) (InputSource, error) {
+	c.mu.Lock()
+	if e, ok := c.inputs[monitorID]; ok && time.Since(e.at) < c.ttl {
+		c.mu.Unlock()
+		return e.input, nil
+	}
+	gen := c.gens[monitorID]
+	c.mu.Unlock()
+
+	input, err := c.Controller.GetCurrentInput(monitorID)
+	if err != nil {
+		return input, err
+	}
+
+	c.mu.Lock()
+	if c.gens[monitorID] == gen {
+		c.inputs[monitorID] = cachedInput{input: input, at: time.Now()}
+	}
+	c.mu.Unlock()
+	return input, nil
+}
+
+// SetInputSource switches a monitor and invalidates its cached reading
+func (c *cachedController) SetInputSource(monitorID string, source InputSource) error {
+	defer c.invalidate(monitorID)
+	return c.Controller.SetInputSource(monitorID, source)
+}
+
+// SetPower sets the monitor power state and invalidates its cached reading
+func (c *cachedController) SetPower(monitorID string, on bool) error {
+	defer c.invalidate(monitorID)
+	return c.Controller.SetPower(monitorID, on)
+}
+
+// invalidate drops the cached reading for a monitor and makes reads in
+// progress discard theirs
+func (c *cachedController) invalidate(monitorID string) {
+	c.mu.Lock()
+	delete(c.inputs, monitorID)
+	c.gens[monitorID]++
+	c.mu.Unlock()
+}
+
+// GetVCP reads a VCP code (never cached)
+func (c *cachedController) GetVCP(monitorID string, code byte) (int, error) {
+	vc, err := AsVCP(c.Controller)
+	if err != nil {
+		return 0, err
+	}
+	return vc.GetVCP(monitorID, code)
+}
+
+// SetVCP writes a VCP code, invalidating the cached input when it changes
+func (c *cachedController) SetVCP(monitorID string, code byte, value int) error {
+	vc, err := AsVCP(c.Controller)
+	if err != nil {
+		return err
+	}
+	if code == VCPInputSource || code == VCPPowerMode {
+		defer c.invalidate(monitorID)
+	}
+	return vc.SetVCP(monitorID, code, value)
+}
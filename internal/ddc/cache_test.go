@@ -0,0 +1,136 @@
+package ddc
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeController is a monitor backend that counts reads and writes. While
+// block is set, reads signal it once they have started and wait on it to
+// finish.
+type fakeController struct {
+	mu     sync.Mutex
+	input  InputSource
+	reads  int
+	writes []time.Time
+	block  chan struct{}
+}
+
+func (f *fakeController) ListMonitors() ([]Monitor, error) { return nil, nil }
+
+func (f *fakeController) GetCurrentInput(string) (InputSource, error) {
+	f.mu.Lock()
+	f.reads++
+	input, block := f.input, f.block
+	f.mu.Unlock()
+
+	if block != nil {
+		block <- struct{}{}
+		<-block
+	}
+	return input, nil
+}
+
+func (f *fakeController) SetInputSource(_ string, source InputSource) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.input = source
+	f.writes = append(f.writes, time.Now())
+	return nil
+}
+
+func (f *fakeController) SetPower(string, bool) error { return nil }
+
+func (f *fakeController) TestDDCSupport(string) bool { return true }
+
+func (f *fakeController) readCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads
+}
+
+func TestCacheReusesReads(t *testing.T) {
+	fake := &fakeController{input: InputSourceDP1}
+	c := newCachedController(fake, time.Hour)
+
+	for range 3 {
+		if input, err := c.GetCurrentInput("m1"); err != nil || input != InputSourceDP1 {
+			t.Fatalf("GetCurrentInput = %v, %v", input, err)
+		}
+	}
+	if n := fake.readCount(); n != 1 {
+		t.Errorf("%d backend reads, want 1", n)
+	}
+
+	// A write drops the cached reading
+	if err := c.SetInputSource("m1", InputSourceHDMI1); err != nil {
+		t.Fatal(err)
+	}
+	if input, _ := c.GetCurrentInput("m1"); input != InputSourceHDMI1 {
+		t.Errorf("after a write read %v, want %v", input, InputSourceHDMI1)
+	}
+	if n := fake.readCount(); n != 2 {
+		t.Errorf("%d backend reads, want 2", n)
+	}
+}
+
+// A read that started before a switch must not cache the pre-switch input
+func TestCacheDropsReadRacingWrite(t *testing.T) {
+	fake := &fakeController{input: InputSourceDP1, block: make(chan struct{})}
+	c := newCachedController(fake, time.Hour)
+
+	read := make(chan InputSource)
+	go func() {
+		input, _ := c.GetCurrentInput("m1")
+		read <- input
+	}()
+	<-fake.block // the read has reached the backend
+
+	if err := c.SetInputSource("m1", InputSourceHDMI1); err != nil {
+		t.Fatal(err)
+	}
+	fake.block <- struct{}{}
+	if input := <-read; input != InputSourceDP1 {
+		t.Fatalf("slow read returned %v, want %v", input, InputSourceDP1)
+	}
+
+	fake.mu.Lock()
+	fake.block = nil
+	fake.mu.Unlock()
+	if input, _ := c.GetCurrentInput("m1"); input != InputSourceHDMI1 {
+		t.Errorf("next read returned %v, want %v", input, InputSourceHDMI1)
+	}
+	if n := fake.readCount(); n != 2 {
+		t.Errorf("%d backend reads, want 2 (the next read must not come from the cache)", n)
+	}
+}
+
+func TestThrottleSpacesWrites(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	fake := &fakeController{}
+	c := newThrottledController(fake, interval)
+
+	for _, source := range []InputSource{InputSourceDP1, InputSourceHDMI1, InputSourceDP1} {
+		if err := c.SetInputSource("m1", source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.mu.Lock()
+	writes := append([]time.Time(nil), fake.writes...)
+	fake.mu.Unlock()
+	for i := 1; i < len(writes); i++ {
+		if gap := writes[i].Sub(writes[i-1]); gap < interval {
+			t.Errorf("write %d came %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+
+	// Other monitors don't wait for m1
+	start := time.Now()
+	if err := c.SetInputSource("m2", InputSourceDP1); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= interval {
+		t.Errorf("first write to m2 waited %v", d)
+	}
+}
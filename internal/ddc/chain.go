@@ -0,0 +1,235 @@
+package ddc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"vkvm/internal/logging"
+)
+
+// backend is a registered Controller implementation
+type backend struct {
+	name     string
+	priority int
+	factory  func(Options) (Controller, error)
+}
+
+var (
+	backendsMu sync.Mutex
+	backends   []backend
+)
+
+// RegisterBackend makes a controller implementation available to NewController.
+// Lower priority values are tried first. Platform files call this from init().
+func RegisterBackend(name string, priority int, factory func(Options) (Controller, error)) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends = append(backends, backend{name: name, priority: priority, factory: factory})
+}
+
+// namedController is an initialized backend
+type namedController struct {
+	name string
+	Controller
+}
+
+// chainController tries several backends in priority order for each monitor
+// and remembers which one last worked, since some monitors only respond to
+// one of them (e.g. native API vs. external tool).
+type chainController struct {
+	backends []namedController
+
+	mu        sync.Mutex
+	preferred map[string]int // monitor ID -> index into backends
+}
+
+// newChainController initializes every registered backend that is usable on this machine
+func newChainController(opts Options) (Controller, error) {
+	backendsMu.Lock()
+	registered := make([]backend, len(backends))
+	copy(registered, backends)
+	backendsMu.Unlock()
+
+	if len(registered) == 0 {
+		return nil, ErrUnsupportedPlatform
+	}
+	sort.SliceStable(registered, func(i, j int) bool {
+		return registered[i].priority < registered[j].priority
+	})
+
+	c := &chainController{preferred: make(map[string]int)}
+	var lastErr error
+	for _, b := range registered {
+		ctrl, err := b.factory(opts)
+		if err != nil {
+			logging.Infof("DDC: Backend %s unavailable: %v", b.name, err)
+			lastErr = err
+			continue
+		}
+		logging.Infof("DDC: Backend %s ready", b.name)
+		c.backends = append(c.backends, namedController{name: b.name, Controller: ctrl})
+	}
+
+	if len(c.backends) == 0 {
+		return nil, lastErr
+	}
+	return c, nil
+}
+
+// ListMonitors merges the monitors reported by all backends. When several
+// backends see the same monitor ID, the highest-priority one's details win.
+func (c *chainController) ListMonitors() ([]Monitor, error) {
+	var monitors []Monitor
+	seen := make(map[string]bool)
+	var lastErr error
+	anyOK := false
+
+	for idx, b := range c.backends {
+		list, err := b.ListMonitors()
+		if err != nil {
+			logging.Errorf("DDC: Backend %s failed to list monitors: %v", b.name, err)
+			lastErr = err
+			if list == nil {
+				continue
+			}
+		} else {
+			anyOK = true
+		}
+
+		for _, m := range list {
+			if seen[m.ID] {
+				continue
+			}
+			seen[m.ID] = true
+
+			c.mu.Lock()
+			if _, ok := c.preferred[m.ID]; !ok && m.DDCSupported {
+				c.preferred[m.ID] = idx
+			}
+			if pref, ok := c.preferred[m.ID]; ok {
+				m.Backend = c.backends[pref].name
+			} else {
+				m.Backend = b.name
+			}
+			c.mu.Unlock()
+
+			monitors = append(monitors, m)
+		}
+	}
+
+	assignLabels(monitors)
+
+	if !anyOK {
+		return monitors, lastErr
+	}
+	return monitors, nil
+}
+
+// order returns backend indices for a monitor, remembered backend first
+func (c *chainController) order(monitorID string) []int {
+	c.mu.Lock()
+	pref, ok := c.preferred[monitorID]
+	c.mu.Unlock()
+
+	order := make([]int, 0, len(c.backends))
+	if ok {
+		order = append(order, pref)
+	}
+	for i := range c.backends {
+		if !ok || i != pref {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// remember records the backend that just worked for a monitor
+func (c *chainController) remember(monitorID string, idx int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.preferred[monitorID]; !ok || prev != idx {
+		logging.Debugf("DDC: Using backend %s for monitor %s", c.backends[idx].name, monitorID)
+	}
+	c.preferred[monitorID] = idx
+}
+
+// try runs op against each backend in order until one succeeds
+func (c *chainController) try(monitorID string, op func(Controller) error) error {
+	var errs []error
+	for _, idx := range c.order(monitorID) {
+		b := c.backends[idx]
+		if err := op(b.Controller); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, err))
+			continue
+		}
+		c.remember(monitorID, idx)
+		return nil
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("all DDC backends failed: %w", errors.Join(errs...))
+}
+
+// GetCurrentInput gets the current input source for a monitor
+func (c *chainController) GetCurrentInput(monitorID string) (InputSource, error) {
+	var input InputSource
+	err := c.try(monitorID, func(ctrl Controller) error {
+		var err error
+		input, err = ctrl.GetCurrentInput(monitorID)
+		return err
+	})
+	return input, err
+}
+
+// SetInputSource switches a monitor to the specified input
+func (c *chainController) SetInputSource(monitorID string, source InputSource) error {
+	return c.try(monitorID, func(ctrl Controller) error {
+		return ctrl.SetInputSource(monitorID, source)
+	})
+}
+
+// SetPower sets the monitor power state
+func (c *chainController) SetPower(monitorID string, on bool) error {
+	return c.try(monitorID, func(ctrl Controller) error {
+		return ctrl.SetPower(monitorID, on)
+	})
+}
+
+// TestDDCSupport reports whether any backend can talk to the monitor
+func (c *chainController) TestDDCSupport(monitorID string) bool {
+	err := c.try(monitorID, func(ctrl Controller) error {
+		if !ctrl.TestDDCSupport(monitorID) {
+			return ErrDDCNotSupported
+		}
+		return nil
+	})
+	return err == nil
+}
+
+// GetVCP reads a VCP code through the first backend that supports it
+func (c *chainController) GetVCP(monitorID string, code byte) (int, error) {
+	var value int
+	err := c.try(monitorID, func(ctrl Controller) error {
+		vc, err := AsVCP(ctrl)
+		if err != nil {
+			return err
+		}
+		value, err = vc.GetVCP(monitorID, code)
+		return err
+	})
+	return value, err
+}
+
+// SetVCP writes a VCP code through the first backend that supports it
+func (c *chainController) SetVCP(monitorID string, code byte, value int) error {
+	return c.try(monitorID, func(ctrl Controller) error {
+		vc, err := AsVCP(ctrl)
+		if err != nil {
+			return err
+		}
+		return vc.SetVCP(monitorID, code, value)
+	})
+}
@@ -1,7 +1,7 @@
 // Package ddc provides DDC/CI control abstraction for monitor input switching.
 package ddc
 
-import "runtime"
+import "time"
 
 // InputSource represents monitor input sources
 type InputSource int
@@ -22,6 +22,9 @@ type Monitor struct {
 	Serial       string      `json:"serial,omitempty"`
 	InputSource  InputSource `json:"input_source"`
 	DDCSupported bool        `json:"ddc_supported"`
+	Backend      string      `json:"backend,omitempty"`   // Controller backend that handles this monitor
+	Connector    string      `json:"connector,omitempty"` // Output/adapter path the monitor is attached to
+	Label        string      `json:"label,omitempty"`     // Display name, unique even for identical models
 }
 
 // Controller defines the interface for DDC control operations
@@ -42,16 +45,68 @@ type Controller interface {
 	TestDDCSupport(monitorID string) bool
 }
 
-// NewController creates a platform-specific DDC controller
-func NewController() (Controller, error) {
-	switch runtime.GOOS {
-	case "darwin":
-		return newMacController()
-	case "windows":
-		return newWindowsController()
-	default:
-		return nil, ErrUnsupportedPlatform
+// ToolPaths overrides the location of external DDC tools. Empty fields
+// fall back to auto-detection (embedded copy, PATH, well-known locations).
+type ToolPaths struct {
+	ControlMyMonitor string
+	M1DDC            string
+	DDCUtil          string
+}
+
+// DefaultCommandTimeout bounds each external DDC tool invocation
+const DefaultCommandTimeout = 3 * time.Second
+
+// Options configures controller creation
+type Options struct {
+	ToolPaths ToolPaths
+
+	// CommandTimeout bounds each external tool run (0: DefaultCommandTimeout)
+	CommandTimeout time.Duration
+
+	// InputCacheTTL is how long input-source reads are reused
+	// (0: DefaultInputCacheTTL, negative: disabled)
+	InputCacheTTL time.Duration
+
+	// MinWriteInterval is the minimum time between two input writes to the
+	// same monitor (0: DefaultMinWriteInterval, negative: disabled)
+	MinWriteInterval time.Duration
+
+	// Probes, if set, keeps DDC/CI probe results across restarts
+	Probes ProbeCache
+}
+
+// commandTimeout returns the effective per-command timeout
+func (o Options) commandTimeout() time.Duration {
+	if o.CommandTimeout <= 0 {
+		return DefaultCommandTimeout
+	}
+	return o.CommandTimeout
+}
+
+// NewController creates a DDC controller that chains every backend
+// registered for this platform, trying them in priority order per monitor
+func NewController(opts Options) (Controller, error) {
+	ctrl, err := newChainController(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := opts.MinWriteInterval
+	if interval == 0 {
+		interval = DefaultMinWriteInterval
+	}
+	if interval > 0 {
+		ctrl = newThrottledController(ctrl, interval)
+	}
+
+	ttl := opts.InputCacheTTL
+	if ttl == 0 {
+		ttl = DefaultInputCacheTTL
+	}
+	if ttl < 0 {
+		return ctrl, nil
 	}
+	return newCachedController(ctrl, ttl), nil
 }
 
 // InputSourceName returns a human-readable name for the input source
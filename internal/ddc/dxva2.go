@@ -0,0 +1,352 @@
+//go:build windows
+
+package ddc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+
+	"vkvm/internal/logging"
+)
+
+func init() {
+	RegisterBackend("dxva2", 50, func(opts Options) (Controller, error) {
+		c, err := newDXVA2Controller()
+		if err != nil {
+			return nil, err
+		}
+		c.probes = opts.probes("dxva2")
+		return c, nil
+	})
+}
+
+var (
+	modDxva2                                    = windows.NewLazySystemDLL("dxva2.dll")
+	procGetNumberOfPhysicalMonitorsFromHMONITOR = modDxva2.NewProc("GetNumberOfPhysicalMonitorsFromHMONITOR")
+	procGetPhysicalMonitorsFromHMONITOR         = modDxva2.NewProc("GetPhysicalMonitorsFromHMONITOR")
+	procDestroyPhysicalMonitors                 = modDxva2.NewProc("DestroyPhysicalMonitors")
+	procGetVCPFeatureAndVCPFeatureReply         = modDxva2.NewProc("GetVCPFeatureAndVCPFeatureReply")
+	procSetVCPFeature                           = modDxva2.NewProc("SetVCPFeature")
+
+	modUser32               = windows.NewLazySystemDLL("user32.dll")
+	procEnumDisplayMonitors = modUser32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfoW     = modUser32.NewProc("GetMonitorInfoW")
+	procEnumDisplayDevicesW = modUser32.NewProc("EnumDisplayDevicesW")
+)
+
+const (
+	displayDeviceActive        = 0x1 // DISPLAY_DEVICE_ACTIVE
+	eddGetDeviceInterfaceName  = 0x1 // EDD_GET_DEVICE_INTERFACE_NAME
+	physicalMonitorDescription = 128
+)
+
+// physicalMonitor is PHYSICAL_MONITOR
+type physicalMonitor struct {
+	handle      windows.Handle
+	description [physicalMonitorDescription]uint16
+}
+
+// monitorInfoEx is MONITORINFOEXW
+type monitorInfoEx struct {
+	size    uint32
+	monitor [4]int32
+	work    [4]int32
+	flags   uint32
+	device  [32]uint16
+}
+
+// displayDevice is DISPLAY_DEVICEW
+type displayDevice struct {
+	size   uint32
+	name   [32]uint16
+	desc   [128]uint16
+	state  uint32
+	id     [128]uint16
+	regKey [128]uint16
+}
+
+// EnumDisplayMonitors needs a callback, and callbacks can't be freed, so one
+// is shared by every enumeration
+var (
+	enumMu       sync.Mutex
+	enumHandles  []windows.Handle
+	enumCallback = syscall.NewCallback(func(hmon, hdc, rect, data uintptr) uintptr {
+		enumHandles = append(enumHandles, windows.Handle(hmon))
+		return 1
+	})
+)
+
+// dxva2Controller implements Controller for Windows with the Monitor
+// Configuration API (dxva2.dll), talking DDC/CI without an external tool.
+// Monitor IDs are the PnP monitor IDs ControlMyMonitor uses too, so profiles
+// work with either backend.
+type dxva2Controller struct {
+	mu     sync.Mutex // one DDC/CI transaction at a time
+	probes probes
+}
+
+// newDXVA2Controller creates a dxva2 controller if the API is available
+func newDXVA2Controller() (*dxva2Controller, error) {
+	if err := modDxva2.Load(); err != nil {
+		return nil, fmt.Errorf("%w: dxva2.dll: %v", ErrUnsupportedPlatform, err)
+	}
+	if err := procGetVCPFeatureAndVCPFeatureReply.Find(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPlatform, err)
+	}
+	return &dxva2Controller{}, nil
+}
+
+// dxva2Monitor is a monitor with its open physical monitor handle
+type dxva2Monitor struct {
+	Monitor
+	handle windows.Handle
+}
+
+// enumerate opens every physical monitor. The handles are only valid until
+// release is called.
+func (c *dxva2Controller) enumerate() (monitors []dxva2Monitor, release func(), err error) {
+	enumMu.Lock()
+	enumHandles = nil
+	r, _, callErr := procEnumDisplayMonitors.Call(0, 0, enumCallback, 0)
+	hmons := enumHandles
+	enumMu.Unlock()
+	if r == 0 {
+		return nil, func() {}, fmt.Errorf("%w: EnumDisplayMonitors: %v", ErrCommandFailed, callErr)
+	}
+
+	var opened [][]physicalMonitor
+	release = func() {
+		for _, phys := range opened {
+			procDestroyPhysicalMonitors.Call(uintptr(len(phys)), uintptr(unsafe.Pointer(&phys[0])))
+		}
+	}
+
+	for _, hmon := range hmons {
+		info := monitorInfoEx{size: uint32(unsafe.Sizeof(monitorInfoEx{}))}
+		if r, _, _ := procGetMonitorInfoW.Call(uintptr(hmon), uintptr(unsafe.Pointer(&info))); r == 0 {
+			continue
+		}
+		adapter := windows.UTF16ToString(info.device[:])
+
+		var n uint32
+		if r, _, _ := procGetNumberOfPhysicalMonitorsFromHMONITOR.Call(uintptr(hmon), uintptr(unsafe.Pointer(&n))); r == 0 || n == 0 {
+			continue
+		}
+		phys := make([]physicalMonitor, n)
+		if r, _, _ := procGetPhysicalMonitorsFromHMONITOR.Call(uintptr(hmon), uintptr(n), uintptr(unsafe.Pointer(&phys[0]))); r == 0 {
+			continue
+		}
+		opened = append(opened, phys)
+
+		// Physical monitors come in the order of the adapter's attached monitors
+		devices := attachedMonitors(adapter)
+		for i, p := range phys {
+			m := Monitor{Name: windows.UTF16ToString(p.description[:])}
+			if i < len(devices) {
+				d := devices[i]
+				m.ID = d.id
+				m.DeviceName = d.name
+				m.Connector = d.name
+				if name, serial := readEDID(d.interfacePath); name != "" {
+					m.Name, m.Serial = name, serial
+				}
+			} else {
+				m.ID = fmt.Sprintf(`%s\Monitor%d`, adapter, i)
+				m.DeviceName = m.ID
+			}
+			monitors = append(monitors, dxva2Monitor{Monitor: m, handle: p.handle})
+		}
+	}
+
+	// Same addressing rules as ControlMyMonitor for identical models
+	list := make([]Monitor, len(monitors))
+	for i := range monitors {
+		list[i] = monitors[i].Monitor
+	}
+	disambiguateIDs(list)
+	for i := range monitors {
+		monitors[i].ID = list[i].ID
+	}
+	return monitors, release, nil
+}
+
+// attachedMonitor is a monitor device attached to a display adapter
+type attachedMonitor struct {
+	name          string // \\.\DISPLAY1\Monitor0
+	id            string // MONITOR\GSM5B7F\{4d36e96e-...}\0004
+	interfacePath string // \\?\DISPLAY#GSM5B7F#5&2a1b3c&0&UID4352#{e6f07b5f-...}
+}
+
+// attachedMonitors lists the active monitors of a display adapter
+func attachedMonitors(adapter string) []attachedMonitor {
+	name, err := windows.UTF16PtrFromString(adapter)
+	if err != nil {
+		return nil
+	}
+
+	var list []attachedMonitor
+	for i := uint32(0); ; i++ {
+		dd := displayDevice{size: uint32(unsafe.Sizeof(displayDevice{}))}
+		if r, _, _ := procEnumDisplayDevicesW.Call(uintptr(unsafe.Pointer(name)), uintptr(i), uintptr(unsafe.Pointer(&dd)), 0); r == 0 {
+			break
+		}
+		if dd.state&displayDeviceActive == 0 {
+			continue
+		}
+		m := attachedMonitor{name: windows.UTF16ToString(dd.name[:]), id: windows.UTF16ToString(dd.id[:])}
+
+		di := displayDevice{size: uint32(unsafe.Sizeof(displayDevice{}))}
+		if r, _, _ := procEnumDisplayDevicesW.Call(uintptr(unsafe.Pointer(name)), uintptr(i), uintptr(unsafe.Pointer(&di)), eddGetDeviceInterfaceName); r != 0 {
+			m.interfacePath = windows.UTF16ToString(di.id[:])
+		}
+		list = append(list, m)
+	}
+	return list
+}
+
+// readEDID returns the model name and serial number from the EDID Windows
+// stores for a monitor device interface
+func readEDID(interfacePath string) (name, serial string) {
+	// \\?\DISPLAY#GSM5B7F#5&2a1b3c&0&UID4352#{guid} -> DISPLAY\GSM5B7F\5&2a1b3c&0&UID4352
+	parts := strings.Split(strings.TrimPrefix(interfacePath, `\\?\`), "#")
+	if len(parts) < 3 {
+		return "", ""
+	}
+	path := `SYSTEM\CurrentControlSet\Enum\` + strings.Join(parts[:3], `\`) + `\Device Parameters`
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.QUERY_VALUE)
+	if err != nil {
+		return "", ""
+	}
+	defer k.Close()
+	edid, _, err := k.GetBinaryValue("EDID")
+	if err != nil || len(edid) < 128 {
+		return "", ""
+	}
+
+	// Four 18-byte descriptors; display descriptors start with 00 00 00 <tag>
+	for off := 54; off+18 <= 126; off += 18 {
+		d := edid[off : off+18]
+		if d[0] != 0 || d[1] != 0 || d[2] != 0 {
+			continue
+		}
+		text := strings.TrimSpace(string(bytes.TrimRight(bytes.SplitN(d[5:], []byte{0x0A}, 2)[0], "\x00 ")))
+		switch d[3] {
+		case 0xFC:
+			name = text
+		case 0xFF:
+			serial = text
+		}
+	}
+	return name, serial
+}
+
+// withMonitor runs fn with the open handle of the monitor monitorID
+func (c *dxva2Controller) withMonitor(monitorID string, fn func(h windows.Handle) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	monitors, release, err := c.enumerate()
+	defer release()
+	if err != nil {
+		return err
+	}
+	for _, m := range monitors {
+		if m.ID == monitorID {
+			return fn(m.handle)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrMonitorNotFound, monitorID)
+}
+
+// getVCP reads a VCP code through an open handle
+func getVCP(h windows.Handle, code byte) (int, error) {
+	var codeType, current, maximum uint32
+	r, _, err := procGetVCPFeatureAndVCPFeatureReply.Call(uintptr(h), uintptr(code),
+		uintptr(unsafe.Pointer(&codeType)), uintptr(unsafe.Pointer(&current)), uintptr(unsafe.Pointer(&maximum)))
+	if r == 0 {
+		return 0, fmt.Errorf("%w: reading VCP %02X: %v", ErrCommandFailed, code, err)
+	}
+	return int(current), nil
+}
+
+// ListMonitors returns all connected monitors
+func (c *dxva2Controller) ListMonitors() ([]Monitor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found, release, err := c.enumerate()
+	defer release()
+	if err != nil {
+		return nil, err
+	}
+
+	monitors := make([]Monitor, 0, len(found))
+	for _, m := range found {
+		c.probes.probeMonitor(&m.Monitor, func() (InputSource, error) {
+			input, err := getVCP(m.handle, VCPInputSource)
+			if err != nil {
+				logging.Warnf("DDC: dxva2 can't read monitor %s: %v", m.ID, err)
+			}
+			return InputSource(input), err
+		}, nil)
+		monitors = append(monitors, m.Monitor)
+	}
+	return monitors, nil
+}
+
+// GetCurrentInput gets the current input source for a monitor
+func (c *dxva2Controller) GetCurrentInput(monitorID string) (InputSource, error) {
+	value, err := c.GetVCP(monitorID, VCPInputSource)
+	return InputSource(value), err
+}
+
+// SetInputSource switches a monitor to the specified input
+func (c *dxva2Controller) SetInputSource(monitorID string, source InputSource) error {
+	logging.Debugf("DDC: Setting input for %q to %d (dxva2)", monitorID, source)
+	return c.SetVCP(monitorID, VCPInputSource, int(source))
+}
+
+// SetPower sets the monitor power state
+func (c *dxva2Controller) SetPower(monitorID string, on bool) error {
+	// VCP code 0xD6 is Power Mode. 1 = On, 4 = Off/Standby
+	val := 4
+	if on {
+		val = 1
+	}
+	return c.SetVCP(monitorID, VCPPowerMode, val)
+}
+
+// GetVCP reads the current value of a VCP code
+func (c *dxva2Controller) GetVCP(monitorID string, code byte) (int, error) {
+	var value int
+	err := c.withMonitor(monitorID, func(h windows.Handle) error {
+		var err error
+		value, err = getVCP(h, code)
+		return err
+	})
+	return value, err
+}
+
+// SetVCP writes a VCP code
+func (c *dxva2Controller) SetVCP(monitorID string, code byte, value int) error {
+	return c.withMonitor(monitorID, func(h windows.Handle) error {
+		r, _, err := procSetVCPFeature.Call(uintptr(h), uintptr(code), uintptr(uint32(value)))
+		if r == 0 {
+			return fmt.Errorf("%w: writing VCP %02X: %v", ErrCommandFailed, code, err)
+		}
+		return nil
+	})
+}
+
+// TestDDCSupport tests if a monitor supports DDC/CI by trying to read input source
+func (c *dxva2Controller) TestDDCSupport(monitorID string) bool {
+	_, err := c.GetCurrentInput(monitorID)
+	return err == nil
+}
@@ -17,4 +17,7 @@ var (
 
 	// ErrCommandFailed is returned when the external command fails
 	ErrCommandFailed = errors.New("command execution failed")
+
+	// ErrCommandTimeout is returned when an external command is killed after its deadline
+	ErrCommandTimeout = errors.New("command timed out")
 )
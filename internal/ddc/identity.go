@@ -0,0 +1,52 @@
+package ddc
+
+import "fmt"
+
+// assignLabels gives every monitor a human-readable label that is unique
+// across the list. Identical models are told apart by output connector, then
+// by EDID serial, then by position.
+func assignLabels(monitors []Monitor) {
+	groups := make(map[string][]int)
+	for i, m := range monitors {
+		base := m.Name
+		if base == "" {
+			base = m.DeviceName
+		}
+		if base == "" {
+			base = m.ID
+		}
+		monitors[i].Label = base
+		groups[base] = append(groups[base], i)
+	}
+
+	for base, idxs := range groups {
+		if len(idxs) < 2 {
+			continue
+		}
+		connectors := countValues(monitors, idxs, func(m Monitor) string { return m.Connector })
+		serials := countValues(monitors, idxs, func(m Monitor) string { return m.Serial })
+
+		for n, i := range idxs {
+			m := &monitors[i]
+			switch {
+			case m.Connector != "" && connectors[m.Connector] == 1:
+				m.Label = fmt.Sprintf("%s (%s)", base, m.Connector)
+			case m.Serial != "" && serials[m.Serial] == 1:
+				m.Label = fmt.Sprintf("%s (S/N %s)", base, m.Serial)
+			default:
+				m.Label = fmt.Sprintf("%s #%d", base, n+1)
+			}
+		}
+	}
+}
+
+// countValues counts how often each non-empty field value occurs among monitors[idxs]
+func countValues(monitors []Monitor, idxs []int, field func(Monitor) string) map[string]int {
+	counts := make(map[string]int)
+	for _, i := range idxs {
+		if v := field(monitors[i]); v != "" {
+			counts[v]++
+		}
+	}
+	return counts
+}
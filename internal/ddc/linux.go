@@ -0,0 +1,246 @@
+//go:build linux
+
+package ddc
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+func init() {
+	RegisterBackend("ddcutil", 100, func(opts Options) (Controller, error) {
+		c, err := newLinuxController(opts.ToolPaths.DDCUtil, opts.commandTimeout())
+		if err != nil {
+			return nil, err
+		}
+		c.probes = opts.probes("ddcutil")
+		return c, nil
+	})
+}
+
+// detectTimeoutFactor stretches the timeout for "ddcutil detect", which probes
+// every I2C bus and takes a second or more per connected monitor
+const detectTimeoutFactor = 4
+
+// linuxController implements Controller for Linux using ddcutil. Monitors are
+// addressed by I2C bus ("i2c-4"), which ddcutil reaches through /dev/i2c-*.
+type linuxController struct {
+	toolPath string
+	timeout  time.Duration
+	probes   probes
+}
+
+// newLinuxController creates a new Linux DDC controller
+// configuredPath takes precedence over auto-detection when it is valid.
+func newLinuxController(configuredPath string, timeout time.Duration) (*linuxController, error) {
+	if path, ok := configuredTool("ddcutil", configuredPath); ok {
+		return &linuxController{toolPath: path, timeout: timeout}, nil
+	}
+
+	paths := []string{
+		"ddcutil", // In PATH
+		"/usr/bin/ddcutil",
+		"/usr/local/bin/ddcutil",
+	}
+	for _, p := range paths {
+		if path, err := exec.LookPath(p); err == nil {
+			return &linuxController{toolPath: path, timeout: timeout}, nil
+		}
+	}
+
+	return nil, ErrToolNotFound
+}
+
+// output runs ddcutil with the given timeout and returns its stdout
+func (c *linuxController) output(timeout time.Duration, args ...string) ([]byte, error) {
+	var out []byte
+	err := runTool(timeout, c.toolPath, false, args, func(cmd *exec.Cmd) error {
+		var err error
+		out, err = cmd.Output()
+		return err
+	})
+	return out, err
+}
+
+// busArgs returns the ddcutil arguments that address monitorID
+func busArgs(monitorID string) ([]string, error) {
+	bus := strings.TrimPrefix(monitorID, "i2c-")
+	if _, err := strconv.Atoi(bus); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMonitorNotFound, monitorID)
+	}
+	return []string{"--bus", bus}, nil
+}
+
+// ListMonitors returns all connected monitors
+func (c *linuxController) ListMonitors() ([]Monitor, error) {
+	output, err := c.output(c.timeout*detectTimeoutFactor, "detect", "--brief")
+	if err != nil {
+		return nil, commandError(err)
+	}
+
+	monitors, err := c.parseMonitorList(string(output))
+	if err != nil {
+		return monitors, err
+	}
+
+	for i := range monitors {
+		c.probes.probeMonitor(&monitors[i], func() (InputSource, error) {
+			return c.GetCurrentInput(monitors[i].ID)
+		}, nil)
+	}
+	return monitors, nil
+}
+
+var (
+	detectDisplayRegex = regexp.MustCompile(`^(Display \d+|Invalid display)`)
+	detectBusRegex     = regexp.MustCompile(`^I2C bus:\s+/dev/i2c-(\d+)`)
+)
+
+// parseMonitorList parses "ddcutil detect --brief" output:
+//
+//	Display 1
+//	   I2C bus:  /dev/i2c-4
+//	   DRM connector:           card0-DP-1
+//	   Monitor:                 GSM:LG ULTRAGEAR:123456
+//
+// Displays ddcutil reports as invalid (no DDC/CI) are kept but marked unsupported.
+func (c *linuxController) parseMonitorList(output string) ([]Monitor, error) {
+	var monitors []Monitor
+	var cur *Monitor
+	valid := false
+
+	flush := func() {
+		if cur != nil && cur.ID != "" {
+			cur.DDCSupported = valid
+			monitors = append(monitors, *cur)
+		}
+		cur = nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := detectDisplayRegex.FindStringSubmatch(line); m != nil {
+			flush()
+			cur = &Monitor{}
+			valid = strings.HasPrefix(m[1], "Display")
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+
+		if m := detectBusRegex.FindStringSubmatch(line); m != nil {
+			cur.ID = "i2c-" + m[1]
+			cur.DeviceName = "/dev/i2c-" + m[1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "DRM connector":
+			cur.Connector = value
+		case "Monitor":
+			// mfg:model:serial
+			parts := strings.SplitN(value, ":", 3)
+			if len(parts) == 3 {
+				cur.Name = strings.TrimSpace(parts[1])
+				cur.Serial = strings.TrimSpace(parts[2])
+			} else {
+				cur.Name = value
+			}
+		}
+	}
+	flush()
+
+	return monitors, scanner.Err()
+}
+
+// GetCurrentInput gets the current input source for a monitor
+func (c *linuxController) GetCurrentInput(monitorID string) (InputSource, error) {
+	value, err := c.GetVCP(monitorID, VCPInputSource)
+	if err != nil {
+		return 0, err
+	}
+	// Only the low byte selects the input; some monitors set flags in the high byte
+	return InputSource(value & 0xFF), nil
+}
+
+// SetInputSource switches a monitor to the specified input
+func (c *linuxController) SetInputSource(monitorID string, source InputSource) error {
+	logging.Debugf("DDC: Setting input for %s to %d", monitorID, source)
+	return c.SetVCP(monitorID, VCPInputSource, int(source))
+}
+
+// SetPower sets the monitor power state
+func (c *linuxController) SetPower(monitorID string, on bool) error {
+	// VCP code 0xD6 is Power Mode. 1 = On, 4 = Off/Standby
+	val := 4
+	if on {
+		val = 1
+	}
+	return c.SetVCP(monitorID, VCPPowerMode, val)
+}
+
+// GetVCP reads the current value of a VCP code. ddcutil's terse output is
+// "VCP 60 SNC x0f" for non-continuous codes and "VCP 10 C 50 100" for
+// continuous ones.
+func (c *linuxController) GetVCP(monitorID string, code byte) (int, error) {
+	args, err := busArgs(monitorID)
+	if err != nil {
+		return 0, err
+	}
+	output, err := c.output(c.timeout, append(args, "getvcp", fmt.Sprintf("%02X", code), "--terse")...)
+	if err != nil {
+		return 0, commandError(err)
+	}
+
+	fields := strings.Fields(strings.TrimSpace(string(output)))
+	if len(fields) < 4 || fields[0] != "VCP" {
+		return 0, fmt.Errorf("unexpected ddcutil output for VCP %02X: %q", code, strings.TrimSpace(string(output)))
+	}
+	switch fields[2] {
+	case "C":
+		val, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse VCP %02X value: %w", code, err)
+		}
+		return val, nil
+	case "SNC", "CNC":
+		val, err := strconv.ParseInt(strings.TrimPrefix(fields[len(fields)-1], "x"), 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse VCP %02X value: %w", code, err)
+		}
+		return int(val), nil
+	default:
+		return 0, fmt.Errorf("VCP %02X not readable: %s", code, strings.Join(fields[2:], " "))
+	}
+}
+
+// SetVCP writes a VCP code
+func (c *linuxController) SetVCP(monitorID string, code byte, value int) error {
+	args, err := busArgs(monitorID)
+	if err != nil {
+		return err
+	}
+	if _, err := c.output(c.timeout, append(args, "setvcp", fmt.Sprintf("%02X", code), strconv.Itoa(value))...); err != nil {
+		return commandError(err)
+	}
+	return nil
+}
+
+// TestDDCSupport tests if a monitor supports DDC/CI by trying to read input source
+func (c *linuxController) TestDDCSupport(monitorID string) bool {
+	_, err := c.GetCurrentInput(monitorID)
+	return err == nil
+}
@@ -9,25 +9,40 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"vkvm/internal/embedded"
 )
 
-// Stub for Windows on macOS build
-func newWindowsController() (Controller, error) {
-	return nil, ErrUnsupportedPlatform
+func init() {
+	RegisterBackend("m1ddc", 100, func(opts Options) (Controller, error) {
+		c, err := newMacController(opts.ToolPaths.M1DDC, opts.commandTimeout())
+		if err != nil {
+			return nil, err
+		}
+		c.probes = opts.probes("m1ddc")
+		return c, nil
+	})
 }
 
 // macController implements Controller for macOS using m1ddc
 type macController struct {
 	toolPath string
+	embedded bool // toolPath is the extracted embedded copy
+	timeout  time.Duration
+	probes   probes
 }
 
 // newMacController creates a new macOS DDC controller
-func newMacController() (*macController, error) {
+// configuredPath takes precedence over auto-detection when it is valid.
+func newMacController(configuredPath string, timeout time.Duration) (*macController, error) {
+	if path, ok := configuredTool("m1ddc", configuredPath); ok {
+		return &macController{toolPath: path, timeout: timeout}, nil
+	}
+
 	// Try embedded m1ddc first
 	if path, err := embedded.GetToolPath("m1ddc"); err == nil {
-		return &macController{toolPath: path}, nil
+		return &macController{toolPath: path, embedded: true, timeout: timeout}, nil
 	}
 
 	// Fallback to system-installed m1ddc
@@ -39,19 +54,29 @@ func newMacController() (*macController, error) {
 
 	for _, p := range paths {
 		if path, err := exec.LookPath(p); err == nil {
-			return &macController{toolPath: path}, nil
+			return &macController{toolPath: path, timeout: timeout}, nil
 		}
 	}
 
 	return nil, ErrToolNotFound
 }
 
+// output runs m1ddc with the command timeout and returns its stdout
+func (c *macController) output(args ...string) ([]byte, error) {
+	var out []byte
+	err := runTool(c.timeout, c.toolPath, c.embedded, args, func(cmd *exec.Cmd) error {
+		var err error
+		out, err = cmd.Output()
+		return err
+	})
+	return out, err
+}
+
 // ListMonitors returns all connected monitors
 func (c *macController) ListMonitors() ([]Monitor, error) {
-	cmd := exec.Command(c.toolPath, "display", "list")
-	output, err := cmd.Output()
+	output, err := c.output("display", "list")
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrCommandFailed, err)
+		return nil, commandError(err)
 	}
 
 	monitors, err := c.parseMonitorList(string(output))
@@ -59,19 +84,15 @@ func (c *macController) ListMonitors() ([]Monitor, error) {
 		return monitors, err
 	}
 
-	// Test DDC support and get current input for each monitor
+	// Get the current input for each monitor; a monitor that can't be read
+	// may still support DDC/CI (some KVM switches accept writes only)
 	for i := range monitors {
-		monitors[i].DDCSupported = c.TestDDCSupport(monitors[i].ID)
-
-		// Always try to get current input source (even if DDC test failed)
-		// Some KVM switches may support reading but not writing
-		if currentInput, err := c.GetCurrentInput(monitors[i].ID); err == nil {
-			monitors[i].InputSource = currentInput
-			// If we can read input, mark as DDC supported
-			if !monitors[i].DDCSupported {
-				monitors[i].DDCSupported = true
-			}
-		}
+		id := monitors[i].ID
+		c.probes.probeMonitor(&monitors[i], func() (InputSource, error) {
+			return c.GetCurrentInput(id)
+		}, func() bool {
+			return c.TestDDCSupport(id)
+		})
 	}
 
 	return monitors, nil
@@ -95,9 +116,10 @@ func (c *macController) parseMonitorList(output string) ([]Monitor, error) {
 				continue
 			}
 			monitors = append(monitors, Monitor{
-				ID:     matches[3], // Use UUID as ID for more reliable addressing
-				Name:   name,
-				Serial: matches[3], // Keep Serial as UUID too
+				ID:        matches[3], // Use UUID as ID for more reliable addressing
+				Name:      name,
+				Serial:    matches[3], // Keep Serial as UUID too
+				Connector: "display " + matches[1],
 			})
 		}
 	}
@@ -108,10 +130,9 @@ func (c *macController) parseMonitorList(output string) ([]Monitor, error) {
 // GetCurrentInput gets the current input source for a monitor
 func (c *macController) GetCurrentInput(monitorID string) (InputSource, error) {
 	// Use 'm1ddc display <id> get input' syntax which is more robust
-	cmd := exec.Command(c.toolPath, "display", monitorID, "get", "input")
-	output, err := cmd.Output()
+	output, err := c.output("display", monitorID, "get", "input")
 	if err != nil {
-		return 0, fmt.Errorf("%w: %v", ErrCommandFailed, err)
+		return 0, commandError(err)
 	}
 
 	// Parse the output value
@@ -127,9 +148,8 @@ func (c *macController) GetCurrentInput(monitorID string) (InputSource, error) {
 // SetInputSource switches a monitor to the specified input
 func (c *macController) SetInputSource(monitorID string, source InputSource) error {
 	// Use 'm1ddc display <id> set input <val>' syntax
-	cmd := exec.Command(c.toolPath, "display", monitorID, "set", "input", fmt.Sprintf("%d", source))
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("%w: %v", ErrCommandFailed, err)
+	if _, err := c.output("display", monitorID, "set", "input", fmt.Sprintf("%d", source)); err != nil {
+		return commandError(err)
 	}
 	return nil
 }
@@ -145,9 +165,50 @@ func (c *macController) SetPower(monitorID string, on bool) error {
 		val = "1"
 	}
 	// Syntax: m1ddc display <id> set D6 <val>
-	cmd := exec.Command(c.toolPath, "display", monitorID, "set", "D6", val)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("%w: %v", ErrCommandFailed, err)
+	if _, err := c.output("display", monitorID, "set", "D6", val); err != nil {
+		return commandError(err)
+	}
+	return nil
+}
+
+// vcpAttribute maps VCP codes to m1ddc attribute names; other codes are
+// passed as hex, as SetPower does for D6
+func vcpAttribute(code byte) string {
+	switch code {
+	case VCPBrightness:
+		return "luminance"
+	case VCPContrast:
+		return "contrast"
+	case VCPRedGain:
+		return "red"
+	case VCPGreenGain:
+		return "green"
+	case VCPBlueGain:
+		return "blue"
+	case VCPInputSource:
+		return "input"
+	default:
+		return fmt.Sprintf("%02X", code)
+	}
+}
+
+// GetVCP reads the current value of a VCP code
+func (c *macController) GetVCP(monitorID string, code byte) (int, error) {
+	output, err := c.output("display", monitorID, "get", vcpAttribute(code))
+	if err != nil {
+		return 0, commandError(err)
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(string(output)), 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse VCP %02X value: %v", code, err)
+	}
+	return int(value), nil
+}
+
+// SetVCP writes a VCP code
+func (c *macController) SetVCP(monitorID string, code byte, value int) error {
+	if _, err := c.output("display", monitorID, "set", vcpAttribute(code), strconv.Itoa(value)); err != nil {
+		return commandError(err)
 	}
 	return nil
 }
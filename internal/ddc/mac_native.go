@@ -0,0 +1,370 @@
+//go:build darwin
+
+package ddc
+
+/*
+#cgo LDFLAGS: -framework IOKit -framework CoreFoundation -framework CoreGraphics -framework ApplicationServices
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+#include <IOKit/IOKitLib.h>
+#include <CoreFoundation/CoreFoundation.h>
+#include <CoreGraphics/CoreGraphics.h>
+#include <ApplicationServices/ApplicationServices.h>
+
+// IOAVService is private API on Apple Silicon; its functions are looked up at
+// runtime so that a Mac without them reports the backend as unavailable
+// instead of failing to start.
+typedef CFTypeRef IOAVServiceRef;
+typedef IOAVServiceRef (*avCreateFn)(CFAllocatorRef, io_service_t);
+typedef IOReturn (*avReadFn)(IOAVServiceRef, uint32_t, uint32_t, void*, uint32_t);
+typedef IOReturn (*avWriteFn)(IOAVServiceRef, uint32_t, uint32_t, void*, uint32_t);
+typedef CFDictionaryRef (*infoDictFn)(CGDirectDisplayID);
+
+static avCreateFn avCreate;
+static avReadFn avRead;
+static avWriteFn avWrite;
+static infoDictFn displayInfo;
+
+static int avLoad() {
+    dlopen("/System/Library/Frameworks/CoreDisplay.framework/CoreDisplay", RTLD_LAZY);
+    avCreate = (avCreateFn)dlsym(RTLD_DEFAULT, "IOAVServiceCreateWithService");
+    avRead = (avReadFn)dlsym(RTLD_DEFAULT, "IOAVServiceReadI2C");
+    avWrite = (avWriteFn)dlsym(RTLD_DEFAULT, "IOAVServiceWriteI2C");
+    displayInfo = (infoDictFn)dlsym(RTLD_DEFAULT, "CoreDisplay_DisplayCreateInfoDictionary");
+    return avCreate && avRead && avWrite && displayInfo;
+}
+
+typedef struct {
+    char uuid[64];
+    char name[128];
+    IOAVServiceRef service;
+} avDisplay;
+
+// avServiceAt finds the external DCPAVServiceProxy below the framebuffer at
+// location (the display's IODisplayLocation) in the IO registry
+static IOAVServiceRef avServiceAt(const char* location) {
+    io_iterator_t iter;
+    io_registry_entry_t root = IORegistryGetRootEntry(MACH_PORT_NULL);
+    if (IORegistryEntryCreateIterator(root, kIOServicePlane, kIORegistryIterateRecursively, &iter) != KERN_SUCCESS) {
+        IOObjectRelease(root);
+        return NULL;
+    }
+
+    IOAVServiceRef service = NULL;
+    int inDisplay = 0;
+    io_registry_entry_t entry;
+    while (!service && (entry = IOIteratorNext(iter)) != 0) {
+        io_name_t name;
+        if (IORegistryEntryGetName(entry, name) == KERN_SUCCESS) {
+            if (strcmp(name, "AppleCLCD2") == 0 || strcmp(name, "IOMobileFramebufferShim") == 0) {
+                io_string_t path;
+                inDisplay = IORegistryEntryGetPath(entry, kIOServicePlane, path) == KERN_SUCCESS && strcmp(path, location) == 0;
+            } else if (inDisplay && strcmp(name, "DCPAVServiceProxy") == 0) {
+                CFTypeRef loc = IORegistryEntrySearchCFProperty(entry, kIOServicePlane, CFSTR("Location"), kCFAllocatorDefault, kIORegistryIterateRecursively);
+                if (loc) {
+                    if (CFGetTypeID(loc) == CFStringGetTypeID() && CFStringCompare((CFStringRef)loc, CFSTR("External"), 0) == kCFCompareEqualTo) {
+                        service = avCreate(kCFAllocatorDefault, entry);
+                    }
+                    CFRelease(loc);
+                }
+            }
+        }
+        IOObjectRelease(entry);
+    }
+    IOObjectRelease(iter);
+    IOObjectRelease(root);
+    return service;
+}
+
+// avDisplays fills out with the external displays that have an AV service
+// and returns how many were found
+static int avDisplays(avDisplay* out, int max) {
+    CGDirectDisplayID ids[16];
+    uint32_t count = 0;
+    if (CGGetOnlineDisplayList(16, ids, &count) != kCGErrorSuccess) {
+        return -1;
+    }
+
+    int n = 0;
+    for (uint32_t i = 0; i < count && n < max; i++) {
+        if (CGDisplayIsBuiltin(ids[i])) {
+            continue;
+        }
+        CFDictionaryRef info = displayInfo(ids[i]);
+        if (!info) {
+            continue;
+        }
+
+        char location[512] = {0};
+        CFStringRef loc = (CFStringRef)CFDictionaryGetValue(info, CFSTR("IODisplayLocation"));
+        if (!loc || !CFStringGetCString(loc, location, sizeof(location), kCFStringEncodingUTF8)) {
+            CFRelease(info);
+            continue;
+        }
+
+        avDisplay* d = &out[n];
+        memset(d, 0, sizeof(*d));
+        // DisplayProductName maps locales to names; any of them will do
+        CFDictionaryRef names = (CFDictionaryRef)CFDictionaryGetValue(info, CFSTR("DisplayProductName"));
+        if (names && CFGetTypeID(names) == CFDictionaryGetTypeID() && CFDictionaryGetCount(names) > 0) {
+            CFIndex total = CFDictionaryGetCount(names);
+            const void** values = malloc(sizeof(void*) * total);
+            CFDictionaryGetKeysAndValues(names, NULL, values);
+            if (CFGetTypeID(values[0]) == CFStringGetTypeID()) {
+                CFStringGetCString((CFStringRef)values[0], d->name, sizeof(d->name), kCFStringEncodingUTF8);
+            }
+            free(values);
+        }
+        CFRelease(info);
+
+        CFUUIDRef uuid = CGDisplayCreateUUIDFromDisplayID(ids[i]);
+        if (uuid) {
+            CFStringRef s = CFUUIDCreateString(kCFAllocatorDefault, uuid);
+            CFStringGetCString(s, d->uuid, sizeof(d->uuid), kCFStringEncodingUTF8);
+            CFRelease(s);
+            CFRelease(uuid);
+        }
+
+        d->service = avServiceAt(location);
+        if (d->service && d->uuid[0]) {
+            n++;
+        } else if (d->service) {
+            CFRelease(d->service);
+        }
+    }
+    return n;
+}
+
+static IOReturn avWriteI2C(IOAVServiceRef service, uint8_t* data, uint32_t len) {
+    return avWrite(service, 0x37, 0x51, data, len);
+}
+
+static IOReturn avReadI2C(IOAVServiceRef service, uint8_t* data, uint32_t len) {
+    return avRead(service, 0x37, 0, data, len);
+}
+
+static void avRelease(IOAVServiceRef service) {
+    CFRelease(service);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+func init() {
+	RegisterBackend("ioavservice", 50, func(opts Options) (Controller, error) {
+		c, err := newNativeMacController()
+		if err != nil {
+			return nil, err
+		}
+		c.probes = opts.probes("ioavservice")
+		return c, nil
+	})
+}
+
+const (
+	// maxAVDisplays bounds the external displays looked up at once
+	maxAVDisplays = 16
+
+	// ddcWriteDelay and ddcWrites follow m1ddc: each packet is sent twice
+	// with a short pause, since monitors drop single writes now and then
+	ddcWriteDelay = 10 * time.Millisecond
+	ddcWrites     = 2
+
+	// ddcReplyDelay is how long a monitor gets to prepare a VCP reply (DDC/CI: 40ms)
+	ddcReplyDelay = 40 * time.Millisecond
+
+	// ddcReadAttempts retries reads whose reply doesn't match the request
+	ddcReadAttempts = 3
+)
+
+// nativeMacController implements Controller on Apple Silicon by talking
+// DDC/CI through IOAVService directly, without running m1ddc. Monitors are
+// addressed by display UUID like with m1ddc, so profiles work with either.
+type nativeMacController struct {
+	mu       sync.Mutex // one DDC/CI transaction at a time
+	services map[string]C.IOAVServiceRef
+	monitors []Monitor
+	probes   probes
+}
+
+// newNativeMacController creates the controller if IOAVService is available
+func newNativeMacController() (*nativeMacController, error) {
+	if runtime.GOARCH != "arm64" {
+		return nil, fmt.Errorf("%w: IOAVService needs Apple Silicon", ErrUnsupportedPlatform)
+	}
+	if C.avLoad() == 0 {
+		return nil, fmt.Errorf("%w: IOAVService not available on this macOS version", ErrUnsupportedPlatform)
+	}
+	return &nativeMacController{services: make(map[string]C.IOAVServiceRef)}, nil
+}
+
+// refresh looks up the external displays again; callers must hold c.mu
+func (c *nativeMacController) refresh() error {
+	for _, s := range c.services {
+		C.avRelease(s)
+	}
+	c.services = make(map[string]C.IOAVServiceRef)
+	c.monitors = nil
+
+	var displays [maxAVDisplays]C.avDisplay
+	n := int(C.avDisplays(&displays[0], maxAVDisplays))
+	if n < 0 {
+		return fmt.Errorf("%w: failed to list displays", ErrCommandFailed)
+	}
+	for i := 0; i < n; i++ {
+		d := &displays[i]
+		uuid := C.GoString(&d.uuid[0])
+		name := C.GoString(&d.name[0])
+		c.services[uuid] = d.service
+		c.monitors = append(c.monitors, Monitor{
+			ID:        uuid,
+			Name:      name,
+			Serial:    uuid,
+			Connector: fmt.Sprintf("display %d", i+1),
+		})
+	}
+	return nil
+}
+
+// service returns the AV service of a monitor; callers must hold c.mu
+func (c *nativeMacController) service(monitorID string) (s C.IOAVServiceRef, err error) {
+	if s, ok := c.services[monitorID]; ok {
+		return s, nil
+	}
+	// Displays may have been connected since the last lookup
+	if err := c.refresh(); err != nil {
+		return s, err
+	}
+	if s, ok := c.services[monitorID]; ok {
+		return s, nil
+	}
+	return s, fmt.Errorf("%w: %s", ErrMonitorNotFound, monitorID)
+}
+
+// ddcPacket frames a DDC/CI message: length byte, payload, checksum
+func ddcPacket(payload ...byte) []byte {
+	packet := append([]byte{0x80 | byte(len(payload))}, payload...)
+	sum := byte(0x6E ^ 0x51)
+	for _, b := range packet {
+		sum ^= b
+	}
+	return append(packet, sum)
+}
+
+// write sends a DDC/CI packet; callers must hold c.mu
+func (c *nativeMacController) write(s C.IOAVServiceRef, packet []byte) error {
+	var ret C.IOReturn
+	for i := 0; i < ddcWrites; i++ {
+		time.Sleep(ddcWriteDelay)
+		ret = C.avWriteI2C(s, (*C.uint8_t)(unsafe.Pointer(&packet[0])), C.uint32_t(len(packet)))
+	}
+	if ret != 0 {
+		return fmt.Errorf("%w: I2C write failed (IOReturn 0x%x)", ErrCommandFailed, uint32(ret))
+	}
+	return nil
+}
+
+// getVCP reads a VCP code; callers must hold c.mu
+func (c *nativeMacController) getVCP(monitorID string, code byte) (int, error) {
+	s, err := c.service(monitorID)
+	if err != nil {
+		return 0, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < ddcReadAttempts; attempt++ {
+		if err := c.write(s, ddcPacket(0x01, code)); err != nil {
+			return 0, err
+		}
+		time.Sleep(ddcReplyDelay)
+
+		// Reply: source, length, 0x02, result, code, type, max (2), current (2), checksum
+		var reply [12]byte
+		if ret := C.avReadI2C(s, (*C.uint8_t)(unsafe.Pointer(&reply[0])), C.uint32_t(len(reply))); ret != 0 {
+			lastErr = fmt.Errorf("%w: I2C read failed (IOReturn 0x%x)", ErrCommandFailed, uint32(ret))
+			continue
+		}
+		if reply[2] != 0x02 || reply[4] != code {
+			lastErr = fmt.Errorf("%w: unexpected reply to VCP %02X: % x", ErrCommandFailed, code, reply)
+			continue
+		}
+		if reply[3] != 0 {
+			return 0, fmt.Errorf("%w: VCP %02X", ErrDDCNotSupported, code)
+		}
+		return int(reply[8])<<8 | int(reply[9]), nil
+	}
+	return 0, lastErr
+}
+
+// ListMonitors returns all external monitors that have an AV service
+func (c *nativeMacController) ListMonitors() ([]Monitor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	monitors := make([]Monitor, len(c.monitors))
+	copy(monitors, c.monitors)
+	for i := range monitors {
+		c.probes.probeMonitor(&monitors[i], func() (InputSource, error) {
+			input, err := c.getVCP(monitors[i].ID, VCPInputSource)
+			return InputSource(input), err
+		}, nil)
+	}
+	return monitors, nil
+}
+
+// GetCurrentInput gets the current input source for a monitor
+func (c *nativeMacController) GetCurrentInput(monitorID string) (InputSource, error) {
+	value, err := c.GetVCP(monitorID, VCPInputSource)
+	return InputSource(value), err
+}
+
+// SetInputSource switches a monitor to the specified input
+func (c *nativeMacController) SetInputSource(monitorID string, source InputSource) error {
+	return c.SetVCP(monitorID, VCPInputSource, int(source))
+}
+
+// SetPower sets the monitor power state
+func (c *nativeMacController) SetPower(monitorID string, on bool) error {
+	// VCP code 0xD6 is Power Mode. 1 = On, 4 = Off/Standby
+	val := 4
+	if on {
+		val = 1
+	}
+	return c.SetVCP(monitorID, VCPPowerMode, val)
+}
+
+// GetVCP reads the current value of a VCP code
+func (c *nativeMacController) GetVCP(monitorID string, code byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getVCP(monitorID, code)
+}
+
+// SetVCP writes a VCP code
+func (c *nativeMacController) SetVCP(monitorID string, code byte, value int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, err := c.service(monitorID)
+	if err != nil {
+		return err
+	}
+	return c.write(s, ddcPacket(0x03, code, byte(value>>8), byte(value)))
+}
+
+// TestDDCSupport tests if a monitor supports DDC/CI by trying to read input source
+func (c *nativeMacController) TestDDCSupport(monitorID string) bool {
+	_, err := c.GetCurrentInput(monitorID)
+	return err == nil
+}
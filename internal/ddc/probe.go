@@ -0,0 +1,73 @@
+package ddc
+
+import "strings"
+
+// ProbeCache keeps DDC/CI probe results across restarts, keyed by
+// Fingerprint, so monitors are not probed again on every enumeration
+type ProbeCache interface {
+	// DDCProbe returns the stored result for a fingerprint; ok is false if
+	// the monitor must be probed
+	DDCProbe(fingerprint string) (supported, ok bool)
+
+	// SetDDCProbe stores a probe result
+	SetDDCProbe(fingerprint string, supported bool)
+}
+
+// Fingerprint identifies a monitor to a backend by its EDID name and serial.
+// Monitors whose backend reports no serial fall back to the monitor ID.
+func Fingerprint(backend string, m Monitor) string {
+	unit := m.Serial
+	if unit == "" {
+		unit = m.ID
+	}
+	return strings.Join([]string{backend, m.Name, unit}, "|")
+}
+
+// probes is a backend's view of the ProbeCache; the zero value caches nothing
+type probes struct {
+	cache   ProbeCache
+	backend string
+}
+
+// probes returns the probe cache view for a backend
+func (o Options) probes(backend string) probes {
+	return probes{cache: o.Probes, backend: backend}
+}
+
+// lookup returns the cached result for m; known is false if m must be probed
+func (p probes) lookup(m Monitor) (supported, known bool) {
+	if p.cache == nil {
+		return false, false
+	}
+	return p.cache.DDCProbe(Fingerprint(p.backend, m))
+}
+
+// record stores the probe result for m
+func (p probes) record(m Monitor, supported bool) {
+	if p.cache != nil {
+		p.cache.SetDDCProbe(Fingerprint(p.backend, m), supported)
+	}
+}
+
+// probeMonitor fills m's input source and DDC support using read, skipping
+// monitors the cache knows don't answer. When read fails on a monitor that
+// was never probed, test (if not nil) decides whether it supports DDC/CI; a
+// cached supported monitor stays supported (e.g. while it is asleep).
+func (p probes) probeMonitor(m *Monitor, read func() (InputSource, error), test func() bool) {
+	supported, known := p.lookup(*m)
+	if known && !supported {
+		return
+	}
+
+	input, err := read()
+	if err == nil {
+		m.InputSource = input
+		supported = true
+	} else if !known && test != nil {
+		supported = test()
+	}
+	m.DDCSupported = m.DDCSupported || supported
+	if !known {
+		p.record(*m, m.DDCSupported)
+	}
+}
@@ -0,0 +1,90 @@
+package ddc
+
+import (
+	"sync"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// DefaultMinWriteInterval is the minimum time between two input writes to the same monitor
+const DefaultMinWriteInterval = 500 * time.Millisecond
+
+// throttledController wraps a Controller and spaces out input-source writes
+// per monitor, since some monitor firmware gets confused (or stuck between
+// inputs) when switched again before it has settled
+type throttledController struct {
+	Controller
+	interval time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex // serializes writes per monitor
+	last  map[string]time.Time   // time of the last input write per monitor
+}
+
+// newThrottledController wraps ctrl with a per-monitor input write limit
+func newThrottledController(ctrl Controller, interval time.Duration) *throttledController {
+	return &throttledController{
+		Controller: ctrl,
+		interval:   interval,
+		locks:      make(map[string]*sync.Mutex),
+		last:       make(map[string]time.Time),
+	}
+}
+
+// SetInputSource switches a monitor, waiting first if it was switched too recently
+func (c *throttledController) SetInputSource(monitorID string, source InputSource) error {
+	unlock := c.wait(monitorID)
+	defer unlock()
+	return c.Controller.SetInputSource(monitorID, source)
+}
+
+// wait blocks until monitorID may be written again. The returned function
+// records the write and must be called once it is done.
+func (c *throttledController) wait(monitorID string) func() {
+	c.mu.Lock()
+	lock, ok := c.locks[monitorID]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.locks[monitorID] = lock
+	}
+	c.mu.Unlock()
+
+	lock.Lock()
+	c.mu.Lock()
+	delay := time.Until(c.last[monitorID].Add(c.interval))
+	c.mu.Unlock()
+	if delay > 0 {
+		logging.Debugf("DDC: Monitor %s was switched %v ago, waiting %v", monitorID, c.interval-delay, delay)
+		time.Sleep(delay)
+	}
+
+	return func() {
+		c.mu.Lock()
+		c.last[monitorID] = time.Now()
+		c.mu.Unlock()
+		lock.Unlock()
+	}
+}
+
+// GetVCP reads a VCP code
+func (c *throttledController) GetVCP(monitorID string, code byte) (int, error) {
+	vc, err := AsVCP(c.Controller)
+	if err != nil {
+		return 0, err
+	}
+	return vc.GetVCP(monitorID, code)
+}
+
+// SetVCP writes a VCP code; input source writes are throttled like SetInputSource
+func (c *throttledController) SetVCP(monitorID string, code byte, value int) error {
+	vc, err := AsVCP(c.Controller)
+	if err != nil {
+		return err
+	}
+	if code == VCPInputSource {
+		unlock := c.wait(monitorID)
+		defer unlock()
+	}
+	return vc.SetVCP(monitorID, code, value)
+}
@@ -0,0 +1,120 @@
+package ddc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"vkvm/internal/embedded"
+	"vkvm/internal/logging"
+)
+
+// ValidateToolPath checks that a configured tool path points to an executable file
+func ValidateToolPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrToolNotFound, path)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: %s is a directory", ErrToolNotFound, path)
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		return fmt.Errorf("%s is not executable: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks every configured tool path and returns all problems found
+func (p ToolPaths) Validate() error {
+	var errs []error
+	for _, t := range []struct{ name, path string }{
+		{"ControlMyMonitor", p.ControlMyMonitor},
+		{"m1ddc", p.M1DDC},
+		{"ddcutil", p.DDCUtil},
+	} {
+		if t.path == "" {
+			continue
+		}
+		if err := ValidateToolPath(t.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// configuredTool returns the user-configured path for a tool if it is usable
+func configuredTool(name, path string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+	if err := ValidateToolPath(path); err != nil {
+		logging.Warnf("DDC: Ignoring configured %s path: %v", name, err)
+		return "", false
+	}
+	logging.Infof("DDC: Using configured %s at %s", name, path)
+	return path, true
+}
+
+// CommandStats counts external DDC tool invocations since startup
+type CommandStats struct {
+	Runs     uint64 `json:"runs"`
+	Failures uint64 `json:"failures"`
+	Timeouts uint64 `json:"timeouts"`
+}
+
+var cmdRuns, cmdFailures, cmdTimeouts atomic.Uint64
+
+// Stats returns the external command counters
+func Stats() CommandStats {
+	return CommandStats{
+		Runs:     cmdRuns.Load(),
+		Failures: cmdFailures.Load(),
+		Timeouts: cmdTimeouts.Load(),
+	}
+}
+
+// runTool executes an external tool, killing it once timeout elapses. Embedded
+// binaries are re-checked against their pinned checksum before every run. fn
+// receives the prepared command and is responsible for running it, so callers
+// can pick Run, Output or CombinedOutput and inspect exit codes.
+func runTool(timeout time.Duration, path string, isEmbedded bool, args []string, fn func(cmd *exec.Cmd) error) error {
+	if isEmbedded {
+		if err := embedded.Verify(path); err != nil {
+			return fmt.Errorf("%w: %v", ErrCommandFailed, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	// Don't wait forever on pipes held open by a killed process's children
+	cmd.WaitDelay = time.Second
+
+	cmdRuns.Add(1)
+	err := fn(cmd)
+	// Checked first: fn may swallow the kill as an ordinary exit code
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		cmdTimeouts.Add(1)
+		logging.Warnf("DDC: %s %v killed after %v", filepath.Base(path), args, timeout)
+		return fmt.Errorf("%w after %v: %s", ErrCommandTimeout, timeout, filepath.Base(path))
+	}
+	if err != nil {
+		cmdFailures.Add(1)
+	}
+	return err
+}
+
+// commandError wraps a tool failure in ErrCommandFailed while keeping
+// timeouts distinguishable via ErrCommandTimeout
+func commandError(err error) error {
+	if errors.Is(err, ErrCommandTimeout) || errors.Is(err, ErrCommandFailed) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrCommandFailed, err)
+}
@@ -0,0 +1,74 @@
+package ddc
+
+import (
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// Standard MCCS VCP codes
+const (
+	VCPBrightness  byte = 0x10
+	VCPContrast    byte = 0x12
+	VCPColorPreset byte = 0x14
+	VCPRedGain     byte = 0x16
+	VCPGreenGain   byte = 0x18
+	VCPBlueGain    byte = 0x1A
+	VCPInputSource byte = 0x60
+	VCPPowerMode   byte = 0xD6
+)
+
+// VCPController is implemented by controllers that can read and write
+// arbitrary VCP codes in addition to the Controller basics
+type VCPController interface {
+	// GetVCP reads the current value of a VCP code
+	GetVCP(monitorID string, code byte) (int, error)
+
+	// SetVCP writes a VCP code
+	SetVCP(monitorID string, code byte, value int) error
+}
+
+// AsVCP returns ctrl as a VCPController or ErrDDCNotSupported
+func AsVCP(ctrl Controller) (VCPController, error) {
+	if vc, ok := ctrl.(VCPController); ok {
+		return vc, nil
+	}
+	return nil, ErrDDCNotSupported
+}
+
+// FlashMonitor blinks a monitor's brightness a few times so the user can see
+// which physical panel a monitor ID refers to. The original brightness is
+// restored afterwards.
+func FlashMonitor(ctrl Controller, monitorID string) error {
+	vc, err := AsVCP(ctrl)
+	if err != nil {
+		return err
+	}
+
+	original, err := vc.GetVCP(monitorID, VCPBrightness)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := vc.SetVCP(monitorID, VCPBrightness, original); err != nil {
+			logging.Errorf("DDC: Failed to restore brightness on %s: %v", monitorID, err)
+		}
+	}()
+
+	// Blink away from the current level so the change is always visible
+	blink := 0
+	if original < 50 {
+		blink = 100
+	}
+	for i := 0; i < 3; i++ {
+		if err := vc.SetVCP(monitorID, VCPBrightness, blink); err != nil {
+			return err
+		}
+		time.Sleep(400 * time.Millisecond)
+		if err := vc.SetVCP(monitorID, VCPBrightness, original); err != nil {
+			return err
+		}
+		time.Sleep(400 * time.Millisecond)
+	}
+	return nil
+}
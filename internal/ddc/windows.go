@@ -6,7 +6,6 @@ import (
 	"bufio"
 	"encoding/csv"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,11 +13,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf16"
 	"unicode/utf8"
 
 	"vkvm/internal/embedded"
+	"vkvm/internal/logging"
 )
 
 // decodeUTF16 converts UTF-16LE (potentially with BOM) to UTF-8 string
@@ -64,52 +65,132 @@ func sanitizeForFilename(s string) string {
 	return re.ReplaceAllString(s, "_")
 }
 
-// Stub for macOS on Windows build
-func newMacController() (Controller, error) {
-	return nil, ErrUnsupportedPlatform
+func init() {
+	RegisterBackend("controlmymonitor", 100, func(opts Options) (Controller, error) {
+		c, err := newWindowsController(opts.ToolPaths.ControlMyMonitor, opts.commandTimeout())
+		if err != nil {
+			return nil, err
+		}
+		c.probes = opts.probes("controlmymonitor")
+		return c, nil
+	})
 }
 
+const (
+	// maxToolInvocations caps concurrent ControlMyMonitor processes; they all
+	// share the same I2C buses and become unreliable when too many run at once
+	maxToolInvocations = 3
+
+	// fullDumpTimeoutFactor stretches the timeout for /scomma, which reads
+	// every VCP code and routinely takes a few seconds per monitor
+	fullDumpTimeoutFactor = 2
+)
+
 // windowsController implements Controller for Windows using ControlMyMonitor
 type windowsController struct {
 	toolPath string
+	embedded bool // toolPath is the extracted embedded copy
+	timeout  time.Duration
+
+	slots chan struct{} // limits concurrent tool invocations
+
+	probes probes
+
+	tmpOnce sync.Once
+	tmpDir  string
+	tmpErr  error
+	tmpSeq  atomic.Uint64
 }
 
 // newWindowsController creates a new Windows DDC controller
-func newWindowsController() (*windowsController, error) {
-	// Try project tools directory first (user may have updated version here)
+// configuredPath takes precedence over auto-detection when it is valid.
+func newWindowsController(configuredPath string, timeout time.Duration) (*windowsController, error) {
+	if path, ok := configuredTool("ControlMyMonitor", configuredPath); ok {
+		return newWindowsControllerAt(path, false, timeout), nil
+	}
+
 	paths := []string{
-		`D:\vkvm\tools\ControlMyMonitor.exe`, // Project tools directory (priority)
-		"ControlMyMonitor.exe",                // In PATH
+		"ControlMyMonitor.exe", // In PATH
 		`C:\Program Files\ControlMyMonitor\ControlMyMonitor.exe`,
 		`C:\Program Files (x86)\ControlMyMonitor\ControlMyMonitor.exe`,
 	}
 
+	// tools directory next to the executable (user may have dropped a newer version there)
+	if exe, err := os.Executable(); err == nil {
+		local := filepath.Join(filepath.Dir(exe), "tools", "ControlMyMonitor.exe")
+		paths = append([]string{local}, paths...)
+	}
+
 	for _, p := range paths {
 		if path, err := exec.LookPath(p); err == nil {
-			log.Printf("DDC: Using ControlMyMonitor at %s", path)
-			return &windowsController{toolPath: path}, nil
+			logging.Infof("DDC: Using ControlMyMonitor at %s", path)
+			return newWindowsControllerAt(path, false, timeout), nil
 		}
 	}
 
 	// Try embedded ControlMyMonitor as last resort
 	if path, err := embedded.GetToolPath("ControlMyMonitor.exe"); err == nil {
-		log.Printf("DDC: Using embedded ControlMyMonitor at %s", path)
-		return &windowsController{toolPath: path}, nil
+		logging.Infof("DDC: Using embedded ControlMyMonitor at %s", path)
+		return newWindowsControllerAt(path, true, timeout), nil
 	}
 
-	log.Printf("DDC: ControlMyMonitor.exe not found in any of the expected paths")
+	logging.Warnf("DDC: ControlMyMonitor.exe not found in any of the expected paths")
 	return nil, ErrToolNotFound
 }
 
+// newWindowsControllerAt creates a controller for a resolved tool path
+func newWindowsControllerAt(path string, isEmbedded bool, timeout time.Duration) *windowsController {
+	return &windowsController{
+		toolPath: path,
+		embedded: isEmbedded,
+		timeout:  timeout,
+		slots:    make(chan struct{}, maxToolInvocations),
+	}
+}
+
+// run executes one ControlMyMonitor invocation within the concurrency cap and
+// timeout. fn receives the prepared command and is responsible for running it.
+func (c *windowsController) run(args []string, fn func(cmd *exec.Cmd) error) error {
+	return c.runWithTimeout(c.timeout, args, fn)
+}
+
+// runWithTimeout is run with an explicit timeout for unusually slow operations
+func (c *windowsController) runWithTimeout(timeout time.Duration, args []string, fn func(cmd *exec.Cmd) error) error {
+	c.slots <- struct{}{}
+	defer func() { <-c.slots }()
+
+	return runTool(timeout, c.toolPath, c.embedded, args, fn)
+}
+
+// privateTempDir returns a per-process directory for tool output files. It
+// lives under the user's local app data rather than the shared TMP so other
+// accounts cannot read or plant output files.
+func (c *windowsController) privateTempDir() (string, error) {
+	c.tmpOnce.Do(func() {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		base = filepath.Join(base, "vkvm", "tmp")
+		if err := os.MkdirAll(base, 0700); err != nil {
+			c.tmpErr = err
+			return
+		}
+		c.tmpDir, c.tmpErr = os.MkdirTemp(base, fmt.Sprintf("ddc-%d-", os.Getpid()))
+	})
+	return c.tmpDir, c.tmpErr
+}
+
 // runWithTempFile runs the tool with arguments and captures output from a temporary file.
 // outputSwitch is the switch that specifies the output file (e.g., "/smonitors", "/scomma").
 func (c *windowsController) runWithTempFile(outputSwitch string, preArgs ...string) ([]byte, error) {
-	tmpDir := os.TempDir()
-	// Use a subdirectory to ensure we can write to it and it's isolated
-	// But os.TempDir() is usually writable.
-	// Use nanosecond timestamp to avoid collision
-	tmpFile := filepath.Join(tmpDir, fmt.Sprintf("vkvm_ddc_%d.txt", time.Now().UnixNano()))
-	
+	tmpDir, err := c.privateTempDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	// Sequence number keeps concurrent invocations from colliding
+	tmpFile := filepath.Join(tmpDir, fmt.Sprintf("out_%d.txt", c.tmpSeq.Add(1)))
+
 	// Ensure cleanup
 	defer func() {
 		// Try to remove, but don't fail if it doesn't exist (e.g. tool failed to create it)
@@ -117,13 +198,19 @@ func (c *windowsController) runWithTempFile(outputSwitch string, preArgs ...stri
 	}()
 
 	args := append(preArgs, outputSwitch, tmpFile)
-	cmd := exec.Command(c.toolPath, args...)
-	
+
 	// Capture stderr in case of tool error
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	timeout := c.timeout
+	if outputSwitch == "/scomma" {
+		timeout *= fullDumpTimeoutFactor
+	}
 
-	if err := cmd.Run(); err != nil {
+	var stderr strings.Builder
+	err = c.runWithTimeout(timeout, args, func(cmd *exec.Cmd) error {
+		cmd.Stderr = &stderr
+		return cmd.Run()
+	})
+	if err != nil {
 		// If command fails, still try to read file? No, command failure usually means no output.
 		// ControlMyMonitor might return exit code 0 even on failure?
 		return nil, fmt.Errorf("command execution failed: %w; stderr: %s", err, stderr.String())
@@ -138,7 +225,7 @@ func (c *windowsController) runWithTempFile(outputSwitch string, preArgs ...stri
 		}
 		return nil, fmt.Errorf("failed to read output file: %w", err)
 	}
-	
+
 	return data, nil
 }
 
@@ -147,7 +234,7 @@ func (c *windowsController) ListMonitors() ([]Monitor, error) {
 	// Use /smonitors with a temp file
 	outputBytes, err := c.runWithTempFile("/smonitors")
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrCommandFailed, err)
+		return nil, commandError(err)
 	}
 
 	// Decode potential UTF-16LE output
@@ -158,67 +245,86 @@ func (c *windowsController) ListMonitors() ([]Monitor, error) {
 		return monitors, err
 	}
 
-	// Optimize: Fetch details for all monitors in parallel
+	// Optimize: Fetch details for all monitors in parallel with a small worker
+	// pool; each worker only writes its own monitors[idx]
 	var wg sync.WaitGroup
-	monitorsMutex := &sync.Mutex{} // Protects concurrent writes to monitors slice if needed? 
-	// Actually writing to distinct indices monitors[i] is safe in Go, 
-	// but let's be safe against race detector if any slices inside struct are modified.
-	// However, we are modifying fields of struct, which is safe.
-	
-	for i := range monitors {
+	monitorsMutex := &sync.Mutex{}
+	jobs := make(chan int)
+
+	workers := min(maxToolInvocations, len(monitors))
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
-		go func(idx int) {
+		go func() {
 			defer wg.Done()
-
-			// Check heuristic for missing metadata (Monitor 3 case)
-			if monitors[idx].Name == "" && monitors[idx].Serial == "" {
-				// We still try to fetch details, but we keep this flag in mind
-			}
-
-			supported, input, err := c.fetchMonitorDetails(monitors[idx].ID)
-			
-			monitorsMutex.Lock()
-			monitors[idx].DDCSupported = supported
-			if err == nil {
-				monitors[idx].InputSource = input
-				
-				// Heuristic logic for the DP monitor showing as HDMI1
-				if monitors[idx].Name == "" && monitors[idx].Serial == "" && monitors[idx].InputSource == InputSourceHDMI1 {
-					log.Printf("DDC: Monitor %s has missing metadata and reports HDMI1. Applying heuristic -> DP1", monitors[idx].ID)
-					monitors[idx].InputSource = InputSourceDP1
-				}
-				
-				if !monitors[idx].DDCSupported {
-					monitors[idx].DDCSupported = true
-				}
+			for idx := range jobs {
+				c.fillMonitorDetails(monitors, idx, monitorsMutex)
 			}
-			monitorsMutex.Unlock()
-		}(i)
+		}()
 	}
+	for i := range monitors {
+		jobs <- i
+	}
+	close(jobs)
 	wg.Wait()
 
 	return monitors, nil
 }
 
+// fillMonitorDetails fetches DDC support and current input for monitors[idx].
+// Monitors with a cached probe result skip the slow full VCP dump.
+func (c *windowsController) fillMonitorDetails(monitors []Monitor, idx int, monitorsMutex *sync.Mutex) {
+	monitorsMutex.Lock()
+	m := monitors[idx]
+	monitorsMutex.Unlock()
+
+	if cached, known := c.probes.lookup(m); known {
+		if !cached {
+			return
+		}
+		val, ok := c.getInputSourceFast(m.ID)
+		monitorsMutex.Lock()
+		monitors[idx].DDCSupported = true
+		if ok {
+			monitors[idx].InputSource = InputSource(val)
+		}
+		monitorsMutex.Unlock()
+		return
+	}
+
+	supported, input, err := c.fetchMonitorDetails(m.ID)
+	c.probes.record(m, supported || err == nil)
+
+	monitorsMutex.Lock()
+	defer monitorsMutex.Unlock()
+
+	monitors[idx].DDCSupported = supported
+	if err == nil {
+		monitors[idx].InputSource = input
+
+		if !monitors[idx].DDCSupported {
+			monitors[idx].DDCSupported = true
+		}
+	}
+}
+
 // getInputSourceFast tries to get input source using /GetValue which is faster than full dump.
 // Returns (value, success).
 func (c *windowsController) getInputSourceFast(id string) (int, bool) {
 	// /GetValue returns the value in the exit code.
 	// 0 usually means error or failure for input select (which is normally 15, 17, 27 etc).
-	cmd := exec.Command(c.toolPath, "/GetValue", id, "60")
-	err := cmd.Run()
-
+	// The exit code is the value, so it is not counted as a command failure.
 	var exitCode int
-	if err != nil {
+	err := c.run([]string{"/GetValue", id, "60"}, func(cmd *exec.Cmd) error {
+		err := cmd.Run()
 		if exitError, ok := err.(*exec.ExitError); ok {
 			exitCode = exitError.ExitCode()
-		} else {
-			// Execution failed (not found, permission denied, etc)
-			return 0, false
+			return nil
 		}
-	} else {
-		// Exit code 0
-		exitCode = 0
+		return err
+	})
+	if err != nil {
+		// Execution failed (not found, permission denied, timed out, etc)
+		return 0, false
 	}
 
 	// Valid input sources are usually non-zero (e.g. 15=DP, 17=HDMI)
@@ -233,7 +339,7 @@ func (c *windowsController) fetchMonitorDetails(id string) (bool, InputSource, e
 	// Optimization: Try /GetValue first (fast path)
 	// This avoids the overhead of reading all VCP codes (~2-3s per monitor)
 	if val, ok := c.getInputSourceFast(id); ok {
-		log.Printf("DDC: Fast fetch successful for %s: %d", id, val)
+		logging.Debugf("DDC: Fast fetch successful for %s: %d", id, val)
 		return true, InputSource(val), nil
 	}
 
@@ -268,7 +374,7 @@ func (c *windowsController) fetchMonitorDetails(id string) (bool, InputSource, e
 		if record[0] == "60" || record[0] == "10" {
 			supported = true
 		}
-		
+
 		if record[0] == "60" && len(record) >= 4 {
 			currentValStr := strings.TrimSpace(record[3])
 			val, err := strconv.ParseInt(currentValStr, 10, 32)
@@ -288,7 +394,7 @@ func (c *windowsController) fetchMonitorDetails(id string) (bool, InputSource, e
 
 // parseMonitorList parses ControlMyMonitor monitor list output
 func (c *windowsController) parseMonitorList(output string) ([]Monitor, error) {
-	fmt.Printf("DEBUG: Parsing Windows monitor list (%d chars)\n", len(output))
+	logging.Debugf("DDC: Parsing Windows monitor list (%d chars)", len(output))
 	var monitors []Monitor
 	var currentProps map[string]string
 
@@ -323,6 +429,7 @@ func (c *windowsController) parseMonitorList(output string) ([]Monitor, error) {
 				Name:       currentProps["Monitor Name"],
 				DeviceName: currentProps["Device Name"],
 				Serial:     currentProps["Serial Number"],
+				Connector:  currentProps["Device Name"],
 			})
 			dispName := currentProps["Monitor Name"]
 			if dispName == "" {
@@ -331,7 +438,7 @@ func (c *windowsController) parseMonitorList(output string) ([]Monitor, error) {
 			if dispName == "" {
 				dispName = "Unknown Monitor"
 			}
-			fmt.Printf("DEBUG: Detected monitor: %s (ID: %s)\n", dispName, id)
+			logging.Debugf("DDC: Detected monitor: %s (ID: %s)", dispName, id)
 		}
 		currentProps = nil
 	}
@@ -377,25 +484,57 @@ func (c *windowsController) parseMonitorList(output string) ([]Monitor, error) {
 	}
 	commit() // Don't forget the last one
 
-	fmt.Printf("DEBUG: Found %d monitors total\n", len(monitors))
+	disambiguateIDs(monitors)
+
+	logging.Debugf("DDC: Found %d monitors total", len(monitors))
 	return monitors, scanner.Err()
 }
 
+// disambiguateIDs re-addresses monitors whose Monitor ID collides (identical
+// models on some drivers) by their device path or EDID serial, both of which
+// ControlMyMonitor also accepts as a monitor identifier
+func disambiguateIDs(monitors []Monitor) {
+	used := make(map[string]int)
+	for _, m := range monitors {
+		used[m.ID]++
+	}
+
+	for i := range monitors {
+		m := &monitors[i]
+		if used[m.ID] < 2 {
+			continue
+		}
+		for _, alt := range []string{m.DeviceName, m.Serial} {
+			if alt == "" || used[alt] > 0 {
+				continue
+			}
+			logging.Warnf("DDC: Monitor ID %s is shared by several monitors, addressing one as %s", m.ID, alt)
+			used[m.ID]--
+			used[alt]++
+			m.ID = alt
+			break
+		}
+		if used[m.ID] > 1 {
+			logging.Errorf("DDC: Monitor ID %s is ambiguous and cannot be disambiguated", m.ID)
+		}
+	}
+}
+
 // GetCurrentInput gets the current input source for a monitor
 func (c *windowsController) GetCurrentInput(monitorID string) (InputSource, error) {
 	// Use /Monitor <ID> /scomma <file> to get settings
 	outputBytes, err := c.runWithTempFile("/scomma", "/Monitor", monitorID)
 	if err != nil {
-		return 0, fmt.Errorf("%w: %v", ErrCommandFailed, err)
+		return 0, commandError(err)
 	}
 
 	s := decodeUTF16(outputBytes)
-	
+
 	// Parse CSV
 	reader := csv.NewReader(strings.NewReader(s))
 	// Allow for variable number of fields if the tool behavior changes
-	reader.FieldsPerRecord = -1 
-	
+	reader.FieldsPerRecord = -1
+
 	records, err := reader.ReadAll()
 	if err != nil {
 		return 0, fmt.Errorf("failed to parse CSV output: %w", err)
@@ -404,7 +543,7 @@ func (c *windowsController) GetCurrentInput(monitorID string) (InputSource, erro
 	// Look for VCP code 60 (Input Select)
 	// Default CSV format: VCP Code, VCP Code Name, Read-Write, Current Value, ...
 	// records[0] is header usually
-	
+
 	for _, record := range records {
 		if len(record) < 4 {
 			continue
@@ -428,17 +567,21 @@ func (c *windowsController) SetInputSource(monitorID string, source InputSource)
 	args := []string{"/SetValue", monitorID, "60", fmt.Sprintf("%d", source)}
 
 	// Use %q to see exactly what characters are in the ID string (escapes shown)
-	log.Printf("DDC: Executing %s with ID %q and input %d", c.toolPath, monitorID, source)
-
-	cmd := exec.Command(c.toolPath, args...)
-	output, err := cmd.CombinedOutput()
+	logging.Debugf("DDC: Executing %s with ID %q and input %d", c.toolPath, monitorID, source)
+
+	var output []byte
+	err := c.run(args, func(cmd *exec.Cmd) error {
+		var err error
+		output, err = cmd.CombinedOutput()
+		return err
+	})
 	decoded := decodeUTF16(output)
 	if err != nil {
-		log.Printf("DDC: ControlMyMonitor failed for ID %q. Output: %s", monitorID, decoded)
-		return fmt.Errorf("%w: %v", ErrCommandFailed, err)
+		logging.Errorf("DDC: ControlMyMonitor failed for ID %q. Output: %s", monitorID, decoded)
+		return commandError(err)
 	}
 	if decoded != "" {
-		log.Printf("DDC: ControlMyMonitor output for ID %q: %s", monitorID, decoded)
+		logging.Debugf("DDC: ControlMyMonitor output for ID %q: %s", monitorID, decoded)
 	}
 	return nil
 }
@@ -452,17 +595,68 @@ func (c *windowsController) SetPower(monitorID string, on bool) error {
 	}
 	args := []string{"/SetValue", monitorID, "D6", val}
 
-	log.Printf("DDC: Setting power for ID %q to %s (D6)", monitorID, val)
+	logging.Infof("DDC: Setting power for ID %q to %s (D6)", monitorID, val)
 
-	cmd := exec.Command(c.toolPath, args...)
-	output, err := cmd.CombinedOutput()
+	var output []byte
+	err := c.run(args, func(cmd *exec.Cmd) error {
+		var err error
+		output, err = cmd.CombinedOutput()
+		return err
+	})
 	decoded := decodeUTF16(output)
 	if err != nil {
-		log.Printf("DDC: ControlMyMonitor failed for ID %q. Output: %s", monitorID, decoded)
-		return fmt.Errorf("%w: %v", ErrCommandFailed, err)
+		logging.Errorf("DDC: ControlMyMonitor failed for ID %q. Output: %s", monitorID, decoded)
+		return commandError(err)
 	}
 	if decoded != "" {
-		log.Printf("DDC: ControlMyMonitor output for ID %q: %s", monitorID, decoded)
+		logging.Debugf("DDC: ControlMyMonitor output for ID %q: %s", monitorID, decoded)
+	}
+	return nil
+}
+
+// GetVCP reads the current value of a VCP code from the full settings dump.
+// /GetValue is not used because its exit-code result cannot tell a value of 0
+// from a failure.
+func (c *windowsController) GetVCP(monitorID string, code byte) (int, error) {
+	outputBytes, err := c.runWithTempFile("/scomma", "/Monitor", monitorID)
+	if err != nil {
+		return 0, commandError(err)
+	}
+
+	reader := csv.NewReader(strings.NewReader(decodeUTF16(outputBytes)))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse CSV output: %w", err)
+	}
+
+	want := fmt.Sprintf("%02X", code)
+	for _, record := range records {
+		if len(record) < 4 || !strings.EqualFold(strings.TrimSpace(record[0]), want) {
+			continue
+		}
+		val, err := strconv.Atoi(strings.TrimSpace(record[3]))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse VCP %s value: %w", want, err)
+		}
+		return val, nil
+	}
+	return 0, fmt.Errorf("VCP %s not reported by monitor", want)
+}
+
+// SetVCP writes a VCP code
+func (c *windowsController) SetVCP(monitorID string, code byte, value int) error {
+	args := []string{"/SetValue", monitorID, fmt.Sprintf("%02X", code), strconv.Itoa(value)}
+
+	var output []byte
+	err := c.run(args, func(cmd *exec.Cmd) error {
+		var err error
+		output, err = cmd.CombinedOutput()
+		return err
+	})
+	if err != nil {
+		logging.Errorf("DDC: ControlMyMonitor failed for ID %q. Output: %s", monitorID, decodeUTF16(output))
+		return commandError(err)
 	}
 	return nil
 }
@@ -472,15 +666,15 @@ func (c *windowsController) TestDDCSupport(monitorID string) bool {
 	// Use /scomma to dump values. If we get a valid dump for 60 or 10, it's supported.
 	outputBytes, err := c.runWithTempFile("/scomma", "/Monitor", monitorID)
 	if err != nil {
-		log.Printf("DDC: TestDDCSupport failed to run tool: %v", err)
+		logging.Errorf("DDC: TestDDCSupport failed to run tool: %v", err)
 		return false
 	}
-	
+
 	s := decodeUTF16(outputBytes)
 	if len(s) < 10 { // Too short to be valid
 		return false
 	}
-	
+
 	// Check if we have VCP 60 or 10 in the CSV
 	reader := csv.NewReader(strings.NewReader(s))
 	reader.FieldsPerRecord = -1
@@ -488,7 +682,7 @@ func (c *windowsController) TestDDCSupport(monitorID string) bool {
 	if err != nil {
 		return false
 	}
-	
+
 	for _, record := range records {
 		if len(record) > 0 {
 			if record[0] == "60" || record[0] == "10" {
@@ -496,7 +690,6 @@ func (c *windowsController) TestDDCSupport(monitorID string) bool {
 			}
 		}
 	}
-	
+
 	return false
 }
-
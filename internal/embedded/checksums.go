@@ -0,0 +1,9 @@
+package embedded
+
+// checksums pins the SHA-256 of every tool that may be embedded. Update this
+// table whenever a binary under tools/ is replaced; unknown or mismatching
+// files are never extracted or executed.
+var checksums = map[string]string{
+	"m1ddc":                "25baec655fa0f0c33165531efd9488db702784b90df22100a5630837b7519152",
+	"ControlMyMonitor.exe": "4db1778b2bbe964c11365d2af94d20f7798863bbc9dd44a0887aa572f46f4677",
+}
@@ -3,19 +3,29 @@
 package embedded
 
 import (
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sync"
+
+	"vkvm/internal/logging"
 )
 
 //go:embed tools/*
 var toolsFS embed.FS
 
+// ErrChecksumMismatch is returned when a tool does not match its pinned SHA-256
+var ErrChecksumMismatch = errors.New("tool checksum mismatch")
+
 var (
+	verifyMu sync.Mutex
+
 	extractedDir string
 	extractOnce  sync.Once
 	extractErr   error
@@ -41,9 +51,65 @@ func GetToolPath(toolName string) (string, error) {
 		return "", fmt.Errorf("tool not found: %s", toolName)
 	}
 
+	if err := Verify(toolPath); err != nil {
+		return "", err
+	}
+
 	return toolPath, nil
 }
 
+// Verify checks an extracted tool against its pinned checksum right before it
+// is executed. A tampered file is restored from the embedded copy once; if it
+// still does not match, ErrChecksumMismatch is returned.
+func Verify(toolPath string) error {
+	verifyMu.Lock()
+	defer verifyMu.Unlock()
+
+	name := filepath.Base(toolPath)
+	want, ok := checksums[name]
+	if !ok {
+		return fmt.Errorf("%w: no checksum pinned for %s", ErrChecksumMismatch, name)
+	}
+
+	if got, err := hashFile(toolPath); err == nil && got == want {
+		return nil
+	}
+
+	logging.Warnf("Embedded: %s does not match its checksum, restoring embedded copy", toolPath)
+	if err := extractFile("tools/"+name, toolPath); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", name, err)
+	}
+	if got, err := hashFile(toolPath); err != nil || got != want {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, toolPath)
+	}
+	return nil
+}
+
+// hashFile returns the hex SHA-256 of a file on disk
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashEmbedded returns the hex SHA-256 of an embedded file
+func hashEmbedded(srcPath string) (string, error) {
+	data, err := toolsFS.ReadFile(srcPath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 // extractTools extracts all embedded tools to a temporary directory
 func extractTools() (string, error) {
 	// Create a cache directory that persists across runs
@@ -72,17 +138,20 @@ func extractTools() (string, error) {
 		srcPath := "tools/" + entry.Name()
 		dstPath := filepath.Join(toolsDir, entry.Name())
 
-		// Skip if already extracted (based on size match)
-		srcInfo, _ := toolsFS.Open(srcPath)
-		if srcInfo != nil {
-			srcStat, _ := srcInfo.Stat()
-			if dstStat, err := os.Stat(dstPath); err == nil {
-				if srcStat != nil && dstStat.Size() == srcStat.Size() {
-					srcInfo.Close()
-					continue
-				}
-			}
-			srcInfo.Close()
+		// Refuse to ship anything that doesn't match the pinned checksum
+		want, ok := checksums[entry.Name()]
+		if !ok {
+			logging.Infof("Embedded: Skipping %s, no checksum pinned", entry.Name())
+			continue
+		}
+		if got, err := hashEmbedded(srcPath); err != nil || got != want {
+			logging.Warnf("Embedded: Skipping %s, embedded copy does not match its checksum", entry.Name())
+			continue
+		}
+
+		// Skip if already extracted and intact
+		if got, err := hashFile(dstPath); err == nil && got == want {
+			continue
 		}
 
 		// Extract the tool
@@ -94,7 +163,9 @@ func extractTools() (string, error) {
 	return toolsDir, nil
 }
 
-// extractFile extracts a single file from the embedded FS
+// extractFile extracts a single file from the embedded FS. The file is
+// written next to dstPath and renamed into place so a partially written or
+// running binary is never executed.
 func extractFile(srcPath, dstPath string) error {
 	src, err := toolsFS.Open(srcPath)
 	if err != nil {
@@ -102,14 +173,33 @@ func extractFile(srcPath, dstPath string) error {
 	}
 	defer src.Close()
 
-	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), filepath.Base(dstPath)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer dst.Close()
+	tmpPath := tmp.Name()
 
-	_, err = io.Copy(dst, src)
-	return err
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Windows cannot rename over an existing file
+	os.Remove(dstPath)
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
 }
 
 // getCacheDir returns the cache directory for extracted tools
@@ -0,0 +1,89 @@
+// Package events is an in-process event bus: components publish what
+// happened (a switch, an agent connecting, a monitor changing input) and
+// subscribers such as the rules engine react to it without the publishers
+// knowing about them.
+package events
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"vkvm/internal/logging"
+	"vkvm/internal/supervisor"
+)
+
+// Event types
+const (
+	Switched          = "switch"             // Profile, Origin
+	AgentConnected    = "agent_connected"    // Agent, Address
+	AgentDisconnected = "agent_disconnected" // Agent, Address
+	MonitorInput      = "monitor_input"      // Monitor, Input
+)
+
+// Event is something that happened on this machine
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Profile string    `json:"profile,omitempty"`
+	Origin  string    `json:"origin,omitempty"`
+	Agent   string    `json:"agent,omitempty"`
+	Address string    `json:"address,omitempty"`
+	Monitor string    `json:"monitor,omitempty"`
+	Input   int       `json:"input,omitempty"`
+}
+
+// queueSize bounds the events waiting for delivery; more are dropped
+const queueSize = 64
+
+var (
+	mu          sync.Mutex
+	subscribers []func(Event)
+	queue       = make(chan Event, queueSize)
+	startOnce   sync.Once
+)
+
+// Subscribe registers fn to be called with every event published from now
+// on. Events are delivered in order on one goroutine, so fn should not block
+// for long.
+func Subscribe(fn func(Event)) {
+	mu.Lock()
+	subscribers = append(subscribers, fn)
+	mu.Unlock()
+
+	startOnce.Do(func() {
+		supervisor.Go("events", supervisor.Always, dispatch)
+	})
+}
+
+// Publish queues ev for the subscribers without blocking the caller
+func Publish(ev Event) {
+	mu.Lock()
+	none := len(subscribers) == 0
+	mu.Unlock()
+	if none {
+		return
+	}
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	select {
+	case queue <- ev:
+	default:
+		logging.Warnf("Events: Queue full, dropping %s event", ev.Type)
+	}
+}
+
+// dispatch delivers queued events to the subscribers
+func dispatch() {
+	for ev := range queue {
+		mu.Lock()
+		subs := slices.Clone(subscribers)
+		mu.Unlock()
+
+		for _, fn := range subs {
+			fn(ev)
+		}
+	}
+}
@@ -2,32 +2,140 @@
 package hotkey
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
+	"time"
+
+	"vkvm/internal/logging"
 )
 
+// DefaultDebounce is the minimum interval between two firings of the same hotkey
+// when no explicit debounce is configured
+const DefaultDebounce = 500 * time.Millisecond
+
+// TriggerPolicy controls when a matched hotkey fires
+type TriggerPolicy struct {
+	// ExactMatch only fires when no keys other than the combo are held,
+	// so Ctrl+Alt+1 does not fire while Ctrl+Alt+Shift+1 is pressed
+	ExactMatch bool
+
+	// OnRelease fires when the combo is released instead of when it completes
+	OnRelease bool
+
+	// Debounce is the minimum time between two firings of the same hotkey.
+	// Zero means DefaultDebounce; a negative value disables debouncing.
+	Debounce time.Duration
+}
+
+// EngineStatus reports whether the platform hooks are delivering events
+type EngineStatus struct {
+	// Running is true once the global hooks are installed
+	Running bool `json:"running"`
+
+	// PermissionRequired is true when the OS refused the hooks for lack of a
+	// user-granted permission (macOS Accessibility)
+	PermissionRequired bool `json:"permission_required,omitempty"`
+
+	// Error describes why the hooks are not running
+	Error string `json:"error,omitempty"`
+
+	// Reenabled counts how often the OS disabled the hooks (e.g. macOS tap
+	// timeouts) and they had to be turned back on
+	Reenabled uint64 `json:"reenabled"`
+}
+
 // Manager handles global hotkey and mouse button registration and matching
 type Manager struct {
 	mu           sync.RWMutex
 	hotkeys      []*registeredHotkey
+	nextID       int
+	policy       TriggerPolicy
 	currentState map[string]bool // map of current keys/buttons pressed
+	swallowed    map[string]bool // keys whose press was hidden from other apps; their release is hidden too
+	status       EngineStatus
+
+	stop     chan struct{} // closed by Stop
+	stopOnce sync.Once
 }
 
 type registeredHotkey struct {
+	id       int
 	parts    []string // e.g., ["CTRL", "ALT", "MOUSE4"]
 	original string
 	callback func()
+	policy   *TriggerPolicy // nil uses the Manager policy
+	swallow  bool
+	action   string // Binding.Action; empty for Register
+
+	active    bool // combo is currently held; suppresses key-repeat re-firing
+	lastFired time.Time
+}
+
+// Binding pairs a hotkey string with its callback for bulk registration via ReplaceAll
+type Binding struct {
+	Hotkey   string
+	Callback func()
+
+	// Action names what Callback does (e.g. "settings", "profile:PC1"). A
+	// binding with the same combo and action as one it replaces keeps its
+	// held and debounce state, so a refresh mid-press does not re-fire it.
+	Action string
+
+	// Policy overrides the Manager's trigger policy for this hotkey (optional)
+	Policy *TriggerPolicy
+
+	// Swallow hides the combo's final key from other applications while the
+	// hotkey is held (Windows only; macOS hooks can only listen)
+	Swallow bool
 }
 
 // NewManager creates a new hotkey manager
 func NewManager() *Manager {
 	return &Manager{
 		currentState: make(map[string]bool),
+		swallowed:    make(map[string]bool),
+		stop:         make(chan struct{}),
 	}
 }
 
+// SetPolicy sets the default trigger policy for all hotkeys without their own
+func (m *Manager) SetPolicy(policy TriggerPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy = policy
+}
+
+// parseHotkey splits a hotkey string into its canonical key names
+func parseHotkey(hotkeyStr string) ([]string, error) {
+	parts := strings.Split(strings.ToUpper(hotkeyStr), "+")
+	for i, p := range parts {
+		parts[i] = normalizeKeyName(strings.TrimSpace(p))
+		if parts[i] == "" {
+			return nil, fmt.Errorf("invalid hotkey %q: empty key name", hotkeyStr)
+		}
+	}
+	return parts, nil
+}
+
+// newHotkey parses hotkeyStr and assigns it a fresh ID. Callers must hold m.mu.
+func (m *Manager) newHotkey(hotkeyStr string, callback func()) (*registeredHotkey, error) {
+	parts, err := parseHotkey(hotkeyStr)
+	if err != nil {
+		return nil, err
+	}
+	m.nextID++
+	return &registeredHotkey{
+		id:       m.nextID,
+		parts:    parts,
+		original: hotkeyStr,
+		callback: callback,
+	}, nil
+}
+
 // Register registers a hotkey string (e.g. "Ctrl+Alt+1", "Mouse2+Mouse3") and a callback.
+// The returned ID can be passed to Unregister; it stays valid until then.
 func (m *Manager) Register(hotkeyStr string, callback func()) (int, error) {
 	if hotkeyStr == "" {
 		return 0, nil
@@ -36,18 +144,73 @@ func (m *Manager) Register(hotkeyStr string, callback func()) (int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	parts := strings.Split(strings.ToUpper(hotkeyStr), "+")
-	for i, p := range parts {
-		parts[i] = strings.TrimSpace(p)
+	hk, err := m.newHotkey(hotkeyStr, callback)
+	if err != nil {
+		return 0, err
 	}
+	m.hotkeys = append(m.hotkeys, hk)
 
-	m.hotkeys = append(m.hotkeys, &registeredHotkey{
-		parts:    parts,
-		original: hotkeyStr,
-		callback: callback,
-	})
+	return hk.id, nil
+}
+
+// Unregister removes a single hotkey by the ID returned from Register.
+// It returns false if no hotkey with that ID is registered.
+func (m *Manager) Unregister(id int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, hk := range m.hotkeys {
+		if hk.id == id {
+			m.hotkeys = append(m.hotkeys[:i], m.hotkeys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ReplaceAll swaps the complete set of registered hotkeys in one step, so
+// there is never a window where an in-flight key event sees no hotkeys.
+// Empty hotkey strings are skipped; invalid ones are skipped and reported
+// in the returned error while the rest are still registered.
+func (m *Manager) ReplaceAll(bindings []Binding) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Carry over the state of unchanged hotkeys
+	previous := make(map[string]*registeredHotkey, len(m.hotkeys))
+	for _, hk := range m.hotkeys {
+		if hk.action != "" {
+			previous[hk.stateKey()] = hk
+		}
+	}
 
-	return len(m.hotkeys) - 1, nil
+	var errs []error
+	hotkeys := make([]*registeredHotkey, 0, len(bindings))
+	for _, b := range bindings {
+		if b.Hotkey == "" {
+			continue
+		}
+		hk, err := m.newHotkey(b.Hotkey, b.Callback)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		hk.policy = b.Policy
+		hk.swallow = b.Swallow
+		hk.action = b.Action
+		if old, ok := previous[hk.stateKey()]; ok {
+			hk.active, hk.lastFired = old.active, old.lastFired
+		}
+		hotkeys = append(hotkeys, hk)
+	}
+
+	m.hotkeys = hotkeys
+	return errors.Join(errs...)
+}
+
+// stateKey identifies a hotkey across ReplaceAll calls by its combo and action
+func (hk *registeredHotkey) stateKey() string {
+	return strings.Join(hk.parts, "+") + "\x00" + hk.action
 }
 
 // Clear removes all registered hotkeys
@@ -59,40 +222,301 @@ func (m *Manager) Clear() {
 
 // UpdateState updates the internal state of a key or button and checks for matches.
 func (m *Manager) UpdateState(key string, isDown bool) {
+	m.HandleKey(key, isDown)
+}
+
+// HandleKey is UpdateState for hooks that can block events: it returns true
+// if the event belongs to a swallowing hotkey and should not reach other
+// applications.
+func (m *Manager) HandleKey(key string, isDown bool) (swallow bool) {
 	m.mu.Lock()
-	key = strings.ToUpper(key)
+	key = normalizeKeyName(strings.ToUpper(key))
 	if isDown {
 		m.currentState[key] = true
 	} else {
 		delete(m.currentState, key)
 	}
-	m.mu.Unlock()
+	// Side-specific modifiers also drive the generic name, which stays held
+	// while either side is down (releasing LCTRL with RCTRL held keeps CTRL)
+	if generic, ok := sidedModifiers[key]; ok {
+		if m.currentState["L"+generic] || m.currentState["R"+generic] {
+			m.currentState[generic] = true
+		} else {
+			delete(m.currentState, generic)
+		}
+	}
 
+	var fire []*registeredHotkey
 	if isDown {
-		m.checkMatches()
+		fire = m.checkPressed()
+		swallow = m.shouldSwallow(key)
+		if swallow {
+			m.swallowed[key] = true
+		}
+	} else {
+		fire = m.checkReleased()
+		swallow = m.swallowed[key]
+		delete(m.swallowed, key)
 	}
-}
+	m.mu.Unlock()
 
-func (m *Manager) checkMatches() {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	for _, hk := range fire {
+		logging.Debugf("Hotkey: Triggered %s", hk.original)
+		go hk.callback()
+	}
+	return swallow
+}
 
+// shouldSwallow reports whether pressing key completed (or repeats) a held
+// swallowing hotkey. Modifiers are never swallowed, so other apps do not see
+// them stuck. Callers must hold m.mu.
+func (m *Manager) shouldSwallow(key string) bool {
+	if _, sided := sidedModifiers[key]; sided || isModifier(key) {
+		return false
+	}
 	for _, hk := range m.hotkeys {
-		match := true
-		// All parts of the hotkey must be in currentState
+		if !hk.swallow || !hk.active {
+			continue
+		}
 		for _, part := range hk.parts {
-			if !m.currentState[part] {
-				match = false
-				break
+			if part == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isModifier reports whether key is a generic modifier name
+func isModifier(key string) bool {
+	for _, generic := range sidedModifiers {
+		if key == generic {
+			return true
+		}
+	}
+	return false
+}
+
+// sidedModifiers maps side-specific modifier names reported by the platform
+// hooks to their generic name. Hotkeys may use either form, e.g. "Ctrl+1"
+// fires with either Ctrl key while "RCtrl+1" requires the right one.
+var sidedModifiers = map[string]string{
+	"LCTRL":  "CTRL",
+	"RCTRL":  "CTRL",
+	"LALT":   "ALT",
+	"RALT":   "ALT",
+	"LSHIFT": "SHIFT",
+	"RSHIFT": "SHIFT",
+	"LCMD":   "CMD",
+	"RCMD":   "CMD",
+}
+
+// keyAliases maps alternative spellings (as typed by users or produced by the
+// browser recorder) to the canonical names reported by the platform hooks.
+var keyAliases = map[string]string{
+	"CONTROL":    "CTRL",
+	"OPTION":     "ALT",
+	"OPT":        "ALT",
+	"WIN":        "CMD",
+	"META":       "CMD",
+	"SUPER":      "CMD",
+	"COMMAND":    "CMD",
+	"ESCAPE":     "ESC",
+	"RETURN":     "ENTER",
+	"DEL":        "DELETE",
+	"INS":        "INSERT",
+	"PGUP":       "PAGEUP",
+	"PGDN":       "PAGEDOWN",
+	"ARROWUP":    "UP",
+	"ARROWDOWN":  "DOWN",
+	"ARROWLEFT":  "LEFT",
+	"ARROWRIGHT": "RIGHT",
+
+	// Side-specific modifiers
+	"LCONTROL":     "LCTRL",
+	"RCONTROL":     "RCTRL",
+	"CONTROLLEFT":  "LCTRL",
+	"CONTROLRIGHT": "RCTRL",
+	"LOPTION":      "LALT",
+	"ROPTION":      "RALT",
+	"ALTLEFT":      "LALT",
+	"ALTRIGHT":     "RALT",
+	"ALTGR":        "RALT",
+	"SHIFTLEFT":    "LSHIFT",
+	"SHIFTRIGHT":   "RSHIFT",
+	"LWIN":         "LCMD",
+	"RWIN":         "RCMD",
+	"LCOMMAND":     "LCMD",
+	"RCOMMAND":     "RCMD",
+	"METALEFT":     "LCMD",
+	"METARIGHT":    "RCMD",
+
+	// Numpad
+	"NUMPADADD":      "NUMADD",
+	"NUMPADSUBTRACT": "NUMSUB",
+	"NUMPADMULTIPLY": "NUMMUL",
+	"NUMPADDIVIDE":   "NUMDIV",
+	"NUMPADDECIMAL":  "NUMDEC",
+	"NUMPADENTER":    "NUMENTER",
+	"NUMPADEQUAL":    "NUMEQUALS",
+
+	// OEM punctuation
+	";":            "SEMICOLON",
+	"=":            "EQUALS",
+	"EQUAL":        "EQUALS",
+	",":            "COMMA",
+	"-":            "MINUS",
+	".":            "PERIOD",
+	"/":            "SLASH",
+	"`":            "BACKTICK",
+	"BACKQUOTE":    "BACKTICK",
+	"[":            "LBRACKET",
+	"BRACKETLEFT":  "LBRACKET",
+	"]":            "RBRACKET",
+	"BRACKETRIGHT": "RBRACKET",
+	"\\":           "BACKSLASH",
+	"'":            "QUOTE",
+
+	// Media
+	"AUDIOVOLUMEMUTE":    "VOLUMEMUTE",
+	"AUDIOVOLUMEDOWN":    "VOLUMEDOWN",
+	"AUDIOVOLUMEUP":      "VOLUMEUP",
+	"MEDIATRACKNEXT":     "MEDIANEXT",
+	"MEDIATRACKPREVIOUS": "MEDIAPREV",
+	"MEDIAPLAYPAUSE":     "MEDIAPLAY",
+}
+
+// normalizeKeyName converts an upper-cased key name to its canonical form,
+// e.g. "NUMPAD5" -> "NUM5", "ESCAPE" -> "ESC", ";" -> "SEMICOLON".
+func normalizeKeyName(key string) string {
+	if alias, ok := keyAliases[key]; ok {
+		return alias
+	}
+	// "NUMPAD0".."NUMPAD9" and "KP0".."KP9" -> "NUM0".."NUM9"
+	for _, prefix := range []string{"NUMPAD", "KP"} {
+		if rest := strings.TrimPrefix(key, prefix); rest != key && len(rest) == 1 && rest[0] >= '0' && rest[0] <= '9' {
+			return "NUM" + rest
+		}
+	}
+	return key
+}
+
+// checkPressed arms hotkeys whose combo just completed and returns those that
+// should fire now. Callers must hold m.mu.
+func (m *Manager) checkPressed() []*registeredHotkey {
+	var fire []*registeredHotkey
+	for _, hk := range m.hotkeys {
+		policy := m.policyFor(hk)
+		matched := m.isHeld(hk.parts) && (!policy.ExactMatch || m.onlyHeld(hk.parts))
+
+		if hk.active {
+			// Already armed: ignore key repeat, but an extra key pressed during an
+			// exact-match combo cancels a pending on-release trigger
+			if !matched {
+				hk.active = false
 			}
+			continue
+		}
+		if !matched {
+			continue
+		}
+
+		hk.active = true
+		if !policy.OnRelease && m.debounced(hk, policy) {
+			fire = append(fire, hk)
 		}
+	}
+	return fire
+}
 
-		if match {
-			// Basic match found, trigger callback in a goroutine
-			log.Printf("Hotkey triggered: %s", hk.original)
-			go hk.callback()
+// checkReleased disarms hotkeys whose combo was broken by a release and returns
+// on-release hotkeys that should fire now. Callers must hold m.mu.
+func (m *Manager) checkReleased() []*registeredHotkey {
+	var fire []*registeredHotkey
+	for _, hk := range m.hotkeys {
+		if !hk.active || m.isHeld(hk.parts) {
+			continue
+		}
+		hk.active = false
+
+		policy := m.policyFor(hk)
+		if policy.OnRelease && m.debounced(hk, policy) {
+			fire = append(fire, hk)
+		}
+	}
+	return fire
+}
+
+// isHeld reports whether every part of a combo is currently pressed
+func (m *Manager) isHeld(parts []string) bool {
+	for _, part := range parts {
+		if !m.currentState[part] {
+			return false
+		}
+	}
+	return true
+}
+
+// onlyHeld reports whether nothing outside the combo is pressed. A sided
+// modifier counts as part of the combo when its generic name is used
+// (LCTRL for "Ctrl+1") and vice versa (CTRL for "RCtrl+1").
+func (m *Manager) onlyHeld(parts []string) bool {
+	inCombo := make(map[string]bool, len(parts))
+	derived := make(map[string]bool)
+	for _, part := range parts {
+		inCombo[part] = true
+		if generic, ok := sidedModifiers[part]; ok {
+			derived[generic] = true
+		}
+	}
+	for key := range m.currentState {
+		if inCombo[key] || derived[key] {
+			continue
+		}
+		if generic, ok := sidedModifiers[key]; ok && inCombo[generic] {
+			continue
 		}
+		return false
 	}
+	return true
+}
+
+// debounced records a firing and reports whether it is allowed under the policy's debounce
+func (m *Manager) debounced(hk *registeredHotkey, policy TriggerPolicy) bool {
+	interval := policy.Debounce
+	if interval == 0 {
+		interval = DefaultDebounce
+	}
+	now := time.Now()
+	if interval > 0 && now.Sub(hk.lastFired) < interval {
+		return false
+	}
+	hk.lastFired = now
+	return true
+}
+
+// policyFor returns the effective trigger policy of a hotkey
+func (m *Manager) policyFor(hk *registeredHotkey) TriggerPolicy {
+	if hk.policy != nil {
+		return *hk.policy
+	}
+	return m.policy
+}
+
+// Status returns the current state of the platform hooks
+func (m *Manager) Status() EngineStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// setStatus is called by the platform code whenever the hooks change state.
+// The Reenabled count is kept across calls.
+func (m *Manager) setStatus(status EngineStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status.Reenabled = m.status.Reenabled
+	m.status = status
 }
 
 // Start initiates the platform-specific global hooks.
@@ -100,3 +524,10 @@ func (m *Manager) checkMatches() {
 func (m *Manager) Start() error {
 	return m.startPlatform()
 }
+
+// Stop ends the platform hooks. The Linux engine stops looking for new
+// devices and closes the ones it reads; the Windows and macOS hooks live
+// until the process exits.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
@@ -6,14 +6,19 @@ package hotkey
 #cgo LDFLAGS: -framework CoreGraphics -framework CoreFoundation -framework ApplicationServices
 #include <CoreGraphics/CoreGraphics.h>
 #include <CoreFoundation/CoreFoundation.h>
+#include <ApplicationServices/ApplicationServices.h>
 
 // Forward declaration of the callback
 CGEventRef eventCallback(CGEventTapProxy proxy, CGEventType type, CGEventRef event, void *refcon);
 
-// Helper to start the loop
-static inline void startEventTap(void* refcon) {
+// activeTap is kept so the callback can re-enable the tap after macOS disables it
+static CFMachPortRef activeTap = NULL;
+
+// createEventTap creates the listen-only session tap; returns NULL when the
+// process lacks Accessibility (or Input Monitoring) permission
+static inline CFMachPortRef createEventTap(void* refcon) {
     CGEventMask mask = kCGEventMaskForAllEvents;
-    CFMachPortRef tap = CGEventTapCreate(
+    activeTap = CGEventTapCreate(
         kCGSessionEventTap,
         kCGHeadInsertEventTap,
         kCGEventTapOptionListenOnly,
@@ -21,26 +26,50 @@ static inline void startEventTap(void* refcon) {
         eventCallback,
         refcon
     );
+    return activeTap;
+}
 
-    if (!tap) {
-        printf("Hotkey Engine: ERROR! Failed to create CGEventTap. Accessibility permissions missing?\n");
-        return;
+static inline void reenableEventTap() {
+    if (activeTap) {
+        CGEventTapEnable(activeTap, true);
     }
+}
 
+// runEventTap attaches the tap to the current run loop and blocks running it
+static inline void runEventTap(CFMachPortRef tap) {
     CFRunLoopSourceRef source = CFMachPortCreateRunLoopSource(kCFAllocatorDefault, tap, 0);
     CFRunLoopAddSource(CFRunLoopGetCurrent(), source, kCFRunLoopCommonModes);
     CGEventTapEnable(tap, true);
-    printf("Hotkey Engine: CGEventTap successfully initialized.\n");
     CFRunLoopRun();
 }
+
+static inline int isAccessibilityTrusted() {
+    return AXIsProcessTrusted() ? 1 : 0;
+}
 */
 import "C"
 import (
-	"log"
+	"runtime"
 	"runtime/cgo"
 	"strconv"
 	"strings"
+	"time"
 	"unsafe"
+
+	"vkvm/internal/logging"
+)
+
+// Device-dependent modifier bits from IOKit's IOLLEvent.h (NX_DEVICE*KEYMASK).
+// CGEventFlags only exposes generic masks, but the low bits carry the side.
+const (
+	nxDeviceLCtlKeyMask   = 0x00000001
+	nxDeviceLShiftKeyMask = 0x00000002
+	nxDeviceRShiftKeyMask = 0x00000004
+	nxDeviceLCmdKeyMask   = 0x00000008
+	nxDeviceRCmdKeyMask   = 0x00000010
+	nxDeviceLAltKeyMask   = 0x00000020
+	nxDeviceRAltKeyMask   = 0x00000040
+	nxDeviceRCtlKeyMask   = 0x00002000
 )
 
 //export eventCallback
@@ -49,6 +78,13 @@ func eventCallback(proxy C.CGEventTapProxy, eventType C.CGEventType, event C.CGE
 	m := h.Value().(*Manager)
 
 	switch eventType {
+	case C.kCGEventTapDisabledByTimeout, C.kCGEventTapDisabledByUserInput:
+		// macOS turns the tap off if a callback is too slow (or on secure input);
+		// without re-enabling it, hotkeys silently stop until restart
+		count := m.noteTapReenabled()
+		logging.Warnf("Hotkey Engine: CGEventTap was disabled by the system (type %d), re-enabling (#%d)", int(eventType), count)
+		C.reenableEventTap()
+
 	case C.kCGEventKeyDown, C.kCGEventKeyUp:
 		isDown := eventType == C.kCGEventKeyDown
 		keyCode := uint16(C.CGEventGetIntegerValueField(event, C.kCGKeyboardEventKeycode))
@@ -62,16 +98,25 @@ func eventCallback(proxy C.CGEventTapProxy, eventType C.CGEventType, event C.CGE
 		flags := C.CGEventGetFlags(event)
 		keyCode := uint16(C.CGEventGetIntegerValueField(event, C.kCGKeyboardEventKeycode))
 
-		// Determine which modifier and its state based on keycode and flags
+		// Determine which modifier and its state based on keycode and the
+		// device-dependent flag bits, which track each side separately
 		switch keyCode {
-		case 55, 54: // Command keys
-			m.UpdateState("CMD", (flags&C.kCGEventFlagMaskCommand) != 0)
-		case 56, 60: // Shift keys
-			m.UpdateState("SHIFT", (flags&C.kCGEventFlagMaskShift) != 0)
-		case 58, 61: // Alt/Option keys
-			m.UpdateState("ALT", (flags&C.kCGEventFlagMaskAlternate) != 0)
-		case 59, 62: // Control keys
-			m.UpdateState("CTRL", (flags&C.kCGEventFlagMaskControl) != 0)
+		case 55: // Left Command
+			m.UpdateState("LCMD", (flags&nxDeviceLCmdKeyMask) != 0)
+		case 54: // Right Command
+			m.UpdateState("RCMD", (flags&nxDeviceRCmdKeyMask) != 0)
+		case 56: // Left Shift
+			m.UpdateState("LSHIFT", (flags&nxDeviceLShiftKeyMask) != 0)
+		case 60: // Right Shift
+			m.UpdateState("RSHIFT", (flags&nxDeviceRShiftKeyMask) != 0)
+		case 58: // Left Alt/Option
+			m.UpdateState("LALT", (flags&nxDeviceLAltKeyMask) != 0)
+		case 61: // Right Alt/Option
+			m.UpdateState("RALT", (flags&nxDeviceRAltKeyMask) != 0)
+		case 59: // Left Control
+			m.UpdateState("LCTRL", (flags&nxDeviceLCtlKeyMask) != 0)
+		case 62: // Right Control
+			m.UpdateState("RCTRL", (flags&nxDeviceRCtlKeyMask) != 0)
 		}
 
 	case C.kCGEventLeftMouseDown, C.kCGEventLeftMouseUp,
@@ -107,31 +152,92 @@ func eventCallback(proxy C.CGEventTapProxy, eventType C.CGEventType, event C.CGE
 	return event
 }
 
+// tapRetryInterval is how often tap creation is retried while permission is missing
+const tapRetryInterval = 5 * time.Second
+
+// noteTapReenabled counts a system-disabled tap being turned back on
+func (m *Manager) noteTapReenabled() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.Reenabled++
+	return m.status.Reenabled
+}
+
 func (m *Manager) startPlatform() error {
 	handle := cgo.NewHandle(m)
 	go func() {
-		log.Println("Hotkey Engine: macOS CGEventTap started.")
-		C.startEventTap(unsafe.Pointer(handle))
+		// The tap must be created and run on the same locked thread
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		var tap C.CFMachPortRef
+		for {
+			tap = C.createEventTap(unsafe.Pointer(handle))
+			if tap != 0 {
+				break
+			}
+			trusted := C.isAccessibilityTrusted() != 0
+			m.setStatus(EngineStatus{
+				PermissionRequired: !trusted,
+				Error:              "failed to create CGEventTap",
+			})
+			logging.Warnf("Hotkey Engine: Failed to create CGEventTap (accessibility trusted: %v). Retrying in %s...", trusted, tapRetryInterval)
+			time.Sleep(tapRetryInterval)
+		}
+
+		m.setStatus(EngineStatus{Running: true})
+		logging.Infof("Hotkey Engine: macOS CGEventTap started.")
+		C.runEventTap(tap)
 	}()
 	return nil
 }
 
 func macKeyCodeToName(code uint16) string {
 	switch code {
-	case 55, 54:
-		return "CMD"
-	case 56, 60:
-		return "SHIFT"
-	case 58, 61:
-		return "ALT"
-	case 59, 62:
-		return "CTRL"
+	case 55:
+		return "LCMD"
+	case 54:
+		return "RCMD"
+	case 56:
+		return "LSHIFT"
+	case 60:
+		return "RSHIFT"
+	case 58:
+		return "LALT"
+	case 61:
+		return "RALT"
+	case 59:
+		return "LCTRL"
+	case 62:
+		return "RCTRL"
 	case 49:
 		return "SPACE"
 	case 36:
 		return "ENTER"
 	case 53:
 		return "ESC"
+	case 48:
+		return "TAB"
+	case 51:
+		return "BACKSPACE"
+	case 117:
+		return "DELETE"
+	case 115:
+		return "HOME"
+	case 119:
+		return "END"
+	case 116:
+		return "PAGEUP"
+	case 121:
+		return "PAGEDOWN"
+	case 123:
+		return "LEFT"
+	case 124:
+		return "RIGHT"
+	case 125:
+		return "DOWN"
+	case 126:
+		return "UP"
 
 	case 0:
 		return "A"
@@ -231,6 +337,92 @@ func macKeyCodeToName(code uint16) string {
 		return "F11"
 	case 111:
 		return "F12"
+	case 105:
+		return "F13"
+	case 107:
+		return "F14"
+	case 113:
+		return "F15"
+	case 106:
+		return "F16"
+	case 64:
+		return "F17"
+	case 79:
+		return "F18"
+	case 80:
+		return "F19"
+	case 90:
+		return "F20"
+
+	// Keypad
+	case 82:
+		return "NUM0"
+	case 83:
+		return "NUM1"
+	case 84:
+		return "NUM2"
+	case 85:
+		return "NUM3"
+	case 86:
+		return "NUM4"
+	case 87:
+		return "NUM5"
+	case 88:
+		return "NUM6"
+	case 89:
+		return "NUM7"
+	case 91:
+		return "NUM8"
+	case 92:
+		return "NUM9"
+	case 65:
+		return "NUMDEC"
+	case 67:
+		return "NUMMUL"
+	case 69:
+		return "NUMADD"
+	case 75:
+		return "NUMDIV"
+	case 76:
+		return "NUMENTER"
+	case 78:
+		return "NUMSUB"
+	case 81:
+		return "NUMEQUALS"
+	case 71:
+		return "NUMLOCK" // Keypad Clear sits where Num Lock is on PC keyboards
+
+	// OEM punctuation (ANSI positions)
+	case 41:
+		return "SEMICOLON"
+	case 24:
+		return "EQUALS"
+	case 43:
+		return "COMMA"
+	case 27:
+		return "MINUS"
+	case 47:
+		return "PERIOD"
+	case 44:
+		return "SLASH"
+	case 50:
+		return "BACKTICK"
+	case 33:
+		return "LBRACKET"
+	case 42:
+		return "BACKSLASH"
+	case 30:
+		return "RBRACKET"
+	case 39:
+		return "QUOTE"
+
+	// Volume keys (on keyboards that send them as regular key events)
+	case 72:
+		return "VOLUMEUP"
+	case 73:
+		return "VOLUMEDOWN"
+	case 74:
+		return "VOLUMEMUTE"
 	}
 	return ""
 }
@@ -0,0 +1,369 @@
+//go:build linux
+
+package hotkey
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"vkvm/internal/logging"
+)
+
+// The Linux engine reads key and button events straight from the evdev
+// devices (/dev/input/event*), which works the same under X11 and Wayland.
+// It needs read access to those devices, usually by membership in the
+// "input" group. Events are only observed, never grabbed, so hotkeys can't
+// be swallowed on Linux.
+
+const (
+	evKey = 0x01 // EV_KEY
+
+	keyA    = 30    // KEY_A, present on keyboards
+	btnLeft = 0x110 // BTN_LEFT, present on mice
+
+	// devicesRescanInterval is how often newly plugged keyboards and mice are picked up
+	devicesRescanInterval = 5 * time.Second
+)
+
+// inputEventSize is sizeof(struct input_event): a timeval followed by
+// type (u16), code (u16) and value (s32)
+var inputEventSize = int(unsafe.Sizeof(unix.Timeval{})) + 8
+
+func (m *Manager) startPlatform() error {
+	go func() {
+		var mu sync.Mutex
+		open := make(map[string]*os.File)
+
+		ticker := time.NewTicker(devicesRescanInterval)
+		defer ticker.Stop()
+		for {
+			opened, denied := 0, 0
+			paths, _ := filepath.Glob("/dev/input/event*")
+			for _, path := range paths {
+				mu.Lock()
+				known := open[path] != nil
+				mu.Unlock()
+				if known {
+					opened++
+					continue
+				}
+
+				f, name, err := openInputDevice(path)
+				if errors.Is(err, os.ErrPermission) {
+					denied++
+					continue
+				}
+				if err != nil || f == nil {
+					continue // not a keyboard or mouse
+				}
+				logging.Infof("Hotkey Engine: Listening to %s (%s)", name, path)
+				opened++
+
+				mu.Lock()
+				open[path] = f
+				mu.Unlock()
+				go func() {
+					m.readInputDevice(f)
+					mu.Lock()
+					delete(open, path)
+					mu.Unlock()
+				}()
+			}
+
+			switch {
+			case opened > 0:
+				if !m.Status().Running {
+					logging.Infof("Hotkey Engine: Linux evdev hooks started.")
+				}
+				m.setStatus(EngineStatus{Running: true})
+			case denied > 0:
+				m.setStatus(EngineStatus{
+					PermissionRequired: true,
+					Error:              "no permission to read /dev/input (add your user to the input group)",
+				})
+			default:
+				m.setStatus(EngineStatus{Error: "no keyboard or mouse found in /dev/input"})
+			}
+
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				// Closing the devices ends their readers
+				mu.Lock()
+				for _, f := range open {
+					f.Close()
+				}
+				mu.Unlock()
+				m.setStatus(EngineStatus{Error: "stopped"})
+				logging.Infof("Hotkey Engine: Linux evdev hooks stopped.")
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// openInputDevice opens an evdev device if it is a keyboard or mouse. It
+// returns a nil file for other devices (power buttons, lid switches, ...).
+func openInputDevice(path string) (*os.File, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var keys [(btnLeft + 8) / 8]byte
+	if err := ioctl(f, eviocgbit(evKey, len(keys)), unsafe.Pointer(&keys[0])); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	hasBit := func(bit int) bool { return keys[bit/8]&(1<<(bit%8)) != 0 }
+	if !hasBit(keyA) && !hasBit(btnLeft) {
+		f.Close()
+		return nil, "", nil
+	}
+
+	var name [256]byte
+	if err := ioctl(f, eviocgname(len(name)), unsafe.Pointer(&name[0])); err != nil {
+		return f, filepath.Base(path), nil
+	}
+	return f, strings.TrimRight(string(name[:]), "\x00"), nil
+}
+
+// readInputDevice feeds key and button events from f to the Manager until
+// the device goes away
+func (m *Manager) readInputDevice(f *os.File) {
+	defer f.Close()
+
+	buf := make([]byte, inputEventSize*64)
+	tv := inputEventSize - 8
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			select {
+			case <-m.stop:
+			default:
+				logging.Warnf("Hotkey Engine: Stopped reading %s: %v", f.Name(), err)
+			}
+			return
+		}
+		for off := 0; off+inputEventSize <= n; off += inputEventSize {
+			ev := buf[off : off+inputEventSize]
+			if binary.NativeEndian.Uint16(ev[tv:]) != evKey {
+				continue
+			}
+			code := binary.NativeEndian.Uint16(ev[tv+2:])
+			value := int32(binary.NativeEndian.Uint32(ev[tv+4:]))
+
+			name := evdevCodeToName(code)
+			if name == "" {
+				continue
+			}
+			// value 1 is a press, 2 an autorepeat and 0 a release
+			m.HandleKey(name, value != 0)
+		}
+	}
+}
+
+// ioctl issues an evdev ioctl that fills the buffer at arg
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// eviocgbit is EVIOCGBIT(ev, size): the event codes a device supports
+func eviocgbit(ev, size int) uintptr {
+	return iocRead(0x20+ev, size)
+}
+
+// eviocgname is EVIOCGNAME(size): the device name
+func eviocgname(size int) uintptr {
+	return iocRead(0x06, size)
+}
+
+// iocRead is the kernel's _IOR('E', nr, size)
+func iocRead(nr, size int) uintptr {
+	const iocRead = 2
+	return uintptr(iocRead<<30 | size<<16 | 'E'<<8 | nr)
+}
+
+// evdevCodeToName maps Linux key codes (linux/input-event-codes.h) to hotkey names
+func evdevCodeToName(code uint16) string {
+	switch code {
+	// Modifiers
+	case 29:
+		return "LCTRL"
+	case 97:
+		return "RCTRL"
+	case 56:
+		return "LALT"
+	case 100:
+		return "RALT"
+	case 42:
+		return "LSHIFT"
+	case 54:
+		return "RSHIFT"
+	case 125:
+		return "LCMD" // Super key as CMD for consistency
+	case 126:
+		return "RCMD"
+
+	case 1:
+		return "ESC"
+	case 14:
+		return "BACKSPACE"
+	case 15:
+		return "TAB"
+	case 28:
+		return "ENTER"
+	case 57:
+		return "SPACE"
+	case 58:
+		return "CAPSLOCK"
+	case 69:
+		return "NUMLOCK"
+	case 70:
+		return "SCROLLLOCK"
+	case 99:
+		return "PRINTSCREEN"
+	case 119:
+		return "PAUSE"
+	case 102:
+		return "HOME"
+	case 103:
+		return "UP"
+	case 104:
+		return "PAGEUP"
+	case 105:
+		return "LEFT"
+	case 106:
+		return "RIGHT"
+	case 107:
+		return "END"
+	case 108:
+		return "DOWN"
+	case 109:
+		return "PAGEDOWN"
+	case 110:
+		return "INSERT"
+	case 111:
+		return "DELETE"
+
+	// Punctuation (US layout positions)
+	case 12:
+		return "MINUS"
+	case 13:
+		return "EQUALS"
+	case 26:
+		return "LBRACKET"
+	case 27:
+		return "RBRACKET"
+	case 39:
+		return "SEMICOLON"
+	case 40:
+		return "QUOTE"
+	case 41:
+		return "BACKTICK"
+	case 43:
+		return "BACKSLASH"
+	case 51:
+		return "COMMA"
+	case 52:
+		return "PERIOD"
+	case 53:
+		return "SLASH"
+
+	// Numpad
+	case 55:
+		return "NUMMUL"
+	case 74:
+		return "NUMSUB"
+	case 78:
+		return "NUMADD"
+	case 83:
+		return "NUMDEC"
+	case 96:
+		return "NUMENTER"
+	case 98:
+		return "NUMDIV"
+	case 117:
+		return "NUMEQUALS"
+	case 82:
+		return "NUM0"
+	case 79, 80, 81:
+		return fmt.Sprintf("NUM%d", code-78)
+	case 75, 76, 77:
+		return fmt.Sprintf("NUM%d", code-71)
+	case 71, 72, 73:
+		return fmt.Sprintf("NUM%d", code-64)
+
+	// Media keys
+	case 113:
+		return "VOLUMEMUTE"
+	case 114:
+		return "VOLUMEDOWN"
+	case 115:
+		return "VOLUMEUP"
+	case 163:
+		return "MEDIANEXT"
+	case 164:
+		return "MEDIAPLAY"
+	case 165:
+		return "MEDIAPREV"
+	case 166:
+		return "MEDIASTOP"
+
+	// Mouse buttons, numbered like the other platforms
+	case btnLeft:
+		return "MOUSE1"
+	case 0x112:
+		return "MOUSE2" // BTN_MIDDLE
+	case 0x111:
+		return "MOUSE3" // BTN_RIGHT
+	case 0x113:
+		return "MOUSE4" // BTN_SIDE
+	case 0x114:
+		return "MOUSE5" // BTN_EXTRA
+	}
+
+	// Letters by keyboard row
+	for _, row := range []struct {
+		first   uint16
+		letters string
+	}{{16, "QWERTYUIOP"}, {30, "ASDFGHJKL"}, {44, "ZXCVBNM"}} {
+		if code >= row.first && int(code-row.first) < len(row.letters) {
+			return string(row.letters[code-row.first])
+		}
+	}
+
+	// Numbers 1-9, 0
+	if code >= 2 && code <= 10 {
+		return fmt.Sprintf("%d", code-1)
+	}
+	if code == 11 {
+		return "0"
+	}
+
+	// F1-F10, F11-F12, F13-F24
+	switch {
+	case code >= 59 && code <= 68:
+		return fmt.Sprintf("F%d", code-58)
+	case code == 87 || code == 88:
+		return fmt.Sprintf("F%d", code-76)
+	case code >= 183 && code <= 194:
+		return fmt.Sprintf("F%d", code-170)
+	}
+
+	return ""
+}
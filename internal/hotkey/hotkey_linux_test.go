@@ -0,0 +1,76 @@
+//go:build linux
+
+package hotkey
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvdevCodeToName(t *testing.T) {
+	tests := []struct {
+		code uint16
+		want string
+	}{
+		{29, "LCTRL"},
+		{100, "RALT"},
+		{125, "LCMD"},
+		{16, "Q"},
+		{38, "L"},
+		{50, "M"},
+		{2, "1"},
+		{10, "9"},
+		{11, "0"},
+		{59, "F1"},
+		{68, "F10"},
+		{87, "F11"},
+		{88, "F12"},
+		{183, "F13"},
+		{194, "F24"},
+		{79, "NUM1"},
+		{75, "NUM4"},
+		{73, "NUM9"},
+		{82, "NUM0"},
+		{96, "NUMENTER"},
+		{btnLeft, "MOUSE1"},
+		{0x111, "MOUSE3"},
+		{0x114, "MOUSE5"},
+		{0, ""},   // KEY_RESERVED
+		{116, ""}, // KEY_POWER
+	}
+	for _, tt := range tests {
+		if got := evdevCodeToName(tt.code); got != tt.want {
+			t.Errorf("evdevCodeToName(%d) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+// Event names must be canonical, or hotkeys naming the key never match it
+func TestEvdevNamesCanonical(t *testing.T) {
+	for code := range uint16(0x120) {
+		name := evdevCodeToName(code)
+		if name == "" {
+			continue
+		}
+		if parts, err := parseHotkey(name); err != nil || len(parts) != 1 || parts[0] != name {
+			t.Errorf("code %d maps to %q, which parses as %v: %v", code, name, parts, err)
+		}
+	}
+}
+
+func TestStopEndsRescans(t *testing.T) {
+	m := NewManager()
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	m.Stop()
+	m.Stop() // idempotent
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Status().Error != "stopped" {
+		if time.Now().After(deadline) {
+			t.Fatalf("status %+v after Stop", m.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
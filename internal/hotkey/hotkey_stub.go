@@ -1,10 +1,11 @@
-//go:build !windows && !darwin
+//go:build !windows && !darwin && !linux
 
 package hotkey
 
-import "log"
+import "vkvm/internal/logging"
 
 func (m *Manager) startPlatform() error {
-	log.Println("Hotkey Engine: Global hooks not supported on this platform.")
+	logging.Infof("Hotkey Engine: Global hooks not supported on this platform.")
+	m.setStatus(EngineStatus{Error: "global hotkeys are not supported on this platform"})
 	return nil
 }
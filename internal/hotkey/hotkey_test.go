@@ -0,0 +1,266 @@
+package hotkey
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// recorder collects the actions of fired hotkeys; callbacks run on their own
+// goroutines
+type recorder chan string
+
+func newRecorder() recorder { return make(recorder, 16) }
+
+// binding returns a Binding that records action when it fires
+func (r recorder) binding(hotkey, action string) Binding {
+	return Binding{Hotkey: hotkey, Action: action, Callback: func() { r <- action }}
+}
+
+// expect fails the test unless exactly the actions in want fired since the
+// last call, in any order
+func (r recorder) expect(t *testing.T, want ...string) {
+	t.Helper()
+	var got []string
+	for range want {
+		select {
+		case a := <-r:
+			got = append(got, a)
+		case <-time.After(time.Second):
+			t.Fatalf("fired %v, want %v", got, want)
+		}
+	}
+	select {
+	case a := <-r:
+		t.Fatalf("fired %v and %s, want %v", got, a, want)
+	case <-time.After(50 * time.Millisecond):
+	}
+	slices.Sort(got)
+	want = slices.Sorted(slices.Values(want))
+	if !slices.Equal(got, want) {
+		t.Fatalf("fired %v, want %v", got, want)
+	}
+}
+
+// press sends key-down events for keys in order
+func press(m *Manager, keys ...string) {
+	for _, k := range keys {
+		m.UpdateState(k, true)
+	}
+}
+
+// release sends key-up events for keys in order
+func release(m *Manager, keys ...string) {
+	for _, k := range keys {
+		m.UpdateState(k, false)
+	}
+}
+
+func TestReplaceAllKeepsHeldChord(t *testing.T) {
+	m := NewManager()
+	m.SetPolicy(TriggerPolicy{Debounce: -1})
+	r := newRecorder()
+	bindings := []Binding{r.binding("Ctrl+1", "profile:A"), r.binding("Ctrl+2", "profile:B")}
+	if err := m.ReplaceAll(bindings); err != nil {
+		t.Fatal(err)
+	}
+
+	press(m, "LCTRL", "1")
+	r.expect(t, "profile:A")
+
+	// A refresh while the chord is held must not re-fire it on key repeat
+	if err := m.ReplaceAll(bindings); err != nil {
+		t.Fatal(err)
+	}
+	press(m, "1")
+	r.expect(t)
+
+	// Once released, the chord fires again
+	release(m, "1")
+	press(m, "1")
+	r.expect(t, "profile:A")
+	release(m, "1", "LCTRL")
+
+	// A binding whose action changed is a new hotkey
+	if err := m.ReplaceAll([]Binding{r.binding("Ctrl+1", "profile:C")}); err != nil {
+		t.Fatal(err)
+	}
+	press(m, "LCTRL", "1")
+	r.expect(t, "profile:C")
+	release(m, "1", "LCTRL")
+}
+
+func TestReplaceAllKeepsDebounce(t *testing.T) {
+	m := NewManager()
+	m.SetPolicy(TriggerPolicy{Debounce: time.Hour})
+	r := newRecorder()
+	bindings := []Binding{r.binding("Ctrl+1", "profile:A")}
+	if err := m.ReplaceAll(bindings); err != nil {
+		t.Fatal(err)
+	}
+
+	press(m, "LCTRL", "1")
+	release(m, "1", "LCTRL")
+	r.expect(t, "profile:A")
+
+	if err := m.ReplaceAll(bindings); err != nil {
+		t.Fatal(err)
+	}
+	press(m, "LCTRL", "1")
+	release(m, "1", "LCTRL")
+	r.expect(t)
+}
+
+func TestReplaceAllRemovesBindings(t *testing.T) {
+	m := NewManager()
+	m.SetPolicy(TriggerPolicy{Debounce: -1})
+	r := newRecorder()
+	if err := m.ReplaceAll([]Binding{r.binding("Ctrl+1", "profile:A"), r.binding("Ctrl+2", "profile:B")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.ReplaceAll([]Binding{r.binding("Ctrl+1", "profile:A")}); err != nil {
+		t.Fatal(err)
+	}
+
+	press(m, "LCTRL", "2")
+	release(m, "2")
+	press(m, "1")
+	release(m, "1", "LCTRL")
+	r.expect(t, "profile:A")
+}
+
+// send replays events of the form "+KEY" (down) and "-KEY" (up)
+func send(m *Manager, events ...string) {
+	for _, e := range events {
+		m.UpdateState(e[1:], e[0] == '+')
+	}
+}
+
+func TestTriggerPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy TriggerPolicy
+		events []string
+		fired  int
+	}{
+		{
+			name:   "exact match fires on the combo",
+			policy: TriggerPolicy{ExactMatch: true, Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+1"},
+			fired:  1,
+		},
+		{
+			name:   "extra modifier blocks exact match",
+			policy: TriggerPolicy{ExactMatch: true, Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+LSHIFT", "+1"},
+		},
+		{
+			name:   "extra modifier does not block a loose match",
+			policy: TriggerPolicy{Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+LSHIFT", "+1"},
+			fired:  1,
+		},
+		{
+			name:   "on release waits for the combo to be released",
+			policy: TriggerPolicy{OnRelease: true, Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+1"},
+		},
+		{
+			name:   "on release fires once when the combo is released",
+			policy: TriggerPolicy{OnRelease: true, Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+1", "-1", "-LALT", "-LCTRL"},
+			fired:  1,
+		},
+		{
+			name:   "on release with exact match is cancelled by an extra key",
+			policy: TriggerPolicy{ExactMatch: true, OnRelease: true, Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+1", "+LSHIFT", "-1", "-LSHIFT", "-LALT", "-LCTRL"},
+		},
+		{
+			name:   "key repeat does not re-fire",
+			policy: TriggerPolicy{Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+1", "+1", "+1"},
+			fired:  1,
+		},
+		{
+			name:   "debounce drops a repeat inside the window",
+			policy: TriggerPolicy{Debounce: time.Hour},
+			events: []string{"+LCTRL", "+LALT", "+1", "-1", "+1"},
+			fired:  1,
+		},
+		{
+			name:   "no debounce fires every press",
+			policy: TriggerPolicy{Debounce: -1},
+			events: []string{"+LCTRL", "+LALT", "+1", "-1", "+1"},
+			fired:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.SetPolicy(tt.policy)
+			r := newRecorder()
+			if err := m.ReplaceAll([]Binding{r.binding("Ctrl+Alt+1", "a")}); err != nil {
+				t.Fatal(err)
+			}
+			send(m, tt.events...)
+			r.expect(t, slices.Repeat([]string{"a"}, tt.fired)...)
+		})
+	}
+}
+
+func TestSidedModifiers(t *testing.T) {
+	tests := []struct {
+		name   string
+		hotkey string
+		policy TriggerPolicy
+		events []string
+		fired  int
+	}{
+		{name: "generic matches left", hotkey: "Ctrl+1", events: []string{"+LCTRL", "+1"}, fired: 1},
+		{name: "generic matches right", hotkey: "Ctrl+1", events: []string{"+RCTRL", "+1"}, fired: 1},
+		{name: "right matches right", hotkey: "RCtrl+1", events: []string{"+RCTRL", "+1"}, fired: 1},
+		{name: "right rejects left", hotkey: "RCtrl+1", events: []string{"+LCTRL", "+1"}},
+		{name: "left rejects right", hotkey: "LAlt+1", events: []string{"+RALT", "+1"}},
+		{name: "aliases name sides", hotkey: "ControlRight+AltGr+1", events: []string{"+RCTRL", "+RALT", "+1"}, fired: 1},
+		{
+			name:   "generic stays held while the other side is down",
+			hotkey: "Ctrl+1",
+			events: []string{"+LCTRL", "+RCTRL", "-LCTRL", "+1"},
+			fired:  1,
+		},
+		{
+			name:   "generic is released with both sides",
+			hotkey: "Ctrl+1",
+			events: []string{"+LCTRL", "+RCTRL", "-LCTRL", "-RCTRL", "+1"},
+		},
+		{
+			name:   "sided key is part of an exact generic combo",
+			hotkey: "Ctrl+1",
+			policy: TriggerPolicy{ExactMatch: true},
+			events: []string{"+RCTRL", "+1"},
+			fired:  1,
+		},
+		{
+			name:   "other side is extra in an exact sided combo",
+			hotkey: "RCtrl+1",
+			policy: TriggerPolicy{ExactMatch: true},
+			events: []string{"+RCTRL", "+LCTRL", "+1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			tt.policy.Debounce = -1
+			m.SetPolicy(tt.policy)
+			r := newRecorder()
+			if err := m.ReplaceAll([]Binding{r.binding(tt.hotkey, "a")}); err != nil {
+				t.Fatal(err)
+			}
+			send(m, tt.events...)
+			r.expect(t, slices.Repeat([]string{"a"}, tt.fired)...)
+		})
+	}
+}
@@ -4,12 +4,13 @@ package hotkey
 
 import (
 	"fmt"
-	"log"
 	"runtime"
 	"syscall"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
+
+	"vkvm/internal/logging"
 )
 
 var (
@@ -41,6 +42,8 @@ const (
 	WM_MBUTTONUP   = 0x0208
 	WM_XBUTTONDOWN = 0x020B
 	WM_XBUTTONUP   = 0x020C
+
+	LLKHF_EXTENDED = 0x01
 )
 
 type KBDLLHOOKSTRUCT struct {
@@ -83,7 +86,8 @@ func (m *Manager) startPlatform() error {
 			0,
 		)
 		if keyboardHook == 0 {
-			log.Printf("Error setting keyboard hook: %v", err)
+			logging.Errorf("Hotkey Engine: Failed to set keyboard hook: %v", err)
+			m.setStatus(EngineStatus{Error: fmt.Sprintf("failed to install keyboard hook: %v", err)})
 			return
 		}
 
@@ -94,11 +98,13 @@ func (m *Manager) startPlatform() error {
 			0,
 		)
 		if mouseHook == 0 {
-			log.Printf("Error setting mouse hook: %v", err)
+			logging.Errorf("Hotkey Engine: Failed to set mouse hook: %v", err)
+			m.setStatus(EngineStatus{Error: fmt.Sprintf("failed to install mouse hook: %v", err)})
 			return
 		}
 
-		log.Println("Hotkey Engine: Windows Global Hooks started.")
+		m.setStatus(EngineStatus{Running: true})
+		logging.Infof("Hotkey Engine: Windows Global Hooks started.")
 
 		var msg struct {
 			Hwnd    syscall.Handle
@@ -120,6 +126,7 @@ func (m *Manager) startPlatform() error {
 
 		procUnhookWindowsHookEx.Call(keyboardHook)
 		procUnhookWindowsHookEx.Call(mouseHook)
+		m.setStatus(EngineStatus{Error: "hook message loop exited"})
 	}()
 
 	return nil
@@ -129,9 +136,16 @@ func keyboardHookPtr(nCode int, wParam uintptr, lParam uintptr) uintptr {
 	if nCode == 0 {
 		kbd := (*KBDLLHOOKSTRUCT)(unsafe.Pointer(lParam))
 		keyName := vkCodeToName(kbd.VkCode)
+		// The numpad Enter shares VK_RETURN with the main Enter key and is only
+		// distinguishable by the extended-key flag
+		if kbd.VkCode == 0x0D && kbd.Flags&LLKHF_EXTENDED != 0 {
+			keyName = "NUMENTER"
+		}
 		if keyName != "" {
 			isDown := wParam == WM_KEYDOWN || wParam == WM_SYSKEYDOWN
-			instanceManager.UpdateState(keyName, isDown)
+			if instanceManager.HandleKey(keyName, isDown) {
+				return 1 // swallowed: don't pass the key on to other applications
+			}
 		}
 	}
 	ret, _, _ := procCallNextHookEx.Call(keyboardHook, uintptr(nCode), wParam, lParam)
@@ -184,14 +198,30 @@ func mouseHookPtr(nCode int, wParam uintptr, lParam uintptr) uintptr {
 func vkCodeToName(vk uint32) string {
 	// Modifier keys
 	switch vk {
-	case 0x11, 0xA2, 0xA3:
+	// Low-level hooks report the sided virtual keys; the Manager derives
+	// the generic CTRL/ALT/SHIFT/CMD state from them
+	case 0x11:
 		return "CTRL"
-	case 0x12, 0xA4, 0xA5:
+	case 0xA2:
+		return "LCTRL"
+	case 0xA3:
+		return "RCTRL"
+	case 0x12:
 		return "ALT"
-	case 0x10, 0xA0, 0xA1:
+	case 0xA4:
+		return "LALT"
+	case 0xA5:
+		return "RALT"
+	case 0x10:
 		return "SHIFT"
-	case 0x5B, 0x5C:
-		return "CMD" // Windows key as CMD for consistency
+	case 0xA0:
+		return "LSHIFT"
+	case 0xA1:
+		return "RSHIFT"
+	case 0x5B:
+		return "LCMD" // Windows key as CMD for consistency
+	case 0x5C:
+		return "RCMD"
 	case 0x20:
 		return "SPACE"
 	case 0x0D:
@@ -230,6 +260,60 @@ func vkCodeToName(vk uint32) string {
 		return "PAUSE"
 	case 0x91:
 		return "SCROLLLOCK"
+	case 0x90:
+		return "NUMLOCK"
+
+	// Numpad operators
+	case 0x6A:
+		return "NUMMUL"
+	case 0x6B:
+		return "NUMADD"
+	case 0x6D:
+		return "NUMSUB"
+	case 0x6E:
+		return "NUMDEC"
+	case 0x6F:
+		return "NUMDIV"
+
+	// OEM punctuation (US layout positions)
+	case 0xBA:
+		return "SEMICOLON"
+	case 0xBB:
+		return "EQUALS"
+	case 0xBC:
+		return "COMMA"
+	case 0xBD:
+		return "MINUS"
+	case 0xBE:
+		return "PERIOD"
+	case 0xBF:
+		return "SLASH"
+	case 0xC0:
+		return "BACKTICK"
+	case 0xDB:
+		return "LBRACKET"
+	case 0xDC:
+		return "BACKSLASH"
+	case 0xDD:
+		return "RBRACKET"
+	case 0xDE:
+		return "QUOTE"
+
+	// Media keys
+	case 0xAD:
+		return "VOLUMEMUTE"
+	case 0xAE:
+		return "VOLUMEDOWN"
+	case 0xAF:
+		return "VOLUMEUP"
+	case 0xB0:
+		return "MEDIANEXT"
+	case 0xB1:
+		return "MEDIAPREV"
+	case 0xB2:
+		return "MEDIASTOP"
+	case 0xB3:
+		return "MEDIAPLAY"
 	}
 
 	// Letters A-Z
@@ -242,8 +326,13 @@ func vkCodeToName(vk uint32) string {
 		return string(rune(vk))
 	}
 
-	// F1-F12
-	if vk >= 0x70 && vk <= 0x7B {
+	// Numpad 0-9
+	if vk >= 0x60 && vk <= 0x69 {
+		return fmt.Sprintf("NUM%d", vk-0x60)
+	}
+
+	// F1-F24
+	if vk >= 0x70 && vk <= 0x87 {
 		return fmt.Sprintf("F%d", vk-0x6F)
 	}
 
@@ -0,0 +1,229 @@
+// Package logging is vkvm's log. Messages have a level and a component, taken
+// from the "Component: " prefix they start with, and are written as text or
+// JSON lines to stderr and to a rotating file next to config.json.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a message
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses "debug", "info", "warn" or "error"; empty is info
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "info":
+		return LevelInfo, nil
+	case "debug":
+		return LevelDebug, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", s)
+}
+
+const (
+	defaultMaxSizeMB = 10
+	defaultMaxFiles  = 3
+)
+
+// Options configures the log
+type Options struct {
+	Level     string // minimum level written (empty: info)
+	JSON      bool   // write JSON lines instead of text
+	Dir       string // directory of the log file (empty: stderr only)
+	File      string // log file name (empty: vkvm.log)
+	MaxSizeMB int    // size at which the file is rotated (0: 10 MB)
+	MaxFiles  int    // rotated files kept besides the current one (0: 3)
+}
+
+var (
+	mu     sync.Mutex
+	opts   Options
+	level  = LevelInfo
+	file   *rotatingFile
+	stderr io.Writer = os.Stderr
+)
+
+func init() {
+	// Route the standard logger through here, for code that still uses it
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{})
+}
+
+// Setup applies opts. It can be called again to apply changed settings; the
+// log file is reopened only if its location changed. An invalid level is
+// reported but the other options are still applied, at info level.
+func Setup(o Options) error {
+	lvl, levelErr := ParseLevel(o.Level)
+	if o.File == "" {
+		o.File = "vkvm.log"
+	}
+	if o.MaxSizeMB <= 0 {
+		o.MaxSizeMB = defaultMaxSizeMB
+	}
+	if o.MaxFiles <= 0 {
+		o.MaxFiles = defaultMaxFiles
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	opts, level = o, lvl
+	path := ""
+	if o.Dir != "" {
+		path = filepath.Join(o.Dir, o.File)
+	}
+	if file != nil && file.path != path {
+		file.Close()
+		file = nil
+	}
+	if path != "" && file == nil {
+		f, err := openRotating(path)
+		if err != nil {
+			return err
+		}
+		file = f
+	}
+	if file != nil {
+		file.setLimits(int64(o.MaxSizeMB)<<20, o.MaxFiles)
+	}
+	return levelErr
+}
+
+// Path returns the current log file, or "" when logging to stderr only
+func Path() string {
+	mu.Lock()
+	defer mu.Unlock()
+	if file == nil {
+		return ""
+	}
+	return file.path
+}
+
+// Close closes the log file; later messages go to stderr only
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+}
+
+// Enabled reports whether messages at l are written, to skip building
+// expensive debug output
+func Enabled(l Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return l >= level
+}
+
+// Debugf logs per-event detail that is only useful when troubleshooting
+func Debugf(format string, args ...any) { logf(LevelDebug, format, args...) }
+
+// Infof logs normal operation
+func Infof(format string, args ...any) { logf(LevelInfo, format, args...) }
+
+// Warnf logs a problem vkvm recovers from
+func Warnf(format string, args ...any) { logf(LevelWarn, format, args...) }
+
+// Errorf logs a failed operation
+func Errorf(format string, args ...any) { logf(LevelError, format, args...) }
+
+// Fatalf logs an error and exits
+func Fatalf(format string, args ...any) {
+	logf(LevelError, format, args...)
+	Close()
+	os.Exit(1)
+}
+
+func logf(l Level, format string, args ...any) {
+	if !Enabled(l) {
+		return
+	}
+	write(l, fmt.Sprintf(format, args...))
+}
+
+// entry is one JSON log line
+type entry struct {
+	Time      string `json:"time"`
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+	Message   string `json:"msg"`
+}
+
+func write(l Level, msg string) {
+	now := time.Now()
+	component, text := splitComponent(strings.TrimRight(msg, "\n"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	var line []byte
+	if opts.JSON {
+		line, _ = json.Marshal(entry{now.Format(time.RFC3339Nano), l.String(), component, text})
+	} else {
+		prefix := ""
+		if component != "" {
+			prefix = component + ": "
+		}
+		line = fmt.Appendf(nil, "%s %-5s %s%s", now.Format("2006/01/02 15:04:05.000"), strings.ToUpper(l.String()), prefix, text)
+	}
+	line = append(line, '\n')
+
+	stderr.Write(line)
+	if file != nil {
+		if _, err := file.Write(line); err != nil {
+			fmt.Fprintf(stderr, "logging: cannot write %s: %v\n", file.path, err)
+		}
+	}
+}
+
+// splitComponent splits the "Component: " prefix of msg, one or two words
+// such as "API" or "WS Client", off the message
+func splitComponent(msg string) (component, text string) {
+	head, rest, ok := strings.Cut(msg, ": ")
+	if !ok || head == "" || len(head) > 24 || strings.Count(head, " ") > 1 {
+		return "", msg
+	}
+	for _, r := range head {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == ' ') {
+			return "", msg
+		}
+	}
+	return head, rest
+}
+
+// stdWriter logs what the standard logger writes at info level
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	logf(LevelInfo, "%s", p)
+	return len(p), nil
+}
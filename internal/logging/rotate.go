@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// rotatingFile is a log file that is renamed to name.1 once it reaches
+// maxSize, shifting older files up to name.<maxFiles>
+type rotatingFile struct {
+	path     string
+	f        *os.File
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+func openRotating(path string) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) setLimits(maxSize int64, maxFiles int) {
+	r.maxSize, r.maxFiles = maxSize, maxFiles
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.f == nil {
+		// A failed rotation left no file open; try again
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts name.i to name.i+1, dropping the oldest, and starts a new file
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	r.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+	for i := r.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
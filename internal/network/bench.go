@@ -0,0 +1,266 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"vkvm/internal/protocol"
+)
+
+// benchReplyTimeout is how long a probe may go unanswered before it counts
+// as lost
+const benchReplyTimeout = 2 * time.Second
+
+// BenchOptions shapes a benchmark run: Rounds bursts of Burst probes, one
+// burst every Interval
+type BenchOptions struct {
+	Token      string
+	TLS        bool   // probe over wss:// and https://
+	CertSHA256 string // pinned certificate, see ClientTLSConfig
+	Rounds     int
+	Burst      int
+	Interval   time.Duration
+}
+
+// BenchResult summarizes the round trips measured over one transport
+type BenchResult struct {
+	Transport string
+	Sent      int
+	Received  int
+	Min       time.Duration
+	Avg       time.Duration
+	Max       time.Duration
+	Jitter    time.Duration // mean difference between consecutive round trips
+	Err       error         // set if the transport could not be used at all
+}
+
+// Loss returns the share of probes that got no reply, in percent
+func (r BenchResult) Loss() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+	return float64(r.Sent-r.Received) * 100 / float64(r.Sent)
+}
+
+// Bench measures round trips to the vkvm API at addr over the WebSocket link
+// (sync requests on an authenticated connection) and over HTTP (status
+// requests)
+func Bench(ctx context.Context, addr string, opts BenchOptions) []BenchResult {
+	return []BenchResult{benchWS(ctx, addr, opts), benchHTTP(ctx, addr, opts)}
+}
+
+// benchWS authenticates like an agent, then times sync requests by the ID
+// their replies echo
+func benchWS(ctx context.Context, addr string, opts BenchOptions) BenchResult {
+	result := BenchResult{Transport: "WebSocket"}
+
+	u := url.URL{Scheme: "ws", Host: addr, Path: "/ws"}
+	dialer := *websocket.DefaultDialer
+	if opts.TLS {
+		u.Scheme = "wss"
+		dialer.TLSClientConfig = ClientTLSConfig(opts.CertSHA256, nil)
+	}
+	header := http.Header{}
+	header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+	if opts.Token != "" {
+		header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer conn.Close()
+
+	if v, _ := strconv.Atoi(resp.Header.Get(protocol.VersionHeader)); v < protocol.RepliesVersion {
+		result.Err = fmt.Errorf("host speaks protocol %d and does not answer requests", v)
+		return result
+	}
+
+	// The Host closes connections whose first message is not auth; a pairing
+	// token is only valid under this machine's name
+	auth, err := protocol.NewMessage(protocol.TypeAuth, protocol.AuthPayload{
+		Token:     opts.Token,
+		AgentName: MachineID(),
+		MAC:       InterfaceMAC(conn.LocalAddr()),
+	})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	conn.SetWriteDeadline(time.Now().Add(benchReplyTimeout))
+	if err := conn.WriteJSON(auth); err != nil {
+		result.Err = err
+		return result
+	}
+
+	var mu sync.Mutex
+	sent := make(map[string]time.Time)
+	var rtts []time.Duration
+	var closeErr error
+
+	// Broadcasts and unknown replies are discarded
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				mu.Lock()
+				closeErr = err
+				mu.Unlock()
+				return
+			}
+			msg, err := protocol.Decode(data)
+			if err != nil || msg.ID == "" {
+				continue
+			}
+			mu.Lock()
+			if at, ok := sent[msg.ID]; ok {
+				rtts = append(rtts, time.Since(at))
+				delete(sent, msg.ID)
+			}
+			mu.Unlock()
+		}
+	}()
+
+	seq := 0
+	benchRounds(ctx, opts, func() {
+		seq++
+		msg := protocol.Message{Type: protocol.TypeSyncRequest, ID: fmt.Sprintf("bench-%d", seq)}
+		mu.Lock()
+		sent[msg.ID] = time.Now()
+		mu.Unlock()
+		result.Sent++
+		conn.SetWriteDeadline(time.Now().Add(benchReplyTimeout))
+		if err := conn.WriteJSON(msg); err != nil {
+			result.Err = err
+		}
+	})
+
+	// Give the last replies time to arrive
+	deadline := time.Now().Add(benchReplyTimeout)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		waiting := len(sent)
+		mu.Unlock()
+		if waiting == 0 {
+			break
+		}
+		select {
+		case <-readDone:
+			deadline = time.Now() // the Host hung up; nothing more will arrive
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// Say goodbye, so the Host unregisters us right away, and wait for it to
+	// close its end
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bench done"),
+		time.Now().Add(benchReplyTimeout))
+	select {
+	case <-readDone:
+	case <-time.After(benchReplyTimeout):
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rtts) == 0 && result.Err == nil && !websocket.IsCloseError(closeErr, websocket.CloseNormalClosure) {
+		result.Err = closeErr // e.g. closed by the Host for a bad token
+	}
+	result.summarize(rtts)
+	return result
+}
+
+// benchHTTP times authenticated /status requests over a kept-alive connection
+func benchHTTP(ctx context.Context, addr string, opts BenchOptions) BenchResult {
+	result := BenchResult{Transport: "HTTP"}
+	client, scheme := PeerClient(opts.TLS, opts.CertSHA256, benchReplyTimeout)
+	var rtts []time.Duration
+	var lastErr error
+
+	benchRounds(ctx, opts, func() {
+		req, err := http.NewRequestWithContext(ctx, "GET", scheme+"://"+addr+"/api/v1/status", nil)
+		if err != nil {
+			lastErr = err
+			return
+		}
+		req.Header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+		if opts.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+opts.Token)
+		}
+		result.Sent++
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			return
+		}
+		// Drain the body so the connection is reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("status %d", resp.StatusCode)
+			return
+		}
+		rtts = append(rtts, time.Since(start))
+	})
+
+	if len(rtts) == 0 {
+		result.Err = lastErr
+	}
+	result.summarize(rtts)
+	return result
+}
+
+// benchRounds calls probe opts.Burst times back to back, opts.Rounds times,
+// waiting opts.Interval between bursts
+func benchRounds(ctx context.Context, opts BenchOptions, probe func()) {
+	for round := 0; round < opts.Rounds; round++ {
+		if round > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(opts.Interval):
+			}
+		}
+		for i := 0; i < opts.Burst && ctx.Err() == nil; i++ {
+			probe()
+		}
+	}
+}
+
+// summarize fills in the statistics of the measured round trips
+func (r *BenchResult) summarize(rtts []time.Duration) {
+	r.Received = len(rtts)
+	if len(rtts) == 0 {
+		return
+	}
+	var total, diffs time.Duration
+	r.Min, r.Max = rtts[0], rtts[0]
+	for i, rtt := range rtts {
+		total += rtt
+		r.Min = min(r.Min, rtt)
+		r.Max = max(r.Max, rtt)
+		if i > 0 {
+			diff := rtt - rtts[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			diffs += diff
+		}
+	}
+	r.Avg = total / time.Duration(len(rtts))
+	if len(rtts) > 1 {
+		r.Jitter = diffs / time.Duration(len(rtts)-1)
+	}
+}
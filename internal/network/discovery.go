@@ -7,17 +7,49 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/protocol"
 )
 
 // DiscoveredHost represents a VKVM instance found on the network
 type DiscoveredHost struct {
 	IP             string   `json:"ip"`
 	Port           int      `json:"port"`
+	ID             string   `json:"id,omitempty"`      // Hostname the instance reports
+	Role           string   `json:"role,omitempty"`    // "host" or "agent"
+	Machine        string   `json:"machine,omitempty"` // Name in our machine registry, if registered
 	CurrentProfile string   `json:"current_profile"`
 	Profiles       []string `json:"profiles"`
+	Degraded       bool     `json:"degraded,omitempty"` // /health reports a broken component
+
+	Version       string `json:"version,omitempty"`
+	Platform      string `json:"platform,omitempty"` // GOOS of the instance
+	Protocol      int    `json:"protocol,omitempty"`
+	Incompatible  bool   `json:"incompatible,omitempty"`   // Its protocol version can't talk to ours
+	TokenRequired bool   `json:"token_required,omitempty"` // Its API needs a token
+}
+
+// Addr returns the host's API address (ip:port)
+func (h DiscoveredHost) Addr() string {
+	return net.JoinHostPort(h.IP, strconv.Itoa(h.Port))
+}
+
+// ApplyMachines matches discovered hosts against the machine registry: known
+// machines get their name filled in, and registered machines whose ID shows
+// up at a new address are updated
+func ApplyMachines(hosts []DiscoveredHost, cfgMgr *config.Manager) {
+	for i := range hosts {
+		cfgMgr.UpdateMachineAddress(hosts[i].ID, hosts[i].Addr())
+		if mc := cfgMgr.FindMachine(hosts[i].Addr()); mc != nil {
+			hosts[i].Machine = mc.Name
+		}
+	}
 }
 
 // GetLocalIP returns the primary local IP address
@@ -32,9 +64,29 @@ func GetLocalIP() (string, error) {
 	return localAddr.IP.String(), nil
 }
 
+const (
+	// scanWorkers bounds the addresses probed at the same time by a LAN scan
+	scanWorkers = 64
+
+	// probeTimeout bounds the probe of one address
+	probeTimeout = 500 * time.Millisecond
+
+	// mdnsBrowseTime is how long a scan listens for mDNS answers
+	mdnsBrowseTime = 2 * time.Second
+)
+
 // ScanLAN scans the local network for VKVM instances
 // Returns discovered hosts on the same subnet
-func ScanLAN(port int) ([]DiscoveredHost, error) {
+func ScanLAN(port int, useTLS bool) ([]DiscoveredHost, error) {
+	return ScanLANContext(context.Background(), port, useTLS, nil)
+}
+
+// ScanLANContext finds VKVM instances through mDNS and, for instances too old
+// to advertise themselves, by probing the local /24 subnet with a bounded
+// pool of workers. With useTLS instances are probed over https. found, if not nil, is called for each host as soon as it
+// answers, one call at a time. Cancelling ctx stops the scan; the hosts found
+// so far are returned with ctx's error.
+func ScanLANContext(ctx context.Context, port int, useTLS bool, found func(DiscoveredHost)) ([]DiscoveredHost, error) {
 	localIP, err := GetLocalIP()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get local IP: %w", err)
@@ -51,49 +103,104 @@ func ScanLAN(port int) ([]DiscoveredHost, error) {
 	var hosts []DiscoveredHost
 	var mu sync.Mutex
 	var wg sync.WaitGroup
+	seen := make(map[string]bool) // by IP: mDNS and the sweep find the same hosts
 
-	// Scan IPs 1-254 in the subnet
-	for i := 1; i <= 254; i++ {
-		wg.Add(1)
-		go func(hostNum int) {
-			defer wg.Done()
-
-			ip := fmt.Sprintf("%s.%d", subnet, hostNum)
+	report := func(host DiscoveredHost) {
+		mu.Lock()
+		defer mu.Unlock()
+		if seen[host.IP] {
+			return
+		}
+		seen[host.IP] = true
+		hosts = append(hosts, host)
+		if found != nil {
+			found(host)
+		}
+	}
 
-			// Skip our own IP
+	// Instances that advertise themselves answer within milliseconds. They
+	// are still probed for the details /health and /api/status add.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		browseCtx, cancel := context.WithTimeout(ctx, mdnsBrowseTime)
+		defer cancel()
+		err := BrowseMDNS(browseCtx, func(ip string, port int, txt map[string]string) {
 			if ip == localIP {
 				return
 			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				host, ok := probeHost(ctx, ip, port, useTLS)
+				if !ok {
+					host = hostFromTXT(ip, port, txt)
+				}
+				report(host)
+			}()
+		})
+		if err != nil {
+			logging.Warnf("mDNS: Browsing failed, relying on the subnet scan: %v", err)
+		}
+	}()
 
-			// Try to connect to the VKVM API
-			if host, ok := probeHost(ip, port); ok {
-				mu.Lock()
-				hosts = append(hosts, host)
-				mu.Unlock()
+	// Scan IPs 1-254 in the subnet, skipping our own
+	var ips []string
+	for i := 1; i <= 254; i++ {
+		if ip := fmt.Sprintf("%s.%d", subnet, i); ip != localIP {
+			ips = append(ips, ip)
+		}
+	}
+	sweep(ctx, ips, func(ip string) (DiscoveredHost, bool) {
+		return probeHost(ctx, ip, port, useTLS)
+	}, report)
+	wg.Wait()
+
+	return hosts, ctx.Err()
+}
+
+// sweep probes ips with scanWorkers workers and reports each host that
+// answers. It stops handing out addresses once ctx is cancelled.
+func sweep(ctx context.Context, ips []string, probe func(ip string) (DiscoveredHost, bool), report func(DiscoveredHost)) {
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for range scanWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range queue {
+				if host, ok := probe(ip); ok {
+					report(host)
+				}
 			}
-		}(i)
+		}()
 	}
 
+feed:
+	for _, ip := range ips {
+		select {
+		case queue <- ip:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
 	wg.Wait()
-	return hosts, nil
 }
 
 // probeHost checks if a host is running VKVM API
-func probeHost(ip string, port int) (DiscoveredHost, bool) {
-	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+func probeHost(ctx context.Context, ip string, port int, useTLS bool) (DiscoveredHost, bool) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
 	defer cancel()
 
 	// First check health endpoint
-	healthURL := fmt.Sprintf("http://%s:%d/health", ip, port)
+	client, scheme := PeerClient(useTLS, "", probeTimeout)
+	healthURL := fmt.Sprintf("%s://%s:%d/health", scheme, ip, port)
 	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
 	if err != nil {
 		return DiscoveredHost{}, false
 	}
 
-	client := &http.Client{
-		Timeout: 500 * time.Millisecond,
-	}
-
 	resp, err := client.Do(req)
 	if err != nil {
 		return DiscoveredHost{}, false
@@ -103,35 +210,64 @@ func probeHost(ip string, port int) (DiscoveredHost, bool) {
 	if resp.StatusCode != http.StatusOK {
 		return DiscoveredHost{}, false
 	}
+	var health struct {
+		Degraded      bool   `json:"degraded"`
+		Version       string `json:"version"`
+		Protocol      int    `json:"protocol"`
+		Machine       string `json:"machine"`
+		Role          string `json:"role"`
+		Platform      string `json:"platform"`
+		TokenRequired bool   `json:"token_required"`
+	}
+	json.NewDecoder(resp.Body).Decode(&health)
+
+	host := DiscoveredHost{
+		IP:            ip,
+		Port:          port,
+		ID:            health.Machine,
+		Role:          health.Role,
+		Degraded:      health.Degraded,
+		Version:       health.Version,
+		Platform:      health.Platform,
+		Protocol:      health.Protocol,
+		Incompatible:  health.Protocol != 0 && !protocol.IsCompatible(health.Protocol),
+		TokenRequired: health.TokenRequired,
+	}
+	if host.TokenRequired {
+		return host, true // profiles are only readable with the token
+	}
 
 	// Try to get status
-	statusURL := fmt.Sprintf("http://%s:%d/api/status", ip, port)
+	statusURL := fmt.Sprintf("%s://%s:%d/api/status", scheme, ip, port)
 	req, err = http.NewRequestWithContext(ctx, "GET", statusURL, nil)
 	if err != nil {
-		return DiscoveredHost{IP: ip, Port: port}, true
+		return host, true
 	}
 
 	resp, err = client.Do(req)
 	if err != nil {
-		return DiscoveredHost{IP: ip, Port: port}, true
+		return host, true
 	}
 	defer resp.Body.Close()
 
 	var status struct {
+		Machine        string   `json:"machine"`
+		Role           string   `json:"role"`
 		CurrentProfile string   `json:"current_profile"`
 		Profiles       []string `json:"profiles"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&status); err == nil {
-		return DiscoveredHost{
-			IP:             ip,
-			Port:           port,
-			CurrentProfile: status.CurrentProfile,
-			Profiles:       status.Profiles,
-		}, true
+		// Older instances only describe themselves in /api/status
+		if host.ID == "" {
+			host.ID = status.Machine
+			host.Role = status.Role
+		}
+		host.CurrentProfile = status.CurrentProfile
+		host.Profiles = status.Profiles
 	}
 
-	return DiscoveredHost{IP: ip, Port: port}, true
+	return host, true
 }
 
 // GetLocalIPs returns all available local IPv4 addresses
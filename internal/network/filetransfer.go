@@ -0,0 +1,301 @@
+package network
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/protocol"
+)
+
+const (
+	// fileChunkTimeout bounds the wait for the acknowledgement of one chunk
+	fileChunkTimeout = 10 * time.Second
+
+	// staleTransferTimeout drops incoming transfers whose sender went quiet
+	staleTransferTimeout = time.Minute
+
+	// maxIncomingTransfers caps the files being received at once, from all
+	// senders together
+	maxIncomingTransfers = 4
+
+	// partSuffix marks files that are still being received
+	partSuffix = ".vkvm-part"
+)
+
+// ErrFilesUnsupported is returned when the peer speaks a protocol version
+// without file transfer
+var ErrFilesUnsupported = errors.New("peer does not support file transfer, update vkvm on both machines")
+
+// SendFile offers data as a file called name and sends it chunk by chunk.
+// request sends one message and waits for its reply (a TypeFileAck). It
+// returns where the receiver saved the file.
+func SendFile(name string, data []byte, request func(protocol.Message, time.Duration) (protocol.Message, error)) (string, error) {
+	if len(data) > protocol.MaxFileSize {
+		return "", fmt.Errorf("file too large (%d bytes, max %d)", len(data), protocol.MaxFileSize)
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	sum := sha256.Sum256(data)
+	offer := protocol.FileOfferPayload{
+		TransferID: hex.EncodeToString(id),
+		Name:       filepath.Base(name),
+		Size:       int64(len(data)),
+		SHA256:     hex.EncodeToString(sum[:]),
+	}
+
+	ack, err := fileRequest(protocol.TypeFileOffer, offer, request)
+	if err != nil {
+		return "", err
+	}
+
+	for offset := 0; !ack.Done; offset += protocol.FileChunkSize {
+		if offset >= len(data) && len(data) > 0 {
+			return "", errors.New("receiver did not confirm the complete file")
+		}
+		end := min(offset+protocol.FileChunkSize, len(data))
+		ack, err = fileRequest(protocol.TypeFileChunk, protocol.FileChunkPayload{
+			TransferID: offer.TransferID,
+			Offset:     int64(offset),
+			Data:       data[offset:end],
+		}, request)
+		if err != nil {
+			return "", err
+		}
+		if ack.Received != int64(end) {
+			return "", fmt.Errorf("receiver stored %d bytes, expected %d", ack.Received, end)
+		}
+	}
+	return ack.Path, nil
+}
+
+// fileRequest sends one file transfer message and decodes the acknowledgement
+func fileRequest(t protocol.MessageType, payload interface{}, request func(protocol.Message, time.Duration) (protocol.Message, error)) (protocol.FileAckPayload, error) {
+	var ack protocol.FileAckPayload
+	msg, err := protocol.NewMessage(t, payload)
+	if err != nil {
+		return ack, err
+	}
+	reply, err := request(msg, fileChunkTimeout)
+	if err != nil {
+		return ack, err
+	}
+	if err := reply.DecodePayload(&ack); err != nil {
+		return ack, fmt.Errorf("unexpected %s reply: %w", t, err)
+	}
+	if ack.Error != "" {
+		return ack, errors.New(ack.Error)
+	}
+	return ack, nil
+}
+
+// incomingFile is a file being received
+type incomingFile struct {
+	key      string // see transferKey
+	offer    protocol.FileOfferPayload
+	from     string
+	file     *os.File
+	hash     hash.Hash
+	received int64
+	lastSeen time.Time
+}
+
+// FileReceiver stores files sent over the WebSocket link. Files are only
+// accepted while receive_files is enabled and are saved to receive_dir.
+type FileReceiver struct {
+	configMgr *config.Manager
+
+	mu        sync.Mutex
+	transfers map[string]*incomingFile // by transferKey
+}
+
+// transferKey identifies a transfer by its sender and ID, so one peer cannot
+// write to or replace another's transfer by reusing its ID
+func transferKey(from, id string) string {
+	return from + "\x00" + id
+}
+
+// NewFileReceiver creates a receiver that follows cfgMgr's settings
+func NewFileReceiver(cfgMgr *config.Manager) *FileReceiver {
+	return &FileReceiver{configMgr: cfgMgr, transfers: make(map[string]*incomingFile)}
+}
+
+// HandleOffer accepts or declines a file offered by from, which identifies
+// the sending connection; only from may send the file's chunks
+func (r *FileReceiver) HandleOffer(from string, offer protocol.FileOfferPayload) protocol.FileAckPayload {
+	ack := protocol.FileAckPayload{TransferID: offer.TransferID}
+	general := r.configMgr.Get().General
+	if !general.ReceiveFiles {
+		logging.Infof("Files: Declined '%s' from %s: receiving files is disabled", offer.Name, from)
+		ack.Error = "the receiving machine does not accept files (enable \"Accept files\" in its settings)"
+		return ack
+	}
+
+	name := filepath.Base(filepath.Clean(offer.Name))
+	if name == "." || name == ".." || name == string(filepath.Separator) || strings.ContainsAny(name, `/\`) {
+		ack.Error = "invalid file name"
+		return ack
+	}
+
+	dir := ReceiveDir(general.ReceiveDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		ack.Error = err.Error()
+		return ack
+	}
+	key := transferKey(from, offer.TransferID)
+	r.mu.Lock()
+	r.dropStale()
+	if old := r.transfers[key]; old != nil {
+		r.discard(old)
+	}
+	if len(r.transfers) >= maxIncomingTransfers {
+		r.mu.Unlock()
+		logging.Warnf("Files: Declined '%s' from %s: already receiving %d files", name, from, maxIncomingTransfers)
+		ack.Error = "the receiving machine is busy with other files, try again later"
+		return ack
+	}
+	f, err := os.CreateTemp(dir, name+".*"+partSuffix)
+	if err != nil {
+		r.mu.Unlock()
+		ack.Error = err.Error()
+		return ack
+	}
+	offer.Name = name
+	r.transfers[key] = &incomingFile{key: key, offer: offer, from: from, file: f, hash: sha256.New(), lastSeen: time.Now()}
+	r.mu.Unlock()
+
+	logging.Infof("Files: Receiving '%s' (%d bytes) from %s", name, offer.Size, from)
+	if offer.Size == 0 {
+		return r.finish(key)
+	}
+	return ack
+}
+
+// HandleChunk stores the next part of a file offered by from
+func (r *FileReceiver) HandleChunk(from string, chunk protocol.FileChunkPayload) protocol.FileAckPayload {
+	ack := protocol.FileAckPayload{TransferID: chunk.TransferID}
+
+	r.mu.Lock()
+	t := r.transfers[transferKey(from, chunk.TransferID)]
+	if t == nil {
+		r.mu.Unlock()
+		ack.Error = "unknown transfer"
+		return ack
+	}
+	if chunk.Offset != t.received || t.received+int64(len(chunk.Data)) > t.offer.Size {
+		r.discard(t)
+		r.mu.Unlock()
+		ack.Error = fmt.Sprintf("chunk at %d does not follow the %d bytes received", chunk.Offset, t.received)
+		return ack
+	}
+	if _, err := t.file.Write(chunk.Data); err != nil {
+		r.discard(t)
+		r.mu.Unlock()
+		ack.Error = err.Error()
+		return ack
+	}
+	t.hash.Write(chunk.Data)
+	t.received += int64(len(chunk.Data))
+	t.lastSeen = time.Now()
+	ack.Received = t.received
+	complete := t.received == t.offer.Size
+	r.mu.Unlock()
+
+	if complete {
+		return r.finish(t.key)
+	}
+	return ack
+}
+
+// finish verifies a completely received file and moves it into place
+func (r *FileReceiver) finish(key string) protocol.FileAckPayload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.transfers[key]
+	if t == nil {
+		return protocol.FileAckPayload{Error: "unknown transfer"}
+	}
+	ack := protocol.FileAckPayload{TransferID: t.offer.TransferID, Received: t.received}
+	if hex.EncodeToString(t.hash.Sum(nil)) != t.offer.SHA256 {
+		r.discard(t)
+		ack.Error = "checksum mismatch"
+		return ack
+	}
+	delete(r.transfers, key)
+
+	part := t.file.Name()
+	if err := t.file.Close(); err != nil {
+		os.Remove(part)
+		ack.Error = err.Error()
+		return ack
+	}
+	path := uniquePath(filepath.Join(filepath.Dir(part), t.offer.Name))
+	if err := os.Rename(part, path); err != nil {
+		os.Remove(part)
+		ack.Error = err.Error()
+		return ack
+	}
+
+	logging.Infof("Files: Received '%s' from %s, saved to %s", t.offer.Name, t.from, path)
+	ack.Done = true
+	ack.Path = path
+	return ack
+}
+
+// discard drops a transfer and its partial file. Callers must hold r.mu.
+func (r *FileReceiver) discard(t *incomingFile) {
+	delete(r.transfers, t.key)
+	t.file.Close()
+	os.Remove(t.file.Name())
+}
+
+// dropStale discards transfers whose sender stopped sending. Callers must
+// hold r.mu.
+func (r *FileReceiver) dropStale() {
+	for _, t := range r.transfers {
+		if time.Since(t.lastSeen) > staleTransferTimeout {
+			logging.Warnf("Files: Transfer of '%s' from %s timed out", t.offer.Name, t.from)
+			r.discard(t)
+		}
+	}
+}
+
+// uniquePath returns path, or "name (2).ext" etc. if path already exists
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// ReceiveDir returns the directory received files are saved to: configured,
+// or the user's Downloads folder
+func ReceiveDir(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return os.TempDir()
+	}
+	return filepath.Join(home, "Downloads")
+}
@@ -0,0 +1,448 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"vkvm/internal/logging"
+	"vkvm/internal/protocol"
+)
+
+// MDNSService is the DNS-SD service type vkvm instances advertise
+const MDNSService = "_vkvm._tcp.local."
+
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN    = 1
+	dnsCacheFlush = 0x8000 // set on records only we own
+	dnsUnicast    = 0x8000 // "QU" bit in a question's class
+
+	mdnsTTL = 120
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// dnsQuestion is one entry of a DNS message's question section
+type dnsQuestion struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// dnsRecord is one resource record; Data is the record's raw RDATA except
+// for names, which are decoded into Target
+type dnsRecord struct {
+	Name   string
+	Type   uint16
+	Class  uint16
+	TTL    uint32
+	Data   []byte
+	Target string // PTR target or SRV host
+	Port   uint16 // SRV
+}
+
+// dnsMessage is the subset of a DNS message mDNS discovery needs
+type dnsMessage struct {
+	ID        uint16
+	Response  bool
+	Questions []dnsQuestion
+	Records   []dnsRecord // answers and additional records
+}
+
+// mdnsInstance returns our DNS-SD instance name. Machine IDs are host names
+// and may contain dots, which would split the label.
+func mdnsInstance() string {
+	return strings.ReplaceAll(MachineID(), ".", "-")
+}
+
+// AdvertiseMDNS announces this instance as _vkvm._tcp on port and answers
+// queries for it until ctx is done. txt is called for every answer, so the
+// announced details stay current.
+func AdvertiseMDNS(ctx context.Context, port int, txt func() map[string]string) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	instance := mdnsInstance() + "." + MDNSService
+	respond := func(id uint16, questions []dnsQuestion, to *net.UDPAddr) {
+		msg := mdnsAnswer(instance, port, txt())
+		msg.ID = id
+		msg.Questions = questions
+		if _, err := conn.WriteToUDP(msg.encode(), to); err != nil {
+			logging.Debugf("mDNS: Failed to answer %s: %v", to, err)
+		}
+	}
+
+	// Announce twice, as RFC 6762 asks, so browsers already listening see us
+	respond(0, nil, mdnsGroup)
+	time.AfterFunc(time.Second, func() { respond(0, nil, mdnsGroup) })
+
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		msg, err := parseDNS(buf[:n])
+		if err != nil || msg.Response {
+			continue
+		}
+
+		var asked []dnsQuestion
+		unicast := from.Port != mdnsGroup.Port // legacy unicast querier
+		for _, q := range msg.Questions {
+			name := strings.ToLower(q.Name)
+			if (name == MDNSService && (q.Type == dnsTypePTR || q.Type == dnsTypeANY)) || name == strings.ToLower(instance) {
+				asked = append(asked, dnsQuestion{Name: q.Name, Type: q.Type, Class: dnsClassIN})
+				unicast = unicast || q.Class&dnsUnicast != 0
+			}
+		}
+		if len(asked) == 0 {
+			continue
+		}
+		if unicast {
+			// Legacy unicast replies echo the ID and the questions
+			respond(msg.ID, asked, from)
+		} else {
+			respond(0, nil, mdnsGroup)
+		}
+	}
+}
+
+// mdnsAnswer builds the PTR, SRV, TXT and A records describing instance
+func mdnsAnswer(instance string, port int, txt map[string]string) dnsMessage {
+	target := mdnsInstance() + ".local."
+	msg := dnsMessage{Response: true}
+	msg.Records = append(msg.Records,
+		dnsRecord{Name: MDNSService, Type: dnsTypePTR, Class: dnsClassIN, TTL: mdnsTTL, Target: instance},
+		dnsRecord{Name: instance, Type: dnsTypeSRV, Class: dnsClassIN | dnsCacheFlush, TTL: mdnsTTL, Target: target, Port: uint16(port)},
+		dnsRecord{Name: instance, Type: dnsTypeTXT, Class: dnsClassIN | dnsCacheFlush, TTL: mdnsTTL, Data: encodeTXT(txt)},
+	)
+	if ips, err := GetLocalIPs(); err == nil {
+		for _, ip := range ips {
+			msg.Records = append(msg.Records, dnsRecord{Name: target, Type: dnsTypeA, Class: dnsClassIN | dnsCacheFlush, TTL: mdnsTTL, Data: net.ParseIP(ip).To4()})
+		}
+	}
+	return msg
+}
+
+// BrowseMDNS asks the LAN for _vkvm._tcp instances and calls found for each
+// one that answers, once per instance, until ctx is done. ip is the address
+// the answer came from.
+func BrowseMDNS(ctx context.Context, found func(ip string, port int, txt map[string]string)) error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	// Sending from an ephemeral port makes responders answer us directly.
+	// The query is repeated in case a packet is lost.
+	query := dnsMessage{Questions: []dnsQuestion{{Name: MDNSService, Type: dnsTypePTR, Class: dnsClassIN}}}
+	go func() {
+		for _, delay := range []time.Duration{0, 250 * time.Millisecond, time.Second} {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			conn.WriteToUDP(query.encode(), mdnsGroup)
+		}
+	}()
+
+	seen := make(map[string]bool)
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		msg, err := parseDNS(buf[:n])
+		if err != nil || !msg.Response {
+			continue
+		}
+
+		// An answer carries the SRV and TXT records of the instance
+		ports := make(map[string]uint16)
+		txts := make(map[string]map[string]string)
+		for _, r := range msg.Records {
+			name := strings.ToLower(r.Name)
+			if !strings.HasSuffix(name, "."+MDNSService) {
+				continue
+			}
+			switch r.Type {
+			case dnsTypeSRV:
+				ports[name] = r.Port
+			case dnsTypeTXT:
+				txts[name] = decodeTXT(r.Data)
+			}
+		}
+		for name, port := range ports {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			found(from.IP.String(), int(port), txts[name])
+		}
+	}
+}
+
+// encodeTXT encodes key=value pairs as TXT record strings
+func encodeTXT(txt map[string]string) []byte {
+	var data []byte
+	for k, v := range txt {
+		s := k + "=" + v
+		if len(s) > 255 {
+			s = s[:255]
+		}
+		data = append(data, byte(len(s)))
+		data = append(data, s...)
+	}
+	if len(data) == 0 {
+		data = []byte{0} // a TXT record holds at least one string
+	}
+	return data
+}
+
+// decodeTXT decodes TXT record strings into key=value pairs
+func decodeTXT(data []byte) map[string]string {
+	txt := make(map[string]string)
+	for len(data) > 0 {
+		n := int(data[0])
+		if n+1 > len(data) {
+			break
+		}
+		if k, v, ok := strings.Cut(string(data[1:n+1]), "="); ok {
+			txt[strings.ToLower(k)] = v
+		}
+		data = data[n+1:]
+	}
+	return txt
+}
+
+// encode serializes m without name compression
+func (m dnsMessage) encode() []byte {
+	var flags uint16
+	if m.Response {
+		flags = 0x8400 // response, authoritative
+	}
+	b := binary.BigEndian.AppendUint16(nil, m.ID)
+	b = binary.BigEndian.AppendUint16(b, flags)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(m.Questions)))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(m.Records)))
+	b = binary.BigEndian.AppendUint32(b, 0) // no authority or additional records
+
+	for _, q := range m.Questions {
+		b = appendName(b, q.Name)
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+	}
+	for _, r := range m.Records {
+		data := r.Data
+		switch r.Type {
+		case dnsTypePTR:
+			data = appendName(nil, r.Target)
+		case dnsTypeSRV:
+			data = binary.BigEndian.AppendUint32(nil, 0) // priority, weight
+			data = binary.BigEndian.AppendUint16(data, r.Port)
+			data = appendName(data, r.Target)
+		}
+		b = appendName(b, r.Name)
+		b = binary.BigEndian.AppendUint16(b, r.Type)
+		b = binary.BigEndian.AppendUint16(b, r.Class)
+		b = binary.BigEndian.AppendUint32(b, r.TTL)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+		b = append(b, data...)
+	}
+	return b
+}
+
+// appendName appends name as a sequence of DNS labels
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+var errDNSShort = errors.New("truncated DNS message")
+
+// parseDNS decodes the questions, answers and additional records of a DNS
+// message; authority records are skipped
+func parseDNS(b []byte) (dnsMessage, error) {
+	var m dnsMessage
+	if len(b) < 12 {
+		return m, errDNSShort
+	}
+	m.ID = binary.BigEndian.Uint16(b)
+	m.Response = b[2]&0x80 != 0
+	qd := int(binary.BigEndian.Uint16(b[4:]))
+	an := int(binary.BigEndian.Uint16(b[6:]))
+	ns := int(binary.BigEndian.Uint16(b[8:]))
+	ar := int(binary.BigEndian.Uint16(b[10:]))
+
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, next, err := readName(b, off)
+		if err != nil {
+			return m, err
+		}
+		if next+4 > len(b) {
+			return m, errDNSShort
+		}
+		m.Questions = append(m.Questions, dnsQuestion{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[next:]),
+			Class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		off = next + 4
+	}
+
+	for i := 0; i < an+ns+ar; i++ {
+		name, next, err := readName(b, off)
+		if err != nil {
+			return m, err
+		}
+		if next+10 > len(b) {
+			return m, errDNSShort
+		}
+		r := dnsRecord{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[next:]),
+			Class: binary.BigEndian.Uint16(b[next+2:]),
+			TTL:   binary.BigEndian.Uint32(b[next+4:]),
+		}
+		length := int(binary.BigEndian.Uint16(b[next+8:]))
+		start := next + 10
+		if start+length > len(b) {
+			return m, errDNSShort
+		}
+		r.Data = b[start : start+length]
+		off = start + length
+
+		switch r.Type {
+		case dnsTypePTR:
+			if r.Target, _, err = readName(b, start); err != nil {
+				return m, err
+			}
+		case dnsTypeSRV:
+			if length < 7 {
+				return m, errDNSShort
+			}
+			r.Port = binary.BigEndian.Uint16(b[start+4:])
+			if r.Target, _, err = readName(b, start+6); err != nil {
+				return m, err
+			}
+		}
+		if i < an || i >= an+ns {
+			m.Records = append(m.Records, r)
+		}
+	}
+	return m, nil
+}
+
+// readName decodes the possibly compressed name at off and returns it with
+// the offset following it
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(b) {
+			return "", 0, errDNSShort
+		}
+		n := int(b[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(b) {
+				return "", 0, errDNSShort
+			}
+			if jumps++; jumps > 16 {
+				return "", 0, errors.New("DNS name compression loop")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3FFF)
+		default:
+			if off+1+n > len(b) {
+				return "", 0, errDNSShort
+			}
+			labels = append(labels, string(b[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// hostFromTXT describes an instance from its mDNS TXT record, for instances
+// whose API did not answer a direct probe
+func hostFromTXT(ip string, port int, txt map[string]string) DiscoveredHost {
+	proto, _ := strconv.Atoi(txt["protocol"])
+	return DiscoveredHost{
+		IP:             ip,
+		Port:           port,
+		ID:             txt["id"],
+		Role:           txt["role"],
+		CurrentProfile: txt["profile"],
+		Version:        txt["version"],
+		Platform:       txt["platform"],
+		Protocol:       proto,
+		Incompatible:   proto != 0 && !protocol.IsCompatible(proto),
+		TokenRequired:  txt["token_required"] == "1",
+	}
+}
+
+// MDNSInfo returns the TXT entries an instance announces. The current profile
+// is left out when the API needs a token, since it is not readable without it.
+func MDNSInfo(role, version, platform, profile string, tokenRequired bool) map[string]string {
+	txt := map[string]string{
+		"id":       MachineID(),
+		"role":     role,
+		"version":  version,
+		"protocol": strconv.Itoa(protocol.Version),
+		"platform": platform,
+	}
+	if tokenRequired {
+		txt["token_required"] = "1"
+	} else {
+		txt["profile"] = profile
+	}
+	return txt
+}
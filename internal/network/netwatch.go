@@ -0,0 +1,53 @@
+package network
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// netSettleDelay lets a burst of address changes (e.g. DHCP renewal) settle
+// before the addresses are compared
+const netSettleDelay = time.Second
+
+// WatchNetwork calls onChange whenever this machine's IP addresses change
+// (interface up/down, new DHCP lease), so connections can be re-established
+// right away instead of waiting for a read timeout. It runs for the lifetime
+// of the process.
+func WatchNetwork(onChange func()) {
+	last := localAddrs()
+	for {
+		if err := waitAddrChange(); err != nil {
+			logging.Warnf("Network: Change notification failed, polling instead: %v", err)
+			time.Sleep(netPollInterval)
+		}
+		time.Sleep(netSettleDelay)
+
+		current := localAddrs()
+		if current == last {
+			continue
+		}
+		logging.Infof("Network: Addresses changed from [%s] to [%s]", last, current)
+		last = current
+		onChange()
+	}
+}
+
+// localAddrs returns the machine's non-loopback IP addresses as a sorted list
+func localAddrs() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	var ips []string
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	slices.Sort(ips)
+	return strings.Join(ips, " ")
+}
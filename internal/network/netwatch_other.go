@@ -0,0 +1,14 @@
+//go:build !windows
+
+package network
+
+import "time"
+
+// netPollInterval is how often the interface addresses are compared
+const netPollInterval = 3 * time.Second
+
+// waitAddrChange waits one polling interval; addresses are compared by the caller
+func waitAddrChange() error {
+	time.Sleep(netPollInterval)
+	return nil
+}
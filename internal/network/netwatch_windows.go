@@ -0,0 +1,26 @@
+//go:build windows
+
+package network
+
+import (
+	"syscall"
+	"time"
+)
+
+// netPollInterval is how often addresses are polled if notifications fail
+const netPollInterval = 5 * time.Second
+
+var (
+	iphlpapi             = syscall.NewLazyDLL("iphlpapi.dll")
+	procNotifyAddrChange = iphlpapi.NewProc("NotifyAddrChange")
+)
+
+// waitAddrChange blocks until Windows reports a change in the IP address table
+func waitAddrChange() error {
+	// With both handles NULL the call is synchronous
+	ret, _, _ := procNotifyAddrChange.Call(0, 0)
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// pairTimeout bounds each pairing request to the Host
+const pairTimeout = 10 * time.Second
+
+// HostEndpoint is how an agent reaches its Host's API
+type HostEndpoint struct {
+	Addr       string // host:port
+	TLS        bool
+	CertSHA256 string // pinned certificate, see ClientTLSConfig
+}
+
+// post sends body as JSON to path on the Host and decodes the reply into out
+func (h HostEndpoint) post(path string, body, out interface{}) error {
+	client, scheme := PeerClient(h.TLS, h.CertSHA256, pairTimeout)
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(fmt.Sprintf("%s://%s%s", scheme, h.Addr, path), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Host answered %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// RequestPairing asks the Host to pair with this machine. The Host shows a
+// PIN, which CompletePairing submits with the returned pairing ID.
+func (h HostEndpoint) RequestPairing() (string, error) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := h.post("/api/v1/pair", map[string]string{"agent_name": MachineID()}, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// CompletePairing submits the PIN for pairing id and returns the token the
+// Host issued to this machine
+func (h HostEndpoint) CompletePairing(id, pin string) (string, error) {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := h.post("/api/v1/pair/"+url.PathEscape(id), map[string]string{"pin": pin}, &resp); err != nil {
+		return "", err
+	}
+	if resp.Token == "" {
+		return "", fmt.Errorf("Host did not issue a token")
+	}
+	return resp.Token, nil
+}
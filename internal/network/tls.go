@@ -0,0 +1,227 @@
+package network
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+const (
+	certFile = "api-cert.pem"
+	keyFile  = "api-key.pem"
+
+	// certValidity is how long a generated certificate is valid; peers pin
+	// its fingerprint rather than trusting a CA, so it is long-lived
+	certValidity = 10 * 365 * 24 * time.Hour
+)
+
+// LoadOrCreateCert loads the API server's certificate from dir, generating a
+// self-signed one on first use
+func LoadOrCreateCert(dir string) (tls.Certificate, error) {
+	certPath, keyPath := filepath.Join(dir, certFile), filepath.Join(dir, keyFile)
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		return cert, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return tls.Certificate{}, fmt.Errorf("failed to load %s: %w", certPath, err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "vkvm " + hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
+// CertFingerprint returns the hex SHA-256 of a DER certificate, the value
+// agents pin
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// unpinnedWarned holds the fingerprints of unpinned certificates already warned about
+var unpinnedWarned sync.Map
+
+// ClientTLSConfig returns the TLS settings for dialing a vkvm Host. Hosts use
+// self-signed certificates, so the chain is not verified; with pin set, the
+// certificate's SHA-256 fingerprint must match it instead. Without a pin any
+// certificate is accepted, which only protects against passive eavesdropping;
+// a warning names the fingerprint to pin. onCert, if set, is called with the
+// fingerprint the Host presented.
+func ClientTLSConfig(pin string, onCert func(fingerprint string)) *tls.Config {
+	pin = normalizeFingerprint(pin)
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("no certificate presented")
+			}
+			fingerprint := CertFingerprint(rawCerts[0])
+			if onCert != nil {
+				onCert(fingerprint)
+			}
+			if pin == "" {
+				if _, warned := unpinnedWarned.LoadOrStore(fingerprint, true); !warned {
+					logging.Warnf("Network: Accepting unpinned TLS certificate %s; pin this SHA-256 fingerprint so an impostor cannot take the peer's place", fingerprint)
+				}
+				return nil
+			}
+			if fingerprint != pin {
+				return fmt.Errorf("certificate fingerprint %s does not match the pinned %s", fingerprint, pin)
+			}
+			return nil
+		},
+	}
+}
+
+// PeerClient returns an HTTP client for the API of another vkvm instance and
+// the URL scheme to reach it with. With useTLS the client speaks https and
+// checks the peer's certificate against pin (see ClientTLSConfig).
+func PeerClient(useTLS bool, pin string, timeout time.Duration) (*http.Client, string) {
+	client := &http.Client{Timeout: timeout}
+	if !useTLS {
+		return client, "http"
+	}
+	client.Transport = &http.Transport{TLSClientConfig: ClientTLSConfig(pin, nil)}
+	return client, "https"
+}
+
+// normalizeFingerprint accepts fingerprints with colons and in any case
+func normalizeFingerprint(s string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+}
+
+// SniffTLS wraps ln so connections starting with a TLS handshake are served
+// with config and all others in plaintext, letting older peers and local
+// tools keep using http:// on the same port. With requireTLS, plaintext is
+// only accepted from loopback addresses.
+func SniffTLS(ln net.Listener, config *tls.Config, requireTLS bool) net.Listener {
+	return &sniffListener{Listener: ln, config: config, requireTLS: requireTLS}
+}
+
+type sniffListener struct {
+	net.Listener
+	config     *tls.Config
+	requireTLS bool
+}
+
+func (l *sniffListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &sniffConn{Conn: conn, config: l.config, requireTLS: l.requireTLS}, nil
+}
+
+// errPlaintextRefused fails plaintext connections when TLS is required
+var errPlaintextRefused = errors.New("plaintext connection refused, TLS is required")
+
+// sniffConn decides between TLS and plaintext on first use, so a slow
+// client does not hold up Accept
+type sniffConn struct {
+	net.Conn
+	config     *tls.Config
+	requireTLS bool
+	once       sync.Once
+	inner      net.Conn
+	err        error // set when the connection was refused
+}
+
+func (c *sniffConn) init() {
+	c.once.Do(func() {
+		r := bufio.NewReader(c.Conn)
+		peeked := &peekedConn{Conn: c.Conn, r: r}
+		// 0x16 is the TLS handshake record type
+		if b, err := r.Peek(1); err == nil && b[0] == 0x16 {
+			c.inner = tls.Server(peeked, c.config)
+			return
+		}
+		if c.requireTLS && !isLoopback(c.RemoteAddr()) {
+			logging.Debugf("Network: Refusing plaintext connection from %s, TLS is required", c.RemoteAddr())
+			c.Conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\nThis server requires TLS, use https:// or wss://\n"))
+			c.Conn.Close()
+			c.err = errPlaintextRefused
+			return
+		}
+		c.inner = peeked
+	})
+}
+
+func (c *sniffConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.inner.Read(p)
+}
+
+func (c *sniffConn) Write(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.inner.Write(p)
+}
+
+// isLoopback reports whether addr is on this machine
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+// peekedConn reads through the buffer that holds the sniffed byte
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,117 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// wolPort is the UDP port magic packets are sent to (discard)
+const wolPort = 9
+
+// WakeOnLAN broadcasts a Wake-on-LAN magic packet for mac on every local
+// IPv4 network
+func WakeOnLAN(mac string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address %q: %w", mac, err)
+	}
+	if len(hw) != 6 {
+		return fmt.Errorf("invalid MAC address %q: not 6 bytes", mac)
+	}
+
+	// Six 0xFF bytes followed by the MAC sixteen times
+	packet := append(bytes.Repeat([]byte{0xFF}, 6), bytes.Repeat(hw, 16)...)
+
+	targets := append(broadcastAddrs(), net.IPv4bcast)
+	var lastErr error
+	sent := 0
+	for _, ip := range targets {
+		conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: ip, Port: wolPort})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_, err = conn.Write(packet)
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return fmt.Errorf("failed to send magic packet: %w", lastErr)
+	}
+	return nil
+}
+
+// broadcastAddrs returns the directed broadcast address of every local IPv4
+// network, which routers forward more reliably than 255.255.255.255
+func broadcastAddrs() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var addrs []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifAddrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			ip := ipNet.IP.To4()
+			mask := net.IP(ipNet.Mask).To4()
+			if mask == nil {
+				continue
+			}
+			bcast := make(net.IP, 4)
+			for i := range bcast {
+				bcast[i] = ip[i] | ^mask[i]
+			}
+			addrs = append(addrs, bcast)
+		}
+	}
+	return addrs
+}
+
+// InterfaceMAC returns the hardware address of the interface that has the
+// IP of addr, or "" if it has none (loopback, VPN tunnels)
+func InterfaceMAC(addr net.Addr) string {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return ""
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		if len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifAddrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.HardwareAddr.String()
+			}
+		}
+	}
+	return ""
+}
@@ -2,12 +2,18 @@ package network
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"vkvm/internal/logging"
 	"vkvm/internal/protocol"
+	"vkvm/internal/supervisor"
 
 	"github.com/gorilla/websocket"
 )
@@ -21,14 +27,114 @@ type WSClient struct {
 	done      chan struct{}
 	reconnect chan struct{}
 
-	// Callbacks
-	OnSwitch func(profile string)
-	OnSync   func(profiles interface{})
+	// Callbacks; origin is the machine ID of the Host that performed the switch
+	OnSwitch func(profile, origin string)
+	OnSync   func(profiles json.RawMessage)
 
+	// Topics, if set before Start, limits the broadcasts the Host sends us
+	// (see protocol.Topics); empty subscribes to everything
+	Topics []string
+
+	// Resolve, if set before Start, returns the Host address to dial. It is
+	// called before every attempt with the number of consecutive failed
+	// attempts, so a moved Host can be looked up again.
+	Resolve func(failures int) string
+
+	// OnConnect is called after each successful connection with the dialed
+	// address and the machine ID the Host announced (may be empty)
+	OnConnect func(addr, hostID string)
+
+	// Profile, if set before Start, is announced to the Host as the profile
+	// that shows this machine
+	Profile string
+
+	// Files, if set before Start, receives files the Host sends; without it
+	// offers are declined
+	Files *FileReceiver
+
+	// TLS, if set before Start, dials the Host over wss://. CertSHA256 pins
+	// the Host's certificate; empty accepts any certificate.
+	TLS        bool
+	CertSHA256 string
+
+	closeOnce   sync.Once
 	mu          sync.Mutex
 	isConnected bool
+	connects    int
+	failures    int       // consecutive failed connection attempts
+	nextRetry   time.Time // when the next attempt starts while waiting for the Host
+	lastMessage time.Time
+	rtt         time.Duration
+
+	// Broadcast sequence tracking for gap detection
+	lastSeq  uint64
+	received uint64
+	lost     uint64
+
+	// dropped counts messages that found the send queue full
+	dropped uint64
+
+	// hostProtocol is the protocol version the Host announced on connect (0: unknown)
+	hostProtocol int
+
+	// Outstanding requests keyed by message ID, see protocol's reply convention
+	nextID  uint64
+	pending map[string]chan protocol.Message
 }
 
+var (
+	// ErrNotConnected is returned when a request needs a live connection to the Host
+	ErrNotConnected = errors.New("not connected to host")
+
+	// ErrRequestTimeout is returned when the Host does not answer a request in time
+	ErrRequestTimeout = errors.New("no reply from host")
+
+	// ErrSwitchQueued is returned when the Host queued a switch until its
+	// switch cooldown ends
+	ErrSwitchQueued = errors.New("switch queued by host")
+
+	// ErrClientClosed is returned for messages sent after Close
+	ErrClientClosed = errors.New("client closed")
+
+	// ErrSendQueueFull is returned for messages dropped because the send
+	// queue is full, e.g. while the Host has been away for long
+	ErrSendQueueFull = errors.New("send queue full")
+)
+
+// ConnectionStatus is a point-in-time view of the link to the Host
+type ConnectionStatus struct {
+	Connected     bool       `json:"connected"`
+	State         string     `json:"state"` // "connected", "connecting" or "waiting"
+	Failures      int        `json:"failures,omitempty"`
+	NextRetryAt   *time.Time `json:"next_retry_at,omitempty"`
+	Transport     string     `json:"transport"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+	RTTMillis     float64    `json:"rtt_ms"`
+	Reconnects    int        `json:"reconnects"`
+	Received      uint64     `json:"received"`
+	Lost          uint64     `json:"lost"`
+	LossPercent   float64    `json:"loss_pct"`
+	Dropped       uint64     `json:"dropped,omitempty"`
+}
+
+// Reconnect backoff: a dropped connection is retried after reconnectDelay,
+// failed attempts double the delay up to maxReconnectDelay. At boot the
+// network may take a while to come up, so the client keeps trying.
+const (
+	reconnectDelay    = 5 * time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// MachineID identifies this machine on the LAN (its hostname). It is sent as
+// protocol.MachineHeader and as the origin of switch messages.
+func MachineID() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+// pingInterval is how often the client heartbeats the Host; each pong updates the RTT
+const pingInterval = 10 * time.Second
+
 // NewWSClient creates a new WebSocket client
 func NewWSClient(hostAddr, token string) *WSClient {
 	return &WSClient{
@@ -37,99 +143,224 @@ func NewWSClient(hostAddr, token string) *WSClient {
 		send:      make(chan protocol.Message, 100),
 		done:      make(chan struct{}),
 		reconnect: make(chan struct{}, 1),
+		pending:   make(map[string]chan protocol.Message),
 	}
 }
 
 // Start begins the client loop (connect & process)
 func (c *WSClient) Start() {
-	go c.loop()
+	supervisor.Go("ws-client", supervisor.Always, c.loop)
 }
 
 func (c *WSClient) loop() {
+	failures := 0
 	for {
-		c.connect()
+		addr := c.hostAddr
+		if c.Resolve != nil {
+			if resolved := c.Resolve(failures); resolved != "" {
+				addr = resolved
+			}
+		}
+		if c.connect(addr) {
+			failures = 0
+		} else {
+			failures++
+		}
 
 		// If connect returns, it means we disconnected. Wait a bit and retry.
+		delay := reconnectDelay
+		for i := 1; i < failures && delay < maxReconnectDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, maxReconnectDelay)
+		if failures > 0 {
+			logging.Warnf("WS Client: Host unreachable (%d attempt(s)), retrying in %v", failures, delay)
+		}
+		c.mu.Lock()
+		c.failures = failures
+		c.nextRetry = time.Now().Add(delay)
+		c.mu.Unlock()
+
 		select {
 		case <-c.done:
 			return
-		case <-time.After(5 * time.Second):
-			log.Println("WS Client: Attempting reconnection...")
-			continue
+		case <-time.After(delay):
+			logging.Debugf("WS Client: Attempting reconnection...")
+		case <-c.reconnect:
+			logging.Debugf("WS Client: Reconnecting now...")
 		}
+		c.mu.Lock()
+		c.nextRetry = time.Time{}
+		c.mu.Unlock()
 	}
 }
 
-func (c *WSClient) connect() {
-	u := url.URL{Scheme: "ws", Host: c.hostAddr, Path: "/ws"}
-	log.Printf("WS Client: Connecting to %s", u.String())
+// connect dials addr and serves the connection until it drops. It returns
+// false if no connection could be established.
+func (c *WSClient) connect(addr string) bool {
+	u := url.URL{Scheme: "ws", Host: addr, Path: "/ws"}
+	dialer := *websocket.DefaultDialer
+	if c.TLS {
+		u.Scheme = "wss"
+		dialer.TLSClientConfig = ClientTLSConfig(c.CertSHA256, nil)
+	}
+	logging.Infof("WS Client: Connecting to %s", u.String())
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	header := http.Header{}
+	header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	conn, resp, err := dialer.Dial(u.String(), header)
 	if err != nil {
-		log.Printf("WS Client: Connection failed: %v", err)
-		return
+		if resp != nil && resp.StatusCode == http.StatusUpgradeRequired {
+			logging.Errorf("WS Client: Host %s rejected protocol version %d (host speaks %s). Update vkvm on both machines to the same version.",
+				addr, protocol.Version, resp.Header.Get(protocol.VersionHeader))
+			return false
+		}
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			logging.Errorf("WS Client: Host %s rejected our API token. Check that the token matches the Host's API token.", addr)
+			return false
+		}
+		logging.Warnf("WS Client: Connection failed: %v", err)
+		return false
 	}
 	defer conn.Close()
 
+	// Closed while dialing
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	// Connecting to ourselves would loop every switch back to us
+	hostID := resp.Header.Get(protocol.MachineHeader)
+	if hostID != "" && hostID == MachineID() {
+		logging.Errorf("WS Client: Coordinator %s is this machine. An agent must point at another computer's Host; not connecting.", addr)
+		return false
+	}
+
 	c.mu.Lock()
 	c.conn = conn
 	c.isConnected = true
+	c.connects++
+	c.lastMessage = time.Now()
+	c.rtt = 0
+	c.lastSeq = 0 // Host may have broadcast while we were away; restart gap tracking
+	c.hostProtocol, _ = strconv.Atoi(resp.Header.Get(protocol.VersionHeader))
 	c.mu.Unlock()
 
-	log.Println("WS Client: Connected to Host")
+	logging.Infof("WS Client: Connected to Host")
+	if c.OnConnect != nil {
+		c.OnConnect(addr, hostID)
+	}
 
-	// Send Auth/Handshake immediately
-	// For now we assume open or token header, but let's send an Identify if needed.
-	// We'll immediately request Sync as well.
+	// Identify ourselves, then request a sync right away.
+	// The token also travels in the Authorization header of the upgrade request;
+	// the auth message lets the Host re-check it on an established connection.
+	// It is written before the write pump starts: the Host closes connections
+	// whose first message is not auth, and the queue may hold messages from
+	// while we were disconnected.
+	if err := c.writeAuth(conn); err != nil {
+		logging.Errorf("WS Client: Failed to authenticate: %v", err)
+		c.mu.Lock()
+		c.isConnected = false
+		c.conn = nil
+		c.mu.Unlock()
+		return true
+	}
 	c.SendSyncRequest()
 
 	// Start read/write pumps
 	// specific done channel for this connection
 	connDone := make(chan struct{})
+	readDone := make(chan struct{})
 
-	go func() {
+	supervisor.Go("ws-client-write", supervisor.Once, func() {
 		defer close(connDone)
-		c.writePump(conn)
-	}()
+		c.writePump(conn, readDone)
+	})
 
 	c.readPump(conn)
 
+	// Stop the write pump before reporting the disconnect, so messages queued
+	// from now on wait for the next connection instead of a dead one
+	close(readDone)
+	<-connDone
+
 	// Cleanup
 	c.mu.Lock()
 	c.isConnected = false
 	c.conn = nil
 	c.mu.Unlock()
-
-	// Ensure write pump stops
-	<-connDone
+	return true
 }
 
 func (c *WSClient) readPump(conn *websocket.Conn) {
-	conn.SetReadLimit(4096)
+	conn.SetReadLimit(protocol.MaxMessageSize)
 	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
+	conn.SetPongHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		// Our pings carry their send time, so the pong tells us the round trip
+		if sent, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			c.mu.Lock()
+			c.rtt = time.Since(time.Unix(0, sent))
+			c.lastMessage = time.Now()
+			c.mu.Unlock()
+		}
+		return nil
+	})
 
 	for {
 		_, data, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WS Client: Read error: %v", err)
+				logging.Warnf("WS Client: Read error: %v", err)
 			}
 			break
 		}
 
-		var msg protocol.Message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			log.Printf("WS Client: Invalid message: %v", err)
+		c.mu.Lock()
+		c.lastMessage = time.Now()
+		c.mu.Unlock()
+
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			logging.Warnf("WS Client: Invalid message: %v", err)
 			continue
 		}
 
+		if msg.Seq != 0 {
+			c.trackSeq(msg.Seq)
+		}
 		c.handleMessage(msg)
+		if msg.ID != "" && protocol.IsReply(msg.Type) {
+			c.resolve(msg)
+		}
 	}
 }
 
-func (c *WSClient) writePump(conn *websocket.Conn) {
-	ticker := time.NewTicker(30 * time.Second) // Ping ticker
+// trackSeq records a broadcast sequence number and counts any gap since the previous one
+func (c *WSClient) trackSeq(seq uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.received++
+	if c.lastSeq != 0 && seq > c.lastSeq+1 {
+		gap := seq - c.lastSeq - 1
+		c.lost += gap
+		logging.Warnf("WS Client: Detected gap of %d message(s) from Host (seq %d -> %d)", gap, c.lastSeq, seq)
+	}
+	if seq > c.lastSeq {
+		c.lastSeq = seq
+	}
+}
+
+// writePump writes queued messages and pings to conn until readDone is closed
+func (c *WSClient) writePump(conn *websocket.Conn, readDone <-chan struct{}) {
+	ticker := time.NewTicker(pingInterval)
 	defer ticker.Stop()
 
 	for {
@@ -138,20 +369,24 @@ func (c *WSClient) writePump(conn *websocket.Conn) {
 			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			jsonMsg, err := json.Marshal(msg)
 			if err != nil {
-				log.Printf("WS Client: Marshal error: %v", err)
+				logging.Errorf("WS Client: Marshal error: %v", err)
 				continue
 			}
 			if err := conn.WriteMessage(websocket.TextMessage, jsonMsg); err != nil {
-				log.Printf("WS Client: Write error: %v", err)
+				logging.Errorf("WS Client: Write error: %v", err)
 				return
 			}
 
 		case <-ticker.C:
 			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			ping := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+			if err := conn.WriteMessage(websocket.PingMessage, ping); err != nil {
 				return
 			}
 
+		case <-readDone:
+			return
+
 		case <-c.done:
 			return
 		}
@@ -159,45 +394,310 @@ func (c *WSClient) writePump(conn *websocket.Conn) {
 }
 
 func (c *WSClient) handleMessage(msg protocol.Message) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Errorf("WS Client: Recovered from panic handling %s: %v", msg.Type, r)
+		}
+	}()
+
 	switch msg.Type {
 	case protocol.TypeSwitch:
 		var payload protocol.SwitchPayload
-		bytes, _ := json.Marshal(msg.Payload)
-		json.Unmarshal(bytes, &payload)
+		if err := msg.DecodePayload(&payload); err != nil {
+			logging.Warnf("WS Client: Ignoring invalid switch command: %v", err)
+			return
+		}
+
+		// A switch we started coming back means the Host relays our own
+		// broadcasts, e.g. two machines configured as each other's agent
+		if payload.Origin == MachineID() {
+			logging.Warnf("WS Client: Dropping switch to '%s' that originated on this machine. "+
+				"Check that no two machines use each other as coordinator.", payload.Profile)
+			return
+		}
 
-		log.Printf("WS Client: Received switch command for '%s'", payload.Profile)
+		logging.Infof("WS Client: Received switch command for '%s'", payload.Profile)
 		if c.OnSwitch != nil {
-			c.OnSwitch(payload.Profile)
+			// Switching writes to the monitors and takes a while; the read
+			// pump must keep going meanwhile, e.g. for the reply to our own
+			// RequestSwitch
+			supervisor.Go("ws-client-switch", supervisor.Once, func() {
+				c.OnSwitch(payload.Profile, payload.Origin)
+			})
+		}
+
+	case protocol.TypeFileOffer, protocol.TypeFileChunk:
+		c.reply(protocol.TypeFileAck, msg.ID, c.handleFile(msg))
+
+	case protocol.TypeSwitchResult, protocol.TypeFileAck, protocol.TypeError:
+		// Replies are delivered to the waiting request by resolve
+		if msg.ID == "" {
+			logging.Debugf("WS Client: Ignoring %s without request ID", msg.Type)
 		}
 
 	case protocol.TypeSyncResponse:
-		var payload protocol.SyncResponsePayload
-		bytes, _ := json.Marshal(msg.Payload)
-		json.Unmarshal(bytes, &payload)
+		if msg.ID != "" {
+			return // applied by RequestSync
+		}
+		if err := c.applySync(msg); err != nil {
+			logging.Warnf("WS Client: Ignoring config sync: %v", err)
+		}
+	}
+}
+
+// applySync hands the profiles of a sync response to OnSync
+func (c *WSClient) applySync(msg protocol.Message) error {
+	var payload protocol.SyncResponsePayload
+	if err := msg.DecodePayload(&payload); err != nil {
+		return err
+	}
 
-		log.Printf("WS Client: Received config sync")
-		if c.OnSync != nil {
-			c.OnSync(payload.Profiles)
+	logging.Debugf("WS Client: Received config sync")
+	if c.OnSync != nil {
+		c.OnSync(payload.Profiles)
+	}
+	return nil
+}
+
+// writeAuth writes the authentication/identification message to conn
+func (c *WSClient) writeAuth(conn *websocket.Conn) error {
+	msg, err := protocol.NewMessage(protocol.TypeAuth, protocol.AuthPayload{
+		Token:     c.token,
+		AgentName: MachineID(),
+		Topics:    c.Topics,
+		Profile:   c.Profile,
+		MAC:       InterfaceMAC(conn.LocalAddr()),
+	})
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.WriteJSON(msg)
+}
+
+// handleFile passes a file offer or chunk from the Host to Files
+func (c *WSClient) handleFile(msg protocol.Message) protocol.FileAckPayload {
+	if c.Files == nil {
+		return protocol.FileAckPayload{Error: "this machine does not accept files"}
+	}
+	if msg.Type == protocol.TypeFileOffer {
+		var offer protocol.FileOfferPayload
+		if err := msg.DecodePayload(&offer); err != nil {
+			return protocol.FileAckPayload{Error: err.Error()}
 		}
+		return c.Files.HandleOffer("Host", offer)
+	}
+	var chunk protocol.FileChunkPayload
+	if err := msg.DecodePayload(&chunk); err != nil {
+		return protocol.FileAckPayload{Error: err.Error()}
+	}
+	return c.Files.HandleChunk("Host", chunk)
+}
+
+// SendFile sends data to the Host as a file called name and returns where
+// the Host saved it
+func (c *WSClient) SendFile(name string, data []byte) (string, error) {
+	if !c.IsConnected() {
+		return "", ErrNotConnected
+	}
+	c.mu.Lock()
+	hostProtocol := c.hostProtocol
+	c.mu.Unlock()
+	if hostProtocol < protocol.FileTransferVersion {
+		return "", ErrFilesUnsupported
+	}
+	return SendFile(name, data, c.request)
+}
+
+// reply answers the Host's request with the given ID
+func (c *WSClient) reply(t protocol.MessageType, id string, payload interface{}) {
+	if id == "" {
+		return // fire-and-forget request
+	}
+	msg, err := protocol.NewMessage(t, payload)
+	if err != nil {
+		logging.Errorf("WS Client: %v", err)
+		return
+	}
+	msg.ID = id
+	c.enqueue(msg)
+}
+
+// queue builds a message and hands it to the write pump
+func (c *WSClient) queue(t protocol.MessageType, payload interface{}) {
+	msg, err := protocol.NewMessage(t, payload)
+	if err != nil {
+		logging.Errorf("WS Client: %v", err)
+		return
+	}
+	c.enqueue(msg)
+}
+
+// enqueue hands msg to the write pump without blocking. Messages queued
+// while disconnected are sent after the next connect; once the queue is full
+// they are dropped, and after Close they are refused.
+func (c *WSClient) enqueue(msg protocol.Message) error {
+	select {
+	case <-c.done:
+		return ErrClientClosed
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return nil
+	default:
+		c.mu.Lock()
+		c.dropped++
+		c.mu.Unlock()
+		logging.Warnf("WS Client: Send queue full, dropping %s", msg.Type)
+		return ErrSendQueueFull
 	}
 }
 
 // SendSwitch sends a switch request to host
 func (c *WSClient) SendSwitch(profile string) {
-	c.send <- protocol.Message{
-		Type: protocol.TypeSwitch,
-		Payload: protocol.SwitchPayload{
-			Profile: profile,
-			Origin:  "agent", // Host will replace with actual IP if needed
-		},
+	c.queue(protocol.TypeSwitch, protocol.SwitchPayload{
+		Profile: profile,
+		Origin:  MachineID(),
+	})
+}
+
+// resolve hands a reply to the request waiting for it, if any
+func (c *WSClient) resolve(msg protocol.Message) {
+	c.mu.Lock()
+	ch, ok := c.pending[msg.ID]
+	c.mu.Unlock()
+	if !ok {
+		logging.Debugf("WS Client: Ignoring %s for unknown or expired request %q", msg.Type, msg.ID)
+		return
+	}
+	select {
+	case ch <- msg:
+	default: // duplicate reply
 	}
 }
 
+// request sends msg with a fresh ID and waits for the Host's reply. A
+// TypeError reply is returned as an error.
+func (c *WSClient) request(msg protocol.Message, timeout time.Duration) (protocol.Message, error) {
+	c.mu.Lock()
+	if !c.isConnected {
+		c.mu.Unlock()
+		return protocol.Message{}, ErrNotConnected
+	}
+	c.nextID++
+	msg.ID = fmt.Sprintf("req-%d", c.nextID)
+	ch := make(chan protocol.Message, 1)
+	c.pending[msg.ID] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+	}()
+
+	if err := c.enqueue(msg); err != nil {
+		return protocol.Message{}, err
+	}
+
+	select {
+	case reply := <-ch:
+		if reply.Type == protocol.TypeError {
+			var payload protocol.ErrorPayload
+			if err := reply.DecodePayload(&payload); err != nil {
+				return reply, fmt.Errorf("host error: %w", err)
+			}
+			return reply, fmt.Errorf("host error (%s): %s", payload.Code, payload.Message)
+		}
+		return reply, nil
+	case <-time.After(timeout):
+		return protocol.Message{}, fmt.Errorf("%w within %v for %s", ErrRequestTimeout, timeout, msg.Type)
+	case <-c.done:
+		return protocol.Message{}, ErrNotConnected
+	}
+}
+
+// supportsReplies reports whether the connected Host answers requests with an ID
+func (c *WSClient) supportsReplies() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hostProtocol >= protocol.RepliesVersion
+}
+
+// RequestSwitch asks the Host to switch profiles and waits for its verdict.
+// Hosts older than protocol.RepliesVersion never answer, so the request is
+// sent fire-and-forget to them.
+func (c *WSClient) RequestSwitch(profile string, timeout time.Duration) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	if !c.supportsReplies() {
+		c.SendSwitch(profile)
+		return nil
+	}
+
+	msg, err := protocol.NewMessage(protocol.TypeSwitch, protocol.SwitchPayload{
+		Profile: profile,
+		Origin:  MachineID(),
+	})
+	if err != nil {
+		return err
+	}
+	reply, err := c.request(msg, timeout)
+	if err != nil {
+		return err
+	}
+
+	var result protocol.SwitchResultPayload
+	if err := reply.DecodePayload(&result); err != nil {
+		return fmt.Errorf("unexpected switch reply: %w", err)
+	}
+	if result.Queued {
+		return ErrSwitchQueued
+	}
+	if !result.Success {
+		return fmt.Errorf("host failed to switch to '%s': %s", profile, result.Error)
+	}
+	return nil
+}
+
+// RequestSync asks the Host for its profiles and waits until they have been
+// applied via OnSync. Old hosts get a fire-and-forget sync request.
+func (c *WSClient) RequestSync(timeout time.Duration) error {
+	if !c.IsConnected() {
+		return ErrNotConnected
+	}
+	if !c.supportsReplies() {
+		c.SendSyncRequest()
+		return nil
+	}
+	reply, err := c.request(protocol.Message{Type: protocol.TypeSyncRequest}, timeout)
+	if err != nil {
+		return err
+	}
+	return c.applySync(reply)
+}
+
 // SendSyncRequest asks host for config
 func (c *WSClient) SendSyncRequest() {
-	c.send <- protocol.Message{
-		Type:    protocol.TypeSyncRequest,
-		Payload: nil,
+	c.queue(protocol.TypeSyncRequest, nil)
+}
+
+// Reconnect drops the current connection, if any, and dials the Host again
+// without waiting for the reconnect delay, e.g. after the network changed
+func (c *WSClient) Reconnect() {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+
+	select {
+	case c.reconnect <- struct{}{}:
+	default:
 	}
 }
 
@@ -208,7 +708,52 @@ func (c *WSClient) IsConnected() bool {
 	return c.isConnected
 }
 
-// Close stops the client
+// Status returns connection details: liveness, last traffic, RTT and reconnect count
+func (c *WSClient) Status() ConnectionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := ConnectionStatus{
+		Connected: c.isConnected,
+		State:     "connecting",
+		Transport: "ws",
+		RTTMillis: float64(c.rtt.Microseconds()) / 1000,
+	}
+	switch {
+	case c.isConnected:
+		status.State = "connected"
+	case !c.nextRetry.IsZero():
+		status.State = "waiting"
+		status.Failures = c.failures
+		next := c.nextRetry
+		status.NextRetryAt = &next
+	}
+	if c.connects > 1 {
+		status.Reconnects = c.connects - 1
+	}
+	status.Received = c.received
+	status.Lost = c.lost
+	status.Dropped = c.dropped
+	if total := c.received + c.lost; total > 0 {
+		status.LossPercent = float64(c.lost) * 100 / float64(total)
+	}
+	if !c.lastMessage.IsZero() {
+		last := c.lastMessage
+		status.LastMessageAt = &last
+	}
+	return status
+}
+
+// Close stops the client and drops its connection
 func (c *WSClient) Close() {
-	close(c.done)
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
 }
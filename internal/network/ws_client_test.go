@@ -0,0 +1,401 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/protocol"
+	"vkvm/internal/testutil"
+)
+
+// A closed client refuses messages instead of blocking the caller
+func TestWSClientSendAfterClose(t *testing.T) {
+	c := NewWSClient("192.0.2.1:8080", "")
+	c.mu.Lock()
+	c.isConnected = true // as if the connection had not noticed yet
+	c.mu.Unlock()
+	c.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.request(protocol.Message{Type: protocol.TypeSyncRequest}, time.Minute)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClientClosed) {
+			t.Errorf("request after Close: %v, want ErrClientClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request after Close blocked")
+	}
+	if err := c.enqueue(protocol.Message{Type: protocol.TypeSyncRequest}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("enqueue after Close: %v, want ErrClientClosed", err)
+	}
+}
+
+// Without a write pump, a full queue drops messages instead of blocking
+func TestWSClientSendQueueFull(t *testing.T) {
+	c := NewWSClient("192.0.2.1:8080", "")
+	for range cap(c.send) {
+		c.SendSyncRequest()
+	}
+	if err := c.enqueue(protocol.Message{Type: protocol.TypeSyncRequest}); !errors.Is(err, ErrSendQueueFull) {
+		t.Errorf("enqueue to a full queue: %v, want ErrSendQueueFull", err)
+	}
+	c.reply(protocol.TypeFileAck, "req-1", protocol.FileAckPayload{})
+	if dropped := c.Status().Dropped; dropped != 2 {
+		t.Errorf("dropped %d, want 2", dropped)
+	}
+}
+
+// A slow switch must not hold up the read pump
+func TestWSClientSwitchDoesNotBlockReads(t *testing.T) {
+	c := NewWSClient("192.0.2.1:8080", "")
+	release := make(chan struct{})
+	switched := make(chan string, 1)
+	c.OnSwitch = func(profile, origin string) {
+		<-release
+		switched <- profile
+	}
+
+	msg, err := protocol.NewMessage(protocol.TypeSwitch, protocol.SwitchPayload{Profile: "PC1", Origin: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan struct{})
+	go func() {
+		c.handleMessage(msg)
+		close(handled)
+	}()
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("handleMessage waited for the switch")
+	}
+
+	close(release)
+	select {
+	case p := <-switched:
+		if p != "PC1" {
+			t.Errorf("switched to %q, want PC1", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnSwitch not called")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	var ips []string
+	for i := 1; i <= 254; i++ {
+		ips = append(ips, fmt.Sprintf("192.0.2.%d", i))
+	}
+
+	var running, most, probed atomic.Int32
+	probe := func(ip string) (DiscoveredHost, bool) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		probed.Add(1)
+		time.Sleep(5 * time.Millisecond)
+		return DiscoveredHost{IP: ip}, ip == "192.0.2.7" || ip == "192.0.2.200"
+	}
+
+	var mu sync.Mutex
+	var found []string
+	sweep(context.Background(), ips, probe, func(h DiscoveredHost) {
+		mu.Lock()
+		found = append(found, h.IP)
+		mu.Unlock()
+	})
+	slices.Sort(found)
+	if !slices.Equal(found, []string{"192.0.2.200", "192.0.2.7"}) {
+		t.Errorf("found %v", found)
+	}
+	if n := probed.Load(); n != 254 {
+		t.Errorf("probed %d addresses, want 254", n)
+	}
+	if n := most.Load(); n > scanWorkers {
+		t.Errorf("%d probes ran at once, want at most %d", n, scanWorkers)
+	}
+
+	// Cancelling stops the sweep: the first hit is reported right away, and
+	// the addresses after the ones in flight are never probed
+	ctx, cancel := context.WithCancel(context.Background())
+	probed.Store(0)
+	start := time.Now()
+	sweep(ctx, ips, probe, func(DiscoveredHost) { cancel() })
+	if n := probed.Load(); n >= 254 {
+		t.Errorf("probed all %d addresses after cancelling", n)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("cancelled sweep took %v", d)
+	}
+}
+
+func TestProbeHost(t *testing.T) {
+	var tokenRequired atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"version":"1.2.0","protocol":%d,"machine":"desk","role":"host","platform":"linux","token_required":%v}`,
+			protocol.Version, tokenRequired.Load())
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"current_profile":"PC1","profiles":["PC1","PC2"]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	host, ok := probeHost(context.Background(), u.Hostname(), port, false)
+	if !ok || host.ID != "desk" || host.Role != "host" || host.Incompatible || host.CurrentProfile != "PC1" || len(host.Profiles) != 2 {
+		t.Errorf("probeHost = %+v, %v", host, ok)
+	}
+
+	// Without the token the profiles stay unknown
+	tokenRequired.Store(true)
+	host, ok = probeHost(context.Background(), u.Hostname(), port, false)
+	if !ok || !host.TokenRequired || host.Profiles != nil {
+		t.Errorf("probeHost with a token = %+v, %v", host, ok)
+	}
+
+	// Other web servers are not vkvm
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+	u, _ = url.Parse(other.URL)
+	port, _ = strconv.Atoi(u.Port())
+	if host, ok := probeHost(context.Background(), u.Hostname(), port, false); ok {
+		t.Errorf("probeHost of a web server = %+v", host)
+	}
+}
+
+// newTestReceiver returns a FileReceiver that accepts files into a temporary
+// directory, and that directory
+func newTestReceiver(t *testing.T) (*FileReceiver, string) {
+	t.Helper()
+	m := testutil.NewConfig(t)
+	dir := t.TempDir()
+	m.Update(func(c *config.Config) {
+		c.General.ReceiveFiles = true
+		c.General.ReceiveDir = dir
+	})
+	return NewFileReceiver(m), dir
+}
+
+// deliverTo returns a SendFile request function that hands the messages to
+// r as coming from sender
+func deliverTo(r *FileReceiver, sender string) func(protocol.Message, time.Duration) (protocol.Message, error) {
+	return func(msg protocol.Message, _ time.Duration) (protocol.Message, error) {
+		var ack protocol.FileAckPayload
+		switch msg.Type {
+		case protocol.TypeFileOffer:
+			var offer protocol.FileOfferPayload
+			if err := msg.DecodePayload(&offer); err != nil {
+				return protocol.Message{}, err
+			}
+			ack = r.HandleOffer(sender, offer)
+		case protocol.TypeFileChunk:
+			var chunk protocol.FileChunkPayload
+			if err := msg.DecodePayload(&chunk); err != nil {
+				return protocol.Message{}, err
+			}
+			ack = r.HandleChunk(sender, chunk)
+		}
+		return protocol.NewMessage(protocol.TypeFileAck, ack)
+	}
+}
+
+func TestSendFile(t *testing.T) {
+	r, dir := newTestReceiver(t)
+	data := bytes.Repeat([]byte("vkvm"), protocol.FileChunkSize/2+100) // three chunks
+
+	path, err := SendFile("/home/me/notes.txt", data, deliverTo(r, "laptop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, "notes.txt") {
+		t.Errorf("saved to %s", path)
+	}
+	if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("saved %d bytes (%v), want %d", len(got), err, len(data))
+	}
+
+	// The same name again does not overwrite; empty files need no chunks
+	path, err = SendFile("notes.txt", nil, deliverTo(r, "laptop"))
+	if err != nil || path != filepath.Join(dir, "notes (2).txt") {
+		t.Errorf("second file saved to %s: %v", path, err)
+	}
+}
+
+func TestReceiveFileRejects(t *testing.T) {
+	r, dir := newTestReceiver(t)
+	data := []byte("hello")
+	offer := protocol.FileOfferPayload{TransferID: "t1", Name: "a.txt", Size: int64(len(data)), SHA256: "00"}
+
+	// A chunk from another connection can't write to the transfer
+	if ack := r.HandleOffer("laptop", offer); ack.Error != "" {
+		t.Fatal(ack.Error)
+	}
+	if ack := r.HandleChunk("desktop", protocol.FileChunkPayload{TransferID: "t1", Data: data}); ack.Error != "unknown transfer" {
+		t.Errorf("chunk from another sender: %+v", ack)
+	}
+	// A file that does not match its checksum is dropped
+	if ack := r.HandleChunk("laptop", protocol.FileChunkPayload{TransferID: "t1", Data: data}); ack.Error != "checksum mismatch" {
+		t.Errorf("corrupt file: %+v", ack)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+
+	if ack := r.HandleOffer("laptop", protocol.FileOfferPayload{TransferID: "t2", Name: ".."}); ack.Error != "invalid file name" {
+		t.Errorf("offer of '..': %+v", ack)
+	}
+
+	// At most maxIncomingTransfers files are received at once
+	for i := range maxIncomingTransfers {
+		offer := protocol.FileOfferPayload{TransferID: fmt.Sprint("busy", i), Name: "b.txt", Size: 1}
+		if ack := r.HandleOffer("laptop", offer); ack.Error != "" {
+			t.Fatalf("offer %d: %s", i, ack.Error)
+		}
+	}
+	if ack := r.HandleOffer("desktop", offer); ack.Error == "" {
+		t.Error("accepted one transfer too many")
+	}
+
+	r.configMgr.Update(func(c *config.Config) { c.General.ReceiveFiles = false })
+	if _, err := SendFile("c.txt", data, deliverTo(r, "laptop")); err == nil {
+		t.Error("sent a file with receiving disabled")
+	}
+}
+
+func TestMDNSAnswer(t *testing.T) {
+	instance := mdnsInstance() + "." + MDNSService
+	info := MDNSInfo("host", "1.2.0", "linux", "PC1", false)
+	msg, err := parseDNS(mdnsAnswer(instance, 8080, info).encode())
+	if err != nil || !msg.Response {
+		t.Fatalf("parseDNS = %+v, %v", msg, err)
+	}
+
+	var host DiscoveredHost
+	for _, r := range msg.Records {
+		switch r.Type {
+		case dnsTypePTR:
+			if r.Name != MDNSService || r.Target != instance {
+				t.Errorf("PTR %s -> %s", r.Name, r.Target)
+			}
+		case dnsTypeSRV:
+			if r.Name != instance || r.Port != 8080 {
+				t.Errorf("SRV %s port %d", r.Name, r.Port)
+			}
+		case dnsTypeTXT:
+			host = hostFromTXT("192.0.2.7", 8080, decodeTXT(r.Data))
+		}
+	}
+	want := DiscoveredHost{
+		IP: "192.0.2.7", Port: 8080, ID: MachineID(), Role: "host", CurrentProfile: "PC1",
+		Version: "1.2.0", Platform: "linux", Protocol: protocol.Version,
+	}
+	if fmt.Sprint(host) != fmt.Sprint(want) {
+		t.Errorf("host from TXT %+v, want %+v", host, want)
+	}
+
+	// The profile is not announced when the API needs a token
+	if txt := MDNSInfo("host", "1.2.0", "linux", "PC1", true); txt["profile"] != "" || txt["token_required"] != "1" {
+		t.Errorf("TXT with a token %v", txt)
+	}
+}
+
+func TestParseDNS(t *testing.T) {
+	// A response whose SRV record names its instance through a pointer to
+	// the PTR target, as real responders compress them
+	b := dnsMessage{Response: true, Records: []dnsRecord{
+		{Name: MDNSService, Type: dnsTypePTR, Class: dnsClassIN, Target: "desk." + MDNSService},
+	}}.encode()
+	b[7] = 2                                              // two answers
+	target := 12 + len(appendName(nil, MDNSService)) + 10 // the PTR's RDATA
+	b = append(b, 0xC0|byte(target>>8), byte(target))
+	b = binary.BigEndian.AppendUint16(b, dnsTypeSRV)
+	b = binary.BigEndian.AppendUint16(b, dnsClassIN)
+	b = binary.BigEndian.AppendUint32(b, mdnsTTL)
+	b = binary.BigEndian.AppendUint16(b, 8)
+	b = append(b, 0, 0, 0, 0, 0x1F, 0x90, 0xC0|byte(target>>8), byte(target))
+
+	msg, err := parseDNS(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Records) != 2 || msg.Records[1].Name != "desk."+MDNSService || msg.Records[1].Port != 8080 || msg.Records[1].Target != "desk."+MDNSService {
+		t.Errorf("records %+v", msg.Records)
+	}
+
+	// Truncated messages are errors, not panics
+	for n := range len(b) {
+		if _, err := parseDNS(b[:n]); err == nil {
+			t.Errorf("parsed the first %d of %d bytes", n, len(b))
+		}
+	}
+
+	// A pointer to itself is a loop
+	loop := append(dnsMessage{}.encode(), 0xC0, 12, 0, 1, 0, 1)
+	loop[5] = 1 // one question
+	if _, err := parseDNS(loop); err == nil {
+		t.Error("parsed a name compression loop")
+	}
+}
+
+func TestMDNSAdvertiseBrowse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	advertised := make(chan error, 1)
+	go func() {
+		advertised <- AdvertiseMDNS(ctx, 18080, func() map[string]string {
+			return MDNSInfo("host", "1.2.0", "linux", "PC1", false)
+		})
+	}()
+
+	browseCtx, stop := context.WithTimeout(ctx, 2*time.Second)
+	defer stop()
+	found := make(chan map[string]string, 1)
+	err := BrowseMDNS(browseCtx, func(ip string, port int, txt map[string]string) {
+		if port == 18080 && txt["id"] == MachineID() {
+			select {
+			case found <- txt:
+			default:
+			}
+			stop()
+		}
+	})
+	select {
+	case err := <-advertised:
+		t.Skipf("multicast unavailable: %v", err)
+	default:
+	}
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	select {
+	case txt := <-found:
+		if txt["profile"] != "PC1" {
+			t.Errorf("TXT %v", txt)
+		}
+	default:
+		t.Skip("no answer over multicast; the network may not loop it back")
+	}
+}
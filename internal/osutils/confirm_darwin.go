@@ -0,0 +1,34 @@
+//go:build darwin
+
+package osutils
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Confirm asks the local user a yes/no question. It returns false if the
+// user declines or does not answer within timeout.
+func Confirm(title, message string, timeout time.Duration) (bool, error) {
+	script := fmt.Sprintf(`display dialog %s with title %s buttons {"Decline", "Accept"} default button "Accept" with icon caution giving up after %d`,
+		appleScriptString(message), appleScriptString(title), int(timeout.Seconds()))
+	out, err := exec.Command("osascript", "-e", script).Output()
+	if err != nil {
+		// osascript exits with an error when the dialog is cancelled
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	// Output looks like "button returned:Accept, gave up:false"
+	result := string(out)
+	return strings.Contains(result, "button returned:Accept") && !strings.Contains(result, "gave up:true"), nil
+}
+
+// appleScriptString quotes s as an AppleScript string literal
+func appleScriptString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,31 @@
+//go:build !darwin && !windows
+
+package osutils
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Confirm asks the local user a yes/no question through zenity, if it is
+// installed. It returns false if the user declines or does not answer within
+// timeout.
+func Confirm(title, message string, timeout time.Duration) (bool, error) {
+	path, err := exec.LookPath("zenity")
+	if err != nil {
+		return false, errors.New("confirmation prompts need zenity on this platform")
+	}
+	err = exec.Command(path, "--question", "--title", title, "--text", message,
+		"--ok-label", "Accept", "--cancel-label", "Decline",
+		fmt.Sprintf("--timeout=%d", int(timeout.Seconds()))).Run()
+	if err != nil {
+		// zenity exits with 1 on decline and 5 on timeout
+		if _, ok := err.(*exec.ExitError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
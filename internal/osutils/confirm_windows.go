@@ -0,0 +1,49 @@
+//go:build windows
+
+package osutils
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	mbYesNo         = 0x00000004
+	mbIconQuestion  = 0x00000020
+	mbSystemModal   = 0x00001000
+	mbSetForeground = 0x00010000
+	mbTopmost       = 0x00040000
+	idYes           = 6
+)
+
+// MessageBoxTimeoutW is undocumented but available since Windows XP; it
+// closes the box and returns 32000 once the timeout expires
+var procMessageBoxTimeoutW = modUser32.NewProc("MessageBoxTimeoutW")
+
+// Confirm asks the local user a yes/no question. It returns false if the
+// user declines or does not answer within timeout.
+func Confirm(title, message string, timeout time.Duration) (bool, error) {
+	if err := procMessageBoxTimeoutW.Find(); err != nil {
+		return false, err
+	}
+	t, err := windows.UTF16PtrFromString(title)
+	if err != nil {
+		return false, err
+	}
+	m, err := windows.UTF16PtrFromString(message)
+	if err != nil {
+		return false, err
+	}
+
+	ret, _, _ := procMessageBoxTimeoutW.Call(
+		0,
+		uintptr(unsafe.Pointer(m)),
+		uintptr(unsafe.Pointer(t)),
+		uintptr(mbYesNo|mbIconQuestion|mbSystemModal|mbSetForeground|mbTopmost),
+		0,
+		uintptr(timeout.Milliseconds()),
+	)
+	return ret == idYes, nil
+}
@@ -0,0 +1,21 @@
+//go:build darwin
+
+package osutils
+
+/*
+#cgo LDFLAGS: -framework CoreGraphics
+#include <CoreGraphics/CoreGraphics.h>
+
+double secondsSinceLastInput() {
+    return CGEventSourceSecondsSinceLastEventType(kCGEventSourceStateCombinedSessionState, kCGAnyInputEventType);
+}
+*/
+import "C"
+
+import "time"
+
+// IdleTime returns how long ago the user last pressed a key or moved the mouse
+func IdleTime() (time.Duration, error) {
+	seconds := float64(C.secondsSinceLastInput())
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !windows
+
+package osutils
+
+import (
+	"errors"
+	"time"
+)
+
+// IdleTime is not supported on this platform
+func IdleTime() (time.Duration, error) {
+	return 0, errors.New("idle detection is not supported on this platform")
+}
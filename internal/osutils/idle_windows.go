@@ -0,0 +1,32 @@
+//go:build windows
+
+package osutils
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	procGetLastInputInfo = user32.NewProc("GetLastInputInfo")
+	procGetTickCount     = syscall.NewLazyDLL("kernel32.dll").NewProc("GetTickCount")
+)
+
+type lastInputInfo struct {
+	CbSize uint32
+	DwTime uint32
+}
+
+// IdleTime returns how long ago the user last pressed a key or moved the mouse
+func IdleTime() (time.Duration, error) {
+	info := lastInputInfo{CbSize: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	ret, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 0, fmt.Errorf("GetLastInputInfo failed: %v", err)
+	}
+	now, _, _ := procGetTickCount.Call()
+	// Both are 32-bit millisecond tick counts; the subtraction survives wrap-around
+	return time.Duration(uint32(now)-info.DwTime) * time.Millisecond, nil
+}
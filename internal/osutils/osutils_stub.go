@@ -4,9 +4,10 @@ package osutils
 
 import (
 	"fmt"
-	"log"
 	"os/exec"
 	"runtime"
+
+	"vkvm/internal/logging"
 )
 
 // IsAdmin is a stub for non-Windows platforms
@@ -24,6 +25,6 @@ func TurnOffDisplay() error {
 
 // EnsureFirewallRule is a stub for non-Windows platforms
 func EnsureFirewallRule(port int) error {
-	log.Println("Firewall: Automatic rule management is only supported on Windows")
+	logging.Infof("Firewall: Automatic rule management is only supported on Windows")
 	return nil
 }
@@ -4,12 +4,13 @@ package osutils
 
 import (
 	"fmt"
-	"log"
 	"os/exec"
 	"strings"
 	"syscall"
 
 	"golang.org/x/sys/windows"
+
+	"vkvm/internal/logging"
 )
 
 const (
@@ -21,7 +22,7 @@ const (
 
 var (
 	// Reuse user32 from wake_windows.go if available, otherwise redefine here locally if needed.
-	// Since order of init is not guaranteed, safer to load what we need or use the one from wake_windows.go 
+	// Since order of init is not guaranteed, safer to load what we need or use the one from wake_windows.go
 	// assuming it's package level. But wake_windows.go vars are unexported (lowercase user32).
 	// So we should define our own to be safe and independent.
 	modUser32        = syscall.NewLazyDLL("user32.dll")
@@ -81,7 +82,7 @@ func IsAdmin() bool {
 func EnsureFirewallRule(port int) error {
 	ruleName := "VKVM Remote Switch"
 
-	log.Printf("Firewall: Checking status for rule '%s' on port %d...", ruleName, port)
+	logging.Infof("Firewall: Checking status for rule '%s' on port %d...", ruleName, port)
 
 	// 1. Check if rule already exists AND matches the port
 	// We use netsh to be safe, but check for the port string in the output
@@ -93,12 +94,12 @@ func EnsureFirewallRule(port int) error {
 		// Rule exists, check if port matches
 		portStr := fmt.Sprintf("%d", port)
 		if strings.Contains(outputStr, portStr) && strings.Contains(outputStr, "Allow") {
-			log.Printf("Firewall: Rule '%s' already exists and matches port %d. OK.", ruleName, port)
+			logging.Infof("Firewall: Rule '%s' already exists and matches port %d. OK.", ruleName, port)
 			return nil
 		}
-		log.Printf("Firewall: Rule '%s' exists but port/action mismatch. Updating...", ruleName)
+		logging.Infof("Firewall: Rule '%s' exists but port/action mismatch. Updating...", ruleName)
 	} else {
-		log.Printf("Firewall: Rule '%s' not found. Creating...", ruleName)
+		logging.Infof("Firewall: Rule '%s' not found. Creating...", ruleName)
 	}
 
 	// 2. Prepare PowerShell command to create the rule
@@ -111,7 +112,7 @@ func EnsureFirewallRule(port int) error {
 
 	// 3. Execute with RunAs verb to trigger UAC if not already admin
 	if !IsAdmin() {
-		log.Println("Firewall: Current process is NOT elevated. Requesting UAC elevation via ShellExecute...")
+		logging.Infof("Firewall: Current process is NOT elevated. Requesting UAC elevation via ShellExecute...")
 
 		verbPtr, _ := syscall.UTF16PtrFromString("runas")
 		exePtr, _ := syscall.UTF16PtrFromString("powershell.exe")
@@ -123,14 +124,14 @@ func EnsureFirewallRule(port int) error {
 		if err != nil {
 			return fmt.Errorf("failed to launch elevated powershell via ShellExecute: %w", err)
 		}
-		log.Println("Firewall: UAC prompt requested. Please check your screen/taskbar.")
+		logging.Infof("Firewall: UAC prompt requested. Please check your screen/taskbar.")
 	} else {
-		log.Println("Firewall: Already running as admin. Applying simplified port-based rule directly.")
+		logging.Infof("Firewall: Already running as admin. Applying simplified port-based rule directly.")
 		cmd := exec.Command("powershell", "-NoProfile", "-Command", psCommand)
 		if output, err := cmd.CombinedOutput(); err != nil {
 			return fmt.Errorf("failed to create firewall rule: %w (Output: %s)", err, string(output))
 		}
-		log.Printf("Firewall: Successfully applied simplified rule for port %d", port)
+		logging.Infof("Firewall: Successfully applied simplified rule for port %d", port)
 	}
 
 	return nil
@@ -0,0 +1,18 @@
+//go:build darwin
+
+package osutils
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// OnBattery reports whether the machine currently runs on battery power
+func OnBattery() (bool, error) {
+	// First line: "Now drawing from 'Battery Power'" or "'AC Power'"
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(out), "'Battery Power'"), nil
+}
@@ -0,0 +1,34 @@
+//go:build !darwin && !windows
+
+package osutils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OnBattery reports whether the machine currently runs on battery power,
+// i.e. it has mains supplies (Linux sysfs) and none of them is online
+func OnBattery() (bool, error) {
+	supplies, err := filepath.Glob("/sys/class/power_supply/*")
+	if err != nil {
+		return false, err
+	}
+	offline := false
+	for _, dir := range supplies {
+		kind, err := os.ReadFile(filepath.Join(dir, "type"))
+		if err != nil || strings.TrimSpace(string(kind)) != "Mains" {
+			continue
+		}
+		online, err := os.ReadFile(filepath.Join(dir, "online"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(online)) == "1" {
+			return false, nil
+		}
+		offline = true
+	}
+	return offline, nil // false on desktops without a mains supply entry
+}
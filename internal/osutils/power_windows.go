@@ -0,0 +1,31 @@
+//go:build windows
+
+package osutils
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procGetSystemPowerStatus = syscall.NewLazyDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// OnBattery reports whether the machine currently runs on battery power
+func OnBattery() (bool, error) {
+	var status systemPowerStatus
+	ret, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return false, fmt.Errorf("GetSystemPowerStatus failed: %v", err)
+	}
+	// ACLineStatus: 0 offline, 1 online, 255 unknown
+	return status.ACLineStatus == 0, nil
+}
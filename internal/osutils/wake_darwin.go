@@ -3,8 +3,11 @@
 package osutils
 
 /*
-#cgo LDFLAGS: -framework CoreGraphics -framework CoreFoundation
+#cgo LDFLAGS: -framework CoreGraphics -framework CoreFoundation -framework ApplicationServices
 #include <CoreGraphics/CoreGraphics.h>
+#include <ApplicationServices/ApplicationServices.h>
+#include <math.h>
+#include <unistd.h>
 
 void wakeUpMouse() {
     // Get current mouse position
@@ -23,13 +26,50 @@ void wakeUpMouse() {
     CGEventPost(kCGHIDEventTap, move2);
     CFRelease(move2);
 }
+
+// moveMouseCircle moves the pointer once around a circle that starts and
+// ends at its current position. Returns 0 without Accessibility permission,
+// since macOS silently drops injected events then.
+int moveMouseCircle(int radius, int steps) {
+    if (!AXIsProcessTrusted()) {
+        return 0;
+    }
+
+    CGEventRef event = CGEventCreate(NULL);
+    CGPoint loc = CGEventGetLocation(event);
+    CFRelease(event);
+
+    for (int i = 1; i <= steps; i++) {
+        double angle = 2 * M_PI * i / steps;
+        CGPoint p = CGPointMake(loc.x + radius * (cos(angle) - 1), loc.y + radius * sin(angle));
+        CGEventRef move = CGEventCreateMouseEvent(NULL, kCGEventMouseMoved, p, kCGMouseButtonLeft);
+        CGEventPost(kCGHIDEventTap, move);
+        CFRelease(move);
+        usleep(10000);
+    }
+    return 1;
+}
 */
 import "C"
 
-import "log"
+import (
+	"errors"
+
+	"vkvm/internal/logging"
+)
 
 // WakeUp simulates a small mouse movement to wake the system from sleep or screensaver
 func WakeUp() {
-	log.Println("WakeUp: Simulating mouse movement to wake system...")
+	logging.Infof("WakeUp: Simulating mouse movement to wake system...")
 	C.wakeUpMouse()
 }
+
+// TestInject moves the mouse pointer once around a small circle and back to
+// where it started, to verify that input injection works
+func TestInject(radius int, steps int) error {
+	logging.Infof("TestInject: Moving mouse in a %dpx circle", radius)
+	if C.moveMouseCircle(C.int(radius), C.int(steps)) == 0 {
+		return errors.New("accessibility permission is required to inject input")
+	}
+	return nil
+}
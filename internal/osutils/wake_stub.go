@@ -2,9 +2,18 @@
 
 package osutils
 
-import "log"
+import (
+	"errors"
+
+	"vkvm/internal/logging"
+)
 
 // WakeUp is a no-op stub for unsupported platforms
 func WakeUp() {
-	log.Println("WakeUp: Not implemented on this platform")
+	logging.Infof("WakeUp: Not implemented on this platform")
+}
+
+// TestInject is not supported on this platform
+func TestInject(radius int, steps int) error {
+	return errors.New("input injection is not supported on this platform")
 }
@@ -3,9 +3,13 @@
 package osutils
 
 import (
-	"log"
+	"errors"
+	"math"
 	"syscall"
+	"time"
 	"unsafe"
+
+	"vkvm/internal/logging"
 )
 
 var (
@@ -35,7 +39,7 @@ type INPUT struct {
 
 // WakeUp simulates a small mouse movement to wake the system from sleep or screensaver
 func WakeUp() {
-	log.Println("WakeUp: Simulating mouse movement to wake system...")
+	logging.Infof("WakeUp: Simulating mouse movement to wake system...")
 
 	// Create mouse move input (relative movement of 1 pixel)
 	var input INPUT
@@ -60,3 +64,37 @@ func WakeUp() {
 		unsafe.Sizeof(input),
 	)
 }
+
+// TestInject moves the mouse pointer once around a small circle and back to
+// where it started, to verify that input injection works. It returns an
+// error if Windows rejected the injected input (e.g. UIPI blocks it while an
+// elevated window has focus).
+func TestInject(radius int, steps int) error {
+	logging.Infof("TestInject: Moving mouse in a %dpx circle", radius)
+
+	var input INPUT
+	input.Type = INPUT_MOUSE
+	input.Mi.DwFlags = MOUSEEVENTF_MOVE
+
+	// Relative moves from point to point around the circle, starting at the cursor
+	prevX, prevY := 0, 0
+	for i := 1; i <= steps; i++ {
+		angle := 2 * math.Pi * float64(i) / float64(steps)
+		x := int(math.Round(float64(radius) * (math.Cos(angle) - 1)))
+		y := int(math.Round(float64(radius) * math.Sin(angle)))
+		input.Mi.Dx = int32(x - prevX)
+		input.Mi.Dy = int32(y - prevY)
+		prevX, prevY = x, y
+
+		sent, _, err := procSendInput.Call(
+			1,
+			uintptr(unsafe.Pointer(&input)),
+			unsafe.Sizeof(input),
+		)
+		if sent == 0 {
+			return errors.Join(errors.New("input injection was blocked"), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
@@ -1,5 +1,38 @@
 package protocol
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Version is the wire protocol version spoken by this build.
+// Bump it whenever a message or endpoint changes in an incompatible way.
+//
+//	1: initial WebSocket protocol
+//	2: requests may carry an ID and are answered with a reply carrying the same ID
+//	3: file transfer (TypeFileOffer, TypeFileChunk, TypeFileAck)
+const Version = 3
+
+// MinCompatibleVersion is the oldest peer protocol version this build still understands.
+const MinCompatibleVersion = 1
+
+// VersionHeader is the HTTP header peers use to announce their protocol version
+// on API requests and WebSocket upgrades.
+const VersionHeader = "X-VKVM-Protocol"
+
+// MachineHeader carries the Host's machine ID (its hostname) on WebSocket
+// upgrades, so agents can find the Host again after its address changes
+const MachineHeader = "X-VKVM-Machine"
+
+// IsCompatible reports whether a peer speaking protocol version v can talk to this build
+func IsCompatible(v int) bool {
+	return v >= MinCompatibleVersion && v <= Version
+}
+
 // MessageType defines the type of WebSocket message
 type MessageType string
 
@@ -18,12 +51,151 @@ const (
 	
 	// TypePing can be used for application-level heartbeats if needed
 	TypePing MessageType = "ping"
+
+	// TypeSwitchResult is the host's reply to an agent's TypeSwitch request
+	TypeSwitchResult MessageType = "switch_result"
+
+	// TypeError is the reply to any request that could not be handled
+	TypeError MessageType = "error"
+
+	// TypeFileOffer announces a file; the receiver answers with TypeFileAck
+	TypeFileOffer MessageType = "file_offer"
+
+	// TypeFileChunk carries the next part of an accepted file
+	TypeFileChunk MessageType = "file_chunk"
+
+	// TypeFileAck is the reply to TypeFileOffer and TypeFileChunk
+	TypeFileAck MessageType = "file_ack"
 )
 
+// FileTransferVersion is the first protocol version whose peers accept files
+const FileTransferVersion = 3
+
+// IsReply reports whether messages of type t answer a request
+func IsReply(t MessageType) bool {
+	switch t {
+	case TypeSwitchResult, TypeSyncResponse, TypeFileAck, TypeError:
+		return true
+	}
+	return false
+}
+
+// RepliesVersion is the first protocol version whose peers answer requests that carry an ID
+const RepliesVersion = 2
+
+// Reply convention: a request that expects an answer sets a unique, non-empty
+// ID. The receiver answers exactly once with a message carrying the same ID,
+// either the request's response type (TypeSyncRequest -> TypeSyncResponse,
+// TypeSwitch -> TypeSwitchResult, TypeFileOffer/TypeFileChunk -> TypeFileAck)
+// or TypeError. Messages without an ID are
+// fire-and-forget and are never answered.
+
+// MaxMessageSize is the largest WebSocket message either side accepts
+const MaxMessageSize = 64 * 1024
+
+// MaxFieldLength bounds names, tokens and other free-form string fields
+const MaxFieldLength = 256
+
 // Message is the generic container for all WebSocket messages
 type Message struct {
-	Type    MessageType     `json:"type"`
-	Payload interface{}     `json:"payload,omitempty"`
+	Type MessageType `json:"type"`
+
+	// Payload is the type-specific body; build it with NewMessage and read it
+	// with DecodePayload
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// Seq numbers the host broadcasts sent on a connection (starting at 1) so
+	// receivers can detect dropped messages. Zero for direct replies that are
+	// not broadcast.
+	Seq uint64 `json:"seq,omitempty"`
+
+	// ID correlates a request with its reply; replies echo the request's ID.
+	// Empty for messages that expect no reply.
+	ID string `json:"id,omitempty"`
+}
+
+// NewMessage builds a message of type t with payload encoded as JSON (nil: no payload)
+func NewMessage(t MessageType, payload interface{}) (Message, error) {
+	msg := Message{Type: t}
+	if payload == nil {
+		return msg, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return msg, fmt.Errorf("failed to encode %s payload: %w", t, err)
+	}
+	msg.Payload = data
+	return msg, nil
+}
+
+// Decode parses a WebSocket frame into a Message. Oversized frames, unknown
+// envelope fields and trailing data are rejected.
+func Decode(data []byte) (Message, error) {
+	var msg Message
+	if len(data) > MaxMessageSize {
+		return msg, fmt.Errorf("message of %d bytes exceeds limit of %d", len(data), MaxMessageSize)
+	}
+	if err := decodeStrict(data, &msg); err != nil {
+		return msg, fmt.Errorf("invalid message: %w", err)
+	}
+	if msg.Type == "" {
+		return msg, errors.New("invalid message: missing type")
+	}
+	if len(msg.Type) > MaxFieldLength || len(msg.ID) > MaxFieldLength {
+		return msg, errors.New("invalid message: type or ID too long")
+	}
+	return msg, nil
+}
+
+// DecodePayload strictly decodes the payload into v. A missing payload,
+// unknown fields and trailing data are errors, and payloads with a Validate
+// method are validated.
+func (m Message) DecodePayload(v interface{}) error {
+	if len(m.Payload) == 0 || string(m.Payload) == "null" {
+		return fmt.Errorf("%s: missing payload", m.Type)
+	}
+	if err := decodeStrict(m.Payload, v); err != nil {
+		return fmt.Errorf("%s: invalid payload: %w", m.Type, err)
+	}
+	if vv, ok := v.(interface{ Validate() error }); ok {
+		if err := vv.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", m.Type, err)
+		}
+	}
+	return nil
+}
+
+// decodeStrict unmarshals exactly one JSON value with no unknown fields
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// Broadcast topics a client can subscribe to via AuthPayload.Topics
+const (
+	TopicSwitch = "switch" // Profile switches
+	TopicConfig = "config" // Profile and settings changes
+)
+
+// Topics lists every broadcast topic
+var Topics = []string{TopicSwitch, TopicConfig}
+
+// TopicOf returns the topic a broadcast of type t belongs to ("" if none)
+func TopicOf(t MessageType) string {
+	switch t {
+	case TypeSwitch:
+		return TopicSwitch
+	case TypeSyncResponse:
+		return TopicConfig
+	}
+	return ""
 }
 
 // AuthPayload is the payload for TypeAuth
@@ -31,16 +203,162 @@ type AuthPayload struct {
 	Token       string `json:"token"`
 	AgentName   string `json:"agent_name"`
 	AgentVersion string `json:"agent_version"`
+
+	// Profile is the profile that shows the agent and MAC the hardware
+	// address it reaches the Host through; the Host keeps both in its agent
+	// registry for offline warnings and Wake-on-LAN
+	Profile string `json:"profile,omitempty"`
+	MAC     string `json:"mac,omitempty"`
+
+	// Topics limits which broadcasts the Host sends this client. Empty means
+	// all topics, so clients that predate subscriptions keep working.
+	Topics []string `json:"topics,omitempty"`
+}
+
+// Validate checks field lengths and that only known topics are requested
+func (p *AuthPayload) Validate() error {
+	if err := checkLength("token", p.Token); err != nil {
+		return err
+	}
+	if err := checkLength("agent_name", p.AgentName); err != nil {
+		return err
+	}
+	if err := checkLength("agent_version", p.AgentVersion); err != nil {
+		return err
+	}
+	if err := checkLength("profile", p.Profile); err != nil {
+		return err
+	}
+	if err := checkLength("mac", p.MAC); err != nil {
+		return err
+	}
+	if len(p.Topics) > len(Topics) {
+		return fmt.Errorf("too many topics (%d)", len(p.Topics))
+	}
+	for _, topic := range p.Topics {
+		if !slices.Contains(Topics, topic) {
+			return fmt.Errorf("unknown topic %q", topic)
+		}
+	}
+	return nil
 }
 
 // SwitchPayload is the payload for TypeSwitch
 type SwitchPayload struct {
 	Profile   string `json:"profile"`
-	Origin    string `json:"origin"`    // "host" or agent ID/IP
+	Origin    string `json:"origin"`    // Machine ID of the requesting agent (requests) or of the machine the switch started on (broadcasts)
 	Propagate bool   `json:"propagate"` // Whether receivers should propagate further (usually false for broadcasts)
 }
 
+// Validate checks required fields
+func (p *SwitchPayload) Validate() error {
+	if p.Profile == "" {
+		return errors.New("missing profile")
+	}
+	if err := checkLength("profile", p.Profile); err != nil {
+		return err
+	}
+	return checkLength("origin", p.Origin)
+}
+
+// checkLength rejects string fields longer than MaxFieldLength
+func checkLength(field, value string) error {
+	if len(value) > MaxFieldLength {
+		return fmt.Errorf("%s too long (%d bytes, max %d)", field, len(value), MaxFieldLength)
+	}
+	return nil
+}
+
 // SyncResponsePayload is the payload for TypeSyncResponse
 type SyncResponsePayload struct {
-	Profiles interface{} `json:"profiles"` // Using interface{} to avoid circular dependency with config package if possible, or we will move this to a shared location
+	Profiles json.RawMessage `json:"profiles"` // Encoded []config.Profile; kept raw to avoid depending on the config package
+}
+
+// ErrorPayload is the payload for TypeError
+type ErrorPayload struct {
+	Code    string `json:"code"` // Machine-readable reason, e.g. "bad_request", "unsupported"
+	Message string `json:"message"`
+}
+
+// Error codes used in ErrorPayload
+const (
+	ErrCodeBadRequest  = "bad_request"
+	ErrCodeUnsupported = "unsupported"
+	ErrCodeInternal    = "internal"
+)
+
+// NewError builds a TypeError reply to the request with the given ID
+func NewError(id, code, message string) Message {
+	msg, _ := NewMessage(TypeError, ErrorPayload{Code: code, Message: message}) // plain strings always encode
+	msg.ID = id
+	return msg
+}
+
+// SwitchResultPayload is the payload for TypeSwitchResult. Queued reports a
+// switch that waits for the Host's switch cooldown; it is not a success yet.
+type SwitchResultPayload struct {
+	Profile string `json:"profile"`
+	Success bool   `json:"success"`
+	Queued  bool   `json:"queued,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// FileChunkSize is the largest file part in one TypeFileChunk; base64 and the
+// envelope keep the message below MaxMessageSize
+const FileChunkSize = 32 * 1024
+
+// MaxFileSize is the largest file that can be transferred
+const MaxFileSize = 100 * 1024 * 1024
+
+// FileOfferPayload is the payload for TypeFileOffer
+type FileOfferPayload struct {
+	TransferID string `json:"transfer_id"`
+	Name       string `json:"name"`   // Base name, no directories
+	Size       int64  `json:"size"`   // Total size in bytes
+	SHA256     string `json:"sha256"` // Hex digest of the whole file
+}
+
+// Validate checks the offer's fields
+func (p *FileOfferPayload) Validate() error {
+	if p.TransferID == "" || p.Name == "" {
+		return errors.New("missing transfer ID or file name")
+	}
+	if p.Size < 0 || p.Size > MaxFileSize {
+		return fmt.Errorf("file size %d outside 0..%d", p.Size, MaxFileSize)
+	}
+	if len(p.SHA256) != 64 {
+		return errors.New("invalid sha256")
+	}
+	if err := checkLength("transfer_id", p.TransferID); err != nil {
+		return err
+	}
+	return checkLength("name", p.Name)
+}
+
+// FileChunkPayload is the payload for TypeFileChunk. Chunks are sent in
+// order, each after the previous one was acknowledged.
+type FileChunkPayload struct {
+	TransferID string `json:"transfer_id"`
+	Offset     int64  `json:"offset"`
+	Data       []byte `json:"data"` // base64 in JSON
+}
+
+// Validate checks the chunk's fields
+func (p *FileChunkPayload) Validate() error {
+	if p.TransferID == "" {
+		return errors.New("missing transfer ID")
+	}
+	if p.Offset < 0 || len(p.Data) > FileChunkSize {
+		return errors.New("invalid chunk offset or size")
+	}
+	return checkLength("transfer_id", p.TransferID)
+}
+
+// FileAckPayload is the payload for TypeFileAck
+type FileAckPayload struct {
+	TransferID string `json:"transfer_id"`
+	Received   int64  `json:"received"`        // Bytes stored so far
+	Done       bool   `json:"done,omitempty"`  // The whole file was received and verified
+	Error      string `json:"error,omitempty"` // The offer was declined or the transfer failed
+	Path       string `json:"path,omitempty"`  // Where the receiver saved the file (when done)
 }
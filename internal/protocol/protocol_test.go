@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// seedMessages are valid frames of every payload type the Host and agents
+// exchange
+func seedMessages(t interface{ Fatal(...any) }) [][]byte {
+	build := func(typ MessageType, id string, payload interface{}) []byte {
+		msg, err := NewMessage(typ, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.ID = id
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	return [][]byte{
+		build(TypeAuth, "", AuthPayload{Token: "secret", AgentName: "laptop", AgentVersion: "0.2.0", Profile: "Mac", MAC: "aa:bb:cc:dd:ee:ff", Topics: []string{TopicSwitch}}),
+		build(TypeSwitch, "agent-1", SwitchPayload{Profile: "PC1", Origin: "laptop", Propagate: true}),
+		build(TypeSwitchResult, "agent-1", SwitchResultPayload{Profile: "PC1", Success: true}),
+		build(TypeSyncRequest, "agent-2", nil),
+		build(TypeSyncResponse, "agent-2", SyncResponsePayload{Profiles: json.RawMessage(`[{"name":"PC1"}]`)}),
+		build(TypePing, "", nil),
+		build(TypeFileOffer, "host-1", FileOfferPayload{TransferID: "t1", Name: "notes.txt", Size: 5, SHA256: strings.Repeat("0", 64)}),
+		build(TypeFileChunk, "host-2", FileChunkPayload{TransferID: "t1", Offset: 0, Data: []byte("hello")}),
+		build(TypeFileAck, "host-2", FileAckPayload{TransferID: "t1", Received: 5, Done: true}),
+		build(TypeError, "agent-3", ErrorPayload{Code: ErrCodeBadRequest, Message: "bad"}),
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, seed := range seedMessages(f) {
+		f.Add(seed)
+	}
+	f.Add([]byte(`{"type":"switch","payload":{"profile":"PC1"}} trailing`))
+	f.Add([]byte(`{"type":"","unknown":1}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := Decode(data)
+		if err != nil {
+			return
+		}
+		if len(data) > MaxMessageSize {
+			t.Fatalf("accepted a %d byte frame", len(data))
+		}
+		if msg.Type == "" || len(msg.Type) > MaxFieldLength || len(msg.ID) > MaxFieldLength {
+			t.Fatalf("accepted type %q, ID %q", msg.Type, msg.ID)
+		}
+	})
+}
+
+func FuzzDecodePayload(f *testing.F) {
+	for _, seed := range seedMessages(f) {
+		msg, err := Decode(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(msg.Type), []byte(msg.Payload))
+	}
+
+	f.Fuzz(func(t *testing.T, typ string, payload []byte) {
+		msg := Message{Type: MessageType(typ), Payload: payload}
+
+		var auth AuthPayload
+		if msg.DecodePayload(&auth) == nil {
+			for _, s := range []string{auth.Token, auth.AgentName, auth.AgentVersion, auth.Profile, auth.MAC} {
+				if len(s) > MaxFieldLength {
+					t.Fatalf("auth field of %d bytes accepted", len(s))
+				}
+			}
+			for _, topic := range auth.Topics {
+				if !slices.Contains(Topics, topic) {
+					t.Fatalf("unknown topic %q accepted", topic)
+				}
+			}
+		}
+
+		var sw SwitchPayload
+		if msg.DecodePayload(&sw) == nil {
+			if sw.Profile == "" || len(sw.Profile) > MaxFieldLength || len(sw.Origin) > MaxFieldLength {
+				t.Fatalf("switch payload %+v accepted", sw)
+			}
+		}
+
+		var offer FileOfferPayload
+		if msg.DecodePayload(&offer) == nil {
+			if offer.TransferID == "" || offer.Name == "" || offer.Size < 0 || offer.Size > MaxFileSize ||
+				len(offer.SHA256) != 64 || len(offer.TransferID) > MaxFieldLength || len(offer.Name) > MaxFieldLength {
+				t.Fatalf("file offer %+v accepted", offer)
+			}
+		}
+
+		var chunk FileChunkPayload
+		if msg.DecodePayload(&chunk) == nil {
+			if chunk.TransferID == "" || chunk.Offset < 0 || len(chunk.Data) > FileChunkSize || len(chunk.TransferID) > MaxFieldLength {
+				t.Fatalf("file chunk (%q, offset %d, %d bytes) accepted", chunk.TransferID, chunk.Offset, len(chunk.Data))
+			}
+		}
+
+		// Payloads without Validate must still decode without panicking
+		var result SwitchResultPayload
+		msg.DecodePayload(&result)
+		var sync SyncResponsePayload
+		msg.DecodePayload(&sync)
+		var ack FileAckPayload
+		msg.DecodePayload(&ack)
+		var perr ErrorPayload
+		msg.DecodePayload(&perr)
+	})
+}
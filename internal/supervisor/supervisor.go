@@ -0,0 +1,129 @@
+// Package supervisor runs long-lived goroutines so that a panic is logged
+// and, if the policy asks for it, the goroutine is restarted instead of
+// taking the whole process down.
+package supervisor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// Policy decides what happens after a supervised goroutine panics.
+// A goroutine that returns normally is never restarted.
+type Policy struct {
+	Restart     bool          // Restart the goroutine after a panic
+	Backoff     time.Duration // Delay before the first restart, doubled after each panic
+	MaxBackoff  time.Duration // Upper bound for the restart delay
+	MaxRestarts int           // Give up after this many restarts (0: unlimited)
+}
+
+var (
+	// Once recovers and logs a panic but does not restart
+	Once = Policy{}
+
+	// Always restarts after every panic with a backoff of 1s up to 1 minute
+	Always = Policy{Restart: true, Backoff: time.Second, MaxBackoff: time.Minute}
+)
+
+// Status describes the supervised goroutines sharing a name
+type Status struct {
+	Name      string     `json:"name"`
+	Running   int        `json:"running"`
+	Panics    int        `json:"panics"`
+	Restarts  int        `json:"restarts"`
+	LastPanic string     `json:"last_panic,omitempty"`
+	LastAt    *time.Time `json:"last_panic_at,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	statuses = make(map[string]*Status)
+)
+
+// Go runs fn in a new goroutine under the given policy. Goroutines started
+// with the same name share one Status entry.
+func Go(name string, policy Policy, fn func()) {
+	st := status(name)
+	mu.Lock()
+	st.Running++
+	mu.Unlock()
+
+	go func() {
+		defer func() {
+			mu.Lock()
+			st.Running--
+			mu.Unlock()
+		}()
+
+		backoff := policy.Backoff
+		for restarts := 0; ; restarts++ {
+			if !runOnce(name, st, fn) {
+				return // returned normally
+			}
+			if !policy.Restart || (policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts) {
+				logging.Errorf("Supervisor: %s stopped after panic", name)
+				return
+			}
+
+			logging.Warnf("Supervisor: Restarting %s in %v", name, backoff)
+			time.Sleep(backoff)
+			mu.Lock()
+			st.Restarts++
+			mu.Unlock()
+
+			backoff *= 2
+			if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+		}
+	}()
+}
+
+// runOnce calls fn and reports whether it panicked
+func runOnce(name string, st *Status, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			logging.Errorf("Supervisor: %s panicked: %v\n%s", name, r, debug.Stack())
+
+			now := time.Now()
+			mu.Lock()
+			st.Panics++
+			st.LastPanic = fmt.Sprint(r)
+			st.LastAt = &now
+			mu.Unlock()
+		}
+	}()
+	fn()
+	return false
+}
+
+// Statuses returns a snapshot of every supervised goroutine, sorted by name
+func Statuses() []Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := make([]Status, 0, len(statuses))
+	for _, st := range statuses {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func status(name string) *Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	st, ok := statuses[name]
+	if !ok {
+		st = &Status{Name: name}
+		statuses[name] = st
+	}
+	return st
+}
@@ -0,0 +1,163 @@
+package switcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/network"
+	"vkvm/internal/supervisor"
+)
+
+// agentLinkSettings are the general settings (json names) the WebSocket
+// client is built from
+var agentLinkSettings = []string{"role", "coordinator_addr", "api_token", "agent_profile", "coordinator_tls", "coordinator_cert_sha256", "agent_token"}
+
+// client returns the WebSocket client to the Host, or nil if this machine is
+// not an agent
+func (s *Switcher) client() *network.WSClient {
+	s.wsMu.Lock()
+	defer s.wsMu.Unlock()
+	return s.wsClient
+}
+
+// followsHost reports whether this machine is an agent, whose profile is set
+// by its Host rather than by its own schedules and monitor sets
+func (s *Switcher) followsHost() bool {
+	return s.configMgr.Get().General.Role == "agent"
+}
+
+// SendFileToHost sends data to the Host as a file named name and returns
+// where the Host saved it
+func (s *Switcher) SendFileToHost(name string, data []byte) (string, error) {
+	c := s.client()
+	if c == nil {
+		return "", fmt.Errorf("not connected to a Host")
+	}
+	return c.SendFile(name, data)
+}
+
+// hostEndpoint returns how to reach the Host's API
+func (s *Switcher) hostEndpoint() (network.HostEndpoint, error) {
+	cfg := s.configMgr.Get()
+	if cfg.General.Role != "agent" || cfg.General.CoordinatorAddr == "" {
+		return network.HostEndpoint{}, fmt.Errorf("this machine is not an agent of a Host")
+	}
+	return network.HostEndpoint{
+		Addr:       s.coordinatorAddr(0),
+		TLS:        cfg.General.CoordinatorTLS,
+		CertSHA256: cfg.General.CoordinatorCertSHA256,
+	}, nil
+}
+
+// RequestPairing asks the Host to pair with this agent and returns the
+// pairing ID; the Host shows the PIN to pass to CompletePairing
+func (s *Switcher) RequestPairing() (string, error) {
+	host, err := s.hostEndpoint()
+	if err != nil {
+		return "", err
+	}
+	logging.Infof("Switcher: Requesting pairing with Host %s", host.Addr)
+	return host.RequestPairing()
+}
+
+// CompletePairing submits the PIN for pairing id and saves the token the Host
+// issued, which then replaces the API token on the link to the Host
+func (s *Switcher) CompletePairing(id, pin string) error {
+	host, err := s.hostEndpoint()
+	if err != nil {
+		return err
+	}
+	token, err := host.CompletePairing(id, pin)
+	if err != nil {
+		return err
+	}
+
+	cfg := s.configMgr.Get()
+	cfg.General.AgentToken = token
+	s.configMgr.Set(cfg)
+	if err := s.configMgr.Save(); err != nil {
+		return fmt.Errorf("paired, but saving the token failed: %w", err)
+	}
+	logging.Infof("Switcher: Paired with Host %s", host.Addr)
+	return nil
+}
+
+// startAgentLink connects to the Host if cfg makes this machine an agent
+func (s *Switcher) startAgentLink(cfg *config.Config) {
+	if cfg.General.Role != "agent" || cfg.General.CoordinatorAddr == "" {
+		return
+	}
+
+	logging.Infof("Switcher: Initializing WebSocket client to Host %s", cfg.General.CoordinatorAddr)
+	token := cfg.General.APIToken
+	if cfg.General.AgentToken != "" {
+		token = cfg.General.AgentToken
+	}
+	c := network.NewWSClient(cfg.General.CoordinatorAddr, token)
+	c.Resolve = s.coordinatorAddr
+	c.OnConnect = s.rememberHostID
+	c.Profile = cfg.General.AgentProfile
+	c.Files = network.NewFileReceiver(s.configMgr)
+	c.TLS = cfg.General.CoordinatorTLS
+	c.CertSHA256 = cfg.General.CoordinatorCertSHA256
+
+	// Wire up callbacks
+	c.OnSwitch = func(profile, origin string) {
+		logging.Infof("Switcher: Received remote switch command for '%s'", profile)
+		if err := s.switchRemote(profile, origin); err != nil && !errors.Is(err, ErrQueued) {
+			logging.Errorf("Switcher: Remote switch execution failed: %v", err)
+		}
+	}
+
+	c.OnSync = func(profiles json.RawMessage) {
+		if err := s.configMgr.UpdateProfilesFromRemote(profiles); err != nil {
+			logging.Errorf("Switcher: Config sync failed: %v", err)
+		} else {
+			logging.Infof("Switcher: Config synced from Host")
+		}
+	}
+
+	s.wsMu.Lock()
+	s.wsClient = c
+	s.wsMu.Unlock()
+
+	// Start client
+	c.Start()
+
+	// Reconnect (and re-authenticate) as soon as our addresses change
+	s.netWatchOnce.Do(func() {
+		supervisor.Go("net-watch", supervisor.Always, func() {
+			network.WatchNetwork(func() {
+				if c := s.client(); c != nil {
+					c.Reconnect()
+				}
+			})
+		})
+	})
+}
+
+// applyConfigChange rebuilds the WebSocket client when the Host address,
+// token or role changed, so the agent talks to the right Host without a
+// restart
+func (s *Switcher) applyConfigChange(change config.Change) {
+	if !slices.ContainsFunc(change.General, func(name string) bool {
+		return slices.Contains(agentLinkSettings, name)
+	}) {
+		return
+	}
+
+	s.wsMu.Lock()
+	old := s.wsClient
+	s.wsClient = nil
+	s.wsMu.Unlock()
+	if old != nil {
+		logging.Infof("Switcher: Host connection settings changed, closing the connection")
+		old.Close()
+	}
+
+	s.startAgentLink(s.configMgr.Get())
+}
@@ -0,0 +1,145 @@
+package switcher
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/network"
+)
+
+// agentPingTimeout bounds the reachability check of one agent before a switch
+const agentPingTimeout = time.Second
+
+// ErrAgentUnreachable is matched by AgentUnreachableError
+var ErrAgentUnreachable = errors.New("agent unreachable")
+
+// AgentUnreachableError is returned by SwitchToProfile when
+// check_agents_before_switch is set and an agent showing the profile does not
+// answer. SwitchVideoOnly performs the switch anyway.
+type AgentUnreachableError struct {
+	Profile string
+	Agents  []string
+}
+
+func (e *AgentUnreachableError) Error() string {
+	return fmt.Sprintf("agent %s for profile '%s' is unreachable", strings.Join(e.Agents, ", "), e.Profile)
+}
+
+func (e *AgentUnreachableError) Unwrap() error {
+	return ErrAgentUnreachable
+}
+
+// WakeAgent sends a Wake-on-LAN packet to a known agent (see
+// config.KnownAgent). The agent must have reported its MAC address while it
+// was connected.
+func (s *Switcher) WakeAgent(name string) error {
+	agent, err := s.configMgr.FindKnownAgent(name)
+	if err != nil {
+		return err
+	}
+	if agent.MAC == "" {
+		return fmt.Errorf("the MAC address of agent '%s' is not known", agent.Name)
+	}
+	if err := network.WakeOnLAN(agent.MAC); err != nil {
+		return err
+	}
+	logging.Infof("Switcher: Sent Wake-on-LAN packet to agent '%s' (%s)", agent.Name, agent.MAC)
+	return nil
+}
+
+// warnOfflineAgents reports the agents that show profileName but are not
+// connected, before a switch to it leaves the user looking at a dark screen.
+// The switch still goes ahead: the agent may be on its way up.
+func (s *Switcher) warnOfflineAgents(profileName string) {
+	offline := s.configMgr.OfflineAgents(profileName)
+	if len(offline) == 0 {
+		return
+	}
+
+	names := make([]string, len(offline))
+	for i, a := range offline {
+		names[i] = a.Name
+		logging.Warnf("Switcher: Agent '%s' for profile '%s' is offline (last seen %s)",
+			a.Name, profileName, lastSeen(a))
+	}
+
+	s.mu.Lock()
+	onError := s.onError
+	s.mu.Unlock()
+	if onError != nil {
+		onError(fmt.Errorf("agent %s for profile '%s' is not connected", strings.Join(names, ", "), profileName))
+	}
+}
+
+// lastSeen formats when an agent was last connected for logs
+func lastSeen(a config.KnownAgent) string {
+	if a.LastSeen == nil {
+		return "never"
+	}
+	return a.LastSeen.Format("2006-01-02 15:04")
+}
+
+// unreachableAgents returns the known agents showing profileName that are
+// neither connected to this Host nor answering on their API. Agents that
+// never connected are not checked.
+func (s *Switcher) unreachableAgents(profileName string) []string {
+	var (
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		unreachable []string
+	)
+	for _, a := range s.configMgr.KnownAgents() {
+		if a.Profile != profileName || a.Online {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.pingAgent(a) {
+				return
+			}
+			logging.Warnf("Switcher: Agent '%s' for profile '%s' is unreachable (last seen %s)", a.Name, profileName, lastSeen(a))
+			mu.Lock()
+			unreachable = append(unreachable, a.Name)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return unreachable
+}
+
+// pingAgent reports whether a's API answers /health. The registered machine
+// with a's ID supplies the API address; otherwise the agent is assumed to
+// listen on our own API port.
+func (s *Switcher) pingAgent(a config.KnownAgent) bool {
+	cfg := s.configMgr.Get()
+	addr, pin := "", ""
+	if a.Address != "" {
+		addr = net.JoinHostPort(a.Address, strconv.Itoa(cfg.General.APIPort))
+	}
+	for _, mc := range cfg.Machines {
+		if mc.ID != "" && strings.EqualFold(mc.ID, a.Name) {
+			addr, pin = mc.Address, mc.CertSHA256
+			break
+		}
+	}
+	if addr == "" {
+		return false
+	}
+
+	client, scheme := network.PeerClient(cfg.General.PeerTLS(), pin, agentPingTimeout)
+	resp, err := client.Get(scheme + "://" + addr + "/health")
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
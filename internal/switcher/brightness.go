@@ -0,0 +1,104 @@
+package switcher
+
+import (
+	"fmt"
+	"sync"
+
+	"vkvm/internal/ddc"
+	"vkvm/internal/logging"
+)
+
+// DefaultBrightnessStep is the brightness change per hotkey press (percent)
+const DefaultBrightnessStep = 10
+
+// MonitorBrightness is one monitor's brightness after a read or change
+type MonitorBrightness struct {
+	MonitorID  string `json:"monitor_id"`
+	Brightness int    `json:"brightness"`
+	Error      string `json:"error,omitempty"`
+}
+
+// GetBrightness reads the brightness of every DDC-capable monitor
+func (s *Switcher) GetBrightness() ([]MonitorBrightness, error) {
+	return s.forEachBrightness(func(vc ddc.VCPController, id string) (int, error) {
+		return vc.GetVCP(id, ddc.VCPBrightness)
+	})
+}
+
+// SetBrightness sets every DDC-capable monitor to the same brightness (0-100)
+func (s *Switcher) SetBrightness(value int) ([]MonitorBrightness, error) {
+	value = clampBrightness(value)
+	logging.Infof("Switcher: Setting brightness of all monitors to %d", value)
+	return s.forEachBrightness(func(vc ddc.VCPController, id string) (int, error) {
+		return value, vc.SetVCP(id, ddc.VCPBrightness, value)
+	})
+}
+
+// AdjustBrightness changes the brightness of every DDC-capable monitor by
+// delta, keeping each monitor's own level relative to the others
+func (s *Switcher) AdjustBrightness(delta int) ([]MonitorBrightness, error) {
+	logging.Infof("Switcher: Adjusting brightness of all monitors by %+d", delta)
+	return s.forEachBrightness(func(vc ddc.VCPController, id string) (int, error) {
+		current, err := vc.GetVCP(id, ddc.VCPBrightness)
+		if err != nil {
+			return 0, err
+		}
+		value := clampBrightness(current + delta)
+		if value == current {
+			return value, nil
+		}
+		return value, vc.SetVCP(id, ddc.VCPBrightness, value)
+	})
+}
+
+// forEachBrightness runs op on all DDC-capable monitors in parallel. The
+// returned error is set only if every monitor failed.
+func (s *Switcher) forEachBrightness(op func(vc ddc.VCPController, id string) (int, error)) ([]MonitorBrightness, error) {
+	vc, err := ddc.AsVCP(s.controller)
+	if err != nil {
+		return nil, err
+	}
+
+	monitors, err := s.controller.ListMonitors()
+	if err != nil && len(monitors) == 0 {
+		return nil, err
+	}
+
+	var results []MonitorBrightness
+	for _, m := range monitors {
+		if m.DDCSupported {
+			results = append(results, MonitorBrightness{MonitorID: m.ID})
+		}
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no DDC-capable monitors found")
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(r *MonitorBrightness) {
+			defer wg.Done()
+			value, err := op(vc, r.MonitorID)
+			if err != nil {
+				logging.Errorf("Switcher: Brightness on monitor %s failed: %v", r.MonitorID, err)
+				r.Error = err.Error()
+				return
+			}
+			r.Brightness = value
+		}(&results[i])
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.Error == "" {
+			return results, nil
+		}
+	}
+	return results, fmt.Errorf("brightness failed on all monitors")
+}
+
+// clampBrightness limits a brightness value to 0-100
+func clampBrightness(v int) int {
+	return max(0, min(100, v))
+}
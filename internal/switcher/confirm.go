@@ -0,0 +1,192 @@
+package switcher
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"vkvm/internal/ddc"
+	"vkvm/internal/logging"
+	"vkvm/internal/supervisor"
+)
+
+// confirmDelay gives monitors time to lock onto the new input before it is read back
+const confirmDelay = 2 * time.Second
+
+// Confirmation states
+const (
+	ConfirmPending     = "pending"
+	ConfirmConfirmed   = "confirmed"
+	ConfirmUnconfirmed = "unconfirmed"
+)
+
+// MonitorConfirmation is the read-back result for one monitor
+type MonitorConfirmation struct {
+	MonitorID string `json:"monitor_id"`
+	Requested int    `json:"requested"`
+	Actual    int    `json:"actual"`
+	Confirmed bool   `json:"confirmed"`
+	Retried   bool   `json:"retried,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SwitchConfirmation reports whether a switch took effect on every monitor it targeted
+type SwitchConfirmation struct {
+	Profile   string                `json:"profile"`
+	Status    string                `json:"status"`
+	Monitors  []MonitorConfirmation `json:"monitors,omitempty"`
+	CheckedAt *time.Time            `json:"checked_at,omitempty"`
+
+	done chan struct{} // closed once Status is no longer pending
+}
+
+// startConfirmation reads back the inputs of targets, written by switch gen,
+// in the background. A later switch supersedes an unfinished confirmation.
+func (s *Switcher) startConfirmation(gen uint64, profileName string, targets map[string]ddc.InputSource) {
+	c := &SwitchConfirmation{Profile: profileName, Status: ConfirmPending, done: make(chan struct{})}
+
+	s.confirmMu.Lock()
+	s.confirm = c
+	s.confirmMu.Unlock()
+
+	supervisor.Go("switch-confirm", supervisor.Once, func() {
+		results := s.readBack(targets, confirmDelay)
+
+		// Retry once on mismatch, unless another switch has started meanwhile
+		retry := make(map[string]ddc.InputSource)
+		for _, r := range results {
+			if !r.Confirmed && s.retryInput(gen, r, targets[r.MonitorID]) {
+				retry[r.MonitorID] = targets[r.MonitorID]
+			}
+		}
+		if len(retry) > 0 {
+			retried := s.readBack(retry, confirmDelay)
+			for i, r := range results {
+				for _, rr := range retried {
+					if rr.MonitorID == r.MonitorID {
+						rr.Retried = true
+						results[i] = rr
+					}
+				}
+			}
+		}
+
+		s.finishConfirmation(c, results)
+	})
+}
+
+// retryInput writes a monitor's input once more, unless a switch newer than
+// gen has started. It holds mu, so a newer switch waits for the write instead
+// of being undone by it. It reports whether the write was sent.
+func (s *Switcher) retryInput(gen uint64, r MonitorConfirmation, input ddc.InputSource) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.superseded(gen) {
+		return false
+	}
+
+	logging.Warnf("Switcher: Monitor %s reports input %d instead of %d, retrying", r.MonitorID, r.Actual, r.Requested)
+	if err := s.controller.SetInputSource(r.MonitorID, input); err != nil {
+		logging.Errorf("Switcher: Retry on monitor %s failed: %v", r.MonitorID, err)
+	}
+	return true
+}
+
+// readBack waits for delay and then reads the current input of each target in parallel
+func (s *Switcher) readBack(targets map[string]ddc.InputSource, delay time.Duration) []MonitorConfirmation {
+	time.Sleep(delay)
+
+	results := make([]MonitorConfirmation, 0, len(targets))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for id, requested := range targets {
+		wg.Add(1)
+		go func(id string, requested ddc.InputSource) {
+			defer wg.Done()
+			r := MonitorConfirmation{MonitorID: id, Requested: int(requested)}
+			actual, err := s.controller.GetCurrentInput(id)
+			if err != nil {
+				r.Error = err.Error()
+			} else {
+				r.Actual = int(s.remapInput(id, actual))
+				r.Confirmed = r.Actual == r.Requested
+			}
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		}(id, requested)
+	}
+	wg.Wait()
+	return results
+}
+
+// finishConfirmation records the outcome and wakes AwaitConfirmation callers
+func (s *Switcher) finishConfirmation(c *SwitchConfirmation, results []MonitorConfirmation) {
+	now := time.Now()
+	status := ConfirmConfirmed
+	var failed []string
+	for _, r := range results {
+		if !r.Confirmed {
+			status = ConfirmUnconfirmed
+			failed = append(failed, r.MonitorID)
+		}
+	}
+
+	s.confirmMu.Lock()
+	c.Monitors = results
+	c.Status = status
+	c.CheckedAt = &now
+	close(c.done)
+	s.confirmMu.Unlock()
+
+	if status == ConfirmConfirmed {
+		logging.Infof("Switcher: Switch to '%s' confirmed on %d monitor(s)", c.Profile, len(results))
+		return
+	}
+	logging.Warnf("Switcher: Switch to '%s' not confirmed on %v", c.Profile, failed)
+
+	s.mu.Lock()
+	onError := s.onError
+	s.mu.Unlock()
+	if onError != nil {
+		onError(fmt.Errorf("switch to '%s' not confirmed on monitor(s) %v", c.Profile, failed))
+	}
+}
+
+// LastConfirmation returns the read-back result of the most recent switch,
+// or nil if no switch has been confirmed yet (see GeneralConfig.ConfirmSwitch)
+func (s *Switcher) LastConfirmation() *SwitchConfirmation {
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+	return snapshot(s.confirm)
+}
+
+// AwaitConfirmation waits up to timeout for the most recent switch to be
+// confirmed and returns the result, still pending if the timeout expired
+func (s *Switcher) AwaitConfirmation(timeout time.Duration) *SwitchConfirmation {
+	s.confirmMu.Lock()
+	c := s.confirm
+	s.confirmMu.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	select {
+	case <-c.done:
+	case <-time.After(timeout):
+	}
+
+	s.confirmMu.Lock()
+	defer s.confirmMu.Unlock()
+	return snapshot(c)
+}
+
+// snapshot copies c; callers must hold confirmMu
+func snapshot(c *SwitchConfirmation) *SwitchConfirmation {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	cp.Monitors = append([]MonitorConfirmation(nil), c.Monitors...)
+	return &cp
+}
@@ -0,0 +1,75 @@
+package switcher
+
+import (
+	"errors"
+	"time"
+
+	"vkvm/internal/logging"
+	"vkvm/internal/supervisor"
+)
+
+// ErrQueued is returned by a switch that waits for the switch cooldown to
+// end. It is not a failure: the switch runs later, unless a newer one
+// replaces it.
+var ErrQueued = errors.New("switch queued until the switch cooldown ends")
+
+// cooldown runs switch now, or, within GeneralConfig.SwitchCooldownMs of the
+// previous switch, queues it to run when the cooldown ends. Queued requests
+// are coalesced: a newer one replaces the one waiting, so mashing a hotkey
+// results in a single switch to the last profile chosen. switchFn is told
+// whether it runs queued.
+func (s *Switcher) cooldown(profileName string, switchFn func(queued bool) error) error {
+	period := time.Duration(s.configMgr.Get().General.SwitchCooldownMs) * time.Millisecond
+	if period <= 0 {
+		return switchFn(false)
+	}
+
+	s.cooldownMu.Lock()
+	wait := time.Until(s.lastSwitchAt.Add(period))
+	if wait <= 0 && s.queued == nil {
+		s.lastSwitchAt = time.Now()
+		s.cooldownMu.Unlock()
+		return switchFn(false)
+	}
+
+	if s.queued == nil {
+		time.AfterFunc(max(wait, 0), func() {
+			supervisor.Go("switch-queued", supervisor.Once, s.runQueued)
+		})
+	} else {
+		logging.Infof("Switcher: Switch to '%s' replaces queued switch to '%s'", profileName, s.queuedName)
+	}
+	s.queued = switchFn
+	s.queuedName = profileName
+	s.cooldownMu.Unlock()
+
+	logging.Infof("Switcher: Switch to '%s' queued, cooling down for %v", profileName, wait.Round(time.Millisecond))
+	return ErrQueued
+}
+
+// runQueued performs the switch that waited for the cooldown
+func (s *Switcher) runQueued() {
+	s.cooldownMu.Lock()
+	switchFn, name := s.queued, s.queuedName
+	s.queued = nil
+	s.lastSwitchAt = time.Now()
+	s.cooldownMu.Unlock()
+
+	logging.Infof("Switcher: Running queued switch to '%s'", name)
+	err := switchFn(true)
+	switch {
+	case err == nil, errors.Is(err, ErrSuperseded):
+		// A newer switch taking over is logged where it happens
+		return
+	case errors.Is(err, ErrAgentUnreachable):
+		logging.Infof("Switcher: Queued switch to '%s' held: %v", name, err)
+	default:
+		logging.Errorf("Switcher: Queued switch to '%s' failed: %v", name, err)
+	}
+	s.mu.Lock()
+	onError := s.onError
+	s.mu.Unlock()
+	if onError != nil {
+		onError(err)
+	}
+}
@@ -0,0 +1,129 @@
+package switcher
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+
+	"vkvm/internal/config"
+	"vkvm/internal/logging"
+	"vkvm/internal/network"
+)
+
+// rediscoverEvery is how many failed connection attempts in a row trigger a
+// LAN scan for a Host that may have moved to a new address
+const rediscoverEvery = 3
+
+// coordinatorAddr resolves CoordinatorAddr to host:port. The setting may be
+// an address, a registered machine name or the Host's hostname (machine ID).
+// After repeated failures the LAN is scanned so a Host that got a new DHCP
+// lease is found again.
+func (s *Switcher) coordinatorAddr(failures int) string {
+	coord := s.configMgr.Get().General.CoordinatorAddr
+	if failures > 0 && failures%rediscoverEvery == 0 {
+		s.rediscoverHost(coord)
+	}
+
+	if mc := s.configMgr.FindMachine(coord); mc != nil {
+		if failures == 0 {
+			logging.Infof("Switcher: Host '%s' resolved to %s", mc.Name, mc.Address)
+		}
+		return mc.Address
+	}
+	return coord
+}
+
+// rediscoverHost scans the LAN for the Host named by coord and updates the
+// machine registry with its current address
+func (s *Switcher) rediscoverHost(coord string) {
+	id := coord
+	general := s.configMgr.Get().General
+	port := general.APIPort
+	mc := s.configMgr.FindMachine(coord)
+	if mc != nil {
+		id = mc.ID
+		if _, p, err := net.SplitHostPort(mc.Address); err == nil {
+			port, _ = strconv.Atoi(p)
+		}
+	}
+	if id == "" || (mc == nil && isAddress(coord)) {
+		return // a bare address (or a machine whose ID is unknown) can't be looked up
+	}
+
+	if s.PowerSaving() {
+		logging.Warnf("Switcher: Host %s unreachable, not scanning the LAN to save battery", coord)
+		return
+	}
+
+	logging.Warnf("Switcher: Host %s unreachable, scanning LAN port %d for machine '%s'", coord, port, id)
+	// Stop scanning as soon as the Host answers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hosts, err := network.ScanLANContext(ctx, port, general.PeerTLS(), func(h network.DiscoveredHost) {
+		if h.ID == id {
+			cancel()
+		}
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logging.Errorf("Switcher: LAN scan failed: %v", err)
+		return
+	}
+	network.ApplyMachines(hosts, s.configMgr)
+
+	// CoordinatorAddr held the registered machine's old address: refer to the
+	// machine by name from now on so future moves are followed too
+	if mc != nil && mc.Address == coord {
+		if moved := s.configMgr.FindMachine(mc.Name); moved != nil && moved.Address != coord {
+			logging.Infof("Switcher: Host '%s' moved to %s, now referring to it by name", mc.Name, moved.Address)
+			s.configMgr.Update(func(cfg *config.Config) {
+				cfg.General.CoordinatorAddr = mc.Name
+			})
+			if err := s.configMgr.Save(); err != nil {
+				logging.Errorf("Switcher: Failed to save coordinator address: %v", err)
+			}
+		}
+		return
+	}
+
+	// A Host referenced by hostname only gets registered under that name
+	if mc == nil {
+		for _, h := range hosts {
+			if h.ID == id {
+				logging.Infof("Switcher: Found Host '%s' at %s", id, h.Addr())
+				s.configMgr.SetMachine(config.Machine{Name: coord, ID: id, Address: h.Addr(), Role: h.Role})
+				if err := s.configMgr.Save(); err != nil {
+					logging.Errorf("Switcher: Failed to save machine registry: %v", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// rememberHostID records the machine ID the Host announced on connect, which
+// later lets discovery follow it to a new address. A Host configured by bare
+// address is registered under its hostname.
+func (s *Switcher) rememberHostID(addr, hostID string) {
+	if hostID == "" {
+		return
+	}
+	mc := s.configMgr.FindMachine(addr)
+	if mc == nil {
+		logging.Infof("Switcher: Registering Host %s as machine '%s'", addr, hostID)
+		mc = &config.Machine{Name: hostID, Address: addr, Role: "host"}
+	} else if mc.ID == hostID {
+		return
+	}
+	mc.ID = hostID
+	s.configMgr.SetMachine(*mc)
+	if err := s.configMgr.Save(); err != nil {
+		logging.Errorf("Switcher: Failed to save machine registry: %v", err)
+	}
+}
+
+// isAddress reports whether s looks like host:port rather than a name
+func isAddress(s string) bool {
+	host, _, err := net.SplitHostPort(s)
+	return err == nil && net.ParseIP(host) != nil
+}
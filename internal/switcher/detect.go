@@ -0,0 +1,45 @@
+package switcher
+
+// DetectProfile returns the profile whose inputs match what the monitors
+// currently show, or "" if none does. Readings go through the controller's
+// input cache, so calling this often does not flood the DDC bus. When several
+// profiles match, the one covering the most monitors wins, and the current
+// profile wins ties.
+func (s *Switcher) DetectProfile() (string, error) {
+	monitors, err := s.ListMonitors()
+	if err != nil && len(monitors) == 0 {
+		return "", err
+	}
+
+	inputs := make(map[string]int, len(monitors))
+	for _, m := range monitors {
+		if m.DDCSupported && m.InputSource != 0 {
+			inputs[m.ID] = int(m.InputSource)
+		}
+	}
+
+	current := s.GetCurrentProfile()
+	best, bestCount := "", 0
+	for _, p := range s.configMgr.Get().Profiles {
+		count := 0
+		matches := true
+		for id, want := range p.MonitorInputs {
+			got, ok := inputs[id]
+			if !ok {
+				continue // not attached or unreadable here
+			}
+			if got != want {
+				matches = false
+				break
+			}
+			count++
+		}
+		if !matches || count == 0 {
+			continue
+		}
+		if count > bestCount || (count == bestCount && p.Name == current) {
+			best, bestCount = p.Name, count
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,103 @@
+package switcher
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/ddc"
+	"vkvm/internal/logging"
+)
+
+// scheduleCheckInterval is how often profile schedules are evaluated
+const scheduleCheckInterval = 20 * time.Second
+
+// applyDisplaySettings writes a profile's picture settings to every
+// DDC-capable monitor. Failures are logged and don't fail the switch.
+func (s *Switcher) applyDisplaySettings(monitors []ddc.Monitor, settings *config.DisplaySettings) {
+	vc, err := ddc.AsVCP(s.controller)
+	if err != nil {
+		logging.Infof("Switcher: Display settings not supported: %v", err)
+		return
+	}
+
+	// Preset first: selecting a preset may reset the individual gains
+	writes := []struct {
+		code  byte
+		value *int
+	}{
+		{ddc.VCPColorPreset, settings.ColorPreset},
+		{ddc.VCPRedGain, settings.RedGain},
+		{ddc.VCPGreenGain, settings.GreenGain},
+		{ddc.VCPBlueGain, settings.BlueGain},
+		{ddc.VCPBrightness, settings.Brightness},
+	}
+
+	var wg sync.WaitGroup
+	for _, m := range monitors {
+		if !m.DDCSupported {
+			continue
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for _, w := range writes {
+				if w.value == nil {
+					continue
+				}
+				if err := vc.SetVCP(id, w.code, *w.value); err != nil {
+					logging.Errorf("Switcher: Failed to set VCP %02X on monitor %s: %v", w.code, id, err)
+				}
+			}
+		}(m.ID)
+	}
+	wg.Wait()
+}
+
+// RunSchedule switches to profiles at their configured time of day. It starts
+// once the first display is detected and runs for the lifetime of the process,
+// idle while this machine is an agent (agents follow the Host instead).
+func (s *Switcher) RunSchedule() {
+	<-s.displaysReady
+
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	fired := make(map[string]string) // profile name -> date it last fired
+	for now := range ticker.C {
+		if s.followsHost() {
+			continue
+		}
+		s.runDueProfiles(now, fired)
+	}
+}
+
+// runDueProfiles switches to each profile whose schedule matches now, at most once per day
+func (s *Switcher) runDueProfiles(now time.Time, fired map[string]string) {
+	today := now.Format("2006-01-02")
+	current := now.Format("15:04")
+
+	for _, profile := range s.configMgr.Get().Profiles {
+		if profile.Schedule == "" {
+			continue
+		}
+		at, err := time.Parse("15:04", profile.Schedule)
+		if err != nil {
+			if fired[profile.Name] != "invalid" {
+				logging.Warnf("Switcher: Ignoring invalid schedule %q for profile '%s' (want HH:MM)", profile.Schedule, profile.Name)
+				fired[profile.Name] = "invalid"
+			}
+			continue
+		}
+		if at.Format("15:04") != current || fired[profile.Name] == today {
+			continue
+		}
+
+		fired[profile.Name] = today
+		logging.Infof("Switcher: Scheduled switch to profile '%s' at %s", profile.Name, profile.Schedule)
+		if err := s.SwitchToProfile(profile.Name); err != nil && !errors.Is(err, ErrQueued) {
+			logging.Errorf("Switcher: Scheduled switch failed: %v", err)
+		}
+	}
+}
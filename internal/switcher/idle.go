@@ -0,0 +1,52 @@
+package switcher
+
+import (
+	"time"
+
+	"vkvm/internal/logging"
+	"vkvm/internal/osutils"
+)
+
+// defaultIdleThreshold is how long without input counts as idle when
+// GeneralConfig.IdleThresholdSec is 0
+const defaultIdleThreshold = 5 * time.Minute
+
+// idleSlowdown is how many times less often background checks run while idle
+// or saving battery
+const idleSlowdown = 6
+
+// IsIdle reports whether the user has not touched this machine for the idle
+// threshold. Background work that only matters while someone is at the desk
+// slows down or pauses while idle. Platforms without idle detection are never
+// idle.
+func (s *Switcher) IsIdle() bool {
+	threshold := defaultIdleThreshold
+	if sec := s.configMgr.Get().General.IdleThresholdSec; sec < 0 {
+		return false
+	} else if sec > 0 {
+		threshold = time.Duration(sec) * time.Second
+	}
+
+	idleFor, err := osutils.IdleTime()
+	if err != nil {
+		return false
+	}
+	idle := idleFor >= threshold
+	if s.idle.Swap(idle) != idle {
+		if idle {
+			logging.Infof("Switcher: No input for %v, slowing down background checks", idleFor.Round(time.Second))
+		} else {
+			logging.Infof("Switcher: Input resumed, background checks back to normal")
+		}
+	}
+	return idle
+}
+
+// checkInterval stretches the interval of a background check while idle or
+// saving battery
+func (s *Switcher) checkInterval(interval time.Duration) time.Duration {
+	if s.IsIdle() || s.PowerSaving() {
+		return interval * idleSlowdown
+	}
+	return interval
+}
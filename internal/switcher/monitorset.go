@@ -0,0 +1,83 @@
+package switcher
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// monitorSetCheckInterval is how often the connected monitors are compared
+// with the profiles' monitor sets (six times less often while idle or on
+// battery)
+const monitorSetCheckInterval = 10 * time.Second
+
+// RunMonitorSetWatch switches to the profile whose MonitorSet matches the
+// connected monitors whenever that set changes, e.g. when a laptop is docked.
+// It starts once the first display is detected and runs for the lifetime of
+// the process, idle while this machine is an agent.
+func (s *Switcher) RunMonitorSetWatch() {
+	<-s.displaysReady
+
+	var last []string
+	for {
+		time.Sleep(s.checkInterval(monitorSetCheckInterval))
+		if s.followsHost() || !s.hasMonitorSets() {
+			last = nil
+			continue
+		}
+
+		monitors, err := s.controller.ListMonitors()
+		if err != nil && len(monitors) == 0 {
+			continue
+		}
+		connected := make([]string, 0, len(monitors))
+		for _, m := range monitors {
+			connected = append(connected, m.ID)
+		}
+		slices.Sort(connected)
+
+		// The first reading is the baseline: only changes trigger a switch
+		if last == nil || slices.Equal(connected, last) {
+			last = connected
+			continue
+		}
+		logging.Infof("Switcher: Connected monitors changed to [%s]", strings.Join(connected, ", "))
+		last = connected
+
+		if name := s.profileForMonitorSet(connected); name != "" && name != s.GetCurrentProfile() {
+			logging.Infof("Switcher: Monitor set matches profile '%s', switching", name)
+			if err := s.SwitchToProfile(name); err != nil && !errors.Is(err, ErrQueued) {
+				logging.Errorf("Switcher: Monitor set switch failed: %v", err)
+			}
+		}
+	}
+}
+
+// hasMonitorSets reports whether any profile is bound to a monitor set
+func (s *Switcher) hasMonitorSets() bool {
+	for _, p := range s.configMgr.Get().Profiles {
+		if len(p.MonitorSet) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// profileForMonitorSet returns the first profile whose MonitorSet is exactly
+// the sorted list of connected monitor IDs, or ""
+func (s *Switcher) profileForMonitorSet(connected []string) string {
+	for _, p := range s.configMgr.Get().Profiles {
+		if len(p.MonitorSet) == 0 {
+			continue
+		}
+		set := slices.Clone(p.MonitorSet)
+		slices.Sort(set)
+		if slices.Equal(slices.Compact(set), connected) {
+			return p.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,219 @@
+package switcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/ddc"
+	"vkvm/internal/events"
+	"vkvm/internal/logging"
+	"vkvm/internal/supervisor"
+)
+
+const (
+	// pluginQueueSize bounds the events waiting for one plugin to read them
+	pluginQueueSize = 32
+
+	// pluginMinBackoff and pluginMaxBackoff bound the delay before a crashed
+	// plugin is restarted
+	pluginMinBackoff = time.Second
+	pluginMaxBackoff = time.Minute
+)
+
+// PluginCommand is a line a plugin writes to stdout:
+//
+//	{"command": "switch", "profile": "Gaming"}
+//	{"command": "set_vcp", "monitor": "DELL-1", "code": 16, "value": 50}
+type PluginCommand struct {
+	Command string `json:"command"`
+	Profile string `json:"profile,omitempty"`
+	Monitor string `json:"monitor,omitempty"`
+	Code    int    `json:"code,omitempty"`
+	Value   int    `json:"value,omitempty"`
+}
+
+// plugin is a running plugin process and the events waiting for it
+type plugin struct {
+	config.Plugin
+	events chan events.Event
+	cancel context.CancelFunc
+}
+
+// StartPlugins runs the configured plugins (Config.Plugins) and restarts
+// them whenever the plugin configuration changes
+func (s *Switcher) StartPlugins() {
+	s.pluginsOnce.Do(func() {
+		events.Subscribe(s.sendPluginEvent)
+		s.configMgr.RegisterChangeCallback(func(change config.Change) {
+			if change.Has(config.SectionPlugins) {
+				s.applyPlugins(s.configMgr.Get().Plugins)
+			}
+		})
+		s.applyPlugins(s.configMgr.Get().Plugins)
+	})
+}
+
+// applyPlugins stops the running plugins and starts the enabled ones in list
+func (s *Switcher) applyPlugins(list []config.Plugin) {
+	s.pluginsMu.Lock()
+	defer s.pluginsMu.Unlock()
+
+	for _, p := range s.plugins {
+		p.cancel()
+	}
+	s.plugins = nil
+
+	for _, pc := range list {
+		if pc.Disabled {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		p := &plugin{Plugin: pc, events: make(chan events.Event, pluginQueueSize), cancel: cancel}
+		s.plugins = append(s.plugins, p)
+		supervisor.Go("plugin "+pc.Name, supervisor.Once, func() { s.runPlugin(ctx, p) })
+	}
+}
+
+// sendPluginEvent queues ev for every running plugin, dropping it for
+// plugins that are not keeping up
+func (s *Switcher) sendPluginEvent(ev events.Event) {
+	s.pluginsMu.Lock()
+	defer s.pluginsMu.Unlock()
+
+	for _, p := range s.plugins {
+		select {
+		case p.events <- ev:
+		default:
+			logging.Warnf("Switcher: Plugin %s is not reading events, dropping %s event", p.Name, ev.Type)
+		}
+	}
+}
+
+// runPlugin runs p until ctx is cancelled, restarting it with a growing
+// delay whenever it exits
+func (s *Switcher) runPlugin(ctx context.Context, p *plugin) {
+	var backoff time.Duration
+	for {
+		started := time.Now()
+		err := s.runPluginOnce(ctx, p)
+		if ctx.Err() != nil {
+			logging.Infof("Switcher: Plugin %s stopped", p.Name)
+			return
+		}
+
+		backoff = pluginBackoff(backoff, time.Since(started))
+		logging.Warnf("Switcher: Plugin %s exited (%v), restarting in %v", p.Name, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// pluginBackoff returns the delay before restarting a plugin that exited
+// after running for ran, given the delay before its last start (0 if none).
+// The delay doubles while the plugin keeps crashing and starts over once it
+// ran for longer than the longest delay.
+func pluginBackoff(prev, ran time.Duration) time.Duration {
+	if prev == 0 || ran > pluginMaxBackoff {
+		return pluginMinBackoff
+	}
+	return min(prev*2, pluginMaxBackoff)
+}
+
+// runPluginOnce starts the plugin process, feeds it events and executes its
+// commands until it exits
+func (s *Switcher) runPluginOnce(ctx context.Context, p *plugin) error {
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.WaitDelay = time.Second
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	logging.Infof("Switcher: Plugin %s started (%s)", p.Name, p.Path)
+
+	exited := make(chan struct{})
+	go func() {
+		enc := json.NewEncoder(stdin)
+		for {
+			select {
+			case <-exited:
+				return
+			case ev := <-p.events:
+				if err := enc.Encode(ev); err != nil {
+					return // the plugin closed stdin; keep reading its commands
+				}
+			}
+		}
+	}()
+	go logPluginOutput(p.Name, stderr)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var c PluginCommand
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			logging.Warnf("Switcher: Plugin %s sent an invalid command: %v", p.Name, err)
+			continue
+		}
+		if err := s.runPluginCommand(c); err != nil {
+			logging.Errorf("Switcher: Plugin %s: %s failed: %v", p.Name, c.Command, err)
+		}
+	}
+
+	err = cmd.Wait()
+	close(exited)
+	stdin.Close()
+	return err
+}
+
+// runPluginCommand executes one command sent by a plugin
+func (s *Switcher) runPluginCommand(c PluginCommand) error {
+	switch c.Command {
+	case "switch":
+		if c.Profile == "" {
+			return fmt.Errorf("missing profile")
+		}
+		if err := s.SwitchToProfile(c.Profile); !errors.Is(err, ErrQueued) {
+			return err
+		}
+		return nil // runs when the cooldown ends
+	case "set_vcp":
+		if c.Monitor == "" || c.Code < 0 || c.Code > 0xFF {
+			return fmt.Errorf("need a monitor and a VCP code between 0 and 255")
+		}
+		vc, err := ddc.AsVCP(s.controller)
+		if err != nil {
+			return err
+		}
+		return vc.SetVCP(c.Monitor, byte(c.Code), c.Value)
+	default:
+		return fmt.Errorf("unknown command %q", c.Command)
+	}
+}
+
+// logPluginOutput copies a plugin's stderr to the log line by line
+func logPluginOutput(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		logging.Infof("Plugin %s: %s", name, scanner.Text())
+	}
+}
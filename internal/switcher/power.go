@@ -0,0 +1,50 @@
+package switcher
+
+import (
+	"time"
+
+	"vkvm/internal/logging"
+	"vkvm/internal/osutils"
+)
+
+// Battery saver modes (GeneralConfig.BatterySaver)
+const (
+	BatterySaverAuto   = "auto" // save power while unplugged (default)
+	BatterySaverAlways = "always"
+	BatterySaverNever  = "never"
+)
+
+// powerCheckInterval bounds how often the power source is queried
+const powerCheckInterval = 30 * time.Second
+
+// PowerSaving reports whether background work should be reduced to save
+// battery: polling slows down and automatic LAN scans are skipped
+func (s *Switcher) PowerSaving() bool {
+	switch s.configMgr.Get().General.BatterySaver {
+	case BatterySaverAlways:
+		return true
+	case BatterySaverNever:
+		return false
+	}
+
+	s.powerMu.Lock()
+	defer s.powerMu.Unlock()
+	if time.Since(s.powerCheckedAt) < powerCheckInterval {
+		return s.onBattery
+	}
+	s.powerCheckedAt = time.Now()
+
+	onBattery, err := osutils.OnBattery()
+	if err != nil {
+		return s.onBattery
+	}
+	if onBattery != s.onBattery {
+		if onBattery {
+			logging.Infof("Switcher: Running on battery, reducing background work")
+		} else {
+			logging.Infof("Switcher: Back on AC power")
+		}
+		s.onBattery = onBattery
+	}
+	return onBattery
+}
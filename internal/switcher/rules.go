@@ -0,0 +1,127 @@
+package switcher
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/events"
+	"vkvm/internal/logging"
+	"vkvm/internal/supervisor"
+)
+
+// ruleCheckInterval is how often time rules are checked and, if a rule
+// watches monitor inputs, the monitors are read
+const ruleCheckInterval = 20 * time.Second
+
+// RunRules runs the automation rules (Config.Rules): agent and monitor input
+// rules react to events, time rules are checked periodically. It starts once
+// the first display is detected and runs for the lifetime of the process.
+func (s *Switcher) RunRules() {
+	s.rulesOnce.Do(func() {
+		events.Subscribe(s.handleRuleEvent)
+	})
+	<-s.displaysReady
+
+	fired := make(map[string]string) // rule label -> date it last fired
+	inputs := make(map[string]int)   // monitor ID -> last reported input
+	for {
+		time.Sleep(ruleCheckInterval)
+		rules := s.configMgr.Get().Rules
+		s.runTimeRules(rules, time.Now(), fired)
+		if hasRule(rules, config.RuleMonitorInput) {
+			s.pollInputs(inputs)
+		}
+	}
+}
+
+// runTimeRules fires each time rule that is due now, at most once per day
+func (s *Switcher) runTimeRules(rules []config.Rule, now time.Time, fired map[string]string) {
+	today := now.Format("2006-01-02")
+	for _, r := range rules {
+		if r.Disabled || r.When.Event != config.RuleTime || r.When.Time != now.Format("15:04") {
+			continue
+		}
+		if !r.When.OnDay(now.Weekday()) || fired[r.Label()] == today {
+			continue
+		}
+		fired[r.Label()] = today
+		s.fireRule(r)
+	}
+}
+
+// pollInputs reads the monitors' inputs and publishes a MonitorInput event
+// for each one that changed since the last poll. The first reading of a
+// monitor is its baseline.
+func (s *Switcher) pollInputs(last map[string]int) {
+	monitors, err := s.ListMonitors()
+	if err != nil && len(monitors) == 0 {
+		return
+	}
+	for _, m := range monitors {
+		if !m.DDCSupported || m.InputSource == 0 {
+			continue
+		}
+		input := int(m.InputSource)
+		prev, seen := last[m.ID]
+		last[m.ID] = input
+		if seen && prev != input {
+			events.Publish(events.Event{Type: events.MonitorInput, Monitor: m.ID, Input: input})
+		}
+	}
+}
+
+// handleRuleEvent fires the rules matching ev
+func (s *Switcher) handleRuleEvent(ev events.Event) {
+	for _, r := range s.configMgr.Get().Rules {
+		if !r.Disabled && s.ruleMatches(r.When, ev) {
+			s.fireRule(r)
+		}
+	}
+}
+
+// ruleMatches reports whether an event-driven trigger matches ev
+func (s *Switcher) ruleMatches(t config.RuleTrigger, ev events.Event) bool {
+	switch {
+	case t.Event == config.RuleAgentConnected && ev.Type == events.AgentConnected,
+		t.Event == config.RuleAgentDisconnected && ev.Type == events.AgentDisconnected:
+		return s.isAgent(t.Agent, ev)
+	case t.Event == config.RuleMonitorInput && ev.Type == events.MonitorInput:
+		return t.Monitor == ev.Monitor && t.Input == ev.Input
+	}
+	return false
+}
+
+// isAgent reports whether want names the agent of ev: its hostname, its
+// address or the name it is registered under (empty matches any agent)
+func (s *Switcher) isAgent(want string, ev events.Event) bool {
+	if want == "" || strings.EqualFold(want, ev.Agent) || want == ev.Address {
+		return true
+	}
+	mc := s.configMgr.FindMachine(want)
+	return mc != nil && mc.ID != "" && strings.EqualFold(mc.ID, ev.Agent)
+}
+
+// fireRule switches to the rule's profile in the background
+func (s *Switcher) fireRule(r config.Rule) {
+	if r.Switch == s.GetCurrentProfile() {
+		return
+	}
+	logging.Infof("Switcher: Rule '%s' fired, switching to '%s'", r.Label(), r.Switch)
+	supervisor.Go("rule-switch", supervisor.Once, func() {
+		if err := s.SwitchToProfile(r.Switch); err != nil && !errors.Is(err, ErrQueued) {
+			logging.Errorf("Switcher: Rule '%s' switch failed: %v", r.Label(), err)
+		}
+	})
+}
+
+// hasRule reports whether an enabled rule uses the given trigger event
+func hasRule(rules []config.Rule, event string) bool {
+	for _, r := range rules {
+		if !r.Disabled && r.When.Event == event {
+			return true
+		}
+	}
+	return false
+}
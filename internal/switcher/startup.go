@@ -0,0 +1,62 @@
+package switcher
+
+import (
+	"time"
+
+	"vkvm/internal/logging"
+)
+
+// Display enumeration retry backoff: starts at displayRetryMin and doubles
+// up to displayRetryMax
+const (
+	displayRetryMin = time.Second
+	displayRetryMax = 30 * time.Second
+)
+
+// displayWaitTimeout bounds how long a switch waits for the first display at startup
+const displayWaitTimeout = 10 * time.Second
+
+// WaitForDisplays blocks until the DDC backends report at least one monitor.
+// At boot the service often starts before the displays are enumerated, so
+// it retries with backoff instead of working with an empty monitor list.
+func (s *Switcher) WaitForDisplays() {
+	delay := displayRetryMin
+	for {
+		monitors, err := s.controller.ListMonitors()
+		if len(monitors) > 0 {
+			s.readyOnce.Do(func() {
+				logging.Infof("Switcher: %d display(s) detected", len(monitors))
+				close(s.displaysReady)
+			})
+			return
+		}
+
+		if err != nil {
+			logging.Infof("Switcher: Waiting for displays (%v), retrying in %v", err, delay)
+		} else {
+			logging.Infof("Switcher: Waiting for displays, retrying in %v", delay)
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, displayRetryMax)
+	}
+}
+
+// DisplaysReady reports whether WaitForDisplays has seen a display yet
+func (s *Switcher) DisplaysReady() bool {
+	select {
+	case <-s.displaysReady:
+		return true
+	default:
+		return false
+	}
+}
+
+// awaitDisplays waits up to timeout for the first display and reports whether one appeared
+func (s *Switcher) awaitDisplays(timeout time.Duration) bool {
+	select {
+	case <-s.displaysReady:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -2,72 +2,118 @@
 package switcher
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"vkvm/internal/config"
 	"vkvm/internal/ddc"
+	"vkvm/internal/events"
+	"vkvm/internal/logging"
 	"vkvm/internal/network"
 	"vkvm/internal/osutils"
 )
 
+// ErrSuperseded is returned by a switch that was dropped because a newer
+// switch request arrived before it finished
+var ErrSuperseded = errors.New("switch superseded by a newer request")
+
+// forwardTimeout bounds how long an agent waits for the Host to confirm a switch
+const forwardTimeout = 10 * time.Second
+
 // Switcher coordinates monitor input switching
 type Switcher struct {
 	mu         sync.Mutex
 	controller ddc.Controller
 	configMgr  *config.Manager
-	wsClient   *network.WSClient
 
-	// Callbacks for UI notifications
-	onSwitch func(profileName string)
+	// wsClient is the link to the Host on agents (see agent.go)
+	wsMu         sync.Mutex
+	wsClient     *network.WSClient
+	netWatchOnce sync.Once
+
+	// Callbacks for UI notifications; origin is the machine a remote switch
+	// started on, empty for switches started here
+	onSwitch func(profileName, origin string)
 	onError  func(error)
+
+	// confirm is the read-back of the most recent switch (see confirm.go)
+	confirmMu sync.Mutex
+	confirm   *SwitchConfirmation
+
+	// switchGen counts switch requests; activeGen (guarded by mu) is the one
+	// being performed. A request is superseded once a newer one arrives.
+	switchGen atomic.Uint64
+	activeGen uint64
+
+	// rulesOnce subscribes the rules engine to events once (see rules.go)
+	rulesOnce sync.Once
+
+	// Running plugin processes (see plugins.go)
+	pluginsOnce sync.Once
+	pluginsMu   sync.Mutex
+	plugins     []*plugin
+
+	// idle is the last result of IsIdle (see idle.go)
+	idle atomic.Bool
+
+	// Cached power source (see power.go)
+	powerMu        sync.Mutex
+	onBattery      bool
+	powerCheckedAt time.Time
+
+	// Switch cooldown state (see cooldown.go)
+	cooldownMu   sync.Mutex
+	lastSwitchAt time.Time
+	queued       func(queued bool) error // latest switch waiting for the cooldown to end
+	queuedName   string
+
+	// displaysReady is closed once the first display is detected (see startup.go)
+	displaysReady chan struct{}
+	readyOnce     sync.Once
 }
 
 // New creates a new Switcher instance
 func New(configMgr *config.Manager) (*Switcher, error) {
-	controller, err := ddc.NewController()
+	cfg := configMgr.Get()
+
+	paths := ddc.ToolPaths{
+		ControlMyMonitor: cfg.General.ControlMyMonitorPath,
+		M1DDC:            cfg.General.M1DDCPath,
+		DDCUtil:          cfg.General.DDCUtilPath,
+	}
+	if err := paths.Validate(); err != nil {
+		logging.Warnf("Switcher: Invalid DDC tool path configuration, falling back to auto-detect: %v", err)
+	}
+
+	controller, err := ddc.NewController(ddc.Options{
+		ToolPaths:        paths,
+		CommandTimeout:   time.Duration(cfg.General.DDCCommandTimeoutMs) * time.Millisecond,
+		MinWriteInterval: time.Duration(cfg.General.InputWriteIntervalMs) * time.Millisecond,
+		Probes:           configMgr,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create DDC controller: %w", err)
 	}
 
 	s := &Switcher{
-		controller: controller,
-		configMgr:  configMgr,
+		controller:    controller,
+		configMgr:     configMgr,
+		displaysReady: make(chan struct{}),
 	}
 
-	// Initialize WebSocket client if Agent
-	cfg := configMgr.Get()
-	if cfg.General.Role == "agent" && cfg.General.CoordinatorAddr != "" {
-		log.Printf("Switcher: Initializing WebSocket client to Host %s", cfg.General.CoordinatorAddr)
-		s.wsClient = network.NewWSClient(cfg.General.CoordinatorAddr, cfg.General.APIToken)
-
-		// Wire up callbacks
-		s.wsClient.OnSwitch = func(profile string) {
-			log.Printf("Switcher: Received remote switch command for '%s'", profile)
-			if err := s.SwitchLocalOnly(profile); err != nil {
-				log.Printf("Switcher: Remote switch execution failed: %v", err)
-			}
-		}
-
-		s.wsClient.OnSync = func(profiles interface{}) {
-			if err := s.configMgr.UpdateProfilesFromRemote(profiles); err != nil {
-				log.Printf("Switcher: Config sync failed: %v", err)
-			} else {
-				log.Printf("Switcher: Config synced from Host")
-			}
-		}
-
-		// Start client
-		s.wsClient.Start()
-	}
+	// Initialize WebSocket client if Agent, and follow changes of the Host
+	s.startAgentLink(cfg)
+	configMgr.RegisterChangeCallback(s.applyConfigChange)
 
 	return s, nil
 }
 
 // SetOnSwitch sets the callback for switch events
-func (s *Switcher) SetOnSwitch(callback func(profileName string)) {
+func (s *Switcher) SetOnSwitch(callback func(profileName, origin string)) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.onSwitch = callback
@@ -81,44 +127,107 @@ func (s *Switcher) SetOnError(callback func(error)) {
 }
 
 func (s *Switcher) SwitchToProfile(profileName string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	// Agents forward to the Host without holding the lock: the Host's broadcast
+	// back to us needs it while we are still waiting for the reply
+	cfg := s.configMgr.Get()
+	if cfg.General.Role == "agent" && cfg.General.CoordinatorAddr != "" {
+		return s.forwardSwitch(profileName)
+	}
 
-	profile := s.configMgr.GetProfile(profileName)
-	if profile == nil {
-		return fmt.Errorf("profile not found: %s", profileName)
+	if cfg.General.CheckAgentsBeforeSwitch {
+		if unreachable := s.unreachableAgents(profileName); len(unreachable) > 0 {
+			return &AgentUnreachableError{Profile: profileName, Agents: unreachable}
+		}
+	} else {
+		s.warnOfflineAgents(profileName)
+	}
+	return s.switchLocal(profileName, true, "", true)
+}
+
+// SwitchVideoOnly switches to a profile without checking that its agents are
+// reachable, after the user chose to switch the monitors to a machine that
+// won't take the keyboard (see AgentUnreachableError)
+func (s *Switcher) SwitchVideoOnly(profileName string) error {
+	logging.Infof("Switcher: Switching video only to '%s'", profileName)
+	return s.switchLocal(profileName, true, "", false)
+}
+
+// forwardSwitch asks the Host to perform a switch and reports its outcome
+func (s *Switcher) forwardSwitch(profileName string) error {
+	c := s.client()
+	if c == nil {
+		logging.Errorf("Switcher: Agent role but no WebSocket client available")
+		return fmt.Errorf("agent is not connected to a host")
 	}
 
-	return s.switchToProfileInternal(profile, profileName, true)
+	logging.Infof("Switcher: Operating as Agent, forwarding switch request '%s' to Host via WebSocket", profileName)
+	if err := c.RequestSwitch(profileName, forwardTimeout); errors.Is(err, network.ErrSwitchQueued) {
+		logging.Infof("Switcher: Host queued switch to '%s' until its cooldown ends", profileName)
+		return ErrQueued
+	} else if err != nil {
+		logging.Errorf("Switcher: Forwarded switch to '%s' failed: %v", profileName, err)
+		return err
+	}
+	logging.Infof("Switcher: Host confirmed switch to '%s'", profileName)
+	return nil
 }
 
 // SwitchLocalOnly switches local monitors only, bypassing agent forwarding or host propagation
 func (s *Switcher) SwitchLocalOnly(profileName string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.switchLocal(profileName, false, "", false)
+}
+
+// switchRemote applies a switch broadcast by the Host. The origin is passed
+// on to the OnSwitch callback so a rebroadcast keeps it and can be dropped
+// by the machine it started on instead of looping.
+func (s *Switcher) switchRemote(profileName, origin string) error {
+	return s.switchLocal(profileName, false, origin, false)
+}
+
+// superseded reports whether a switch request newer than gen has arrived
+func (s *Switcher) superseded(gen uint64) bool {
+	return s.switchGen.Load() != gen
+}
 
-	profile := s.configMgr.GetProfile(profileName)
-	if profile == nil {
+// switchLocal performs a switch on this machine, subject to the switch
+// cooldown. With checkAgents, a switch that waited for the cooldown checks
+// again that the profile's agents are reachable.
+func (s *Switcher) switchLocal(profileName string, allowForward bool, origin string, checkAgents bool) error {
+	if s.configMgr.GetProfile(profileName) == nil {
 		return fmt.Errorf("profile not found: %s", profileName)
 	}
 
-	return s.switchToProfileInternal(profile, profileName, false)
-}
+	return s.cooldown(profileName, func(queued bool) error {
+		// Agents may have gone away while the switch was queued
+		if queued && checkAgents && s.configMgr.Get().General.CheckAgentsBeforeSwitch {
+			if unreachable := s.unreachableAgents(profileName); len(unreachable) > 0 {
+				return &AgentUnreachableError{Profile: profileName, Agents: unreachable}
+			}
+		}
 
-func (s *Switcher) switchToProfileInternal(profile *config.Profile, profileName string, allowForward bool) error {
-	cfg := s.configMgr.Get()
+		// A newer request arriving while this one waits for the lock (or
+		// while it is writing) supersedes it
+		gen := s.switchGen.Add(1)
 
-	// Handle Agent Role: Forward to Host instead of local execution
-	if allowForward && cfg.General.Role == "agent" && cfg.General.CoordinatorAddr != "" {
-		if s.wsClient != nil {
-			log.Printf("Switcher: Operating as Agent, forwarding switch request '%s' to Host via WebSocket", profileName)
-			s.wsClient.SendSwitch(profileName)
-		} else {
-			log.Printf("Switcher: Error: Agent role but no WebSocket client available")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.superseded(gen) {
+			logging.Infof("Switcher: Switch to '%s' superseded by a newer request before it started", profileName)
+			return ErrSuperseded
 		}
-		return nil
-	}
+		s.activeGen = gen
+
+		profile := s.configMgr.GetProfile(profileName)
+		if profile == nil {
+			return fmt.Errorf("profile not found: %s", profileName)
+		}
+		return s.switchToProfileInternal(profile, profileName, allowForward, origin)
+	})
+}
 
+func (s *Switcher) switchToProfileInternal(profile *config.Profile, profileName string, allowForward bool, origin string) error {
+	gen := s.activeGen
 	var lastErr error
 	// count := 0
 
@@ -137,6 +246,13 @@ func (s *Switcher) switchToProfileInternal(profile *config.Profile, profileName
 	if switchMode == "local" || switchMode == "both" {
 		// Get currently detected monitors for this machine to filter inputs
 		activeMonitors, _ := s.controller.ListMonitors()
+		if len(activeMonitors) == 0 && !s.DisplaysReady() {
+			// Right after boot the displays may not be enumerated yet
+			logging.Infof("Switcher: No displays detected yet, waiting up to %v", displayWaitTimeout)
+			if s.awaitDisplays(displayWaitTimeout) {
+				activeMonitors, _ = s.controller.ListMonitors()
+			}
+		}
 		activeIDs := make(map[string]bool)
 		for _, m := range activeMonitors {
 			activeIDs[m.ID] = true
@@ -144,65 +260,125 @@ func (s *Switcher) switchToProfileInternal(profile *config.Profile, profileName
 
 		var wg sync.WaitGroup
 		var errMu sync.Mutex
+		switched := make(map[string]ddc.InputSource)
 
 		for monitorID, inputSource := range profile.MonitorInputs {
 			// Skip monitors not found on this machine (avoids errors from synced foreign configs)
 			if !activeIDs[monitorID] {
-				log.Printf("Switcher: Skipping monitor %s (not detected on this computer)", monitorID)
+				logging.Debugf("Switcher: Skipping monitor %s (not detected on this computer)", monitorID)
 				continue
 			}
 
 			wg.Add(1)
 			go func(mid string, src int) {
 				defer wg.Done()
-				if err := s.controller.SetInputSource(mid, ddc.InputSource(src)); err != nil {
-					log.Printf("Failed to switch monitor %s: %v", mid, err)
+				if s.superseded(gen) {
+					return // e.g. still waiting for the monitor's write interval
+				}
+				if err := s.setInput(gen, mid, ddc.InputSource(src)); err != nil {
+					logging.Errorf("Switcher: Failed to switch monitor %s: %v", mid, err)
 					errMu.Lock()
 					lastErr = err
 					errMu.Unlock()
+					return
 				}
+				errMu.Lock()
+				switched[mid] = ddc.InputSource(src)
+				errMu.Unlock()
 			}(monitorID, inputSource)
 		}
 		wg.Wait()
+
+		// The newer switch takes over: it rewrites the monitors and saves the state
+		if s.superseded(gen) {
+			logging.Infof("Switcher: Switch to '%s' superseded by a newer request after %d monitor(s)", profileName, len(switched))
+			return ErrSuperseded
+		}
+
+		if s.configMgr.Get().General.ConfirmSwitch && len(switched) > 0 {
+			s.startConfirmation(gen, profileName, switched)
+		} else {
+			s.confirmMu.Lock()
+			s.confirm = nil // don't report an earlier switch's result for this one
+			s.confirmMu.Unlock()
+		}
+
+		if profile.Display != nil {
+			s.applyDisplaySettings(activeMonitors, profile.Display)
+		}
 	}
 
-	// Save config
-	cfg.General.CurrentProfile = profileName
-	if err := s.configMgr.Save(); err != nil {
-		log.Printf("Failed to save config: %v", err)
+	// Remember the profile across restarts
+	if err := s.configMgr.UpdateState(func(st *config.State) {
+		now := time.Now()
+		st.CurrentProfile = profileName
+		st.SwitchedAt = &now
+	}); err != nil {
+		logging.Errorf("Switcher: Failed to save runtime state: %v", err)
 	}
 
 	// Legacy RemoteHosts support is deprecated in favor of WebSocket broadcast
 	// The WSManager in the API server will handle broadcasting via the OnSwitch callback
 	if allowForward && len(profile.RemoteHosts) > 0 {
-		log.Printf("Switcher: Note: 'remote_hosts' in config is ignored in WebSocket mode. Ensure agents are connected to Host.")
+		logging.Warnf("Switcher: 'remote_hosts' in config is ignored in WebSocket mode. Ensure agents are connected to Host.")
 	}
 
 	if s.onSwitch != nil {
-		s.onSwitch(profileName)
+		s.onSwitch(profileName, origin)
 	}
+	events.Publish(events.Event{Type: events.Switched, Profile: profileName, Origin: origin})
 
 	return lastErr
 }
 
-// SyncProfiles triggers a sync request via WebSocket if connected
+// syncTimeout bounds how long a manual sync waits for the Host's profiles
+const syncTimeout = 5 * time.Second
+
+// SyncProfiles requests the Host's profiles via WebSocket and waits until they
+// are applied. Returns network.ErrNotConnected while the link is down; the
+// client syncs by itself on every (re)connect.
 func (s *Switcher) SyncProfiles() error {
-	// With WebSocket, sync is automatic/pushed, but we can manually request it
-	if s.wsClient != nil {
-		s.wsClient.SendSyncRequest()
+	c := s.client()
+	if c == nil {
 		return nil
 	}
-	return nil
+	return c.RequestSync(syncTimeout)
 }
 
 // GetCurrentProfile returns the current profile name
 func (s *Switcher) GetCurrentProfile() string {
-	return s.configMgr.Get().General.CurrentProfile
+	return s.configMgr.GetState().CurrentProfile
 }
 
-// ListMonitors returns all detected monitors
+// ListMonitors returns all detected monitors with per-monitor input overrides applied
 func (s *Switcher) ListMonitors() ([]ddc.Monitor, error) {
-	return s.controller.ListMonitors()
+	monitors, err := s.controller.ListMonitors()
+	for i := range monitors {
+		monitors[i].InputSource = s.remapInput(monitors[i].ID, monitors[i].InputSource)
+	}
+	return monitors, err
+}
+
+// ReprobeMonitors forgets the stored DDC/CI probe results and lists the
+// monitors again, probing every one of them
+func (s *Switcher) ReprobeMonitors() ([]ddc.Monitor, error) {
+	if err := s.configMgr.ClearDDCProbes(); err != nil {
+		return nil, err
+	}
+	logging.Infof("Switcher: Re-probing DDC/CI support of all monitors")
+	return s.ListMonitors()
+}
+
+// remapInput applies the configured InputRemap for a monitor to a raw reading
+func (s *Switcher) remapInput(monitorID string, raw ddc.InputSource) ddc.InputSource {
+	info := s.configMgr.GetMonitor(monitorID)
+	if info == nil {
+		return raw
+	}
+	if mapped, ok := info.InputRemap[int(raw)]; ok {
+		return ddc.InputSource(mapped)
+	}
+	return raw
 }
 
 // TestMonitor tests switching a specific monitor to verify DDC works
@@ -210,10 +386,48 @@ func (s *Switcher) TestMonitor(monitorID string, input ddc.InputSource) error {
 	return s.controller.SetInputSource(monitorID, input)
 }
 
+// ReadInput reads a monitor's current input over DDC/CI, with the
+// monitor's InputRemap applied
+func (s *Switcher) ReadInput(monitorID string) (ddc.InputSource, error) {
+	input, err := s.controller.GetCurrentInput(monitorID)
+	if err != nil {
+		return 0, err
+	}
+	return s.remapInput(monitorID, input), nil
+}
+
+// SetMonitorPower puts one monitor into standby (on=false) or wakes it over
+// DDC/CI, leaving the other monitors alone
+func (s *Switcher) SetMonitorPower(monitorID string, on bool) error {
+	monitors, err := s.controller.ListMonitors()
+	if err != nil && len(monitors) == 0 {
+		return err
+	}
+	if !slices.ContainsFunc(monitors, func(m ddc.Monitor) bool { return m.ID == monitorID }) {
+		return fmt.Errorf("%w: %s", ddc.ErrMonitorNotFound, monitorID)
+	}
+	return s.controller.SetPower(monitorID, on)
+}
+
+// FlashMonitor blinks a monitor's brightness to identify the physical panel
+func (s *Switcher) FlashMonitor(monitorID string) error {
+	return ddc.FlashMonitor(s.controller, monitorID)
+}
+
+// ConnectionStatus returns details about the agent's link to the host
+func (s *Switcher) ConnectionStatus() network.ConnectionStatus {
+	c := s.client()
+	if c == nil {
+		return network.ConnectionStatus{}
+	}
+	return c.Status()
+}
+
 // IsConnectedToCheck returns true if the agent is connected to the host
 func (s *Switcher) IsConnectedToCheck() bool {
-	if s.wsClient == nil {
+	c := s.client()
+	if c == nil {
 		return false
 	}
-	return s.wsClient.IsConnected()
+	return c.IsConnected()
 }
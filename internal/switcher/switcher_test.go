@@ -0,0 +1,386 @@
+package switcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"vkvm/internal/config"
+	"vkvm/internal/ddc"
+	"vkvm/internal/events"
+	"vkvm/internal/testutil"
+)
+
+// fakeController is a single monitor "m1" stuck on input, whatever is written
+type fakeController struct {
+	mu     sync.Mutex
+	input  ddc.InputSource
+	writes []ddc.InputSource
+	reads  int
+	err    error // returned by writes
+
+	// gate, if set, holds the next write: it receives once the write has
+	// started and once more to let it finish
+	gate chan struct{}
+}
+
+func (f *fakeController) ListMonitors() ([]ddc.Monitor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return []ddc.Monitor{{ID: "m1", InputSource: f.input, DDCSupported: true}}, nil
+}
+
+func (f *fakeController) GetCurrentInput(string) (ddc.InputSource, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	return f.input, nil
+}
+
+func (f *fakeController) SetInputSource(_ string, source ddc.InputSource) error {
+	f.mu.Lock()
+	f.writes = append(f.writes, source)
+	gate, err := f.gate, f.err
+	f.gate = nil
+	f.mu.Unlock()
+
+	if gate != nil {
+		gate <- struct{}{}
+		<-gate
+	}
+	return err
+}
+
+func (f *fakeController) SetPower(string, bool) error { return nil }
+
+func (f *fakeController) TestDDCSupport(string) bool { return true }
+
+func (f *fakeController) snapshot() (writes []ddc.InputSource, reads int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.writes), f.reads
+}
+
+// newTestSwitcher returns a Switcher on ctrl with profiles "A" (m1 on
+// DisplayPort 1) and "B" (m1 on HDMI 1); edit adjusts the config
+func newTestSwitcher(t *testing.T, ctrl ddc.Controller, edit func(*config.Config)) *Switcher {
+	t.Helper()
+	m := testutil.NewConfig(t)
+	m.Update(func(c *config.Config) {
+		c.Profiles = []config.Profile{
+			{Name: "A", MonitorInputs: map[string]int{"m1": int(ddc.InputSourceDP1)}},
+			{Name: "B", MonitorInputs: map[string]int{"m1": int(ddc.InputSourceHDMI1)}},
+		}
+		c.General.SwitchCooldownMs = 0
+		if edit != nil {
+			edit(c)
+		}
+	})
+	return &Switcher{controller: ctrl, configMgr: m, displaysReady: make(chan struct{})}
+}
+
+// waitFor polls cond until it holds or fails the test after a while
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A confirmation that finds its monitor on the wrong input must not write it
+// back while a newer switch is in flight
+func TestConfirmRetrySkippedWhenSuperseded(t *testing.T) {
+	ctrl := &fakeController{input: ddc.InputSourceHDMI1}
+	s := newTestSwitcher(t, ctrl, func(c *config.Config) { c.General.ConfirmSwitch = true })
+
+	if err := s.SwitchLocalOnly("A"); err != nil {
+		t.Fatal(err)
+	}
+	s.confirmMu.Lock()
+	c := s.confirm
+	s.confirmMu.Unlock()
+	if c == nil {
+		t.Fatal("switch to A started no confirmation")
+	}
+
+	// Switch to B and hold its write until A's confirmation has read m1 back
+	gate := make(chan struct{})
+	ctrl.mu.Lock()
+	ctrl.gate = gate
+	ctrl.mu.Unlock()
+	switched := make(chan error, 1)
+	go func() { switched <- s.SwitchLocalOnly("B") }()
+	<-gate
+	waitFor(t, func() bool { _, reads := ctrl.snapshot(); return reads > 0 }, "the read-back of A")
+	time.Sleep(100 * time.Millisecond) // time for a retry to write, if it did
+	gate <- struct{}{}
+
+	if err := <-switched; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("confirmation of A did not finish")
+	}
+
+	want := []ddc.InputSource{ddc.InputSourceDP1, ddc.InputSourceHDMI1}
+	if writes, _ := ctrl.snapshot(); !slices.Equal(writes, want) {
+		t.Errorf("writes = %v, want %v", writes, want)
+	}
+}
+
+// waitWrites waits until ctrl has seen want writes, in order, and no more
+func waitWrites(t *testing.T, ctrl *fakeController, want ...ddc.InputSource) {
+	t.Helper()
+	waitFor(t, func() bool { writes, _ := ctrl.snapshot(); return len(writes) >= len(want) }, "the switch")
+	if writes, _ := ctrl.snapshot(); !slices.Equal(writes, want) {
+		t.Fatalf("writes = %v, want %v", writes, want)
+	}
+}
+
+func TestTimeRules(t *testing.T) {
+	ctrl := &fakeController{}
+	s := newTestSwitcher(t, ctrl, nil)
+	rules := []config.Rule{
+		{When: config.RuleTrigger{Event: config.RuleTime, Time: "09:00", Days: []string{"weekdays"}}, Switch: "A"},
+		{When: config.RuleTrigger{Event: config.RuleTime, Time: "18:00"}, Switch: "B", Disabled: true},
+	}
+	monday := time.Date(2026, 10, 12, 9, 0, 0, 0, time.Local)
+	fired := make(map[string]string)
+
+	s.runTimeRules(rules, monday, fired)
+	waitWrites(t, ctrl, ddc.InputSourceDP1)
+
+	// Once a day, on the configured days, at the configured time only
+	if err := s.SwitchLocalOnly("B"); err != nil {
+		t.Fatal(err)
+	}
+	s.runTimeRules(rules, monday.Add(30*time.Second), fired)
+	s.runTimeRules(rules, monday.AddDate(0, 0, 5), fired) // Saturday
+	s.runTimeRules(rules, monday.AddDate(0, 0, 1).Add(time.Minute), fired)
+	s.runTimeRules(rules, monday.Add(9*time.Hour), fired) // disabled rule
+	time.Sleep(100 * time.Millisecond)                    // time for a switch, if one started
+	waitWrites(t, ctrl, ddc.InputSourceDP1, ddc.InputSourceHDMI1)
+
+	s.runTimeRules(rules, monday.AddDate(0, 0, 1), fired)
+	waitWrites(t, ctrl, ddc.InputSourceDP1, ddc.InputSourceHDMI1, ddc.InputSourceDP1)
+}
+
+func TestRuleMatches(t *testing.T) {
+	s := newTestSwitcher(t, &fakeController{}, func(c *config.Config) {
+		c.Machines = []config.Machine{{Name: "Work laptop", ID: "laptop-7", Address: "192.0.2.7:8080"}}
+	})
+	gone := events.Event{Type: events.AgentDisconnected, Agent: "LAPTOP-7", Address: "192.0.2.7"}
+
+	tests := []struct {
+		name string
+		when config.RuleTrigger
+		ev   events.Event
+		want bool
+	}{
+		{"any agent", config.RuleTrigger{Event: config.RuleAgentDisconnected}, gone, true},
+		{"hostname ignores case", config.RuleTrigger{Event: config.RuleAgentDisconnected, Agent: "laptop-7"}, gone, true},
+		{"address", config.RuleTrigger{Event: config.RuleAgentDisconnected, Agent: "192.0.2.7"}, gone, true},
+		{"registered machine name", config.RuleTrigger{Event: config.RuleAgentDisconnected, Agent: "Work laptop"}, gone, true},
+		{"other agent", config.RuleTrigger{Event: config.RuleAgentDisconnected, Agent: "desktop"}, gone, false},
+		{"other event", config.RuleTrigger{Event: config.RuleAgentConnected}, gone, false},
+		{
+			"monitor input",
+			config.RuleTrigger{Event: config.RuleMonitorInput, Monitor: "m1", Input: 18},
+			events.Event{Type: events.MonitorInput, Monitor: "m1", Input: 18},
+			true,
+		},
+		{
+			"other input",
+			config.RuleTrigger{Event: config.RuleMonitorInput, Monitor: "m1", Input: 18},
+			events.Event{Type: events.MonitorInput, Monitor: "m1", Input: 17},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		if got := s.ruleMatches(tt.when, tt.ev); got != tt.want {
+			t.Errorf("%s: ruleMatches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAgentRuleSwitches(t *testing.T) {
+	ctrl := &fakeController{}
+	s := newTestSwitcher(t, ctrl, func(c *config.Config) {
+		c.Rules = []config.Rule{
+			{When: config.RuleTrigger{Event: config.RuleAgentDisconnected, Agent: "laptop"}, Switch: "B"},
+			{When: config.RuleTrigger{Event: config.RuleAgentConnected, Agent: "laptop"}, Switch: "A", Disabled: true},
+		}
+	})
+
+	s.handleRuleEvent(events.Event{Type: events.AgentConnected, Agent: "laptop"})
+	s.handleRuleEvent(events.Event{Type: events.AgentDisconnected, Agent: "laptop"})
+	waitWrites(t, ctrl, ddc.InputSourceHDMI1)
+
+	// Already on the rule's profile
+	s.handleRuleEvent(events.Event{Type: events.AgentDisconnected, Agent: "laptop"})
+	time.Sleep(100 * time.Millisecond)
+	waitWrites(t, ctrl, ddc.InputSourceHDMI1)
+}
+
+func TestPluginBackoff(t *testing.T) {
+	var delays []time.Duration
+	backoff := time.Duration(0)
+	for range 8 {
+		backoff = pluginBackoff(backoff, time.Millisecond) // crashes right away
+		delays = append(delays, backoff)
+	}
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		16 * time.Second, 32 * time.Second, time.Minute, time.Minute,
+	}
+	if !slices.Equal(delays, want) {
+		t.Errorf("delays %v, want %v", delays, want)
+	}
+
+	// A plugin that ran for a while before crashing starts over
+	if d := pluginBackoff(time.Minute, 2*time.Minute); d != time.Second {
+		t.Errorf("after a long run: %v, want 1s", d)
+	}
+	if d := pluginBackoff(4*time.Second, 30*time.Second); d != 8*time.Second {
+		t.Errorf("after a short run: %v, want 8s", d)
+	}
+}
+
+func TestPluginSwitches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	ctrl := &fakeController{}
+	s := newTestSwitcher(t, ctrl, nil)
+
+	// The plugin answers an agent connecting with a switch, then exits
+	script := `read -r ev; case "$ev" in *'"agent_connected"'*'"laptop"'*) echo '{"command":"switch","profile":"B"}';; esac`
+	p := &plugin{
+		Plugin: config.Plugin{Name: "test", Path: "/bin/sh", Args: []string{"-c", script}},
+		events: make(chan events.Event, 1),
+	}
+	p.events <- events.Event{Type: events.AgentConnected, Agent: "laptop"}
+	if err := s.runPluginOnce(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	waitWrites(t, ctrl, ddc.InputSourceHDMI1)
+
+	for _, c := range []PluginCommand{
+		{Command: "switch"},
+		{Command: "set_vcp", Code: 16},
+		{Command: "reboot"},
+	} {
+		if err := s.runPluginCommand(c); err == nil {
+			t.Errorf("%+v succeeded", c)
+		}
+	}
+}
+
+const testCooldown = 300 * time.Millisecond
+
+// newCooldownSwitcher returns a test Switcher with a short switch cooldown
+// whose errors are sent to the returned channel
+func newCooldownSwitcher(t *testing.T, ctrl *fakeController, edit func(*config.Config)) (*Switcher, <-chan error) {
+	t.Helper()
+	s := newTestSwitcher(t, ctrl, func(c *config.Config) {
+		c.General.SwitchCooldownMs = int(testCooldown / time.Millisecond)
+		if edit != nil {
+			edit(c)
+		}
+	})
+	errs := make(chan error, 4)
+	s.SetOnError(func(err error) { errs <- err })
+	return s, errs
+}
+
+func TestCooldownCoalescesBurst(t *testing.T) {
+	ctrl := &fakeController{input: ddc.InputSourceDP1}
+	s, errs := newCooldownSwitcher(t, ctrl, nil)
+
+	if err := s.SwitchLocalOnly("A"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"B", "A", "B"} {
+		if err := s.SwitchLocalOnly(name); !errors.Is(err, ErrQueued) {
+			t.Fatalf("switch to %s during the cooldown: %v, want ErrQueued", name, err)
+		}
+	}
+
+	want := []ddc.InputSource{ddc.InputSourceDP1, ddc.InputSourceHDMI1}
+	waitFor(t, func() bool { w, _ := ctrl.snapshot(); return len(w) == len(want) }, "the queued switch")
+	time.Sleep(2 * testCooldown) // time for a second queued run, if there were one
+	if writes, _ := ctrl.snapshot(); !slices.Equal(writes, want) {
+		t.Errorf("writes = %v, want %v", writes, want)
+	}
+	if cur := s.GetCurrentProfile(); cur != "B" {
+		t.Errorf("current profile %q, want B", cur)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("unexpected error %v", err)
+	default:
+	}
+}
+
+func TestCooldownReportsQueuedFailure(t *testing.T) {
+	ctrl := &fakeController{input: ddc.InputSourceDP1}
+	s, errs := newCooldownSwitcher(t, ctrl, nil)
+
+	if err := s.SwitchLocalOnly("A"); err != nil {
+		t.Fatal(err)
+	}
+	ctrl.mu.Lock()
+	ctrl.err = fmt.Errorf("monitor m1: %w", ddc.ErrDDCNotSupported)
+	ctrl.mu.Unlock()
+	if err := s.SwitchLocalOnly("B"); !errors.Is(err, ErrQueued) {
+		t.Fatalf("switch during the cooldown: %v, want ErrQueued", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ddc.ErrDDCNotSupported) {
+			t.Errorf("onError got %v, want the write error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onError not called for the failed queued switch")
+	}
+}
+
+// A queued switch checks again that the profile's agents are reachable
+func TestCooldownReportsUnreachableAgent(t *testing.T) {
+	ctrl := &fakeController{input: ddc.InputSourceDP1}
+	s, errs := newCooldownSwitcher(t, ctrl, func(c *config.Config) { c.General.CheckAgentsBeforeSwitch = true })
+
+	if err := s.SwitchToProfile("A"); err != nil {
+		t.Fatal(err)
+	}
+	s.configMgr.AgentConnected(config.KnownAgent{Name: "laptop", Profile: "B"})
+	if err := s.SwitchToProfile("B"); !errors.Is(err, ErrQueued) {
+		t.Fatalf("switch during the cooldown: %v, want ErrQueued", err)
+	}
+	s.configMgr.AgentDisconnected("laptop")
+
+	select {
+	case err := <-errs:
+		var unreachable *AgentUnreachableError
+		if !errors.As(err, &unreachable) || unreachable.Profile != "B" || !slices.Equal(unreachable.Agents, []string{"laptop"}) {
+			t.Errorf("onError got %v, want laptop unreachable for B", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onError not called for the held queued switch")
+	}
+	if writes, _ := ctrl.snapshot(); len(writes) != 1 {
+		t.Errorf("writes = %v, want only the switch to A", writes)
+	}
+}
@@ -0,0 +1,66 @@
+package switcher
+
+import (
+	"errors"
+	"time"
+
+	"vkvm/internal/ddc"
+	"vkvm/internal/logging"
+)
+
+const (
+	// wakeReadyTimeout bounds how long a monitor that failed a write is given
+	// to wake up and answer DDC reads again
+	wakeReadyTimeout = 8 * time.Second
+
+	// wakePollInterval is the delay between two readiness reads
+	wakePollInterval = 500 * time.Millisecond
+)
+
+// setInput switches one monitor. A monitor coming out of sleep often drops
+// the first DDC command: if the write fails, the monitor's input is polled
+// until it answers and the write is sent once more.
+func (s *Switcher) setInput(gen uint64, monitorID string, input ddc.InputSource) error {
+	err := s.controller.SetInputSource(monitorID, input)
+	if err == nil || !retryAfterWake(err) {
+		return err
+	}
+
+	logging.Infof("Switcher: Monitor %s did not accept the switch (%v), waiting for it to wake", monitorID, err)
+	ready := s.awaitMonitor(gen, monitorID)
+	if s.superseded(gen) {
+		return nil // the newer switch writes this monitor itself
+	}
+	if !ready {
+		logging.Warnf("Switcher: Monitor %s still not answering after %v", monitorID, wakeReadyTimeout)
+		return err
+	}
+	if err := s.controller.SetInputSource(monitorID, input); err != nil {
+		return err
+	}
+	logging.Infof("Switcher: Monitor %s switched after waking up", monitorID)
+	return nil
+}
+
+// awaitMonitor polls monitorID's input until a read succeeds, the timeout
+// expires or a newer switch supersedes gen. It reports whether the monitor
+// answered.
+func (s *Switcher) awaitMonitor(gen uint64, monitorID string) bool {
+	deadline := time.Now().Add(wakeReadyTimeout)
+	for time.Now().Before(deadline) && !s.superseded(gen) {
+		time.Sleep(wakePollInterval)
+		if _, err := s.controller.GetCurrentInput(monitorID); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfterWake reports whether a failed write may succeed once the monitor
+// is awake; missing monitors, tools or DDC support won't change by waiting
+func retryAfterWake(err error) bool {
+	return !errors.Is(err, ddc.ErrMonitorNotFound) &&
+		!errors.Is(err, ddc.ErrToolNotFound) &&
+		!errors.Is(err, ddc.ErrDDCNotSupported) &&
+		!errors.Is(err, ddc.ErrUnsupportedPlatform)
+}
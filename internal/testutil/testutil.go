@@ -0,0 +1,54 @@
+// Package testutil holds the fixtures that the tests of several packages
+// share. It is only imported from _test.go files.
+package testutil
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"vkvm/internal/config"
+)
+
+// NewConfig returns a config manager whose files live in a fresh temporary
+// home directory
+func NewConfig(t *testing.T) *config.Manager {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+	m, err := config.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// FakeDDCTool puts a ddcutil that sees no monitors first on PATH, so a
+// switcher can be created on Linux machines without the real tool
+func FakeDDCTool(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		return
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ddcutil"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// Do sends a request with body and header (both may be nil) through h and
+// returns the recorded response
+func Do(h http.Handler, method, path string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	for k := range header {
+		req.Header.Set(k, header.Get(k))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
@@ -10,6 +10,7 @@ type MenuItem struct {
 	ID       int
 	Title    string
 	Callback func()
+	checked  bool
 	item     *systray.MenuItem
 }
 
@@ -62,9 +63,10 @@ func (t *Tray) AddSeparator() {
 	t.items = append(t.items, nil) // nil indicates separator
 }
 
-// SetItemChecked sets the checked state of a menu item
+// SetItemChecked sets the checked state of a menu item; before Run it sets the initial state
 func (t *Tray) SetItemChecked(id int, checked bool) {
 	if id >= 0 && id < len(t.items) && t.items[id] != nil {
+		t.items[id].checked = checked
 		if t.items[id].item != nil {
 			if checked {
 				t.items[id].item.Check()
@@ -95,6 +97,9 @@ func (t *Tray) setupMenu() {
 		} else {
 			item := systray.AddMenuItem(menuItem.Title, "")
 			menuItem.item = item
+			if menuItem.checked {
+				item.Check()
+			}
 
 			// Handle clicks in goroutine
 			if menuItem.Callback != nil {
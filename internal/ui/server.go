@@ -4,20 +4,27 @@ package ui
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os/exec"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
+	"vkvm/internal/api"
 	"vkvm/internal/config"
 	"vkvm/internal/ddc"
+	"vkvm/internal/hotkey"
+	"vkvm/internal/logging"
 	"vkvm/internal/network"
 	"vkvm/internal/osutils"
+	"vkvm/internal/protocol"
 	"vkvm/internal/switcher"
 )
 
@@ -25,9 +32,18 @@ import (
 type Server struct {
 	configMgr *config.Manager
 	switcher  *switcher.Switcher
+	hotkeyMgr *hotkey.Manager
+	restart   *RestartControl
 	listener  net.Listener
 }
 
+// RestartControl lets the UI offer a restart when settings the service was
+// set up with (such as the role) have changed
+type RestartControl struct {
+	Pending func() []string // settings that changed since the service started
+	Restart func()
+}
+
 // NewServer creates a new UI server
 func NewServer(cfgMgr *config.Manager, sw *switcher.Switcher) *Server {
 	return &Server{
@@ -36,20 +52,19 @@ func NewServer(cfgMgr *config.Manager, sw *switcher.Switcher) *Server {
 	}
 }
 
+// SetHotkeyManager lets the UI show hotkey engine health and permission problems
+func (s *Server) SetHotkeyManager(m *hotkey.Manager) {
+	s.hotkeyMgr = m
+}
+
+// SetRestartControl enables the guided restart; without it the UI asks the
+// user to restart vkvm by hand
+func (s *Server) SetRestartControl(rc *RestartControl) {
+	s.restart = rc
+}
+
 // Start starts the UI server and opens the browser
 func (s *Server) Start() error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.handleIndex)
-	mux.HandleFunc("/api/monitors", s.handleMonitors)
-	mux.HandleFunc("/api/config", s.handleConfig)
-	mux.HandleFunc("/api/switch", s.handleSwitch)
-	mux.HandleFunc("/api/test", s.handleTest)
-	mux.HandleFunc("/api/discover", s.handleUIDiscover)
-	mux.HandleFunc("/api/test-remote", s.handleTestRemote)
-	mux.HandleFunc("/api/sync-to", s.handleSyncTo)
-	mux.HandleFunc("/api/sleep-display", s.handleSleepDisplay)
-	mux.HandleFunc("/api/connection-status", s.handleConnectionStatus)
-
 	// Find an available port
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -60,12 +75,47 @@ func (s *Server) Start() error {
 	port := listener.Addr().(*net.TCPAddr).Port
 	url := fmt.Sprintf("http://127.0.0.1:%d", port)
 
-	log.Printf("Starting UI server at %s", url)
+	logging.Infof("UI: Starting server at %s", url)
 
 	// Open browser
 	go openBrowser(url)
 
-	return http.Serve(listener, mux)
+	return http.Serve(listener, s.routes())
+}
+
+// routes returns the settings page and the endpoints it calls
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/monitors", s.handleMonitors)
+	mux.HandleFunc("/api/reprobe", s.handleReprobe)
+	mux.HandleFunc("/api/config", s.handleConfig)
+	mux.HandleFunc("/api/switch", s.handleSwitch)
+	mux.HandleFunc("/api/test", s.handleTest)
+	mux.HandleFunc("/api/flash", s.handleFlash)
+	mux.HandleFunc("/api/monitor-power", s.handleMonitorPower)
+	mux.HandleFunc("/api/discover", s.handleUIDiscover)
+	mux.HandleFunc("/api/test-remote", s.handleTestRemote)
+	mux.HandleFunc("/api/sync-to", s.handleSyncTo)
+	mux.HandleFunc("/api/adopt", s.handleAdopt)
+	mux.HandleFunc("/api/sleep-display", s.handleSleepDisplay)
+	mux.HandleFunc("/api/connection-status", s.handleConnectionStatus)
+	mux.HandleFunc("/api/hotkey-status", s.handleHotkeyStatus)
+	mux.HandleFunc("/api/known-agents", s.handleKnownAgents)
+	mux.HandleFunc("/api/wake-agent", s.handleWakeAgent)
+	mux.HandleFunc("/api/forget-agent", s.handleForgetAgent)
+	mux.HandleFunc("/api/send-file", s.handleSendFile)
+	mux.HandleFunc("/api/pending-pairings", s.handlePendingPairings)
+	mux.HandleFunc("/api/revoke-agent", s.handleRevokeAgent)
+	mux.HandleFunc("/api/pair-start", s.handlePairStart)
+	mux.HandleFunc("/api/pair-finish", s.handlePairFinish)
+	mux.HandleFunc("/api/restart", s.handleRestart)
+	return mux
+}
+
+// ownHost reports whether r was addressed to 127.0.0.1:<port> of this server
+func (s *Server) ownHost(r *http.Request) bool {
+	return s.listener != nil && r.Host == s.listener.Addr().String()
 }
 
 // Stop stops the UI server
@@ -87,7 +137,7 @@ func openBrowser(url string) {
 		err = exec.Command("xdg-open", url).Start()
 	}
 	if err != nil {
-		log.Printf("Failed to open browser: %v", err)
+		logging.Warnf("UI: Failed to open browser: %v", err)
 	}
 }
 
@@ -112,6 +162,26 @@ func (s *Server) handleMonitors(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(monitors)
 }
 
+// handleReprobe probes every monitor for DDC/CI support again and returns
+// the fresh monitor list
+func (s *Server) handleReprobe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	monitors, err := s.switcher.ReprobeMonitors()
+	if monitors == nil {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		monitors = []ddc.Monitor{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(monitors)
+}
+
 func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -124,6 +194,19 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		paths := ddc.ToolPaths{
+			ControlMyMonitor: cfg.General.ControlMyMonitorPath,
+			M1DDC:            cfg.General.M1DDCPath,
+			DDCUtil:          cfg.General.DDCUtilPath,
+		}
+		if err := paths.Validate(); err != nil {
+			http.Error(w, "Invalid DDC tool path: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := cfg.Validate(); err != nil {
+			http.Error(w, strings.ReplaceAll(err.Error(), "\n", "; "), http.StatusUnprocessableEntity)
+			return
+		}
 		s.configMgr.Set(&cfg)
 		if err := s.configMgr.Save(); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -142,8 +225,27 @@ func (s *Server) handleSwitch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := s.switcher.SwitchToProfile(profileName); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var err error
+	if r.URL.Query().Get("video_only") == "true" {
+		err = s.switcher.SwitchVideoOnly(profileName)
+	} else {
+		err = s.switcher.SwitchToProfile(profileName)
+	}
+	if errors.Is(err, switcher.ErrQueued) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "queued",
+			"profile": profileName,
+		})
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, switcher.ErrAgentUnreachable) {
+			status = http.StatusFailedDependency
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -154,6 +256,11 @@ func (s *Server) handleSwitch(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// testReadBackDelay gives a monitor time to lock onto a test input before it
+// is read back
+const testReadBackDelay = time.Second
+
+// handleTest switches one monitor and reports the input it shows afterwards
 func (s *Server) handleTest(w http.ResponseWriter, r *http.Request) {
 	monitorID := r.URL.Query().Get("monitor")
 	inputStr := r.URL.Query().Get("input")
@@ -164,27 +271,112 @@ func (s *Server) handleTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logging.Infof("UI: Testing input %d on monitor %s", input, monitorID)
 	if err := s.switcher.TestMonitor(monitorID, ddc.InputSource(input)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	result := map[string]interface{}{"status": "ok", "requested": input}
+	time.Sleep(testReadBackDelay)
+	if actual, err := s.switcher.ReadInput(monitorID); err != nil {
+		result["read_error"] = err.Error()
+	} else {
+		result["actual"] = int(actual)
+		result["confirmed"] = int(actual) == input
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleMonitorPower puts one monitor to sleep or wakes it (state=off|on)
+func (s *Server) handleMonitorPower(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	monitorID := r.URL.Query().Get("monitor")
+	state := r.URL.Query().Get("state")
+	if monitorID == "" || (state != "on" && state != "off") {
+		http.Error(w, "Missing monitor or state parameter", http.StatusBadRequest)
+		return
+	}
+
+	logging.Infof("UI: Turning monitor %s %s", monitorID, state)
+	if err := s.switcher.SetMonitorPower(monitorID, state == "on"); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleFlash blinks a monitor so the user can tell which panel an ID refers to
+func (s *Server) handleFlash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	monitorID := r.URL.Query().Get("monitor")
+	if monitorID == "" {
+		http.Error(w, "Missing monitor parameter", http.StatusBadRequest)
+		return
+	}
+
+	logging.Infof("UI: Flashing monitor %s", monitorID)
+	if err := s.switcher.FlashMonitor(monitorID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
 func (s *Server) handleUIDiscover(w http.ResponseWriter, r *http.Request) {
 	cfg := s.configMgr.Get()
-	hosts, err := network.ScanLAN(cfg.General.APIPort)
+	if r.URL.Query().Get("stream") == "true" {
+		s.streamDiscover(w, r, cfg.General.APIPort, cfg.General.PeerTLS())
+		return
+	}
+
+	hosts, err := network.ScanLANContext(r.Context(), cfg.General.APIPort, cfg.General.PeerTLS(), nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	network.ApplyMachines(hosts, s.configMgr)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(hosts)
 }
 
+// streamDiscover sends each host as one JSON line as soon as it answers.
+// Closing the settings page cancels the request and with it the scan.
+func (s *Server) streamDiscover(w http.ResponseWriter, r *http.Request, port int, useTLS bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	hosts, err := network.ScanLANContext(r.Context(), port, useTLS, func(h network.DiscoveredHost) {
+		found := []network.DiscoveredHost{h}
+		network.ApplyMachines(found, s.configMgr)
+		enc.Encode(found[0])
+		flusher.Flush()
+	})
+	if err != nil {
+		logging.Warnf("UI: LAN scan stopped: %v", err)
+		return
+	}
+	logging.Infof("UI: Found %d VKVM instance(s) on LAN", len(hosts))
+}
+
 // handleTestRemote tests connectivity to a remote VKVM instance
 func (s *Server) handleTestRemote(w http.ResponseWriter, r *http.Request) {
 	addr := r.URL.Query().Get("addr")
@@ -193,15 +385,16 @@ func (s *Server) handleTestRemote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("UI: Testing remote host %s", addr)
-
-	client := &http.Client{
-		Timeout: 2 * time.Second,
+	pin := ""
+	if mc := s.configMgr.FindMachine(addr); mc != nil {
+		addr, pin = mc.Address, mc.CertSHA256
 	}
+	logging.Infof("UI: Testing remote host %s", s.configMgr.MachineLabel(addr))
 
-	resp, err := client.Get("http://" + addr + "/health")
+	client, scheme := network.PeerClient(s.configMgr.Get().General.PeerTLS(), pin, 2*time.Second)
+	resp, err := client.Get(scheme + "://" + addr + "/health")
 	if err != nil {
-		log.Printf("UI: Test failed: %v", err)
+		logging.Errorf("UI: Test failed: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -216,11 +409,174 @@ func (s *Server) handleTestRemote(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "OK")
 }
 
+// handleKnownAgents lists the agents that have connected to this Host,
+// including offline ones
+func (s *Server) handleKnownAgents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.configMgr.KnownAgents())
+}
+
+// handleWakeAgent sends a Wake-on-LAN packet to a known agent
+func (s *Server) handleWakeAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.switcher.WakeAgent(r.URL.Query().Get("name")); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "OK")
+}
+
+// handleForgetAgent removes an agent from the list of known agents
+func (s *Server) handleForgetAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if err := s.configMgr.ForgetAgent(name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logging.Infof("UI: Forgot agent '%s'", name)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "OK")
+}
+
+// handleSendFile sends the request body as a file: an agent sends it to the
+// Host, the Host sends it to the agent named by ?to= through its Remote API
+// (which holds the WebSocket connections)
+func (s *Server) handleSendFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "Missing name", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, protocol.MaxFileSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	cfg := s.configMgr.Get()
+	if cfg.General.Role == "agent" {
+		logging.Infof("UI: Sending '%s' (%d bytes) to the Host", name, len(data))
+		path, err := s.switcher.SendFileToHost(name, data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"path": path})
+		return
+	}
+
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		http.Error(w, "Missing to", http.StatusBadRequest)
+		return
+	}
+	logging.Infof("UI: Sending '%s' (%d bytes) to agent '%s'", name, len(data), to)
+	s.forwardToLocalAPI(w, "POST", fmt.Sprintf("/api/v1/agents/%s/files?name=%s", url.PathEscape(to), url.QueryEscape(name)), bytes.NewReader(data))
+}
+
+// forwardToLocalAPI relays a request to this machine's Remote API, which
+// holds the agents' WebSocket connections, and copies its answer to w
+func (s *Server) forwardToLocalAPI(w http.ResponseWriter, method, path string, body io.Reader) {
+	cfg := s.configMgr.Get()
+	req, err := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", cfg.General.APIPort, path), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+	if cfg.General.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.General.APIToken)
+	}
+
+	client := &http.Client{Timeout: remoteChangeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		http.Error(w, "Remote API unreachable, is the service running with the API enabled? "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		http.Error(w, strings.TrimSpace(string(answer)), resp.StatusCode)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(answer)
+}
+
+// handlePendingPairings lists the agents waiting to pair with this Host and
+// the PINs to enter on them
+func (s *Server) handlePendingPairings(w http.ResponseWriter, r *http.Request) {
+	// The PINs must not be readable by a page that rebinds its own name to
+	// 127.0.0.1, so only requests naming this listener are answered
+	if !s.ownHost(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.configMgr.PendingPairings())
+}
+
+// handleRevokeAgent revokes a paired agent's token. The Remote API does it so
+// the agent's connection is dropped as well.
+func (s *Server) handleRevokeAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	logging.Infof("UI: Revoking the pairing of agent '%s'", name)
+	s.forwardToLocalAPI(w, "DELETE", "/api/v1/agents/"+url.PathEscape(name)+"/pairing", nil)
+}
+
+// handlePairStart asks the Host to pair with this agent
+func (s *Server) handlePairStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := s.switcher.RequestPairing()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": id})
+}
+
+// handlePairFinish submits the PIN shown on the Host
+func (s *Server) handlePairFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.switcher.CompletePairing(r.URL.Query().Get("id"), r.URL.Query().Get("pin")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "OK")
+}
+
 // handleSleepDisplay turns off the display
 func (s *Server) handleSleepDisplay(w http.ResponseWriter, r *http.Request) {
-	log.Printf("UI: Requested display sleep")
+	logging.Infof("UI: Requested display sleep")
 	if err := osutils.TurnOffDisplay(); err != nil {
-		log.Printf("Display sleep failed: %v", err)
+		logging.Errorf("UI: Display sleep failed: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -236,7 +592,15 @@ func (s *Server) handleSyncTo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("UI: Syncing local config to %s", addr)
+	// Registered machines can be addressed by name and supply their token
+	token, pin := r.URL.Query().Get("token"), ""
+	if mc := s.configMgr.FindMachine(addr); mc != nil {
+		addr, pin = mc.Address, mc.CertSHA256
+		if token == "" {
+			token = mc.Token
+		}
+	}
+	logging.Infof("UI: Syncing local config to %s", s.configMgr.MachineLabel(addr))
 
 	cfg := s.configMgr.Get()
 	data, err := json.Marshal(cfg)
@@ -246,8 +610,8 @@ func (s *Server) handleSyncTo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create request to target machine's Remote API
-	token := r.URL.Query().Get("token")
-	targetURL := fmt.Sprintf("http://%s/api/config", addr)
+	client, scheme := network.PeerClient(cfg.General.PeerTLS(), pin, remoteChangeTimeout)
+	targetURL := fmt.Sprintf("%s://%s/api/config", scheme, addr)
 
 	req, err := http.NewRequest("POST", targetURL, bytes.NewBuffer(data))
 	if err != nil {
@@ -255,34 +619,184 @@ func (s *Server) handleSyncTo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
 	if token != "" {
 		req.Header.Set("Authorization", "Bearer "+token)
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("UI: Sync failed: %v", err)
+		logging.Errorf("UI: Sync failed: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode == http.StatusUpgradeRequired {
+		http.Error(w, fmt.Sprintf("Target runs an incompatible VKVM version (protocol %s, local %d)", resp.Header.Get(protocol.VersionHeader), protocol.Version), http.StatusConflict)
+		return
+	}
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusServiceUnavailable {
+		// Declined or unconfirmed on the target
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		http.Error(w, strings.TrimSpace(string(body)), resp.StatusCode)
+		return
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
 		http.Error(w, fmt.Sprintf("Target returned status %d", resp.StatusCode), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprint(w, "OK")
+	// Older versions answer {"status":"ok"} only
+	var result api.SyncResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Status == "" {
+		result.Status = "ok"
+	}
+	if result.Status == "rejected" {
+		logging.Warnf("UI: %s rejected the config: %v", s.configMgr.MachineLabel(addr), result.Errors)
+	} else {
+		logging.Infof("UI: Synced config to %s (changed: %v)", s.configMgr.MachineLabel(addr), result.Applied)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	json.NewEncoder(w).Encode(result)
+}
+
+// remoteChangeTimeout covers the confirmation prompt the target may show
+// before accepting a config push or adoption (60s) plus slack
+const remoteChangeTimeout = 75 * time.Second
+
+// handleAdopt asks the instance at addr to become an agent of this machine.
+// The target shows a confirmation prompt, so the request can take a while.
+func (s *Server) handleAdopt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	addr := r.URL.Query().Get("addr")
+	if addr == "" {
+		http.Error(w, "Missing addr", http.StatusBadRequest)
+		return
+	}
+
+	cfg := s.configMgr.Get()
+	if cfg.General.Role == "agent" {
+		http.Error(w, "This machine is an agent itself; adopt machines from the Host", http.StatusBadRequest)
+		return
+	}
+	if !cfg.General.APIEnabled {
+		http.Error(w, "Enable the API server on this machine first, agents connect to it", http.StatusBadRequest)
+		return
+	}
+
+	token, pin := r.URL.Query().Get("token"), ""
+	if mc := s.configMgr.FindMachine(addr); mc != nil {
+		addr, pin = mc.Address, mc.CertSHA256
+		if token == "" {
+			token = mc.Token
+		}
+	}
+
+	data, err := json.Marshal(api.AdoptRequest{
+		HostID:       network.MachineID(),
+		HostPort:     cfg.General.APIPort,
+		Token:        cfg.General.APIToken,
+		AgentProfile: r.URL.Query().Get("profile"),
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode request", http.StatusInternalServerError)
+		return
+	}
+
+	client, scheme := network.PeerClient(cfg.General.PeerTLS(), pin, remoteChangeTimeout)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s://%s/api/adopt", scheme, addr), bytes.NewBuffer(data))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(protocol.VersionHeader, strconv.Itoa(protocol.Version))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	logging.Infof("UI: Asking %s to become an agent of this machine", s.configMgr.MachineLabel(addr))
+	resp, err := client.Do(req)
+	if err != nil {
+		logging.Errorf("UI: Adoption failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		http.Error(w, "Target runs a VKVM version without adoption support", http.StatusConflict)
+		return
+	case http.StatusUpgradeRequired:
+		http.Error(w, fmt.Sprintf("Target runs an incompatible VKVM version (protocol %s, local %d)", resp.Header.Get(protocol.VersionHeader), protocol.Version), http.StatusConflict)
+		return
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		http.Error(w, strings.TrimSpace(string(body)), resp.StatusCode)
+		return
+	}
+
+	logging.Infof("UI: %s is now an agent of this machine", s.configMgr.MachineLabel(addr))
+	w.Header().Set("Content-Type", "application/json")
+	io.Copy(w, resp.Body)
+}
+
+// handleRestart reports (GET) or applies (POST) settings that only take
+// effect after the service restarts
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		status := map[string]interface{}{"supported": s.restart != nil, "pending": []string{}}
+		if s.restart != nil {
+			status["pending"] = s.restart.Pending()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+
+	case "POST":
+		if s.restart == nil {
+			http.Error(w, "The settings UI runs without the service, restart vkvm by hand", http.StatusNotImplemented)
+			return
+		}
+		// Never restart into a role the service can't run in
+		cfg := s.configMgr.Get()
+		if err := cfg.Validate(); err != nil {
+			http.Error(w, "Fix the settings first: "+strings.ReplaceAll(err.Error(), "\n", "; "), http.StatusUnprocessableEntity)
+			return
+		}
+
+		logging.Infof("UI: Restarting the service to apply %v", s.restart.Pending())
+		w.WriteHeader(http.StatusAccepted)
+		// Let the response reach the browser before the server goes away
+		time.AfterFunc(500*time.Millisecond, s.restart.Restart)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
 func (s *Server) handleConnectionStatus(w http.ResponseWriter, r *http.Request) {
-	connected := s.switcher.IsConnectedToCheck()
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{
-		"connected": connected,
-	})
+	json.NewEncoder(w).Encode(s.switcher.ConnectionStatus())
+}
+
+// handleHotkeyStatus reports whether global hotkeys are working.
+// "available" is false when the UI runs standalone without the service.
+func (s *Server) handleHotkeyStatus(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{"available": s.hotkeyMgr != nil}
+	if s.hotkeyMgr != nil {
+		resp["status"] = s.hotkeyMgr.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
@@ -444,6 +958,8 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
     <div class="container">
         <h1>⌨️ VKVM Settings</h1>
 
+        <div id="hotkey-warning" style="display: none; background: rgba(239,68,68,0.15); border: 1px solid rgba(239,68,68,0.3); border-radius: 12px; padding: 1rem; margin-bottom: 1.5rem; color: #fca5a5; font-size: 0.875rem;"></div>
+
         <div class="card">
             <h2>General Settings</h2>
             <div class="input-grid" style="display: grid; grid-template-columns: 1fr 1fr; gap: 1rem; margin-bottom: 0.75rem;">
@@ -454,6 +970,9 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                 <div class="input-group">
                     <label>API Port:</label>
                     <input type="text" id="api-port" onchange="updateGeneralConfig()" placeholder="18080">
+                    <label style="cursor: pointer;"><input type="checkbox" id="api-tls" onchange="updateGeneralConfig()"> Serve HTTPS/WSS (self-signed certificate)</label>
+                    <label style="cursor: pointer;"><input type="checkbox" id="api-require-tls" onchange="updateGeneralConfig()"> Refuse plaintext from other machines</label>
+                    <label style="cursor: pointer;"><input type="checkbox" id="require-pairing" onchange="updateGeneralConfig()"> Only accept paired agents</label>
                 </div>
             </div>
             <div class="input-grid" style="display: grid; grid-template-columns: 1fr 1fr; gap: 1rem;">
@@ -481,6 +1000,94 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                         <button class="btn btn-small" style="background: #ef4444;" onclick="startRecording('sleep')">🔴 Record</button>
                     </div>
                 </div>
+                <div class="input-group">
+                    <label>Brightness Up Hotkey (all monitors):</label>
+                    <div style="display: flex; gap: 0.5rem;">
+                        <input type="text" id="brightness-up-hotkey" onchange="updateGeneralConfig()" placeholder="Ctrl+Alt+Up" style="flex: 1;">
+                        <button class="btn btn-small" style="background: #ef4444;" onclick="startRecording('brightness-up')">🔴 Record</button>
+                    </div>
+                </div>
+                <div class="input-group">
+                    <label>Brightness Down Hotkey (all monitors):</label>
+                    <div style="display: flex; gap: 0.5rem;">
+                        <input type="text" id="brightness-down-hotkey" onchange="updateGeneralConfig()" placeholder="Ctrl+Alt+Down" style="flex: 1;">
+                        <button class="btn btn-small" style="background: #ef4444;" onclick="startRecording('brightness-down')">🔴 Record</button>
+                    </div>
+                </div>
+                <div class="input-group">
+                    <label>Brightness Step (%):</label>
+                    <input type="text" id="brightness-step" onchange="updateGeneralConfig()" placeholder="10">
+                </div>
+                <div class="input-group">
+                    <label>Hotkey Debounce (ms):</label>
+                    <input type="text" id="hotkey-debounce" onchange="updateGeneralConfig()" placeholder="500">
+                </div>
+                <div class="input-group" style="flex-direction: column; align-items: flex-start; gap: 0.25rem;">
+                    <label style="cursor: pointer;"><input type="checkbox" id="hotkey-exact-match" onchange="updateGeneralConfig()"> Exact match (ignore combos with extra keys held)</label>
+                    <label style="cursor: pointer;"><input type="checkbox" id="hotkey-on-release" onchange="updateGeneralConfig()"> Trigger on release</label>
+                    <label style="cursor: pointer;"><input type="checkbox" id="swallow-hotkeys" onchange="updateGeneralConfig()"> Hide profile hotkeys from other apps (Windows)</label>
+                </div>
+                <div class="input-group" style="grid-column: 1 / -1;">
+                    <label>DDC Tool Paths (leave empty to auto-detect, restart to apply):</label>
+                    <input type="text" id="control-my-monitor-path" onchange="updateGeneralConfig()" placeholder="ControlMyMonitor.exe (Windows)">
+                    <input type="text" id="m1ddc-path" onchange="updateGeneralConfig()" placeholder="m1ddc (macOS)" style="margin-top: 0.25rem;">
+                    <input type="text" id="ddcutil-path" onchange="updateGeneralConfig()" placeholder="ddcutil (Linux)" style="margin-top: 0.25rem;">
+                </div>
+                <div class="input-group">
+                    <label>DDC Command Timeout (ms):</label>
+                    <input type="text" id="ddc-command-timeout" onchange="updateGeneralConfig()" placeholder="3000">
+                </div>
+                <div class="input-group">
+                    <label>Min. Interval Between Input Switches per Monitor (ms):</label>
+                    <input type="text" id="input-write-interval" onchange="updateGeneralConfig()" placeholder="500">
+                </div>
+                <div class="input-group">
+                    <label>Switch Cooldown (ms, rapid requests are merged):</label>
+                    <input type="text" id="switch-cooldown" onchange="updateGeneralConfig()" placeholder="0">
+                </div>
+                <div class="input-group">
+                    <label>Startup Delay (seconds):</label>
+                    <input type="text" id="startup-delay" onchange="updateGeneralConfig()" placeholder="0">
+                </div>
+                <div class="input-group">
+                    <label>Idle After (seconds without input, slows background checks; -1: never):</label>
+                    <input type="text" id="idle-threshold" onchange="updateGeneralConfig()" placeholder="300">
+                </div>
+                <div class="input-group">
+                    <label>Battery Saver (slower polling, no automatic LAN scans):</label>
+                    <select id="battery-saver" onchange="updateGeneralConfig()">
+                        <option value="auto">While on battery</option>
+                        <option value="always">Always</option>
+                        <option value="never">Never</option>
+                    </select>
+                </div>
+                <div class="input-group">
+                    <label style="cursor: pointer;"><input type="checkbox" id="confirm-switch" onchange="updateGeneralConfig()"> Confirm switches (read inputs back, retry once)</label>
+                </div>
+                <div class="input-group">
+                    <label style="cursor: pointer;"><input type="checkbox" id="check-agents-before-switch" onchange="updateGeneralConfig()"> Check that the profile's agent is reachable before switching</label>
+                </div>
+                <div class="input-group">
+                    <label style="cursor: pointer;"><input type="checkbox" id="receive-files" onchange="updateGeneralConfig()"> Accept files from other machines</label>
+                    <input type="text" id="receive-dir" placeholder="Save to (default: Downloads)" onchange="updateGeneralConfig()" style="margin-top: 0.5rem;">
+                </div>
+                <div class="input-group">
+                    <label>Log Level (logs folder next to config.json):</label>
+                    <select id="log-level" onchange="updateGeneralConfig()">
+                        <option value="debug">Debug</option>
+                        <option value="info">Info</option>
+                        <option value="warn">Warnings</option>
+                        <option value="error">Errors</option>
+                    </select>
+                    <label style="cursor: pointer;"><input type="checkbox" id="log-json" onchange="updateGeneralConfig()"> Write the log as JSON lines</label>
+                </div>
+                <div class="input-group">
+                    <label>Rotate Log at (MB) / Keep Rotated Files:</label>
+                    <div style="display: flex; gap: 0.5rem;">
+                        <input type="text" id="log-max-size" onchange="updateGeneralConfig()" placeholder="10">
+                        <input type="text" id="log-max-files" onchange="updateGeneralConfig()" placeholder="3">
+                    </div>
+                </div>
                 <div class="input-group">
                      <label>Power control:</label>
                      <button class="btn btn-small btn-warning" onclick="sleepDisplay()">💤 Sleep Displays</button>
@@ -494,15 +1101,21 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                         <option value="host">Host (Master - Controls Others)</option>
                         <option value="agent">Agent (Slave - Follows Host)</option>
                     </select>
+                    <label style="cursor: pointer;"><input type="checkbox" id="managed" onchange="updateGeneralConfig()"> Managed (accept config pushes and adoption without asking)</label>
                 </div>
                 <div class="input-group" id="coordinator-group">
-                    <label>Coordinator Address (IP:Port):</label>
+                    <label>Coordinator Address (IP:Port or machine name):</label>
                     <div style="display: flex; gap: 0.5rem; align-items: center;">
                         <input type="text" id="coordinator-addr" onchange="updateGeneralConfig()" placeholder="e.g. 192.168.1.50:18080" style="flex: 1;">
                         <div id="connection-status" style="display: none; padding: 0.5rem 1rem; border-radius: 8px; font-size: 0.875rem; font-weight: 600;">
                             Checking...
                         </div>
                     </div>
+                    <label style="cursor: pointer;"><input type="checkbox" id="coordinator-tls" onchange="updateGeneralConfig()"> Connect over TLS (wss://)</label>
+                    <button class="btn btn-small btn-secondary" onclick="pairWithHost()" style="margin-top: 0.25rem;">🔗 Pair with Host</button>
+                    <input type="text" id="coordinator-cert-sha256" onchange="updateGeneralConfig()" placeholder="Host certificate SHA-256 to pin (optional)" style="margin-top: 0.25rem;">
+                    <input type="text" id="agent-profile" onchange="updateGeneralConfig()" placeholder="This computer's profile (e.g. Mac)" style="margin-top: 0.25rem;">
+                    <label style="cursor: pointer;"><input type="checkbox" id="agent-hotkeys-when-active" onchange="updateGeneralConfig()"> Only arm profile hotkeys while this computer's profile is active</label>
                 </div>
             </div>
             </div>
@@ -525,16 +1138,22 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                 <h2 style="color: #fff; margin-bottom: 1rem;">Recording Hotkey...</h2>
                 <p style="color: #94a3b8; margin-bottom: 2rem;">Press any key combination or mouse button</p>
                 <div id="recorded-display" class="recorded-keys">Press Keys...</div>
+                <label style="display: block; margin-bottom: 1.5rem; color: #94a3b8; font-size: 0.875rem; cursor: pointer;">
+                    <input type="checkbox" id="record-sides"> Distinguish left/right modifiers (e.g. RCtrl+RAlt+1)
+                </label>
                 <div style="display: flex; gap: 1rem; justify-content: center;">
                     <button class="btn btn-secondary" onclick="cancelRecording()">Cancel</button>
                     <button class="btn" style="background: #4f46e5;" onclick="saveRecording()">Done</button>
                 </div>
-                <p style="margin-top: 2rem; font-size: 0.8rem; color: #64748b;">(Supports Ctrl, Alt, Shift, Cmd, and Mouse Side Buttons)</p>
+                <p style="margin-top: 2rem; font-size: 0.8rem; color: #64748b;">(Supports Ctrl, Alt, Shift, Cmd, numpad, punctuation, media keys and Mouse Side Buttons)</p>
             </div>
         </div>
 
         <div class="card">
-            <h2>Detected Monitors</h2>
+            <h2>
+                Detected Monitors
+                <button class="btn btn-small btn-secondary" onclick="reprobeMonitors()" title="DDC/CI support is remembered per monitor; probe all monitors again">🔄 Re-probe</button>
+            </h2>
             <div id="monitors-info"></div>
         </div>
 
@@ -548,6 +1167,22 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             </div>
         </div>
 
+        <div class="card" id="agents-card" style="display: none;">
+            <h2>Agents</h2>
+            <p style="color: #94a3b8; font-size: 0.875rem;">Drop a file on an online agent to send it there.</p>
+            <div id="pairing-list"></div>
+            <div id="agents-list" style="margin-top: 1rem;"></div>
+        </div>
+
+        <div class="card" id="send-to-host-card" style="display: none;">
+            <h2>Send a File to the Host</h2>
+            <div ondragover="event.preventDefault()" ondrop="dropFile(event, '')" style="padding: 1.5rem; border: 2px dashed rgba(255,255,255,0.15); border-radius: 8px; text-align: center; color: #94a3b8;">
+                Drop a file here
+            </div>
+        </div>
+
+        <div id="restart-banner" style="display: none; background: rgba(251,191,36,0.1); border: 1px solid rgba(251,191,36,0.3); border-radius: 8px; padding: 0.75rem; margin-bottom: 1rem; color: #fcd34d; font-size: 0.875rem;"></div>
+
         <button class="btn" onclick="saveConfig()">💾 Save Settings</button>
     </div>
 
@@ -569,11 +1204,55 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                 if (!config.profiles) config.profiles = [];
                 if (!config.monitors) config.monitors = [];
                 renderUI();
+                checkRestart();
             } catch (e) {
                 showStatus('Error loading data: ' + e.message, true);
             }
         }
 
+        async function reprobeMonitors() {
+            showStatus('Probing monitors for DDC/CI support...');
+            try {
+                const res = await fetch('/api/reprobe', { method: 'POST' });
+                if (!res.ok) throw new Error((await res.text()).trim());
+                monitors = await res.json() || [];
+                renderProfiles();
+                renderMonitors();
+                showStatus('Monitors probed again');
+            } catch (e) {
+                showStatus('Re-probe failed: ' + e.message, true);
+            }
+        }
+
+        async function checkRestart() {
+            const banner = document.getElementById('restart-banner');
+            try {
+                const res = await fetch('/api/restart');
+                const status = await res.json();
+                if (!status.pending || status.pending.length === 0) {
+                    banner.style.display = 'none';
+                    return;
+                }
+                const what = status.pending.join(', ');
+                banner.innerHTML = status.supported
+                    ? '⚠️ Changed ' + what + ' take effect after a restart. <button class="btn btn-small" style="margin-left: 0.5rem;" onclick="restartService()">🔄 Restart now</button>'
+                    : '⚠️ Changed ' + what + ' take effect after vkvm is restarted.';
+                banner.style.display = 'block';
+            } catch (e) {
+                banner.style.display = 'none';
+            }
+        }
+
+        async function restartService() {
+            try {
+                const res = await fetch('/api/restart', { method: 'POST' });
+                if (!res.ok) throw new Error((await res.text()).trim() || 'Restart failed');
+                document.getElementById('restart-banner').textContent = '🔄 Restarting... the settings will open again in a new tab.';
+            } catch (e) {
+                showStatus('Restart failed: ' + e.message, true);
+            }
+        }
+
         function renderUI() {
             renderGeneral();
             renderProfiles();
@@ -582,6 +1261,108 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             
             // Start polling status if agent
             setInterval(checkConnectionStatus, 3000);
+
+            checkHotkeyStatus();
+            setInterval(checkHotkeyStatus, 5000);
+
+            loadKnownAgents();
+            setInterval(loadKnownAgents, 10000);
+        }
+
+        // Agents that connected to this Host, kept while they are offline
+        async function loadKnownAgents() {
+            try {
+                const [res, pairRes] = await Promise.all([fetch('/api/known-agents'), fetch('/api/pending-pairings')]);
+                if (!res.ok || !pairRes.ok) return;
+                const agents = await res.json();
+                const pending = await pairRes.json();
+                document.getElementById('agents-card').style.display = agents.length || pending.length ? 'block' : 'none';
+                document.getElementById('pairing-list').innerHTML = pending.map(p => ` + "`" + `
+                    <div style="padding: 0.75rem; background: rgba(99,102,241,0.15); border-radius: 8px; margin-top: 0.5rem;">
+                        🔗 <strong>${p.agent}</strong> (${p.address}) wants to pair. Enter PIN <strong style="font-size: 1.25rem; letter-spacing: 0.2em;">${p.pin}</strong> on it.
+                    </div>
+                ` + "`" + `).join('');
+                document.getElementById('agents-list').innerHTML = agents.map(a => ` + "`" + `
+                    <div ${a.online ? ` + "`" + `ondragover="event.preventDefault()" ondrop="dropFile(event, '${a.name}')"` + "`" + ` : ''} style="display: flex; justify-content: space-between; align-items: center; padding: 0.75rem; background: rgba(255,255,255,0.03); border-radius: 8px; margin-bottom: 0.5rem;">
+                        <div>
+                            <strong>${a.name}</strong> <span style="color: ${a.online ? '#4ade80' : '#94a3b8'};">${a.online ? '● online' : '○ offline'}</span>${a.paired ? ' <span style="color: #a5b4fc;">🔗 paired</span>' : ''}
+                            <div style="font-size: 0.8rem; color: #a5b4fc;">${a.address || ''}${a.profile ? ' · Profile: ' + a.profile : ''}${!a.online && a.last_seen ? ' · last seen ' + new Date(a.last_seen).toLocaleString() : ''}</div>
+                        </div>
+                        <div style="display: flex; gap: 0.5rem; align-items: center;">
+                            ${!a.online && a.mac ? ` + "`" + `<button class="btn btn-small btn-secondary" onclick="agentAction('wake', '${a.name}')">⏻ Wake</button>` + "`" + ` : ''}
+                            ${a.paired ? ` + "`" + `<button class="btn btn-small btn-secondary" onclick="agentAction('revoke', '${a.name}')">Revoke</button>` + "`" + ` : ''}
+                            ${!a.online ? ` + "`" + `<button class="btn btn-small btn-secondary" onclick="agentAction('forget', '${a.name}')">Forget</button>` + "`" + ` : ''}
+                        </div>
+                    </div>
+                ` + "`" + `).join('');
+            } catch (e) {
+                // The list is refreshed on the next poll
+            }
+        }
+
+        async function agentAction(action, name) {
+            try {
+                const res = await fetch('/api/' + action + '-agent?name=' + encodeURIComponent(name), { method: 'POST' });
+                if (!res.ok) throw new Error(await res.text());
+                showStatus({ wake: 'Wake-on-LAN packet sent to ' + name, revoke: 'Revoked the pairing of ' + name }[action] || 'Forgot ' + name);
+                loadKnownAgents();
+            } catch (e) {
+                showStatus('Failed: ' + e.message, true);
+            }
+        }
+
+        // Pairs this agent with its Host: the Host shows a PIN to type in here
+        async function pairWithHost() {
+            try {
+                const res = await fetch('/api/pair-start', { method: 'POST' });
+                if (!res.ok) throw new Error(await res.text());
+                const { id } = await res.json();
+                const pin = prompt('Enter the PIN shown on the Host:');
+                if (!pin) return;
+                const finish = await fetch('/api/pair-finish?id=' + encodeURIComponent(id) + '&pin=' + encodeURIComponent(pin.trim()), { method: 'POST' });
+                if (!finish.ok) throw new Error(await finish.text());
+                const cfgRes = await fetch('/api/config');
+                config.general.agent_token = (await cfgRes.json()).general.agent_token;
+                showStatus('Paired with the Host');
+            } catch (e) {
+                showStatus('Pairing failed: ' + e.message, true);
+            }
+        }
+
+        // Sends dropped files to agent 'to', or to the Host when to is empty
+        async function dropFile(event, to) {
+            event.preventDefault();
+            for (const file of event.dataTransfer.files) {
+                showStatus('Sending ' + file.name + '...');
+                try {
+                    const res = await fetch('/api/send-file?to=' + encodeURIComponent(to) + '&name=' + encodeURIComponent(file.name), { method: 'POST', body: file });
+                    if (!res.ok) throw new Error(await res.text());
+                    const data = await res.json();
+                    showStatus('Sent ' + file.name + (data.path ? ' → ' + data.path : ''));
+                } catch (e) {
+                    showStatus('Failed to send ' + file.name + ': ' + e.message, true);
+                }
+            }
+        }
+
+        async function checkHotkeyStatus() {
+            try {
+                const res = await fetch('/api/hotkey-status');
+                const data = await res.json();
+                const el = document.getElementById('hotkey-warning');
+                if (!data.available || data.status.running) {
+                    el.style.display = 'none';
+                    return;
+                }
+                let msg = '⚠️ <strong>Global hotkeys are not working.</strong> ' + (data.status.error || '');
+                if (data.status.permission_required) {
+                    msg += '<br>Open System Settings → Privacy & Security → Accessibility and enable VKVM. Hotkeys start automatically once permission is granted.';
+                }
+                el.innerHTML = msg;
+                el.style.display = 'block';
+            } catch (e) {
+                // Ignore errors
+            }
         }
 
         async function checkConnectionStatus() {
@@ -596,11 +1377,34 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                 const el = document.getElementById('connection-status');
                 el.style.display = 'block';
                 
-                if (data.connected) {
+                const lastAgo = data.last_message_at ? Math.round((Date.now() - new Date(data.last_message_at).getTime()) / 1000) : null;
+                const details = [
+                    (data.transport || 'ws').toUpperCase(),
+                    data.rtt_ms ? 'RTT ' + data.rtt_ms.toFixed(1) + ' ms' : null,
+                    lastAgo !== null ? 'last msg ' + lastAgo + 's ago' : null,
+                    data.reconnects ? data.reconnects + ' reconnect' + (data.reconnects > 1 ? 's' : '') : null,
+                    data.lost ? 'loss ' + data.loss_pct.toFixed(1) + '% (' + data.lost + ' dropped)' : null
+                ].filter(Boolean).join(' · ');
+                el.title = details;
+
+                // Heartbeats arrive every 10s, so silence past ~25s or a slow RTT means trouble
+                const laggy = data.rtt_ms > 150 || (lastAgo !== null && lastAgo > 25) || data.loss_pct > 1;
+                if (data.connected && laggy) {
+                    el.style.background = 'rgba(234, 179, 8, 0.2)';
+                    el.style.color = '#facc15';
+                    el.style.border = '1px solid rgba(234, 179, 8, 0.3)';
+                    el.innerHTML = '⚠️ Connected (laggy)<div style="font-size: 0.75rem; font-weight: 400;">' + details + '</div>';
+                } else if (data.connected) {
                     el.style.background = 'rgba(16, 185, 129, 0.2)';
                     el.style.color = '#34d399';
                     el.style.border = '1px solid rgba(16, 185, 129, 0.3)';
-                    el.innerHTML = '✅ Connected to Host';
+                    el.innerHTML = '✅ Connected to Host<div style="font-size: 0.75rem; font-weight: 400;">' + details + '</div>';
+                } else if (data.state === 'waiting' && data.failures) {
+                    const retryIn = Math.max(0, Math.round((new Date(data.next_retry_at).getTime() - Date.now()) / 1000));
+                    el.style.background = 'rgba(234, 179, 8, 0.2)';
+                    el.style.color = '#facc15';
+                    el.style.border = '1px solid rgba(234, 179, 8, 0.3)';
+                    el.innerHTML = '⏳ Waiting for Host<div style="font-size: 0.75rem; font-weight: 400;">' + data.failures + ' failed attempt' + (data.failures > 1 ? 's' : '') + ' · retry in ' + retryIn + 's</div>';
                 } else {
                     el.style.background = 'rgba(239, 68, 68, 0.2)';
                     el.style.color = '#f87171';
@@ -615,17 +1419,50 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
         function renderGeneral() {
             document.getElementById('api-enabled').checked = config.general.api_enabled;
             document.getElementById('api-port').value = config.general.api_port || 18080;
+            document.getElementById('api-tls').checked = !!config.general.api_tls;
+            document.getElementById('api-require-tls').checked = !!config.general.api_require_tls;
+            document.getElementById('require-pairing').checked = !!config.general.require_pairing;
             document.getElementById('this-computer-ip').value = config.general.this_computer_ip || '';
             document.getElementById('start-on-boot').checked = config.general.start_on_boot;
             document.getElementById('settings-hotkey').value = config.general.settings_hotkey || 'Ctrl+Alt+S';
             document.getElementById('sleep-hotkey').value = config.general.sleep_hotkey || '';
+            document.getElementById('brightness-up-hotkey').value = config.general.brightness_up_hotkey || '';
+            document.getElementById('brightness-down-hotkey').value = config.general.brightness_down_hotkey || '';
+            document.getElementById('brightness-step').value = config.general.brightness_step || '';
+            document.getElementById('hotkey-debounce').value = config.general.hotkey_debounce_ms || '';
+            document.getElementById('hotkey-exact-match').checked = !!config.general.hotkey_exact_match;
+            document.getElementById('hotkey-on-release').checked = !!config.general.hotkey_on_release;
+            document.getElementById('control-my-monitor-path').value = config.general.control_my_monitor_path || '';
+            document.getElementById('m1ddc-path').value = config.general.m1ddc_path || '';
+            document.getElementById('ddcutil-path').value = config.general.ddcutil_path || '';
+            document.getElementById('ddc-command-timeout').value = config.general.ddc_command_timeout_ms || '';
+            document.getElementById('input-write-interval').value = config.general.input_write_interval_ms || '';
+            document.getElementById('switch-cooldown').value = config.general.switch_cooldown_ms || '';
+            document.getElementById('startup-delay').value = config.general.startup_delay_sec || '';
+            document.getElementById('idle-threshold').value = config.general.idle_threshold_sec || '';
+            document.getElementById('battery-saver').value = config.general.battery_saver || 'auto';
+            document.getElementById('confirm-switch').checked = !!config.general.confirm_switch;
+            document.getElementById('check-agents-before-switch').checked = !!config.general.check_agents_before_switch;
+            document.getElementById('receive-files').checked = !!config.general.receive_files;
+            document.getElementById('receive-dir').value = config.general.receive_dir || '';
+            document.getElementById('log-level').value = config.general.log_level || 'info';
+            document.getElementById('log-json').checked = !!config.general.log_json;
+            document.getElementById('log-max-size').value = config.general.log_max_size_mb || '';
+            document.getElementById('log-max-files').value = config.general.log_max_files || '';
+            document.getElementById('managed').checked = !!config.general.managed;
+            document.getElementById('swallow-hotkeys').checked = !!config.general.swallow_hotkeys;
+            document.getElementById('agent-profile').value = config.general.agent_profile || '';
+            document.getElementById('agent-hotkeys-when-active').checked = !!config.general.agent_hotkeys_when_active;
             document.getElementById('role').value = config.general.role || 'host';
             document.getElementById('coordinator-addr').value = config.general.coordinator_addr || '';
+            document.getElementById('coordinator-tls').checked = !!config.general.coordinator_tls;
+            document.getElementById('coordinator-cert-sha256').value = config.general.coordinator_cert_sha256 || '';
             
             const isAgent = config.general.role === 'agent';
             document.getElementById('coordinator-group').style.visibility = isAgent ? 'visible' : 'hidden';
             document.getElementById('add-profile-btn').style.display = isAgent ? 'none' : 'inline-block';
             document.getElementById('agent-sync-notice').style.display = isAgent ? 'block' : 'none';
+            document.getElementById('send-to-host-card').style.display = isAgent ? 'block' : 'none';
         }
 
         function toggleCoordinatorUI() {
@@ -636,12 +1473,46 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
         function updateGeneralConfig() {
             config.general.api_enabled = document.getElementById('api-enabled').checked;
             config.general.api_port = parseInt(document.getElementById('api-port').value) || 18080;
+            config.general.api_tls = document.getElementById('api-tls').checked;
+            config.general.api_require_tls = document.getElementById('api-require-tls').checked;
+            config.general.require_pairing = document.getElementById('require-pairing').checked;
             config.general.this_computer_ip = document.getElementById('this-computer-ip').value;
             config.general.start_on_boot = document.getElementById('start-on-boot').checked;
             config.general.settings_hotkey = document.getElementById('settings-hotkey').value;
             config.general.sleep_hotkey = document.getElementById('sleep-hotkey').value;
+            config.general.brightness_up_hotkey = document.getElementById('brightness-up-hotkey').value;
+            config.general.brightness_down_hotkey = document.getElementById('brightness-down-hotkey').value;
+            config.general.brightness_step = parseInt(document.getElementById('brightness-step').value) || 0;
+            config.general.hotkey_debounce_ms = parseInt(document.getElementById('hotkey-debounce').value) || 0;
+            config.general.hotkey_exact_match = document.getElementById('hotkey-exact-match').checked;
+            config.general.hotkey_on_release = document.getElementById('hotkey-on-release').checked;
+            config.general.control_my_monitor_path = document.getElementById('control-my-monitor-path').value.trim();
+            config.general.m1ddc_path = document.getElementById('m1ddc-path').value.trim();
+            config.general.ddcutil_path = document.getElementById('ddcutil-path').value.trim();
+            config.general.ddc_command_timeout_ms = parseInt(document.getElementById('ddc-command-timeout').value) || 0;
+            config.general.input_write_interval_ms = parseInt(document.getElementById('input-write-interval').value) || 0;
+            config.general.switch_cooldown_ms = parseInt(document.getElementById('switch-cooldown').value) || 0;
+            config.general.startup_delay_sec = parseInt(document.getElementById('startup-delay').value) || 0;
+            config.general.idle_threshold_sec = parseInt(document.getElementById('idle-threshold').value) || 0;
+            const batterySaver = document.getElementById('battery-saver').value;
+            config.general.battery_saver = batterySaver === 'auto' ? '' : batterySaver;
+            config.general.confirm_switch = document.getElementById('confirm-switch').checked;
+            config.general.check_agents_before_switch = document.getElementById('check-agents-before-switch').checked;
+            config.general.receive_files = document.getElementById('receive-files').checked;
+            config.general.receive_dir = document.getElementById('receive-dir').value.trim();
+            const logLevel = document.getElementById('log-level').value;
+            config.general.log_level = logLevel === 'info' ? '' : logLevel;
+            config.general.log_json = document.getElementById('log-json').checked;
+            config.general.log_max_size_mb = parseInt(document.getElementById('log-max-size').value) || 0;
+            config.general.log_max_files = parseInt(document.getElementById('log-max-files').value) || 0;
+            config.general.managed = document.getElementById('managed').checked;
+            config.general.swallow_hotkeys = document.getElementById('swallow-hotkeys').checked;
+            config.general.agent_profile = document.getElementById('agent-profile').value.trim();
+            config.general.agent_hotkeys_when_active = document.getElementById('agent-hotkeys-when-active').checked;
             config.general.role = document.getElementById('role').value;
             config.general.coordinator_addr = document.getElementById('coordinator-addr').value;
+            config.general.coordinator_tls = document.getElementById('coordinator-tls').checked;
+            config.general.coordinator_cert_sha256 = document.getElementById('coordinator-cert-sha256').value.trim();
         }
 
         function renderProfiles() {
@@ -686,15 +1557,34 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                         </div>
                     </div>
 
-
-
+                    <div style="margin-top: 1rem; padding-top: 1rem; border-top: 1px solid rgba(255,255,255,0.05);">
+                        <div style="font-size: 0.875rem; color: #a5b4fc; margin-bottom: 0.5rem;">Display &amp; Schedule (optional, applied to all monitors)</div>
+                        <div style="display: grid; grid-template-columns: repeat(6, 1fr); gap: 0.5rem;">
+                            <div class="input-group">
+                                <label>Run at:</label>
+                                <input type="time" value="${profile.schedule || ''}" ${isAgent ? 'disabled' : ''} onchange="updateProfileSchedule(${idx}, this.value)">
+                            </div>
+                            ${[['brightness', 'Brightness'], ['color_preset', 'Color preset'], ['red_gain', 'Red'], ['green_gain', 'Green'], ['blue_gain', 'Blue']].map(([field, label]) => ` + "`" + `
+                                <div class="input-group">
+                                    <label>${label}:</label>
+                                    <input type="number" min="0" max="100" placeholder="-" ${isAgent ? 'disabled' : ''}
+                                           value="${(profile.display && profile.display[field] != null) ? profile.display[field] : ''}"
+                                           data-profile-idx="${idx}" data-field="${field}" onchange="updateProfileDisplay(this)">
+                                </div>
+                            ` + "`" + `).join('')}
+                        </div>
+                        <label style="cursor: pointer; display: block; margin-top: 0.5rem; font-size: 0.8rem; color: #94a3b8;">
+                            <input type="checkbox" ${profile.monitor_set ? 'checked' : ''} ${isAgent ? 'disabled' : ''} onchange="updateProfileMonitorSet(${idx}, this.checked)">
+                            Activate when exactly the monitors connected now are connected (e.g. docking)${profile.monitor_set ? ' · ' + profile.monitor_set.length + ' monitor(s)' : ''}
+                        </label>
+                    </div>
 
                     <div style="margin-top: 1rem; padding-top: 1rem; border-top: 1px solid rgba(255,255,255,0.05);">
                         <div style="font-size: 0.875rem; color: #a5b4fc; margin-bottom: 0.5rem;">Monitor Inputs</div>
                         <div class="monitor-inputs">
                             ${monitors.map(m => ` + "`" + `
                                 <div class="input-group">
-                                    <label>${(m.name && m.name.length>0) ? (m.name + (m.device_name ? ' ('+m.device_name+')' : '')) : (m.device_name || m.id)}:</label>
+                                    <label>${monitorLabel(m)}:</label>
                                     <select data-profile-idx="${idx}" data-monitor-id="${m.id}" onchange="updateProfileMonitorInput(this)">
                                         <option value="">-</option>
                                         <option value="15" ${(profile.monitor_inputs && profile.monitor_inputs[m.id]==15)?'selected':''}>DP1</option>
@@ -718,31 +1608,131 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                 return;
             }
             
-            const inputNames = {
-                15: 'DP1', 16: 'DP2', 17: 'HDMI1', 18: 'HDMI2', 27: 'USB-C'
-            };
-            
             container.innerHTML = monitors.map(m => ` + "`" + `
                 <div style="padding: 0.75rem; background: rgba(255,255,255,0.03); border-radius: 8px; margin-bottom: 0.5rem;">
                     <div style="display: flex; justify-content: space-between; align-items: center; margin-bottom: 0.5rem;">
                         <div>
-                            <strong>${(m.name && m.name.length>0) ? m.name : (m.device_name || m.id)}</strong> <span style="color: #94a3b8; font-size: 0.875rem;">${(m.name && m.name.length>0 && m.device_name) ? ' ('+m.device_name+')' : ' (ID: '+m.id+')'}</span>
+                            <strong>${monitorLabel(m)}</strong> <span style="color: #94a3b8; font-size: 0.875rem;"> (ID: ${m.id})</span>
                         </div>
-                        <div style="font-size: 0.875rem;">
+                        <div style="font-size: 0.875rem; display: flex; align-items: center; gap: 0.5rem;">
                             ${m.ddc_supported 
                                 ? '<span style="color: #34d399;">✓ DDC Supported</span>' 
                                 : '<span style="color: #f87171;">✗ DDC Not Supported</span>'}
+                            ${m.ddc_supported ? ` + "`" + `<button class="btn btn-small" data-monitor-id="${m.id}" onclick="flashMonitor(this)">💡 Flash</button>` + "`" + ` : ''}
                         </div>
                     </div>
-                    ${m.input_source ? ` + "`" + `
-                        <div style="font-size: 0.875rem; color: #a5b4fc;">
-                            Current Input: <strong>${inputNames[m.input_source] || 'Unknown (0x' + m.input_source.toString(16) + ')'}</strong>
+                    <div style="font-size: 0.875rem; color: #a5b4fc;">
+                        Current Input: <strong data-input-for="${m.id}">${m.input_source ? inputName(m.input_source) : 'Unknown'}</strong>
+                    </div>
+                    ${m.ddc_supported ? ` + "`" + `
+                        <div style="display: flex; gap: 0.5rem; align-items: center; margin-top: 0.5rem; flex-wrap: wrap;">
+                            <select data-test-input-for="${m.id}" style="width: auto;">
+                                ${Object.entries(inputNames).map(([v, n]) => ` + "`" + `<option value="${v}" ${m.input_source == v ? 'selected' : ''}>${n}</option>` + "`" + `).join('')}
+                            </select>
+                            <button class="btn btn-small btn-secondary" data-monitor-id="${m.id}" onclick="testMonitorInput(this)">🧪 Test switch</button>
+                            <button class="btn btn-small btn-secondary" data-monitor-id="${m.id}" data-state="off" onclick="setMonitorPower(this)">💤 Sleep</button>
+                            <button class="btn btn-small btn-secondary" data-monitor-id="${m.id}" data-state="on" onclick="setMonitorPower(this)">☀️ Wake</button>
                         </div>
                     ` + "`" + ` : ''}
+                    <label style="font-size: 0.8rem; color: #94a3b8; cursor: pointer; display: block; margin-top: 0.25rem;">
+                        <input type="checkbox" data-monitor-id="${m.id}" onchange="toggleDP1Fix(this)" ${hasDP1Fix(m.id) ? 'checked' : ''}>
+                        Reports HDMI1 while on DP1 (read HDMI1 as DP1, save and rescan to apply)
+                    </label>
                 </div>
             ` + "`" + `).join('');
         }
 
+        const inputNames = {
+            15: 'DP1', 16: 'DP2', 17: 'HDMI1', 18: 'HDMI2', 27: 'USB-C'
+        };
+
+        function inputName(value) {
+            return inputNames[value] || 'Unknown (0x' + value.toString(16) + ')';
+        }
+
+        function monitorElement(attr, id) {
+            return [...document.querySelectorAll('[' + attr + ']')].find(el => el.getAttribute(attr) === id);
+        }
+
+        async function testMonitorInput(el) {
+            const id = el.dataset.monitorId;
+            const input = monitorElement('data-test-input-for', id).value;
+            const current = monitorElement('data-input-for', id);
+            el.disabled = true;
+            try {
+                const res = await fetch('/api/test?monitor=' + encodeURIComponent(id) + '&input=' + input, {method: 'POST'});
+                if (!res.ok) throw new Error((await res.text()).trim() || 'Test failed');
+                const result = await res.json();
+                if (result.read_error) {
+                    current.textContent = 'Unreadable (' + result.read_error + ')';
+                    showStatus('Switch sent, but the input could not be read back', true);
+                } else {
+                    current.textContent = inputName(result.actual);
+                    showStatus(result.confirmed ? 'Monitor switched to ' + inputName(result.actual) : 'Monitor reports ' + inputName(result.actual) + ' instead of ' + inputName(result.requested), !result.confirmed);
+                }
+            } catch (e) {
+                showStatus('Test failed: ' + e.message, true);
+            } finally {
+                el.disabled = false;
+            }
+        }
+
+        async function setMonitorPower(el) {
+            el.disabled = true;
+            try {
+                const res = await fetch('/api/monitor-power?monitor=' + encodeURIComponent(el.dataset.monitorId) + '&state=' + el.dataset.state, {method: 'POST'});
+                if (!res.ok) throw new Error((await res.text()).trim() || 'Power change failed');
+                showStatus(el.dataset.state === 'off' ? 'Monitor put to sleep' : 'Monitor woken');
+            } catch (e) {
+                showStatus('Power change failed: ' + e.message, true);
+            } finally {
+                el.disabled = false;
+            }
+        }
+
+        function monitorLabel(m) {
+            if (m.label) return m.label;
+            return (m.name && m.name.length>0) ? (m.name + (m.device_name ? ' ('+m.device_name+')' : '')) : (m.device_name || m.id);
+        }
+
+        async function flashMonitor(el) {
+            el.disabled = true;
+            try {
+                const res = await fetch('/api/flash?monitor=' + encodeURIComponent(el.dataset.monitorId), {method: 'POST'});
+                if (!res.ok) throw new Error((await res.text()).trim() || 'Flash failed');
+            } catch (e) {
+                showStatus('Flash failed: ' + e.message, true);
+            } finally {
+                el.disabled = false;
+            }
+        }
+
+        function monitorSettings(id) {
+            return config.monitors.find(x => x.id === id);
+        }
+
+        function hasDP1Fix(id) {
+            const info = monitorSettings(id);
+            return !!(info && info.input_remap && info.input_remap[17] === 15);
+        }
+
+        function toggleDP1Fix(el) {
+            const id = el.dataset.monitorId;
+            let info = monitorSettings(id);
+            if (!info) {
+                const m = monitors.find(x => x.id === id) || {};
+                info = { id: id, name: m.name || '', serial: m.serial || '' };
+                config.monitors.push(info);
+            }
+            info.input_remap = info.input_remap || {};
+            if (el.checked) {
+                info.input_remap[17] = 15;
+            } else {
+                delete info.input_remap[17];
+            }
+            if (Object.keys(info.input_remap).length === 0) delete info.input_remap;
+        }
+
 
 
         function addProfile() {
@@ -774,59 +1764,198 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             config.profiles[idx].switch_mode = mode;
         }
 
+        function updateProfileSchedule(idx, time) {
+            if (time) {
+                config.profiles[idx].schedule = time;
+            } else {
+                delete config.profiles[idx].schedule;
+            }
+        }
+
+        function updateProfileMonitorSet(idx, enabled) {
+            if (enabled) {
+                config.profiles[idx].monitor_set = monitors.map(m => m.id);
+            } else {
+                delete config.profiles[idx].monitor_set;
+            }
+            renderProfiles();
+        }
+
+        function updateProfileDisplay(el) {
+            const profile = config.profiles[parseInt(el.dataset.profileIdx)];
+            const display = profile.display || {};
+            const value = parseInt(el.value);
+            if (isNaN(value)) {
+                delete display[el.dataset.field];
+            } else {
+                display[el.dataset.field] = value;
+            }
+            if (Object.keys(display).length === 0) {
+                delete profile.display;
+            } else {
+                profile.display = display;
+            }
+        }
+
+
 
+        let scanAbort = null;
 
         async function scanNetwork() {
-            const container = document.getElementById('discovery-list');
-            container.innerHTML = '<p style="color: #94a3b8;">Scanning network... this may take a few seconds.</p>';
-            
+            // A new scan replaces one that is still running
+            if (scanAbort) scanAbort.abort();
+            const abort = new AbortController();
+            scanAbort = abort;
+            discoveredHosts = [];
+            renderDiscovered(true);
+
             try {
-                const res = await fetch('/api/discover');
+                // Hosts arrive one JSON line each, as soon as they answer
+                const res = await fetch('/api/discover?stream=true', { signal: abort.signal });
                 if (!res.ok) throw new Error('Scan failed');
-                const hosts = await res.json();
-                
-                if (!hosts || hosts.length === 0) {
-                    container.innerHTML = '<p style="color: #94a3b8;">No other VKVM instances found on local network.</p>';
-                    return;
+                const reader = res.body.getReader();
+                const decoder = new TextDecoder();
+                let buf = '';
+                for (;;) {
+                    const { done, value } = await reader.read();
+                    if (done) break;
+                    buf += decoder.decode(value, { stream: true });
+                    const lines = buf.split('\n');
+                    buf = lines.pop();
+                    for (const line of lines) {
+                        if (line.trim()) discoveredHosts.push(JSON.parse(line));
+                    }
+                    renderDiscovered(true);
                 }
 
-                container.innerHTML = hosts.map(h => ` + "`" + `
-                    <div style="display: flex; justify-content: space-between; align-items: center; padding: 0.75rem; background: rgba(255,255,255,0.03); border-radius: 8px; margin-bottom: 0.5rem;">
-                        <div>
-                            <strong>${h.ip}</strong> <span style="color: #94a3b8;">(Port: ${h.port})</span>
-                            <div style="font-size: 0.8rem; color: #a5b4fc;">Profile: ${h.current_profile || 'None'}</div>
-                        </div>
-                        <div style="display: flex; gap: 0.5rem; align-items: center;">
-                            <button class="btn btn-small btn-secondary" onclick="addRemoteFromDiscovery('${h.ip}:${h.port}')">Add as Remote</button>
-                            <button class="btn btn-small" style="background: #4f46e5;" onclick="syncConfigTo('${h.ip}:${h.port}')">☁️ Sync Config</button>
-                        </div>
+                // Discovery may have updated registered machines' addresses
+                const cfgRes = await fetch('/api/config');
+                if (cfgRes.ok) config.machines = (await cfgRes.json()).machines || [];
+                renderDiscovered(false);
+            } catch (e) {
+                if (e.name === 'AbortError') return;
+                document.getElementById('discovery-list').innerHTML = '<p style="color: #f87171;">Scan failed: ' + e.message + '</p>';
+            } finally {
+                if (scanAbort === abort) scanAbort = null;
+            }
+        }
+
+        function renderDiscovered(scanning) {
+            const container = document.getElementById('discovery-list');
+            if (discoveredHosts.length === 0) {
+                container.innerHTML = scanning
+                    ? '<p style="color: #94a3b8;">Scanning network... this may take a few seconds.</p>'
+                    : '<p style="color: #94a3b8;">No other VKVM instances found on local network.</p>';
+                return;
+            }
+
+            container.innerHTML = discoveredHosts.map((h, idx) => ` + "`" + `
+                <div style="display: flex; justify-content: space-between; align-items: center; padding: 0.75rem; background: rgba(255,255,255,0.03); border-radius: 8px; margin-bottom: 0.5rem;">
+                    <div>
+                        <strong>${h.machine || h.id || h.ip}</strong> <span style="color: #94a3b8;">(${h.ip}:${h.port}${h.role ? ', ' + h.role : ''})</span>${h.degraded ? ' <span style="color: #fbbf24;" title="/health reports a problem">⚠️ degraded</span>' : ''}
+                        <div style="font-size: 0.8rem; color: #a5b4fc;">Profile: ${h.token_required ? '🔒 token required' : (h.current_profile || 'None')}${h.version ? ' · v' + h.version : ''}${h.platform ? ' · ' + h.platform : ''}${h.incompatible ? ' <span style="color: #f87171;">· incompatible version (protocol ' + h.protocol + ')</span>' : ''}</div>
                     </div>
-                ` + "`" + `).join('');
+                    <div style="display: flex; gap: 0.5rem; align-items: center;">
+                        <button class="btn btn-small btn-secondary" data-host-idx="${idx}" onclick="nameMachine(this)">🏷️ ${h.machine ? 'Rename' : 'Name'}</button>
+                        <button class="btn btn-small btn-secondary" onclick="addRemoteFromDiscovery('${h.ip}:${h.port}')">Add as Remote</button>
+                        ${h.role !== 'agent' && !h.incompatible ? ` + "`" + `<button class="btn btn-small btn-secondary" onclick="adoptMachine('${h.ip}:${h.port}', ${idx})">🤝 Adopt as agent</button>` + "`" + ` : ''}
+                        ${!h.incompatible ? ` + "`" + `<button class="btn btn-small" style="background: #4f46e5;" onclick="syncConfigTo('${h.ip}:${h.port}', ${idx})">☁️ Sync Config</button>` + "`" + ` : ''}
+                    </div>
+                </div>
+                <div id="sync-result-${idx}" style="display: none; font-size: 0.8rem; margin: -0.25rem 0 0.5rem 0.75rem;"></div>
+            ` + "`" + `).join('') + (scanning ? '<p style="color: #94a3b8;">Scanning...</p>' : '');
+        }
+
+        async function adoptMachine(addr, idx) {
+            const names = (config.profiles || []).map(p => p.name);
+            const profile = prompt('Make ' + addr + ' an agent of this machine.\n\nProfile that shows ' + addr + ' (optional): ' + names.join(', '), '');
+            if (profile === null) {
+                return;
+            }
+            if (profile && !names.includes(profile)) {
+                showStatus('Unknown profile: ' + profile, true);
+                return;
+            }
+
+            showStatus('Waiting for ' + addr + ' to accept (a prompt is shown on that machine)...');
+            const resultEl = document.getElementById('sync-result-' + idx);
+            try {
+                const res = await fetch('/api/adopt?addr=' + encodeURIComponent(addr) + '&profile=' + encodeURIComponent(profile), { method: 'POST' });
+                if (!res.ok) {
+                    const text = await res.text();
+                    showStatus('Adoption failed: ' + text, true);
+                    return;
+                }
+                const result = await res.json();
+                resultEl.style.display = 'block';
+                resultEl.style.color = '#34d399';
+                resultEl.textContent = '✅ Adopted as agent' + (result.restart ? ', VKVM is restarting there' : ', restart VKVM there to connect');
+                showStatus(addr + ' is now an agent of this machine');
             } catch (e) {
-                container.innerHTML = '<p style="color: #f87171;">Scan failed: ' + e.message + '</p>';
+                showStatus('Adoption failed: ' + e.message, true);
             }
         }
 
-        async function syncConfigTo(addr) {
+        async function syncConfigTo(addr, idx) {
             if (!confirm('This will OVERWRITE all settings on ' + addr + ' with your local settings. Continue?')) {
                 return;
             }
             
-            showStatus('Syncing config to ' + addr + '...');
+            showStatus('Syncing config to ' + addr + ' (it may ask for confirmation there)...');
+            const resultEl = document.getElementById('sync-result-' + idx);
             try {
                 // We pass empty token for now, or might need to ask user if target has token
                 const res = await fetch('/api/sync-to?addr=' + encodeURIComponent(addr));
-                if (res.ok) {
-                    showStatus('Config successfully synced to ' + addr);
-                } else {
+                const isJSON = (res.headers.get('Content-Type') || '').includes('application/json');
+                if (!isJSON) {
                     const text = await res.text();
                     showStatus('Sync failed: ' + text, true);
+                    return;
+                }
+
+                const result = await res.json();
+                const version = result.version ? ' (vkvm ' + result.version + ')' : '';
+                resultEl.style.display = 'block';
+                if (result.status === 'rejected') {
+                    resultEl.style.color = '#f87171';
+                    resultEl.innerHTML = '❌ Rejected' + version + ':<br>' + result.errors.map(e => '· ' + e).join('<br>');
+                    showStatus('Sync rejected by ' + addr, true);
+                } else {
+                    const changed = (result.applied || []).map(s => s === 'general' && result.general ? 'general (' + result.general.join(', ') + ')' : s);
+                    resultEl.style.color = '#34d399';
+                    resultEl.textContent = '✅ Synced' + version + ': ' + (changed.length ? 'changed ' + changed.join(', ') : (result.version ? 'already up to date' : 'applied'));
+                    showStatus('Config successfully synced to ' + addr);
                 }
             } catch (e) {
                 showStatus('Sync failed: ' + e.message, true);
             }
         }
 
+        let discoveredHosts = [];
+
+        function nameMachine(el) {
+            const h = discoveredHosts[parseInt(el.dataset.hostIdx)];
+            const addr = h.ip + ':' + h.port;
+            const name = prompt('Name for ' + addr + ':', h.machine || h.id || '');
+            if (!name) return;
+            if (!config.machines) config.machines = [];
+            const existing = config.machines.find(m => m.address === addr || m.name.toLowerCase() === name.toLowerCase());
+            const machine = existing || {};
+            machine.name = name;
+            machine.address = addr;
+            if (h.id) machine.id = h.id;
+            if (h.role) machine.role = h.role;
+            if (h.token_required) {
+                const token = prompt('API token of ' + addr + ' (needed to sync or adopt it):', machine.token || '');
+                if (token !== null) machine.token = token;
+            }
+            if (!existing) config.machines.push(machine);
+            h.machine = name;
+            el.textContent = '🏷️ Rename';
+            el.closest('div').parentElement.querySelector('strong').textContent = name;
+            showStatus('Named ' + addr + ' "' + name + '". Click Save Settings to keep it.');
+        }
+
         function addRemoteFromDiscovery(addr) {
             if (config.profiles.length === 0) {
                 showStatus('Add a profile first', true);
@@ -866,11 +1995,21 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             }
         }
 
-        async function switchToProfile(name) {
+        async function switchToProfile(name, videoOnly) {
             try {
-                const res = await fetch('/api/switch?profile=' + encodeURIComponent(name));
-                if (!res.ok) throw new Error('Switch failed');
-                showStatus('Switched to ' + name);
+                showStatus('Switching to ' + name + '...');
+                const res = await fetch('/api/switch?profile=' + encodeURIComponent(name) + (videoOnly ? '&video_only=true' : ''));
+                if (res.status === 424) {
+                    // An agent showing this profile is unreachable
+                    const msg = (await res.text()).trim();
+                    if (confirm(msg + '\n\nSwitch the monitors anyway (video only)?')) {
+                        return switchToProfile(name, true);
+                    }
+                    showStatus('Switch cancelled: ' + msg, true);
+                    return;
+                }
+                if (!res.ok) throw new Error((await res.text()).trim() || 'Switch failed');
+                showStatus(res.status === 202 ? 'Switch to ' + name + ' queued until the cooldown ends' : 'Switched to ' + name);
             } catch (e) {
                 showStatus('Switch failed: ' + e.message, true);
             }
@@ -896,8 +2035,9 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                     headers: {'Content-Type': 'application/json'},
                     body: JSON.stringify(config)
                 });
-                if (!res.ok) throw new Error('Save failed');
+                if (!res.ok) throw new Error((await res.text()).trim() || 'Save failed');
                 showStatus('Settings saved!');
+                checkRestart();
             } catch (e) {
                 showStatus('Save failed: ' + e.message, true);
             }
@@ -911,7 +2051,9 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             currentHotkey = '';
             document.getElementById('recorded-display').textContent = 'Press Keys...';
             document.getElementById('hotkey-recorder').style.display = 'flex';
+            heldModifierCodes.clear();
             window.addEventListener('keydown', captureKeyEvent);
+            window.addEventListener('keyup', releaseModifierEvent);
             window.addEventListener('mousedown', captureMouseEvent);
             window.addEventListener('auxclick', captureMouseEvent);
             window.addEventListener('contextmenu', preventContext);
@@ -930,6 +2072,12 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
                 } else if (recordingIdx === 'sleep') {
                     config.general.sleep_hotkey = currentHotkey;
                     renderGeneral();
+                } else if (recordingIdx === 'brightness-up') {
+                    config.general.brightness_up_hotkey = currentHotkey;
+                    renderGeneral();
+                } else if (recordingIdx === 'brightness-down') {
+                    config.general.brightness_down_hotkey = currentHotkey;
+                    renderGeneral();
                 } else if (recordingIdx !== -1) {
                     config.profiles[recordingIdx].hotkey = currentHotkey;
                     renderProfiles();
@@ -940,6 +2088,7 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
 
         function stopRecordingListeners() {
             window.removeEventListener('keydown', captureKeyEvent);
+            window.removeEventListener('keyup', releaseModifierEvent);
             window.removeEventListener('mousedown', captureMouseEvent);
             window.removeEventListener('auxclick', captureMouseEvent);
             window.removeEventListener('contextmenu', preventContext);
@@ -951,17 +2100,19 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             e.preventDefault();
             e.stopPropagation();
 
+            const key = e.key;
+            if (key === 'Control' || key === 'Alt' || key === 'Shift' || key === 'Meta') {
+                heldModifierCodes.add(e.code);
+            }
+
             const keys = [];
-            if (e.ctrlKey) keys.push('Ctrl');
-            if (e.altKey) keys.push('Alt');
-            if (e.shiftKey) keys.push('Shift');
-            if (e.metaKey) keys.push('Cmd');
+            if (e.ctrlKey) keys.push(modifierLabel('Ctrl', 'Control'));
+            if (e.altKey) keys.push(modifierLabel('Alt', 'Alt'));
+            if (e.shiftKey) keys.push(modifierLabel('Shift', 'Shift'));
+            if (e.metaKey) keys.push(modifierLabel('Cmd', 'Meta'));
 
-            const key = e.key;
             if (key !== 'Control' && key !== 'Alt' && key !== 'Shift' && key !== 'Meta') {
-                let keyLabel = key.toUpperCase();
-                if (key === ' ') keyLabel = 'Space';
-                keys.push(keyLabel);
+                keys.push(keyLabelFromEvent(e));
                 
                 currentHotkey = keys.join('+');
                 document.getElementById('recorded-display').textContent = currentHotkey;
@@ -970,6 +2121,49 @@ var tmpl = template.Must(template.New("index").Parse(`<!DOCTYPE html>
             }
         }
 
+        // Physical modifier keys currently held (e.g. 'ControlRight'), used when
+        // the recorder is asked to distinguish left and right modifiers
+        const heldModifierCodes = new Set();
+
+        function releaseModifierEvent(e) {
+            heldModifierCodes.delete(e.code);
+        }
+
+        // modifierLabel returns "Ctrl", or "LCtrl"/"RCtrl" when sides are being recorded
+        // and exactly one side is held
+        function modifierLabel(label, codePrefix) {
+            if (!document.getElementById('record-sides').checked) return label;
+            const left = heldModifierCodes.has(codePrefix + 'Left');
+            const right = heldModifierCodes.has(codePrefix + 'Right');
+            if (left && !right) return 'L' + label;
+            if (right && !left) return 'R' + label;
+            return label;
+        }
+
+        // Names understood by the hotkey engine for keys whose e.key is ambiguous
+        // (numpad digits vs. top-row digits) or punctuation that can't be typed in a combo
+        const codeLabels = {
+            NumpadAdd: 'NumAdd', NumpadSubtract: 'NumSub', NumpadMultiply: 'NumMul',
+            NumpadDivide: 'NumDiv', NumpadDecimal: 'NumDec', NumpadEnter: 'NumEnter', NumpadEqual: 'NumEquals',
+            NumLock: 'NumLock',
+            Semicolon: 'Semicolon', Equal: 'Equals', Comma: 'Comma', Minus: 'Minus', Period: 'Period',
+            Slash: 'Slash', Backquote: 'Backtick', BracketLeft: 'LBracket', BracketRight: 'RBracket',
+            Backslash: 'Backslash', Quote: 'Quote',
+            AudioVolumeMute: 'VolumeMute', AudioVolumeDown: 'VolumeDown', AudioVolumeUp: 'VolumeUp',
+            MediaTrackNext: 'MediaNext', MediaTrackPrevious: 'MediaPrev', MediaStop: 'MediaStop', MediaPlayPause: 'MediaPlay'
+        };
+
+        function keyLabelFromEvent(e) {
+            const code = e.code || '';
+            if (codeLabels[code]) return codeLabels[code];
+            if (/^Numpad[0-9]$/.test(code)) return 'Num' + code.slice(6);
+            // Use the physical key for letters and digits so Shift+1 records "1", not "!"
+            if (/^Key[A-Z]$/.test(code)) return code.slice(3);
+            if (/^Digit[0-9]$/.test(code)) return code.slice(5);
+            if (e.key === ' ') return 'Space';
+            return e.key.toUpperCase();
+        }
+
         function captureMouseEvent(e) {
             if (e.button === 0) return; // Ignore Left click
             e.preventDefault();
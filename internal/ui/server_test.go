@@ -0,0 +1,154 @@
+package ui
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"vkvm/internal/config"
+	"vkvm/internal/switcher"
+	"vkvm/internal/testutil"
+)
+
+// newTestServer returns a settings UI server with a fresh config directory
+func newTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	cfgMgr := testutil.NewConfig(t)
+	testutil.FakeDDCTool(t)
+	sw, err := switcher.New(cfgMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(cfgMgr, sw)
+	// Some endpoints only answer requests addressed to the listener
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop() })
+	return s, hostHandler(s.listener.Addr().String(), s.routes())
+}
+
+// hostHandler sends requests through h as if addressed to host
+func hostHandler(host string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = host
+		h.ServeHTTP(w, r)
+	})
+}
+
+func TestIndex(t *testing.T) {
+	_, h := newTestServer(t)
+
+	rec := testutil.Do(h, "GET", "/", nil, nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("GET /: %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "<title>VKVM Settings</title>") {
+		t.Error("settings page not rendered")
+	}
+}
+
+func TestConfig(t *testing.T) {
+	s, h := newTestServer(t)
+
+	rec := testutil.Do(h, "GET", "/api/config", nil, nil)
+	var cfg config.Config
+	if err := json.NewDecoder(rec.Body).Decode(&cfg); err != nil {
+		t.Fatalf("GET /api/config: %v", err)
+	}
+	if cfg.General.APIPort != 18080 || len(cfg.Profiles) != 2 {
+		t.Errorf("unexpected default config %+v", cfg.General)
+	}
+
+	cfg.General.Role = "bogus"
+	data, _ := json.Marshal(cfg)
+	if rec := testutil.Do(h, "POST", "/api/config", data, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid config: %d, want 422", rec.Code)
+	}
+
+	cfg.General.Role = "host"
+	cfg.General.SwitchCooldownMs = 250
+	data, _ = json.Marshal(cfg)
+	rec = testutil.Do(h, "POST", "/api/config", data, nil)
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp["status"] != "ok" {
+		t.Fatalf("saving config: %d %q", rec.Code, rec.Body.String())
+	}
+	if got := s.configMgr.Get().General.SwitchCooldownMs; got != 250 {
+		t.Errorf("switch cooldown %d after save, want 250", got)
+	}
+
+	if rec := testutil.Do(h, "POST", "/api/config", []byte("{"), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed config: %d, want 400", rec.Code)
+	}
+	if rec := testutil.Do(h, "PUT", "/api/config", nil, nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT /api/config: %d, want 405", rec.Code)
+	}
+}
+
+func TestListsAreArrays(t *testing.T) {
+	_, h := newTestServer(t)
+
+	// The page iterates these; null would break it
+	for _, path := range []string{"/api/known-agents", "/api/pending-pairings", "/api/monitors"} {
+		rec := testutil.Do(h, "GET", path, nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: %d", path, rec.Code)
+			continue
+		}
+		var list []json.RawMessage
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || list == nil {
+			t.Errorf("GET %s: %q is not an array", path, rec.Body.String())
+		}
+	}
+}
+
+func TestPendingPairingsHostCheck(t *testing.T) {
+	s, h := newTestServer(t)
+	if _, err := s.configMgr.StartPairing("laptop", "192.0.2.10"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := testutil.Do(h, "GET", "/api/pending-pairings", nil, nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"laptop"`) {
+		t.Errorf("GET /api/pending-pairings: %d %q", rec.Code, rec.Body.String())
+	}
+	// A DNS-rebinding page reaches the listener under its own name
+	for _, host := range []string{"attacker.example:" + strings.Split(s.listener.Addr().String(), ":")[1], "localhost", ""} {
+		rec := testutil.Do(hostHandler(host, s.routes()), "GET", "/api/pending-pairings", nil, nil)
+		if rec.Code != http.StatusForbidden || strings.Contains(rec.Body.String(), "laptop") {
+			t.Errorf("Host %q: %d %q", host, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRestartWithoutService(t *testing.T) {
+	_, h := newTestServer(t)
+
+	rec := testutil.Do(h, "GET", "/api/restart", nil, nil)
+	var status struct {
+		Supported bool     `json:"supported"`
+		Pending   []string `json:"pending"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil || status.Supported || status.Pending == nil {
+		t.Errorf("restart status %q: %v", rec.Body.String(), err)
+	}
+	if rec := testutil.Do(h, "POST", "/api/restart", nil, nil); rec.Code != http.StatusNotImplemented {
+		t.Errorf("POST /api/restart: %d, want 501", rec.Code)
+	}
+}
+
+func TestPostOnlyRoutes(t *testing.T) {
+	_, h := newTestServer(t)
+
+	for _, path := range []string{"/api/wake-agent", "/api/forget-agent", "/api/send-file", "/api/revoke-agent", "/api/pair-start", "/api/pair-finish"} {
+		if rec := testutil.Do(h, "GET", path, nil, nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: %d, want 405", path, rec.Code)
+		}
+	}
+	if rec := testutil.Do(h, "POST", "/api/switch", nil, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("switch without profile: %d, want 400", rec.Code)
+	}
+}